@@ -0,0 +1,133 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+)
+
+// runTestConnection connects with the resolved settings and reports TLS and latency details
+func runTestConnection(args []string) int {
+	fs := flag.NewFlagSet("tip test-connection", flag.ExitOnError)
+	cf := registerConnFlags(fs)
+	pings := fs.Int("n", 3, "Number of round trips used to measure latency")
+	if err := cf.parse(fs, args); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	info, err := cf.connInfo()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	start := time.Now()
+	db, err := openDatabase(info)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Connection to %s:%s as %s failed: %v\n", info.Host, info.Port, info.User, err)
+		return 1
+	}
+	defer db.Close()
+	connectTime := time.Since(start)
+
+	var version, cipher, tlsVersion string
+	if err := db.QueryRow("SELECT VERSION()").Scan(&version); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to query server version: %v\n", err)
+		return 1
+	}
+	var name string
+	db.QueryRow("SHOW STATUS LIKE 'Ssl_cipher'").Scan(&name, &cipher)
+	db.QueryRow("SHOW STATUS LIKE 'Ssl_version'").Scan(&name, &tlsVersion)
+
+	var total, min, max time.Duration
+	for i := 0; i < *pings; i++ {
+		t := time.Now()
+		if err := db.Ping(); err != nil {
+			fmt.Fprintf(os.Stderr, "Ping failed: %v\n", err)
+			return 1
+		}
+		d := time.Since(t)
+		total += d
+		if i == 0 || d < min {
+			min = d
+		}
+		if d > max {
+			max = d
+		}
+	}
+
+	fmt.Printf("Server:       %s:%s\n", info.Host, info.Port)
+	fmt.Printf("User:         %s\n", info.User)
+	fmt.Printf("Version:      %s\n", version)
+	if cipher != "" {
+		fmt.Printf("TLS:          %s (%s)\n", tlsVersion, cipher)
+	} else {
+		fmt.Printf("TLS:          disabled\n")
+	}
+	fmt.Printf("Connect time: %s\n", connectTime)
+	if *pings > 0 {
+		fmt.Printf("Latency:      min %s / avg %s / max %s over %d round trips\n", min, total/time.Duration(*pings), max, *pings)
+	}
+	fmt.Println("OK")
+	return 0
+}
+
+// runPasswd changes the password of the connecting user interactively
+func runPasswd(args []string) int {
+	fs := flag.NewFlagSet("tip passwd", flag.ExitOnError)
+	cf := registerConnFlags(fs)
+	if err := cf.parse(fs, args); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	info, err := cf.connInfo()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if info.Password == "" {
+		// The current password is needed to authenticate before changing it
+		info.Password, err = readPassword("Current password: ")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+	}
+
+	db, err := openDatabase(info)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer db.Close()
+
+	newPass, err := readPassword("New password: ")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if newPass == "" {
+		fmt.Fprintln(os.Stderr, "Password must not be empty")
+		return 1
+	}
+	confirm, err := readPassword("Retype new password: ")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if newPass != confirm {
+		fmt.Fprintln(os.Stderr, "Passwords do not match")
+		return 1
+	}
+
+	// ALTER USER can't be prepared, so the password is passed as an escaped literal
+	if _, err := db.Exec("ALTER USER CURRENT_USER() IDENTIFIED BY " + quoteSQLString(newPass)); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to change password: %v\n", err)
+		return 1
+	}
+	fmt.Printf("Password changed for %s. Remember to update your configuration file.\n", info.User)
+	return 0
+}
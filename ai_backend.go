@@ -0,0 +1,287 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// chatMessage is a single message of a chat conversation
+type chatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// aiBackend sends a conversation to a language model and returns its answer.
+// When onDelta is not nil the answer is streamed, onDelta is called with each
+// chunk of text as it arrives.
+type aiBackend interface {
+	Chat(messages []chatMessage, onDelta func(string)) (string, error)
+}
+
+// newAIBackend creates the backend configured in the [ai] section of the config file:
+//
+//	[ai]
+//	provider = "openai"   # tidbai (default), openai, azure or ollama
+//	base_url = "https://api.openai.com/v1"
+//	api_key = "sk-..."
+//	model = "gpt-4o-mini"
+//	stream = true         # render answers as they arrive
+func newAIBackend(config AIConfig) (aiBackend, error) {
+	switch strings.ToLower(config.Provider) {
+	case "", "tidbai":
+		return &tidbAIBackend{url: withDefault(config.BaseURL, "https://tidb.ai/api/v1/chats")}, nil
+	case "openai":
+		apiKey := withDefault(config.APIKey, os.Getenv("OPENAI_API_KEY"))
+		return &openAIBackend{
+			url:    strings.TrimSuffix(withDefault(config.BaseURL, "https://api.openai.com/v1"), "/") + "/chat/completions",
+			model:  withDefault(config.Model, "gpt-4o-mini"),
+			header: http.Header{"Authorization": {"Bearer " + apiKey}},
+		}, nil
+	case "azure":
+		// base_url points to the deployment, e.g. https://<resource>.openai.azure.com/openai/deployments/<deployment>
+		if config.BaseURL == "" {
+			return nil, fmt.Errorf("ai.base_url is required for the azure provider")
+		}
+		return &openAIBackend{
+			url: strings.TrimSuffix(config.BaseURL, "/") + "/chat/completions?api-version=" +
+				withDefault(config.APIVersion, "2024-02-01"),
+			model:  config.Model,
+			header: http.Header{"api-key": {withDefault(config.APIKey, os.Getenv("AZURE_OPENAI_API_KEY"))}},
+		}, nil
+	case "ollama":
+		if config.Model == "" {
+			return nil, fmt.Errorf("ai.model is required for the ollama provider")
+		}
+		return &ollamaBackend{
+			url:   strings.TrimSuffix(withDefault(config.BaseURL, "http://localhost:11434"), "/") + "/api/chat",
+			model: config.Model,
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown ai provider: %s", config.Provider)
+	}
+}
+
+func withDefault(val string, def string) string {
+	if val == "" {
+		return def
+	}
+	return val
+}
+
+// postRequest sends body as JSON and returns the response, which must be closed by the caller
+func postRequest(url string, header http.Header, body interface{}) (*http.Response, error) {
+	requestBody, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling request body: %v", err)
+	}
+
+	req, err := http.NewRequest("POST", url, bytes.NewBuffer(requestBody))
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %v", err)
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	client := &http.Client{}
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		debugLog.Debug("HTTP request failed", "url", url, "duration", time.Since(start), "error", err)
+		return nil, fmt.Errorf("error sending request: %v", err)
+	}
+	// Headers carry the API keys and are left out
+	debugLog.Debug("HTTP request", "url", url, "status", resp.Status, "duration", time.Since(start), "bytes_sent", len(requestBody))
+	if resp.StatusCode/100 != 2 {
+		respBody, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		return nil, fmt.Errorf("request failed with status %s: %s", resp.Status, strings.TrimSpace(string(respBody)))
+	}
+	return resp, nil
+}
+
+// postJSON sends body as JSON and decodes the JSON response into out
+func postJSON(url string, header http.Header, body interface{}, out interface{}) error {
+	resp, err := postRequest(url, header, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("error reading response body: %v", err)
+	}
+	if err := json.Unmarshal(respBody, out); err != nil {
+		return fmt.Errorf("error unmarshaling response: %v", err)
+	}
+	return nil
+}
+
+// postStream sends body as JSON and calls onLine for each line of the streamed
+// response, onLine returns the text carried by the line, if any
+func postStream(url string, header http.Header, body interface{}, onLine func(line string) (string, error), onDelta func(string)) (string, error) {
+	resp, err := postRequest(url, header, body)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var answer strings.Builder
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+		delta, err := onLine(line)
+		if err != nil {
+			return answer.String(), err
+		}
+		if delta != "" {
+			answer.WriteString(delta)
+			onDelta(delta)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return answer.String(), fmt.Errorf("error reading response stream: %v", err)
+	}
+	return answer.String(), nil
+}
+
+// tidbAIBackend talks to the tidb.ai chat API
+type tidbAIBackend struct {
+	url string
+}
+
+func (b *tidbAIBackend) Chat(messages []chatMessage, onDelta func(string)) (string, error) {
+	if onDelta != nil {
+		// The stream is in the AI SDK data stream format, text parts are lines like 0:"text"
+		return postStream(b.url, nil, map[string]interface{}{
+			"messages":    messages,
+			"chat_engine": "default",
+			"stream":      true,
+		}, func(line string) (string, error) {
+			if !strings.HasPrefix(line, "0:") {
+				return "", nil
+			}
+			var text string
+			if err := json.Unmarshal([]byte(line[2:]), &text); err != nil {
+				return "", fmt.Errorf("error unmarshaling stream chunk: %v", err)
+			}
+			return text, nil
+		}, onDelta)
+	}
+
+	var askResp AskResponse
+	err := postJSON(b.url, nil, map[string]interface{}{
+		"messages":    messages,
+		"chat_engine": "default",
+		"stream":      false,
+	}, &askResp)
+	if err != nil {
+		return "", err
+	}
+	return askResp.Content, nil
+}
+
+// openAIBackend talks to OpenAI compatible chat completion APIs, including Azure OpenAI
+type openAIBackend struct {
+	url    string
+	model  string
+	header http.Header
+}
+
+func (b *openAIBackend) Chat(messages []chatMessage, onDelta func(string)) (string, error) {
+	if onDelta != nil {
+		// Server-sent events, each "data:" line holds a chunk and the stream ends with [DONE]
+		return postStream(b.url, b.header, map[string]interface{}{
+			"model":    b.model,
+			"messages": messages,
+			"stream":   true,
+		}, func(line string) (string, error) {
+			data, ok := strings.CutPrefix(line, "data:")
+			data = strings.TrimSpace(data)
+			if !ok || data == "[DONE]" {
+				return "", nil
+			}
+			var chunk struct {
+				Choices []struct {
+					Delta chatMessage `json:"delta"`
+				} `json:"choices"`
+			}
+			if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+				return "", fmt.Errorf("error unmarshaling stream chunk: %v", err)
+			}
+			if len(chunk.Choices) == 0 {
+				return "", nil
+			}
+			return chunk.Choices[0].Delta.Content, nil
+		}, onDelta)
+	}
+
+	var resp struct {
+		Choices []struct {
+			Message chatMessage `json:"message"`
+		} `json:"choices"`
+	}
+	err := postJSON(b.url, b.header, map[string]interface{}{
+		"model":    b.model,
+		"messages": messages,
+		"stream":   false,
+	}, &resp)
+	if err != nil {
+		return "", err
+	}
+	if len(resp.Choices) == 0 {
+		return "", fmt.Errorf("empty response from %s", b.url)
+	}
+	return resp.Choices[0].Message.Content, nil
+}
+
+// ollamaBackend talks to a local Ollama server
+type ollamaBackend struct {
+	url   string
+	model string
+}
+
+func (b *ollamaBackend) Chat(messages []chatMessage, onDelta func(string)) (string, error) {
+	if onDelta != nil {
+		// One JSON object per line, the last one has "done": true
+		return postStream(b.url, nil, map[string]interface{}{
+			"model":    b.model,
+			"messages": messages,
+			"stream":   true,
+		}, func(line string) (string, error) {
+			var chunk struct {
+				Message chatMessage `json:"message"`
+			}
+			if err := json.Unmarshal([]byte(line), &chunk); err != nil {
+				return "", fmt.Errorf("error unmarshaling stream chunk: %v", err)
+			}
+			return chunk.Message.Content, nil
+		}, onDelta)
+	}
+
+	var resp struct {
+		Message chatMessage `json:"message"`
+	}
+	err := postJSON(b.url, nil, map[string]interface{}{
+		"model":    b.model,
+		"messages": messages,
+		"stream":   false,
+	}, &resp)
+	if err != nil {
+		return "", err
+	}
+	return resp.Message.Content, nil
+}
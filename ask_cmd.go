@@ -1,13 +1,11 @@
 package main
 
 import (
-	"bytes"
-	"encoding/json"
 	"fmt"
 	"io"
-	"net/http"
 	"regexp"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/manifoldco/promptui"
@@ -32,57 +30,40 @@ type AskResponse struct {
 	Content string `json:"content"`
 }
 
-// askQuestion sends a question to the TiDB AI API and returns the response
-func askQuestion(question string) (string, error) {
-	url := "https://tidb.ai/api/v1/chats"
-
-	// Construct request body
-	requestBody, err := json.Marshal(map[string]interface{}{
-		"messages": []map[string]interface{}{
-			{
-				"role":    "user",
-				"content": question,
-			},
-		},
-		"chat_engine": "default",
-		"stream":      false,
-	})
-	if err != nil {
-		return "", fmt.Errorf("error marshaling request body: %v", err)
-	}
+// maxAskHistory bounds the number of messages of the conversation sent with each question
+const maxAskHistory = 20
 
-	// Create HTTP request
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(requestBody))
-	if err != nil {
-		return "", fmt.Errorf("error creating request: %v", err)
-	}
-
-	// Set request headers
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("accept", "application/json")
+var (
+	// askHistory holds the previous questions and answers of the session
+	askHistory []chatMessage
+	// askExecutedSQL holds the statements run since the last answer, they are
+	// sent along with the next question
+	askExecutedSQL []string
+)
 
-	// Send request
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return "", fmt.Errorf("error sending request: %v", err)
+// recordExecutedSQL remembers a statement run in the REPL while a conversation is going on
+func recordExecutedSQL(query string) {
+	if len(askHistory) > 0 {
+		askExecutedSQL = append(askExecutedSQL, query)
 	}
-	defer resp.Body.Close()
+}
 
-	// Read response body
-	body, err := io.ReadAll(resp.Body)
+// askQuestion sends a question to the configured AI backend and returns the response.
+// Unless streaming is disabled with ai.stream = false, onDelta receives the answer as it arrives.
+func askQuestion(question string, onDelta func(string)) (string, error) {
+	config, err := loadConfig(globalConfigFile)
 	if err != nil {
-		return "", fmt.Errorf("error reading response body: %v", err)
+		return "", fmt.Errorf("failed to read ai config: %v", err)
 	}
-
-	// Parse response
-	var askResp AskResponse
-	err = json.Unmarshal(body, &askResp)
+	backend, err := newAIBackend(config.AI)
 	if err != nil {
-		return "", fmt.Errorf("error unmarshaling response: %v", err)
+		return "", err
 	}
-
-	return askResp.Content, nil
+	if config.AI.Stream != nil && !*config.AI.Stream {
+		onDelta = nil
+	}
+	messages := append(append([]chatMessage{}, askHistory...), chatMessage{Role: "user", Content: question})
+	return backend.Chat(messages, onDelta)
 }
 
 func (cmd AskCmd) Handle(args []string, resultWriter io.Writer) error {
@@ -95,19 +76,51 @@ func (cmd AskCmd) Handle(args []string, resultWriter io.Writer) error {
 	done := make(chan bool)
 	go loadingAnimation(resultWriter, done)
 
-	refinedQuestion := refineQuestion(question)
-	answer, err := askQuestion(refinedQuestion)
+	// Stop the loading animation and clear its line, either when the first
+	// chunk of a streamed answer arrives or once the whole answer is there
+	var stopOnce sync.Once
+	stopAnimation := func() {
+		stopOnce.Do(func() {
+			done <- true
+			resultWriter.Write([]byte("\r\033[K"))
+		})
+	}
+
+	// Let follow-up questions refer to what was run after the previous answer
+	if len(askExecutedSQL) > 0 {
+		question = fmt.Sprintf("Statements I executed since your last answer:\n%s\n\n%s", strings.Join(askExecutedSQL, "\n"), question)
+	}
 
-	// Stop the loading animation
-	done <- true
+	streamed := false
+	refinedQuestion := refineQuestion(question)
+	answer, err := askQuestion(refinedQuestion, func(delta string) {
+		stopAnimation()
+		streamed = true
+		resultWriter.Write([]byte(delta))
+	})
+	stopAnimation()
 
 	if err != nil {
+		if streamed {
+			resultWriter.Write([]byte("\n"))
+		}
 		return fmt.Errorf("error asking question: %v", err)
 	}
 
-	// Clear the loading animation line
-	resultWriter.Write([]byte("\r\033[K"))
-	resultWriter.Write([]byte(answer + "\n"))
+	if streamed {
+		resultWriter.Write([]byte("\n"))
+	} else {
+		resultWriter.Write([]byte(answer + "\n"))
+	}
+
+	// The schema context is only sent with the latest question to keep the history small
+	askHistory = append(askHistory,
+		chatMessage{Role: "user", Content: question},
+		chatMessage{Role: "assistant", Content: answer})
+	if len(askHistory) > maxAskHistory {
+		askHistory = askHistory[len(askHistory)-maxAskHistory:]
+	}
+	askExecutedSQL = nil
 
 	// Extract SQL statements
 	sqlStatements := extractSQLStatements(answer)
@@ -148,6 +161,11 @@ func extractSQLStatements(text string) []string {
 }
 
 func loadingAnimation(w io.Writer, done chan bool) {
+	spinnerAnimation(w, "Thinking", done)
+}
+
+// spinnerAnimation shows label followed by a spinning bar until done receives
+func spinnerAnimation(w io.Writer, label string, done chan bool) {
 	frames := []string{"-", "\\", "|", "/"}
 	i := 0
 	for {
@@ -155,7 +173,7 @@ func loadingAnimation(w io.Writer, done chan bool) {
 		case <-done:
 			return
 		default:
-			w.Write([]byte(fmt.Sprintf("\rThinking %s", frames[i])))
+			w.Write([]byte(fmt.Sprintf("\r%s %s", label, frames[i])))
 			time.Sleep(100 * time.Millisecond)
 			i = (i + 1) % len(frames)
 		}
@@ -203,3 +221,24 @@ func refineQuestion(question string) string {
 	refinedQuestion := fmt.Sprintf(template, context, question)
 	return refinedQuestion
 }
+
+type AskClearCmd struct{}
+
+func (cmd AskClearCmd) Name() string {
+	return ".ask-clear"
+}
+
+func (cmd AskClearCmd) Description() string {
+	return "Forget the .ask conversation and start a new one"
+}
+
+func (cmd AskClearCmd) Usage() string {
+	return ".ask-clear"
+}
+
+func (cmd AskClearCmd) Handle(args []string, resultWriter io.Writer) error {
+	askHistory = nil
+	askExecutedSQL = nil
+	resultWriter.Write([]byte("Conversation cleared.\n"))
+	return nil
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/pingcap/tidb/pkg/parser/ast"
+)
+
+// maxCapturedPlans is the number of captured plans kept, the oldest are dropped
+const maxCapturedPlans = 500
+
+// autoExplain captures the plan of every SELECT run in the REPL, see .autoexplain
+var autoExplain bool
+
+// capturedPlan is the plan of a statement of the history as it was when the statement ran
+type capturedPlan struct {
+	SQL  string          `json:"sql"` // as in the history
+	At   time.Time       `json:"at"`
+	Plan []capturedOpRow `json:"plan"`
+}
+
+// capturedOpRow is a planRow as kept in the plans file
+type capturedOpRow struct {
+	ID      string `json:"id"`
+	EstRows string `json:"est_rows"`
+	Task    string `json:"task"`
+	Access  string `json:"access,omitempty"`
+	Info    string `json:"info,omitempty"`
+}
+
+// planHistoryPath returns the file the captured plans are kept in, next to the history
+func planHistoryPath() string {
+	return filepath.Join(os.Getenv("HOME"), ".tip/history_plans")
+}
+
+// isSelect reports whether query is a single SELECT, the statements whose plans are captured
+func isSelect(query string) bool {
+	stmtNodes, _, err := p.Parse(query, "", "")
+	if err != nil || len(stmtNodes) != 1 {
+		return false
+	}
+	switch stmtNodes[0].(type) {
+	case *ast.SelectStmt, *ast.SetOprStmt:
+		return true
+	}
+	return false
+}
+
+// capturePlan explains query, which just ran, and keeps the plan for the history entry
+// entry. It runs in the session, so the plan is the one its variables lead to. Failing
+// to explain is not worth interrupting the user, the plan is then missing.
+func capturePlan(entry, query string) {
+	if !autoExplain || !isSelect(query) {
+		return
+	}
+	db := GetDB()
+	if db == nil {
+		return
+	}
+	plan, err := explainPlan(db, query, false)
+	if err != nil {
+		return
+	}
+	captured := capturedPlan{SQL: entry, At: time.Now()}
+	for _, op := range plan {
+		captured.Plan = append(captured.Plan, capturedOpRow{ID: op.id, EstRows: op.estRows, Task: op.task, Access: op.access, Info: op.info})
+	}
+	data, err := json.Marshal(captured)
+	if err != nil {
+		return
+	}
+
+	plans, _ := loadCapturedPlans()
+	os.MkdirAll(filepath.Dir(planHistoryPath()), 0755)
+	if len(plans) >= maxCapturedPlans {
+		// Rewrite the file without the oldest plans
+		var buf bytes.Buffer
+		for _, old := range plans[len(plans)-maxCapturedPlans+1:] {
+			line, _ := json.Marshal(old)
+			buf.Write(append(line, '\n'))
+		}
+		buf.Write(append(data, '\n'))
+		os.WriteFile(planHistoryPath(), buf.Bytes(), 0600)
+		return
+	}
+	f, err := os.OpenFile(planHistoryPath(), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+	f.Write(append(data, '\n'))
+}
+
+// loadCapturedPlans reads the captured plans, oldest first
+func loadCapturedPlans() ([]capturedPlan, error) {
+	f, err := os.Open(planHistoryPath())
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var plans []capturedPlan
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var cp capturedPlan
+		if json.Unmarshal(scanner.Bytes(), &cp) == nil {
+			plans = append(plans, cp)
+		}
+	}
+	return plans, scanner.Err()
+}
+
+// printCapturedPlan prints the latest plan captured for a history entry
+func printCapturedPlan(w io.Writer, entry string) error {
+	plans, err := loadCapturedPlans()
+	if err != nil {
+		return fmt.Errorf("failed to read captured plans: %v", err)
+	}
+	for i := len(plans) - 1; i >= 0; i-- {
+		if plans[i].SQL != entry {
+			continue
+		}
+		plan := make([]planRow, len(plans[i].Plan))
+		for j, op := range plans[i].Plan {
+			plan[j] = planRow{id: op.ID, estRows: op.EstRows, task: op.Task, access: op.Access, info: op.Info}
+		}
+		fmt.Fprintf(w, "Plan captured %s\n", plans[i].At.Format("2006-01-02 15:04:05"))
+		renderPlan(w, plan, false)
+		return nil
+	}
+	if !autoExplain {
+		return fmt.Errorf("no plan was captured for this entry, turn on .autoexplain to capture plans")
+	}
+	return fmt.Errorf("no plan was captured for this entry, only SELECT plans are")
+}
+
+type AutoExplainCmd struct{}
+
+func (cmd AutoExplainCmd) Name() string {
+	return ".autoexplain"
+}
+
+func (cmd AutoExplainCmd) Description() string {
+	return "Capture the plan of every SELECT run, shown later with .history explain <n>"
+}
+
+func (cmd AutoExplainCmd) Usage() string {
+	return ".autoexplain [on|off]"
+}
+
+func (cmd AutoExplainCmd) Handle(args []string, resultWriter io.Writer) error {
+	if len(args) == 0 {
+		state := "off"
+		if autoExplain {
+			state = "on"
+		}
+		resultWriter.Write([]byte(fmt.Sprintf("Auto explain is %s\n", state)))
+		return nil
+	}
+	if len(args) != 1 {
+		return fmt.Errorf("usage: %s", cmd.Usage())
+	}
+	switch args[0] {
+	case "on":
+		autoExplain = true
+	case "off":
+		autoExplain = false
+	default:
+		return fmt.Errorf("usage: %s", cmd.Usage())
+	}
+	return nil
+}
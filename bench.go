@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// benchWorker is the outcome of the statements run by one connection of a benchmark
+type benchWorker struct {
+	latencies []time.Duration
+	errors    map[string]int
+}
+
+func runBench(args []string) int {
+	if len(args) > 0 && args[0] == "compare" {
+		if len(args) != 3 {
+			fmt.Fprintln(os.Stderr, "usage: tip bench compare <runA> <runB>")
+			return 2
+		}
+		if err := compareBenchRuns(os.Stdout, args[1], args[2]); err != nil {
+			log.Println(err)
+			return 1
+		}
+		return 0
+	}
+	fs := flag.NewFlagSet("tip bench", flag.ExitOnError)
+	cf := registerConnFlags(fs)
+	execSQL := fs.String("e", "", "Statement to run repeatedly")
+	var params stringList
+	fs.Var(&params, "param", "Value bound to the next ? placeholder of the statement (repeatable)")
+	concurrency := fs.Int("concurrency", 8, "Number of connections running the statement at the same time")
+	duration := fs.Duration("duration", 10*time.Second, "How long to run the benchmark")
+	warmup := fs.Duration("warmup", 0, "Time to run the statement before measuring, e.g. to fill caches")
+	reportInterval := fs.Duration("report-interval", 0, "Print the throughput and latency every interval while running, e.g. 5s")
+	save := fs.String("save", "", "Save the results as JSON under this name in ~/.tip/bench, or to this .json file, for tip bench compare")
+	if err := cf.parse(fs, args); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	if *execSQL == "" || *concurrency < 1 || *duration <= 0 {
+		fmt.Fprintln(os.Stderr, "usage: tip bench [flags] -e <sql> [-concurrency 16] [-duration 30s]")
+		return 2
+	}
+	if stmts, err := splitStatements(*execSQL); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to parse SQL: %v\n", err)
+		return 2
+	} else if len(stmts) != 1 {
+		fmt.Fprintln(os.Stderr, "-e must be a single statement")
+		return 2
+	}
+	query := *execSQL
+	queryArgs := make([]interface{}, len(params))
+	for i, param := range params {
+		queryArgs[i] = param
+	}
+
+	info, err := cf.connInfo()
+	if err != nil {
+		log.Println(err)
+		return 1
+	}
+	db, err := openDatabase(info)
+	if err != nil {
+		log.Println(err)
+		return 1
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(*concurrency)
+	db.SetMaxIdleConns(*concurrency)
+
+	// Every worker holds its connection for the whole run, as a connection pool of the application would
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	conns := make([]*sql.Conn, *concurrency)
+	for i := range conns {
+		if conns[i], err = db.Conn(ctx); err != nil {
+			log.Println("Failed to open connections:", err)
+			return 1
+		}
+		defer conns[i].Close()
+	}
+	if err := runDrained(ctx, conns[0], query, queryArgs...); err != nil {
+		log.Printf("The statement fails: %v", err)
+		return 1
+	}
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+
+	log.Printf("Running for %s on %d connections", *duration, *concurrency)
+	var measuring atomic.Bool
+	var done, failed atomic.Int64
+	workers := make([]*benchWorker, *concurrency)
+	var wg sync.WaitGroup
+	for i, conn := range conns {
+		w := &benchWorker{errors: map[string]int{}}
+		workers[i] = w
+		wg.Add(1)
+		go func(conn *sql.Conn) {
+			defer wg.Done()
+			for ctx.Err() == nil {
+				start := time.Now()
+				err := runDrained(ctx, conn, query, queryArgs...)
+				if !measuring.Load() || errors.Is(err, context.Canceled) {
+					continue
+				}
+				if err != nil {
+					w.errors[err.Error()]++
+					failed.Add(1)
+					continue
+				}
+				w.latencies = append(w.latencies, time.Since(start))
+				done.Add(1)
+			}
+		}(conn)
+	}
+
+	if *warmup > 0 {
+		select {
+		case <-time.After(*warmup):
+		case <-interrupt:
+			cancel()
+		}
+	}
+	measuring.Store(true)
+	startTime := time.Now()
+	var ticks <-chan time.Time
+	if *reportInterval > 0 {
+		ticker := time.NewTicker(*reportInterval)
+		defer ticker.Stop()
+		ticks = ticker.C
+	}
+	timer := time.NewTimer(*duration)
+	var lastDone, lastFailed int64
+	lastTick := startTime
+wait:
+	for ctx.Err() == nil {
+		select {
+		case <-timer.C:
+			break wait
+		case <-interrupt:
+			log.Println("Interrupted")
+			break wait
+		case now := <-ticks:
+			d, f := done.Load(), failed.Load()
+			fmt.Fprintf(os.Stderr, "[%3.0fs] qps %.1f, errors %d\n", now.Sub(startTime).Seconds(),
+				float64(d-lastDone)/now.Sub(lastTick).Seconds(), f-lastFailed)
+			lastDone, lastFailed, lastTick = d, f, now
+		}
+	}
+	measuring.Store(false)
+	elapsed := time.Since(startTime)
+	cancel()
+	wg.Wait()
+
+	run := summarizeBench(workers, elapsed, *concurrency)
+	run.Statement, run.StartedAt = query, startTime
+	printBenchRun(os.Stdout, run)
+	if *save != "" {
+		path, err := saveBenchRun(*save, run)
+		if err != nil {
+			log.Printf("Failed to save the results: %v", err)
+			return 1
+		}
+		fmt.Printf("Saved to %s\n", path)
+	}
+	if failed.Load() > 0 {
+		return 1
+	}
+	return 0
+}
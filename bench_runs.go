@@ -0,0 +1,229 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// benchRun is the outcome of a benchmark as saved by tip bench -save
+type benchRun struct {
+	Name        string         `json:"name"`
+	Statement   string         `json:"statement"`
+	StartedAt   time.Time      `json:"started_at"`
+	Concurrency int            `json:"concurrency"`
+	Duration    float64        `json:"duration_seconds"`
+	Succeeded   int            `json:"succeeded"`
+	Failed      int            `json:"failed"`
+	QPS         float64        `json:"qps"`
+	Latency     benchLatency   `json:"latency_us"`
+	Errors      map[string]int `json:"errors,omitempty"`
+}
+
+// benchLatency holds the latencies of a run in microseconds
+type benchLatency struct {
+	Avg int64 `json:"avg"`
+	P50 int64 `json:"p50"`
+	P95 int64 `json:"p95"`
+	P99 int64 `json:"p99"`
+	Max int64 `json:"max"`
+}
+
+// summarizeBench gathers the statements run by the workers of a benchmark
+func summarizeBench(workers []*benchWorker, elapsed time.Duration, concurrency int) benchRun {
+	run := benchRun{Concurrency: concurrency, Duration: elapsed.Seconds(), Errors: map[string]int{}}
+	var latencies []time.Duration
+	for _, worker := range workers {
+		latencies = append(latencies, worker.latencies...)
+		for msg, n := range worker.errors {
+			run.Errors[msg] += n
+			run.Failed += n
+		}
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	run.Succeeded = len(latencies)
+	run.QPS = float64(len(latencies)) / elapsed.Seconds()
+	if len(latencies) > 0 {
+		var total time.Duration
+		for _, d := range latencies {
+			total += d
+		}
+		run.Latency = benchLatency{
+			Avg: (total / time.Duration(len(latencies))).Microseconds(),
+			P50: percentile(latencies, 0.5).Microseconds(),
+			P95: percentile(latencies, 0.95).Microseconds(),
+			P99: percentile(latencies, 0.99).Microseconds(),
+			Max: latencies[len(latencies)-1].Microseconds(),
+		}
+	}
+	return run
+}
+
+// benchRunPath returns the file of a saved run: a name is kept in ~/.tip/bench, a path
+// or a .json file name is used as is
+func benchRunPath(name string) string {
+	if strings.ContainsRune(name, os.PathSeparator) || strings.HasSuffix(name, ".json") {
+		return name
+	}
+	return filepath.Join(benchRunsDir(), name+".json")
+}
+
+func benchRunsDir() string {
+	return filepath.Join(os.Getenv("HOME"), ".tip/bench")
+}
+
+func saveBenchRun(name string, run benchRun) (string, error) {
+	run.Name = strings.TrimSuffix(filepath.Base(name), ".json")
+	data, err := json.MarshalIndent(run, "", "  ")
+	if err != nil {
+		return "", err
+	}
+	path := benchRunPath(name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", err
+	}
+	return path, os.WriteFile(path, append(data, '\n'), 0644)
+}
+
+func loadBenchRun(name string) (benchRun, error) {
+	var run benchRun
+	data, err := os.ReadFile(benchRunPath(name))
+	if err != nil {
+		return run, err
+	}
+	if err := json.Unmarshal(data, &run); err != nil {
+		return run, fmt.Errorf("%s is not a saved benchmark run: %v", benchRunPath(name), err)
+	}
+	return run, nil
+}
+
+// printBenchRun prints the throughput, latency percentiles and errors of a run
+func printBenchRun(w io.Writer, run benchRun) {
+	fmt.Fprintf(w, "Duration:     %s on %d connections\n", time.Duration(run.Duration*float64(time.Second)).Round(time.Millisecond), run.Concurrency)
+	fmt.Fprintf(w, "Statements:   %d succeeded, %d failed\n", run.Succeeded, run.Failed)
+	fmt.Fprintf(w, "QPS:          %.1f\n", run.QPS)
+	if run.Succeeded > 0 {
+		l := run.Latency
+		fmt.Fprintf(w, "Latency:      avg %s, p50 %s, p95 %s, p99 %s, max %s\n",
+			microseconds(l.Avg), microseconds(l.P50), microseconds(l.P95), microseconds(l.P99), microseconds(l.Max))
+	}
+	printBenchErrors(w, run.Errors)
+}
+
+// printBenchErrors prints the error messages met, the most frequent first
+func printBenchErrors(w io.Writer, errors map[string]int) {
+	if len(errors) == 0 {
+		return
+	}
+	msgs := make([]string, 0, len(errors))
+	for msg := range errors {
+		msgs = append(msgs, msg)
+	}
+	sort.Slice(msgs, func(i, j int) bool { return errors[msgs[i]] > errors[msgs[j]] })
+	fmt.Fprintln(w, "Errors:")
+	for _, msg := range msgs {
+		fmt.Fprintf(w, "  %6d  %s\n", errors[msg], msg)
+	}
+}
+
+func microseconds(us int64) time.Duration {
+	return time.Duration(us) * time.Microsecond
+}
+
+// printBenchComparison prints the throughput and latencies of run b next to those of
+// run a, with the change from a to b
+func printBenchComparison(w io.Writer, a, b benchRun) {
+	if a.Statement != b.Statement {
+		fmt.Fprintf(w, "Warning: the runs are of different statements\n  %s: %s\n  %s: %s\n", a.Name, a.Statement, b.Name, b.Statement)
+	}
+	if a.Concurrency != b.Concurrency {
+		fmt.Fprintf(w, "Warning: the runs used %d and %d connections\n", a.Concurrency, b.Concurrency)
+	}
+	fmt.Fprintf(w, "%-12s %14s %14s  %s\n", "", a.Name, b.Name, "change")
+	row := func(metric string, va, vb float64, text func(float64) string, lowerIsBetter bool) {
+		change := "n/a"
+		if va != 0 {
+			delta := (vb - va) / va * 100
+			change = fmt.Sprintf("%+.1f%%", delta)
+			if math.Abs(delta) >= 5 {
+				if (delta < 0) == lowerIsBetter {
+					change += " better"
+				} else {
+					change += " worse"
+				}
+			}
+		}
+		fmt.Fprintf(w, "%-12s %14s %14s  %s\n", metric, text(va), text(vb), change)
+	}
+	qps := func(v float64) string { return fmt.Sprintf("%.1f", v) }
+	latency := func(v float64) string { return microseconds(int64(v)).String() }
+	count := func(v float64) string { return fmt.Sprintf("%d", int64(v)) }
+	row("QPS", a.QPS, b.QPS, qps, false)
+	row("avg", float64(a.Latency.Avg), float64(b.Latency.Avg), latency, true)
+	row("p50", float64(a.Latency.P50), float64(b.Latency.P50), latency, true)
+	row("p95", float64(a.Latency.P95), float64(b.Latency.P95), latency, true)
+	row("p99", float64(a.Latency.P99), float64(b.Latency.P99), latency, true)
+	row("max", float64(a.Latency.Max), float64(b.Latency.Max), latency, true)
+	row("errors", float64(a.Failed), float64(b.Failed), count, true)
+}
+
+// compareBenchRuns loads two saved runs and prints their comparison
+func compareBenchRuns(w io.Writer, nameA, nameB string) error {
+	a, err := loadBenchRun(nameA)
+	if err != nil {
+		return err
+	}
+	b, err := loadBenchRun(nameB)
+	if err != nil {
+		return err
+	}
+	printBenchComparison(w, a, b)
+	return nil
+}
+
+type BenchCmd struct{}
+
+func (cmd BenchCmd) Name() string {
+	return ".bench"
+}
+
+func (cmd BenchCmd) Description() string {
+	return "List the benchmark runs saved by tip bench -save, or compare the throughput and latencies of two of them"
+}
+
+func (cmd BenchCmd) Usage() string {
+	return ".bench list | .bench compare <runA> <runB>"
+}
+
+func (cmd BenchCmd) Handle(args []string, resultWriter io.Writer) error {
+	switch {
+	case len(args) == 3 && args[0] == "compare":
+		return compareBenchRuns(resultWriter, args[1], args[2])
+	case len(args) == 1 && args[0] == "list":
+		files, err := filepath.Glob(filepath.Join(benchRunsDir(), "*.json"))
+		if err != nil {
+			return err
+		}
+		if len(files) == 0 {
+			fmt.Fprintln(resultWriter, "No saved runs, save one with tip bench -save <name>")
+			return nil
+		}
+		for _, file := range files {
+			run, err := loadBenchRun(file)
+			if err != nil {
+				continue
+			}
+			fmt.Fprintf(resultWriter, "%-20s %s  %8.1f qps  p99 %-10s %s\n", run.Name, run.StartedAt.Format("2006-01-02 15:04"),
+				run.QPS, microseconds(run.Latency.P99), run.Statement)
+		}
+		return nil
+	default:
+		return fmt.Errorf("usage: %s", cmd.Usage())
+	}
+}
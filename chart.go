@@ -0,0 +1,209 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/mattn/go-runewidth"
+	"golang.org/x/term"
+)
+
+// Kinds of chart drawn by .chart, the chart output format draws bar charts
+const (
+	chartBar  = "bar"
+	chartLine = "line"
+)
+
+// lineChartRows is the height of line charts in rows of the terminal
+const lineChartRows = 12
+
+// barEighths are the blocks ending a bar, for lengths in eighths of a character
+var barEighths = []string{"", "▏", "▎", "▍", "▌", "▋", "▊", "▉"}
+
+// brailleDots are the bits of the dots of a braille character, by row and column
+var brailleDots = [4][2]rune{{0x01, 0x08}, {0x02, 0x10}, {0x04, 0x20}, {0x40, 0x80}}
+
+// chartWidth returns the width charts are drawn at: that of the terminal, or 80 columns
+func chartWidth() int {
+	if width, _, err := term.GetSize(int(os.Stdout.Fd())); err == nil && width > 0 {
+		return width
+	}
+	return 80
+}
+
+// chartSeries reads the labels and values of a result that can be charted: labels in
+// its first column and numbers in its second. NULL values are charted as 0.
+func chartSeries(output []RowResult) ([]string, []float64, error) {
+	if len(output) == 0 {
+		return nil, nil, fmt.Errorf("no rows to chart")
+	}
+	if n := len(output[0].colNames); n != 2 {
+		return nil, nil, fmt.Errorf("a chart needs two columns, labels and numbers, the result has %d", n)
+	}
+	labels := make([]string, len(output))
+	values := make([]float64, len(output))
+	for i, row := range output {
+		labels[i] = row.displayValue(0)
+		if row.colValues[1] == nil {
+			continue
+		}
+		v, err := strconv.ParseFloat(formatValue(row.colValues[1]), 64)
+		if err != nil || math.IsInf(v, 0) || math.IsNaN(v) {
+			return nil, nil, fmt.Errorf("a chart needs numbers in the second column, %s is not one", formatValue(row.colValues[1]))
+		}
+		values[i] = v
+	}
+	return labels, values, nil
+}
+
+// renderChart draws a two-column result as a chart of the given kind
+func renderChart(w io.Writer, output []RowResult, kind string) error {
+	labels, values, err := chartSeries(output)
+	if err != nil {
+		return err
+	}
+	if kind == chartLine {
+		renderLineChart(w, labels, values, chartWidth())
+	} else {
+		renderBarChart(w, labels, values, chartWidth())
+	}
+	return nil
+}
+
+// renderBarChart draws a horizontal bar per row, the longest for the largest magnitude
+func renderBarChart(w io.Writer, labels []string, values []float64, width int) {
+	labelWidth, valueWidth := 0, 0
+	texts := make([]string, len(values))
+	var top float64
+	for i, v := range values {
+		texts[i] = strconv.FormatFloat(v, 'f', -1, 64)
+		labelWidth = max(labelWidth, runewidth.StringWidth(labels[i]))
+		valueWidth = max(valueWidth, len(texts[i]))
+		top = max(top, math.Abs(v))
+	}
+	labelWidth = min(labelWidth, width/3)
+	barWidth := max(width-labelWidth-valueWidth-3, 10)
+	for i, v := range values {
+		eighths := 0
+		if top > 0 {
+			eighths = int(math.Round(math.Abs(v) / top * float64(barWidth*8)))
+		}
+		bar := strings.Repeat("█", eighths/8) + barEighths[eighths%8]
+		label := runewidth.FillRight(runewidth.Truncate(labels[i], labelWidth, "…"), labelWidth)
+		fmt.Fprintf(w, "%s │%s %s\n", label, bar, texts[i])
+	}
+}
+
+// renderLineChart draws the values as a line from left to right in braille dots, each
+// character holding 2x4 of them, with the range of the values on the left and the
+// first and last labels below
+func renderLineChart(w io.Writer, labels []string, values []float64, width int) {
+	low, high := values[0], values[0]
+	for _, v := range values {
+		low, high = min(low, v), max(high, v)
+	}
+	lowText, highText := strconv.FormatFloat(low, 'g', 6, 64), strconv.FormatFloat(high, 'g', 6, 64)
+	axisWidth := max(len(lowText), len(highText))
+	cols := max(width-axisWidth-2, 10)
+	dotsX, dotsY := cols*2, lineChartRows*4
+
+	canvas := make([][]rune, lineChartRows)
+	for i := range canvas {
+		canvas[i] = []rune(strings.Repeat("⠀", cols))
+	}
+	point := func(i int) (int, int) {
+		x := 0
+		if len(values) > 1 {
+			x = i * (dotsX - 1) / (len(values) - 1)
+		}
+		y := dotsY / 2
+		if high > low {
+			y = int(math.Round((high - values[i]) / (high - low) * float64(dotsY-1)))
+		}
+		return x, y
+	}
+	plot := func(x, y int) {
+		canvas[y/4][x/2] |= brailleDots[y%4][x%2]
+	}
+	x0, y0 := point(0)
+	plot(x0, y0)
+	for i := 1; i < len(values); i++ {
+		x1, y1 := point(i)
+		steps := max(abs(x1-x0), abs(y1-y0))
+		for s := 1; s <= steps; s++ {
+			plot(x0+(x1-x0)*s/steps, y0+(y1-y0)*s/steps)
+		}
+		x0, y0 = x1, y1
+	}
+
+	for i, row := range canvas {
+		axis := ""
+		switch i {
+		case 0:
+			axis = highText
+		case len(canvas) - 1:
+			axis = lowText
+		}
+		tick := "│"
+		if axis != "" {
+			tick = "┤"
+		}
+		fmt.Fprintf(w, "%*s %s%s\n", axisWidth, axis, tick, string(row))
+	}
+	fmt.Fprintf(w, "%*s └%s\n", axisWidth, "", strings.Repeat("─", cols))
+	first := runewidth.Truncate(labels[0], cols/2, "…")
+	last := runewidth.Truncate(labels[len(labels)-1], cols/2, "…")
+	gap := ""
+	if len(labels) > 1 {
+		gap = strings.Repeat(" ", max(cols-runewidth.StringWidth(first)-runewidth.StringWidth(last), 1)) + last
+	}
+	fmt.Fprintf(w, "%*s  %s%s\n", axisWidth, "", first, gap)
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+type ChartCmd struct{}
+
+func (cmd ChartCmd) Name() string {
+	return ".chart"
+}
+
+func (cmd ChartCmd) Description() string {
+	return "Draw the last result set, or the result of a query, with labels and numbers as a bar or line chart"
+}
+
+func (cmd ChartCmd) Usage() string {
+	return ".chart bar|line [<sql>]"
+}
+
+func (cmd ChartCmd) Handle(args []string, resultWriter io.Writer) error {
+	if len(args) == 0 || (args[0] != chartBar && args[0] != chartLine) {
+		return fmt.Errorf("usage: %s", cmd.Usage())
+	}
+	rows := lastResult
+	if len(args) > 1 {
+		db, err := requireDB()
+		if err != nil {
+			return err
+		}
+		query := strings.TrimSuffix(strings.TrimSpace(strings.Join(args[1:], " ")), ";")
+		if isQ, err := isQuery(query); err != nil {
+			return fmt.Errorf("failed to parse SQL: %w", err)
+		} else if !isQ {
+			return fmt.Errorf("only the result of a query can be charted")
+		}
+		if _, rows, _, _, err = executeSQL(db, query, nil); err != nil {
+			return err
+		}
+	}
+	return renderChart(resultWriter, rows, args[0])
+}
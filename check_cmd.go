@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pingcap/tidb/pkg/parser/ast"
+)
+
+// parseErrorPosRe matches the position the TiDB parser reports syntax errors at
+var parseErrorPosRe = regexp.MustCompile(`^line (\d+) column (\d+) (.*)`)
+
+type CheckCmd struct{}
+
+func (cmd CheckCmd) Name() string {
+	return ".check"
+}
+
+func (cmd CheckCmd) Description() string {
+	return "Check the syntax of SQL statements or a SQL file without running them, with --explain also against the server"
+}
+
+func (cmd CheckCmd) Usage() string {
+	return ".check [--explain] <sql|file.sql>"
+}
+
+func (cmd CheckCmd) Handle(args []string, resultWriter io.Writer) error {
+	explain := len(args) > 0 && args[0] == "--explain"
+	if explain {
+		args = args[1:]
+	}
+	if len(args) == 0 {
+		return fmt.Errorf("usage: %s", cmd.Usage())
+	}
+	text := strings.Join(args, " ")
+	if info, err := os.Stat(text); err == nil && !info.IsDir() {
+		data, err := os.ReadFile(text)
+		if err != nil {
+			return err
+		}
+		text = string(data)
+	}
+	var db *sql.DB
+	if explain {
+		var err error
+		if db, err = requireDB(); err != nil {
+			return err
+		}
+	}
+
+	checked, problems, err := checkSQLScript(text, db)
+	if err != nil {
+		return err
+	}
+	for _, pb := range problems {
+		fmt.Fprintf(resultWriter, "line %d, column %d: %s\n", pb.line, pb.column, pb.message)
+	}
+	fmt.Fprintf(resultWriter, "Checked %d statements, %d errors\n", checked, len(problems))
+	return nil
+}
+
+// checkProblem is an error found in a statement, at a position of the checked text
+type checkProblem struct {
+	line    int
+	column  int
+	message string
+}
+
+// checkSQLScript parses every statement of text and, when db is not nil, runs EXPLAIN
+// for the queries and DML statements, which doesn't execute them. Statements using
+// tables the script creates itself can't be explained before it ran and are only parsed,
+// as are DDL statements. It returns the number of statements and the errors found.
+func checkSQLScript(text string, db *sql.DB) (int, []checkProblem, error) {
+	var conn *sql.Conn
+	if db != nil {
+		// USE statements of the script apply to the following ones, so they share a connection
+		var err error
+		if conn, err = db.Conn(context.Background()); err != nil {
+			return 0, nil, err
+		}
+		defer conn.Close()
+	}
+
+	var problems []checkProblem
+	created := map[string]bool{}
+	stmts := splitSQLText(text)
+	for _, stmt := range stmts {
+		nodes, _, err := p.Parse(stmt.text, "", "")
+		if err != nil {
+			problems = append(problems, syntaxProblem(stmt, err))
+			continue
+		}
+		if conn == nil {
+			continue
+		}
+		for _, node := range nodes {
+			switch n := node.(type) {
+			case *ast.CreateTableStmt:
+				created[strings.ToLower(n.Table.Name.O)] = true
+			case *ast.UseStmt:
+				if _, err := conn.ExecContext(context.Background(), "USE "+quoteIdentifier(n.DBName)); err != nil {
+					problems = append(problems, checkProblem{stmt.line, 1, err.Error()})
+				}
+			case *ast.SelectStmt, *ast.SetOprStmt, *ast.InsertStmt, *ast.UpdateStmt, *ast.DeleteStmt:
+				if usesTables(node, created) {
+					continue
+				}
+				rows, err := conn.QueryContext(context.Background(), "EXPLAIN "+node.Text())
+				if err != nil {
+					problems = append(problems, checkProblem{stmt.line, 1, err.Error()})
+					continue
+				}
+				rows.Close()
+			}
+		}
+	}
+	return len(stmts), problems, nil
+}
+
+// syntaxProblem locates the syntax error of a statement in the checked text. The parser
+// counts lines from the start of the statement.
+func syntaxProblem(stmt sqlText, err error) checkProblem {
+	m := parseErrorPosRe.FindStringSubmatch(err.Error())
+	if m == nil {
+		return checkProblem{stmt.line, 1, err.Error()}
+	}
+	line, _ := strconv.Atoi(m[1])
+	column, _ := strconv.Atoi(m[2])
+	return checkProblem{stmt.line + line - 1, column, "syntax error " + strings.TrimSpace(m[3])}
+}
+
+// usesTables reports whether a statement reads or writes one of tables
+func usesTables(node ast.Node, tables map[string]bool) bool {
+	if len(tables) == 0 {
+		return false
+	}
+	collector := &tableSourceCollector{tables: map[string]string{}}
+	node.Accept(collector)
+	for _, name := range collector.tables {
+		if tables[strings.ToLower(nameOf(name))] {
+			return true
+		}
+	}
+	return false
+}
+
+// runCheck checks the statements of a SQL file, or of the standard input when file is
+// empty or "-", and prints the errors as file:line:column. It returns the exit status,
+// 1 when errors were found.
+func runCheck(file string, explain bool) int {
+	name := file
+	if file == "" || file == "-" {
+		name = "<stdin>"
+	}
+	data, err := readSQLFile(file)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	var db *sql.DB
+	if explain {
+		if err := ensureConnected(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		db = GetDB()
+	}
+
+	checked, problems, err := checkSQLScript(string(data), db)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	for _, pb := range problems {
+		fmt.Printf("%s:%d:%d: %s\n", name, pb.line, pb.column, pb.message)
+	}
+	fmt.Fprintf(os.Stderr, "Checked %d statements, %d errors\n", checked, len(problems))
+	if len(problems) > 0 {
+		return 1
+	}
+	return 0
+}
+
+// readSQLFile reads a file of statements, the standard input when file is empty or "-"
+func readSQLFile(file string) ([]byte, error) {
+	if file == "" || file == "-" {
+		return io.ReadAll(os.Stdin)
+	}
+	return os.ReadFile(file)
+}
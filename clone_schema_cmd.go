@@ -0,0 +1,220 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// autoIDOptionRe matches the table options carrying the next auto id, which an empty copy starts over
+var autoIDOptionRe = regexp.MustCompile(`\s+(AUTO_INCREMENT|AUTO_RANDOM_BASE)=\d+`)
+
+type CloneSchemaCmd struct{}
+
+func (cmd CloneSchemaCmd) Name() string {
+	return ".clone-schema"
+}
+
+func (cmd CloneSchemaCmd) Description() string {
+	return "Create the tables, views and sequences of a database, without their rows, in another database"
+}
+
+func (cmd CloneSchemaCmd) Usage() string {
+	return ".clone-schema <src_db> <dst_db> [--profile name]"
+}
+
+// schemaObject is a table, view or sequence and the statement creating it
+type schemaObject struct {
+	name   string
+	kind   string
+	create string
+}
+
+func (cmd CloneSchemaCmd) Handle(args []string, resultWriter io.Writer) error {
+	if len(args) < 2 || strings.HasPrefix(args[0], "-") || strings.HasPrefix(args[1], "-") {
+		return fmt.Errorf("usage: %s", cmd.Usage())
+	}
+	src, dst := strings.Trim(args[0], "`"), strings.Trim(args[1], "`")
+
+	fs := flag.NewFlagSet(cmd.Name(), flag.ContinueOnError)
+	fs.SetOutput(resultWriter)
+	profile := fs.String("profile", "", "Create the copy on the cluster of this profile")
+	if err := fs.Parse(args[2:]); err != nil {
+		return err
+	}
+
+	db, err := requireDB()
+	if err != nil {
+		return err
+	}
+	objects, err := loadSchemaObjects(db, src)
+	if err != nil {
+		return fmt.Errorf("failed to read the schema of %s: %v", src, err)
+	}
+	if len(objects) == 0 {
+		return fmt.Errorf("database %s has no tables, views or sequences", src)
+	}
+
+	target := db
+	if *profile != "" {
+		config, err := loadProfile(globalConfigFile, *profile)
+		if err != nil {
+			return err
+		}
+		if target, err = openDatabase(connInfoFromConfig(config)); err != nil {
+			return err
+		}
+		defer target.Close()
+	} else if strings.EqualFold(src, dst) {
+		return fmt.Errorf("source and destination are the same database")
+	}
+
+	// USE and the statements that follow must run on the same connection
+	ctx := context.Background()
+	conn, err := target.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	// Without a profile the connection is the session's, which is left in its current database
+	var curDB sql.NullString
+	if err := conn.QueryRowContext(ctx, "SELECT DATABASE()").Scan(&curDB); err != nil {
+		return err
+	}
+	if curDB.Valid {
+		defer conn.ExecContext(ctx, "USE "+quoteName(curDB.String))
+	}
+
+	var existing int
+	if err := conn.QueryRowContext(ctx, "SELECT COUNT(*) FROM INFORMATION_SCHEMA.TABLES WHERE TABLE_SCHEMA = ?", dst).Scan(&existing); err != nil {
+		return err
+	}
+	if existing > 0 {
+		return fmt.Errorf("database %s already has %d tables or views, clone into a new or empty database", dst, existing)
+	}
+	for _, stmt := range []string{
+		"CREATE DATABASE IF NOT EXISTS " + quoteName(dst),
+		"USE " + quoteName(dst),
+		// Tables referencing each other are created in name order
+		"SET @@SESSION.foreign_key_checks = 0",
+	} {
+		if _, err := conn.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+	defer conn.ExecContext(ctx, "SET @@SESSION.foreign_key_checks = DEFAULT")
+
+	// Views are created last and retried while some succeed, as they may select from each other
+	counts := map[string]int{}
+	var pending []schemaObject
+	for _, obj := range objects {
+		if obj.kind == "VIEW" {
+			pending = append(pending, obj)
+			continue
+		}
+		if _, err := conn.ExecContext(ctx, obj.create); err != nil {
+			return fmt.Errorf("failed to create %s %s: %v", strings.ToLower(obj.kind), obj.name, err)
+		}
+		counts[obj.kind]++
+	}
+	for len(pending) > 0 {
+		var failed []schemaObject
+		var lastErr error
+		for _, obj := range pending {
+			if _, err := conn.ExecContext(ctx, obj.create); err != nil {
+				failed = append(failed, obj)
+				lastErr = fmt.Errorf("failed to create view %s: %v", obj.name, err)
+				continue
+			}
+			counts[obj.kind]++
+		}
+		if len(failed) == len(pending) {
+			return lastErr
+		}
+		pending = failed
+	}
+
+	msg := fmt.Sprintf("Cloned %d tables, %d views and %d sequences of %s into %s", counts["BASE TABLE"], counts["VIEW"], counts["SEQUENCE"], src, dst)
+	if *profile != "" {
+		msg += " on profile " + *profile
+	}
+	resultWriter.Write([]byte(msg + ".\n"))
+	return nil
+}
+
+// loadSchemaObjects returns the sequences, tables and views of a database with the
+// statements creating them in any database. References to the database itself are
+// left unqualified, and the auto id counters start over.
+func loadSchemaObjects(db *sql.DB, dbName string) ([]schemaObject, error) {
+	rows, err := db.Query("SELECT TABLE_NAME, TABLE_TYPE FROM INFORMATION_SCHEMA.TABLES WHERE TABLE_SCHEMA = ? "+
+		"ORDER BY TABLE_TYPE = 'VIEW', TABLE_TYPE <> 'SEQUENCE', TABLE_NAME", dbName)
+	if err != nil {
+		return nil, err
+	}
+	var objects []schemaObject
+	for rows.Next() {
+		var obj schemaObject
+		if err := rows.Scan(&obj.name, &obj.kind); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		objects = append(objects, obj)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	qualifier := quoteName(dbName) + "."
+	for i, obj := range objects {
+		show := "SHOW CREATE TABLE "
+		switch obj.kind {
+		case "VIEW":
+			show = "SHOW CREATE VIEW "
+		case "SEQUENCE":
+			show = "SHOW CREATE SEQUENCE "
+		}
+		create, err := showCreate(db, show+quoteName(dbName)+"."+quoteName(obj.name))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", obj.name, err)
+		}
+		create = strings.ReplaceAll(create, qualifier, "")
+		objects[i].create = autoIDOptionRe.ReplaceAllString(create, "")
+	}
+	return objects, nil
+}
+
+// showCreate runs a SHOW CREATE statement and returns the statement in its second column
+func showCreate(db *sql.DB, query string) (string, error) {
+	rows, err := db.Query(query)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+	cols, err := rows.Columns()
+	if err != nil {
+		return "", err
+	}
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return "", err
+		}
+		return "", sql.ErrNoRows
+	}
+	values := make([]sql.RawBytes, len(cols))
+	ptrs := make([]interface{}, len(cols))
+	for i := range values {
+		ptrs[i] = &values[i]
+	}
+	if len(values) < 2 {
+		return "", fmt.Errorf("unexpected result of %s", query)
+	}
+	if err := rows.Scan(ptrs...); err != nil {
+		return "", err
+	}
+	return string(values[1]), nil
+}
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/pingcap/tidb/pkg/parser/ast"
+	"github.com/pingcap/tidb/pkg/parser/mysql"
+)
+
+// storedProgramRe matches the start of the stored programs TiDB doesn't run, once the
+// versioned comments mysqldump wraps them in are removed
+var storedProgramRe = regexp.MustCompile(`(?is)^CREATE\s+(?:OR\s+REPLACE\s+)?(?:DEFINER\s*=\s*\S+\s+)?(?:AGGREGATE\s+)?(PROCEDURE|FUNCTION|TRIGGER|EVENT)\b`)
+
+// versionedCommentRe matches the markers of MySQL versioned comments, /*!50003 ... */
+var versionedCommentRe = regexp.MustCompile(`/\*!\d*|\*/`)
+
+type CompatCheckCmd struct{}
+
+func (cmd CompatCheckCmd) Name() string {
+	return ".compat-check"
+}
+
+func (cmd CompatCheckCmd) Description() string {
+	return "Check a SQL file or a database migrated from MySQL for what TiDB doesn't support or runs differently"
+}
+
+func (cmd CompatCheckCmd) Usage() string {
+	return ".compat-check <file.sql|db>"
+}
+
+// compatFinding is an incompatibility of a statement or a schema object
+type compatFinding struct {
+	object   string
+	severity string
+	finding  string
+}
+
+func (cmd CompatCheckCmd) Handle(args []string, resultWriter io.Writer) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: %s", cmd.Usage())
+	}
+	startTime := time.Now()
+
+	var findings []compatFinding
+	var checked int
+	if info, err := os.Stat(args[0]); err == nil && !info.IsDir() {
+		data, err := os.ReadFile(args[0])
+		if err != nil {
+			return err
+		}
+		for _, stmt := range splitSQLText(string(data)) {
+			findings = append(findings, checkCompatibility(fmt.Sprintf("line %d", stmt.line), stmt.text)...)
+			checked++
+		}
+	} else {
+		db, err := requireDB()
+		if err != nil {
+			return err
+		}
+		dbName := strings.Trim(args[0], "`")
+		objects, err := loadSchemaObjects(db, dbName)
+		if err != nil {
+			return fmt.Errorf("failed to read the schema of %s: %v", dbName, err)
+		}
+		programs := loadStoredPrograms(db, dbName)
+		if len(objects) == 0 && len(programs) == 0 {
+			return fmt.Errorf("%s is neither a file nor a database with tables", args[0])
+		}
+		for _, obj := range objects {
+			findings = append(findings, checkCompatibility(obj.name, obj.create)...)
+		}
+		findings = append(findings, programs...)
+		checked = len(objects) + len(programs)
+	}
+
+	if len(findings) == 0 {
+		resultWriter.Write([]byte(fmt.Sprintf("Checked %d statements, nothing found.\n", checked)))
+		return nil
+	}
+	cols := []string{"Object", "Severity", "Finding"}
+	output := make([]RowResult, len(findings))
+	counts := map[string]int{}
+	for i, f := range findings {
+		output[i] = RowResult{colNames: cols, colValues: []interface{}{f.object, f.severity, f.finding}}
+		counts[f.severity]++
+	}
+	printResults(true, output, *globalOutputFormat, true, time.Since(startTime), 0)
+	fmt.Fprintf(resultWriter, "Checked %d statements: %d blockers, %d warnings, %d notes\n", checked, counts["blocker"], counts["warning"], counts["info"])
+	return nil
+}
+
+// loadStoredPrograms lists the procedures, functions, triggers and events of a MySQL
+// database, which TiDB can't run. A server without these tables has none.
+func loadStoredPrograms(db *sql.DB, dbName string) []compatFinding {
+	var findings []compatFinding
+	for _, q := range []string{
+		"SELECT ROUTINE_NAME, ROUTINE_TYPE FROM INFORMATION_SCHEMA.ROUTINES WHERE ROUTINE_SCHEMA = ?",
+		"SELECT TRIGGER_NAME, 'TRIGGER' FROM INFORMATION_SCHEMA.TRIGGERS WHERE TRIGGER_SCHEMA = ?",
+		"SELECT EVENT_NAME, 'EVENT' FROM INFORMATION_SCHEMA.EVENTS WHERE EVENT_SCHEMA = ?",
+	} {
+		rows, err := db.Query(q, dbName)
+		if err != nil {
+			continue
+		}
+		for rows.Next() {
+			var name, kind string
+			if rows.Scan(&name, &kind) == nil {
+				findings = append(findings, compatFinding{name, "blocker", storedProgramFinding(kind)})
+			}
+		}
+		rows.Close()
+	}
+	return findings
+}
+
+func storedProgramFinding(kind string) string {
+	return fmt.Sprintf("%ss are not supported: move the logic to the application", strings.ToLower(kind))
+}
+
+// sqlText is a statement of a SQL file and the line it starts on
+type sqlText struct {
+	text string
+	line int
+}
+
+// splitSQLText splits a SQL file into statements without parsing them, so that a statement
+// TiDB can't parse doesn't hide the others. It follows the DELIMITER lines of mysqldump
+// and the mysql client, and keeps delimiters in quotes and comments.
+func splitSQLText(s string) []sqlText {
+	var stmts []sqlText
+	delimiter := ";"
+	var cur strings.Builder
+	start, line := 1, 1
+	flush := func() {
+		if text := strings.TrimSpace(cur.String()); text != "" {
+			stmts = append(stmts, sqlText{text, start})
+		}
+		cur.Reset()
+	}
+	for i := 0; i < len(s); {
+		c := s[i]
+		if cur.Len() == 0 || strings.TrimSpace(cur.String()) == "" {
+			start = line
+			// DELIMITER is a client command, only recognized at the start of a statement
+			if rest := s[i:]; len(rest) > 10 && strings.EqualFold(rest[:10], "DELIMITER ") {
+				end := strings.IndexByte(rest, '\n')
+				if end < 0 {
+					end = len(rest)
+				}
+				if d := strings.TrimSpace(rest[10:end]); d != "" {
+					delimiter = d
+				}
+				cur.Reset()
+				i += end
+				continue
+			}
+		}
+		switch {
+		case c == '\n':
+			line++
+		case c == '\'' || c == '"' || c == '`':
+			j := i + 1
+			for j < len(s) && s[j] != c {
+				if s[j] == '\\' && c != '`' {
+					j++
+				} else if s[j] == '\n' {
+					line++
+				}
+				j++
+			}
+			cur.WriteString(s[i:min(j+1, len(s))])
+			i = j + 1
+			continue
+		case c == '#' || strings.HasPrefix(s[i:], "-- "):
+			j := strings.IndexByte(s[i:], '\n')
+			if j < 0 {
+				j = len(s) - i
+			}
+			cur.WriteString(s[i : i+j])
+			i += j
+			continue
+		case strings.HasPrefix(s[i:], "/*"):
+			j := strings.Index(s[i+2:], "*/")
+			end := len(s)
+			if j >= 0 {
+				end = i + 2 + j + 2
+			}
+			line += strings.Count(s[i:end], "\n")
+			cur.WriteString(s[i:end])
+			i = end
+			continue
+		case strings.HasPrefix(s[i:], delimiter):
+			flush()
+			i += len(delimiter)
+			continue
+		}
+		cur.WriteByte(c)
+		i++
+	}
+	flush()
+	return stmts
+}
+
+// checkCompatibility returns what TiDB doesn't support, or runs differently than MySQL,
+// in a statement
+func checkCompatibility(object, stmt string) []compatFinding {
+	var findings []compatFinding
+	add := func(severity, format string, a ...interface{}) {
+		findings = append(findings, compatFinding{object, severity, fmt.Sprintf(format, a...)})
+	}
+
+	stmtNodes, _, err := p.Parse(stmt, "", "")
+	if err != nil {
+		if m := storedProgramRe.FindStringSubmatch(strings.TrimSpace(versionedCommentRe.ReplaceAllString(stmt, ""))); m != nil {
+			add("blocker", "%s", storedProgramFinding(m[1]))
+		} else {
+			add("blocker", "TiDB can't parse it: %v", err)
+		}
+		return findings
+	}
+	for _, node := range stmtNodes {
+		switch stmt := node.(type) {
+		case *ast.ProcedureInfo:
+			add("blocker", "%s", storedProgramFinding("procedure"))
+		case *ast.CreateTableStmt:
+			checkCreateTableCompat(stmt, add)
+		case *ast.LockTablesStmt:
+			add("warning", "LOCK TABLES only locks with enable-table-lock in the TiDB configuration, otherwise it is ignored")
+		}
+		collector := &selectCollector{}
+		node.Accept(collector)
+		for _, sel := range collector.selects {
+			if sel.SelectStmtOpts != nil && sel.SelectStmtOpts.CalcFoundRows {
+				add("warning", "SQL_CALC_FOUND_ROWS fails unless tidb_enable_noop_functions is ON, and then FOUND_ROWS() isn't exact: run a separate COUNT(*)")
+			}
+			if sel.LockInfo != nil && (sel.LockInfo.LockType == ast.SelectLockForShare || sel.LockInfo.LockType == ast.SelectLockForShareNoWait) {
+				add("warning", "LOCK IN SHARE MODE / FOR SHARE fails unless tidb_enable_noop_functions is ON, and then takes no lock: use FOR UPDATE")
+			}
+			if sel.Limit != nil && sel.OrderBy == nil && sel.From != nil {
+				add("info", "LIMIT without ORDER BY: TiDB reads regions in parallel, so the rows returned differ from MySQL and between runs")
+			} else if sel.GroupBy != nil && sel.OrderBy == nil {
+				add("info", "GROUP BY without ORDER BY: groups come in no particular order, unlike the sorted groups of MySQL 5.7")
+			}
+		}
+	}
+	return findings
+}
+
+// checkCreateTableCompat adds the findings of the table options, columns and indexes of a CREATE TABLE
+func checkCreateTableCompat(stmt *ast.CreateTableStmt, add func(severity, format string, a ...interface{})) {
+	if stmt.Select != nil {
+		add("blocker", "CREATE TABLE ... SELECT is not supported: create the table, then INSERT ... SELECT")
+	}
+	for _, opt := range stmt.Options {
+		switch opt.Tp {
+		case ast.TableOptionEngine:
+			if opt.StrValue != "" && !strings.EqualFold(opt.StrValue, "InnoDB") {
+				add("warning", "ENGINE=%s is ignored: every table is transactional and stored in TiKV", opt.StrValue)
+			}
+		case ast.TableOptionRowFormat, ast.TableOptionKeyBlockSize, ast.TableOptionCompression:
+			add("info", "storage options such as ROW_FORMAT, KEY_BLOCK_SIZE and COMPRESSION are ignored")
+		}
+	}
+
+	var foreignKeys bool
+	for _, c := range stmt.Constraints {
+		switch c.Tp {
+		case ast.ConstraintFulltext:
+			add("warning", "FULLTEXT index %s is ignored: MATCH ... AGAINST doesn't work", c.Name)
+		case ast.ConstraintForeignKey:
+			foreignKeys = true
+		case ast.ConstraintCheck:
+			add("info", "CHECK constraints are only enforced from v7.2.0 with tidb_enable_check_constraint ON")
+		}
+	}
+	for _, col := range stmt.Cols {
+		for _, opt := range col.Options {
+			switch opt.Tp {
+			case ast.ColumnOptionReference:
+				foreignKeys = true
+			case ast.ColumnOptionAutoIncrement:
+				add("info", "AUTO_INCREMENT column %s: ids are cached per TiDB server, so they aren't consecutive nor in insert order, "+
+					"and an increasing primary key makes a write hotspot: consider AUTO_RANDOM", col.Name.Name.O)
+			}
+		}
+		if col.Tp != nil && col.Tp.GetType() == mysql.TypeGeometry {
+			add("blocker", "spatial column %s is not supported", col.Name.Name.O)
+		}
+	}
+	if foreignKeys {
+		add("info", "foreign keys are only enforced from v6.6.0, earlier releases accept and ignore them")
+	}
+}
+
+// selectCollector collects the SELECT statements of a statement, subqueries included
+type selectCollector struct {
+	selects []*ast.SelectStmt
+}
+
+func (c *selectCollector) Enter(n ast.Node) (ast.Node, bool) {
+	if sel, ok := n.(*ast.SelectStmt); ok {
+		c.selects = append(c.selects, sel)
+	}
+	return n, false
+}
+
+func (c *selectCollector) Leave(n ast.Node) (ast.Node, bool) {
+	return n, true
+}
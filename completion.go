@@ -0,0 +1,189 @@
+package main
+
+import (
+	"database/sql"
+	"regexp"
+	"strings"
+
+	"github.com/pingcap/tidb/pkg/parser/ast"
+)
+
+// completionPlaceholder stands in for the identifier being typed so that an
+// incomplete reference like "t." still parses
+const completionPlaceholder = "tip_completion_placeholder"
+
+// completeSQL returns completions for the word under the cursor. The candidates
+// depend on where the cursor is: tables after FROM/JOIN, columns after "alias.",
+// databases after USE and session variables after SET. prefix holds the
+// previous lines of a multi-line statement.
+func completeSQL(db *sql.DB, curDB string, prefix string, line string, pos int) (head string, completions []string, tail string) {
+	before := line[:pos]
+	wordStart := strings.LastIndexAny(before, " \t\n,()=") + 1
+	word := before[wordStart:]
+	head = line[:wordStart]
+	tail = line[pos:]
+
+	var candidates []string
+	if strings.TrimSpace(prefix+head) == "" && strings.HasPrefix(word, ".") {
+		candidates = SystemCmdNames()
+	} else if strings.HasPrefix(strings.TrimSpace(prefix+head), ".") {
+		// Arguments of system commands are mostly table names
+		if db != nil {
+			candidates, _ = getTableNames(db, curDB)
+		}
+	} else if dot := strings.LastIndex(word, "."); dot >= 0 {
+		qualifier := strings.Trim(word[:dot], "`")
+		candidates = completeQualified(db, curDB, qualifier, prefix+line, pos+len(prefix))
+		for i, c := range candidates {
+			candidates[i] = word[:dot+1] + c
+		}
+	} else {
+		candidates = completeByKeyword(db, curDB, previousKeyword(prefix+head), prefix+line, pos+len(prefix))
+	}
+
+	lower := strings.ToLower(word)
+	for _, item := range candidates {
+		if strings.HasPrefix(strings.ToLower(item), lower) {
+			completions = append(completions, item)
+		}
+	}
+	return head, completions, tail
+}
+
+// previousKeyword returns the upper-cased token preceding the word being typed
+func previousKeyword(text string) string {
+	fields := strings.Fields(text)
+	if len(fields) == 0 {
+		return ""
+	}
+	return strings.ToUpper(strings.Trim(fields[len(fields)-1], ",()"))
+}
+
+func completeByKeyword(db *sql.DB, curDB string, keyword string, stmt string, pos int) []string {
+	if db == nil {
+		return append(KEYWORDS, SystemCmdNames()...)
+	}
+	switch keyword {
+	case "FROM", "JOIN", "INTO", "UPDATE", "TABLE", "DESC", "DESCRIBE":
+		tables, _ := getTableNames(db, curDB)
+		databases, _ := getDatabases(db)
+		return append(append([]string{}, tables...), databases...)
+	case "USE", "DATABASE", "SCHEMA":
+		databases, _ := getDatabases(db)
+		return databases
+	case "SET", "SESSION", "GLOBAL":
+		vars, _ := getSessionVariableNames(db)
+		return append([]string{"SESSION", "GLOBAL"}, vars...)
+	}
+
+	candidates := append([]string{}, KEYWORDS...)
+	// Prefer the columns of the tables referenced in the statement
+	tables := referencedTables(stmt, pos)
+	if len(tables) == 0 {
+		cols, _ := getAllColumnNames(db, curDB)
+		names, _ := getTableNames(db, curDB)
+		return append(append(candidates, names...), cols...)
+	}
+	seen := make(map[string]bool)
+	for alias, table := range tables {
+		candidates = append(candidates, alias)
+		if seen[table] {
+			continue
+		}
+		seen[table] = true
+		cols, _ := getTableColumnNames(db, curDB, table)
+		candidates = append(candidates, cols...)
+	}
+	return candidates
+}
+
+// completeQualified completes the part after "qualifier.", which is either an
+// alias/table (columns) or a database (tables)
+func completeQualified(db *sql.DB, curDB string, qualifier string, stmt string, pos int) []string {
+	if db == nil {
+		return nil
+	}
+	if table, ok := referencedTables(stmt, pos)[strings.ToLower(qualifier)]; ok {
+		cols, _ := getTableColumnNames(db, curDB, table)
+		return cols
+	}
+	databases, _ := getDatabases(db)
+	for _, name := range databases {
+		if strings.EqualFold(name, qualifier) {
+			tables, _ := getTableNames(db, name)
+			return tables
+		}
+	}
+	cols, _ := getTableColumnNames(db, curDB, qualifier)
+	return cols
+}
+
+// referencedTables maps the lower-cased aliases and names of the tables in stmt
+// to their (possibly db-qualified) table names. The statement is parsed with
+// the TiDB parser, falling back to a lexical scan when it is still incomplete.
+func referencedTables(stmt string, pos int) map[string]string {
+	tables := make(map[string]string)
+
+	// Complete a dangling "alias." so the statement has a chance to parse
+	parsable := stmt
+	if pos > 0 && pos <= len(stmt) && stmt[pos-1] == '.' {
+		parsable = stmt[:pos] + completionPlaceholder + stmt[pos:]
+	}
+	if stmtNodes, _, err := p.Parse(parsable, "", ""); err == nil {
+		collector := &tableSourceCollector{tables: tables}
+		for _, node := range stmtNodes {
+			node.Accept(collector)
+		}
+		return tables
+	}
+
+	for _, match := range tableRefRegexp.FindAllStringSubmatch(stmt, -1) {
+		name := strings.ReplaceAll(match[1], "`", "")
+		short := name
+		if dot := strings.LastIndex(name, "."); dot >= 0 {
+			short = name[dot+1:]
+		}
+		tables[strings.ToLower(short)] = name
+		if alias := match[2]; alias != "" && !isReservedAliasWord(alias) {
+			tables[strings.ToLower(alias)] = name
+		}
+	}
+	return tables
+}
+
+var tableRefRegexp = regexp.MustCompile("(?i)\\b(?:FROM|JOIN|UPDATE|INTO)\\s+([\\w.`]+)(?:\\s+(?:AS\\s+)?(\\w+))?")
+
+func isReservedAliasWord(word string) bool {
+	switch strings.ToUpper(word) {
+	case "WHERE", "ON", "USING", "JOIN", "LEFT", "RIGHT", "INNER", "OUTER", "CROSS", "NATURAL",
+		"SET", "GROUP", "ORDER", "LIMIT", "HAVING", "VALUES", "UNION", "AS":
+		return true
+	}
+	return false
+}
+
+type tableSourceCollector struct {
+	tables map[string]string
+}
+
+func (c *tableSourceCollector) Enter(n ast.Node) (ast.Node, bool) {
+	source, ok := n.(*ast.TableSource)
+	if !ok {
+		return n, false
+	}
+	if tn, ok := source.Source.(*ast.TableName); ok {
+		name := tn.Name.O
+		if tn.Schema.O != "" {
+			name = tn.Schema.O + "." + name
+		}
+		c.tables[tn.Name.L] = name
+		if source.AsName.L != "" {
+			c.tables[source.AsName.L] = name
+		}
+	}
+	return n, false
+}
+
+func (c *tableSourceCollector) Leave(n ast.Node) (ast.Node, bool) {
+	return n, true
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// reloadableKeys are the settings of a connection the REPL applies as soon as the
+// configuration file changes, the others only take effect on connecting
+var reloadableKeys = map[string]func(value string) error{
+	"output_format": func(value string) error {
+		*globalOutputFormat = parseOutputFormat(withDefault(value, "table"))
+		return nil
+	},
+	"pager": func(value string) error {
+		pagerEnabled = value != "false"
+		return nil
+	},
+	"safe_row_limit": func(value string) error {
+		n, err := parseRowLimit(withDefault(value, fmt.Sprint(defaultSafeRowLimit)))
+		if err != nil {
+			return err
+		}
+		safeRowLimit = n
+		return nil
+	},
+	"safe_mode": func(value string) error {
+		safeMode = value == "true"
+		return nil
+	},
+}
+
+// configWatch is the state of the configuration file the REPL last applied
+var configWatch struct {
+	modTime time.Time
+	config  ConnConfig // settings of the connection in use, see loadActiveConfig
+}
+
+// loadActiveConfig loads the settings of the profile in use, or the top-level ones
+func loadActiveConfig() (ConnConfig, error) {
+	if globalProfile != "" {
+		return loadProfile(globalConfigFile, globalProfile)
+	}
+	return loadConfigFromFile(globalConfigFile)
+}
+
+// watchConfigFile records the state of the configuration file the REPL starts with
+func watchConfigFile() {
+	if globalConfigFile == "" {
+		return
+	}
+	if fi, err := os.Stat(globalConfigFile); err == nil {
+		configWatch.modTime = fi.ModTime()
+	}
+	configWatch.config, _ = loadActiveConfig()
+}
+
+// reloadConfigIfChanged applies the display and limit settings of the configuration
+// file when it changed since it was last read, and tells what changed. The file is
+// checked before every prompt, the AI settings are read again by every .ask anyway.
+func reloadConfigIfChanged(w io.Writer) {
+	if globalConfigFile == "" {
+		return
+	}
+	fi, err := os.Stat(globalConfigFile)
+	if err != nil || fi.ModTime().Equal(configWatch.modTime) {
+		return
+	}
+	configWatch.modTime = fi.ModTime()
+	config, err := loadActiveConfig()
+	if err != nil {
+		fmt.Fprintf(w, "Configuration not reloaded: %v\n", err)
+		return
+	}
+
+	var applied, pending []string
+	for _, change := range configChanges(configWatch.config, config) {
+		apply, ok := reloadableKeys[change.key]
+		if !ok {
+			pending = append(pending, change.key)
+			continue
+		}
+		if err := apply(change.new); err != nil {
+			fmt.Fprintf(w, "Configuration not reloaded: %s: %v\n", change.key, err)
+			continue
+		}
+		applied = append(applied, fmt.Sprintf("%s %s -> %s", change.key, withDefault(change.old, "(default)"), withDefault(change.new, "(default)")))
+	}
+	configWatch.config = config
+	if len(applied) > 0 {
+		fmt.Fprintf(w, "Configuration reloaded: %s\n", strings.Join(applied, ", "))
+	}
+	if len(pending) > 0 {
+		fmt.Fprintf(w, "Changed connection settings (%s) apply when tip is restarted\n", strings.Join(pending, ", "))
+	}
+}
+
+// configChange is a setting of a connection that changed, with its values as text
+type configChange struct {
+	key, old, new string
+}
+
+// configChanges lists the settings that differ between old and new, by key
+func configChanges(old, new ConnConfig) []configChange {
+	var changes []configChange
+	var walk func(o, n reflect.Value)
+	walk = func(o, n reflect.Value) {
+		for i := 0; i < o.NumField(); i++ {
+			field := o.Type().Field(i)
+			if field.Anonymous {
+				walk(o.Field(i), n.Field(i))
+				continue
+			}
+			if ov, nv := configValueText(o.Field(i)), configValueText(n.Field(i)); ov != nv {
+				changes = append(changes, configChange{field.Tag.Get("toml"), ov, nv})
+			}
+		}
+	}
+	walk(reflect.ValueOf(old), reflect.ValueOf(new))
+	sort.Slice(changes, func(i, j int) bool { return changes[i].key < changes[j].key })
+	return changes
+}
+
+// configValueText returns the value of a setting as text, empty when it is not set
+func configValueText(v reflect.Value) string {
+	// A setting that can't be left at its zero value is a pointer, nil when not set
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return ""
+		}
+		return fmt.Sprint(v.Elem().Interface())
+	}
+	if v.IsZero() {
+		return ""
+	}
+	return fmt.Sprint(v.Interface())
+}
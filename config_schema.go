@@ -0,0 +1,365 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml"
+)
+
+// Config is the configuration file once validated. The settings of the default
+// connection are at the top level of the file, those of the other connections in
+// [profiles.<name>] tables.
+type Config struct {
+	ConnConfig
+	Profiles  map[string]ConnConfig `toml:"profiles"`
+	AI        AIConfig              `toml:"ai"`
+	Share     ShareConfig           `toml:"share"`
+	GSheet    GSheetConfig          `toml:"gsheet"`
+	Telemetry TelemetryConfig       `toml:"telemetry"`
+}
+
+// ConnConfig holds the settings of a connection. The TLS, display and limit settings
+// are grouped here but written next to the others in the file, as they always were.
+type ConnConfig struct {
+	Host                    string     `toml:"host"`
+	Port                    configText `toml:"port"`
+	User                    string     `toml:"user"`
+	Password                string     `toml:"password"`
+	Database                string     `toml:"database"`
+	Socket                  string     `toml:"socket"`
+	AllowCleartextPasswords configBool `toml:"allow_cleartext_passwords"`
+	ProxyProtocol           configBool `toml:"proxy_protocol"`
+	QueryComment            string     `toml:"query_comment"`
+	ReadHost                string     `toml:"read_host"`
+	ReadPort                configText `toml:"read_port"`
+	InitSQL                 string     `toml:"init_sql"`
+	InterpolateParams       configBool `toml:"interpolate_params"`
+	TLSConfig
+	DisplayConfig
+	LimitsConfig
+}
+
+// TLSConfig holds how a connection is encrypted
+type TLSConfig struct {
+	SSLMode string `toml:"ssl_mode"`
+	SSLCA   string `toml:"ssl_ca"`
+	SSLCert string `toml:"ssl_cert"`
+	SSLKey  string `toml:"ssl_key"`
+}
+
+// DisplayConfig holds how the REPL shows results, empty for the defaults
+type DisplayConfig struct {
+	OutputFormat string      `toml:"output_format"`
+	Pager        *configBool `toml:"pager"`
+}
+
+// LimitsConfig holds the safety limits, retries and timeouts of a connection, zero
+// or nil for the defaults
+type LimitsConfig struct {
+	SafeRowLimit     configText    `toml:"safe_row_limit"`
+	SafeMode         configBool    `toml:"safe_mode"`
+	Retries          *configInt    `toml:"retries"`
+	RetryBackoff     time.Duration `toml:"retry_backoff"`
+	ReadTimeout      time.Duration `toml:"read_timeout"`
+	WriteTimeout     time.Duration `toml:"write_timeout"`
+	MaxAllowedPacket configText    `toml:"max_allowed_packet"`
+}
+
+// AIConfig is the [ai] section, see newAIBackend
+type AIConfig struct {
+	Provider   string      `toml:"provider"`
+	BaseURL    string      `toml:"base_url"`
+	APIKey     string      `toml:"api_key"`
+	Model      string      `toml:"model"`
+	APIVersion string      `toml:"api_version"`
+	Stream     *configBool `toml:"stream"`
+}
+
+// ShareConfig is the [share] section, see .share
+type ShareConfig struct {
+	GitHubToken string `toml:"github_token"`
+}
+
+// GSheetConfig is the [gsheet] section, see NewGSheetResultIOWriter
+type GSheetConfig struct {
+	CredentialsFile string `toml:"credentials_file"`
+	AccessToken     string `toml:"access_token"`
+}
+
+// TelemetryConfig is the [telemetry] section, see telemetryEndpoint
+type TelemetryConfig struct {
+	Endpoint string `toml:"endpoint"`
+}
+
+// configText is a value kept as text that may be written as a number as well, such
+// as port = 4000 or safe_row_limit = "off"
+type configText string
+
+func (t *configText) UnmarshalText(text []byte) error {
+	*t = configText(text)
+	return nil
+}
+
+// configBool is a boolean that may be quoted, as in safe_mode = "true"
+type configBool bool
+
+func (b *configBool) UnmarshalText(text []byte) error {
+	v, err := strconv.ParseBool(string(text))
+	*b = configBool(v)
+	return err
+}
+
+// configInt is a number that may be quoted, as in retries = "5"
+type configInt int
+
+func (n *configInt) UnmarshalText(text []byte) error {
+	v, err := strconv.Atoi(string(text))
+	*n = configInt(v)
+	return err
+}
+
+// decodeConfig reads the validated tree of the configuration file into a Config
+func decodeConfig(tree *toml.Tree) (Config, error) {
+	var config Config
+	if err := tree.Unmarshal(&config); err != nil {
+		return Config{}, err
+	}
+	return config, nil
+}
+
+// configCheck validates the value of a configuration key, values are read as
+// strings later, so numbers may as well be written quoted
+type configCheck func(val interface{}) error
+
+// configSection lists the keys a table of the configuration file may have
+type configSection map[string]configCheck
+
+// connectionKeys are the keys of a connection, at the top level of the file or in a profile
+var connectionKeys = configSection{
+	"host":                      isString,
+	"port":                      isPort,
+	"user":                      isString,
+	"password":                  isString,
+	"database":                  isString,
+	"socket":                    isString,
+	"allow_cleartext_passwords": isBool,
+	"proxy_protocol":            isBool,
+	"query_comment":             isString,
+	"read_host":                 isString,
+	"read_port":                 isPort,
+	"safe_row_limit":            isRowLimit,
+	"output_format":             oneOf("plain", "table", "json", "jsonl", "csv", "batch", "chart"),
+	"pager":                     isBool,
+	"safe_mode":                 isBool,
+	"init_sql":                  isString,
+	"ssl_mode":                  isSSLMode,
+	"ssl_ca":                    isString,
+	"ssl_cert":                  isString,
+	"ssl_key":                   isString,
+	"retries":                   isCount,
+	"retry_backoff":             isDuration,
+	"read_timeout":              isDuration,
+	"write_timeout":             isDuration,
+	"max_allowed_packet":        isPacketSize,
+	"interpolate_params":        isBool,
+}
+
+// configSections are the [sections] of the configuration file besides [profiles.<name>]
+var configSections = map[string]configSection{
+	"ai": {
+		"provider":    oneOf("tidbai", "openai", "azure", "ollama"),
+		"base_url":    isString,
+		"api_key":     isString,
+		"model":       isString,
+		"api_version": isString,
+		"stream":      isBool,
+	},
+	"share": {
+		"github_token": isString,
+	},
+	"gsheet": {
+		"credentials_file": isString,
+		"access_token":     isString,
+	},
+	"telemetry": {
+		"endpoint": isString,
+	},
+}
+
+// loadConfigTree reads and validates the configuration file, so that a typo is
+// reported instead of the setting being silently ignored
+func loadConfigTree(configPath string) (*toml.Tree, error) {
+	tree, err := toml.LoadFile(configPath)
+	if err != nil {
+		return nil, err
+	}
+	if err := validateConfig(tree); err != nil {
+		return nil, fmt.Errorf("%s: %v", configPath, err)
+	}
+	return tree, nil
+}
+
+// validateConfig checks every key of the configuration file against the schema
+func validateConfig(tree *toml.Tree) error {
+	sectionNames := []string{"profiles"}
+	for name := range configSections {
+		sectionNames = append(sectionNames, name)
+	}
+	for _, key := range tree.Keys() {
+		sub, isTable := tree.Get(key).(*toml.Tree)
+		if !isTable {
+			if err := validateConfigKey(connectionKeys, key, tree.Get(key), "the default connection"); err != nil {
+				return err
+			}
+			continue
+		}
+		if key == "profiles" {
+			for _, name := range sub.Keys() {
+				profile, ok := sub.Get(name).(*toml.Tree)
+				if !ok {
+					return fmt.Errorf("profile '%s' must be a table, e.g. [profiles.%s]", name, name)
+				}
+				for _, k := range profile.Keys() {
+					if err := validateConfigKey(connectionKeys, k, profile.Get(k), fmt.Sprintf("profile '%s'", name)); err != nil {
+						return err
+					}
+				}
+			}
+			continue
+		}
+		section, ok := configSections[key]
+		if !ok {
+			return fmt.Errorf("unknown section [%s]%s", key, didYouMean(key, sectionNames, "[%s]"))
+		}
+		for _, k := range sub.Keys() {
+			if err := validateConfigKey(section, k, sub.Get(k), fmt.Sprintf("section [%s]", key)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// validateConfigKey checks a key of a table against the keys the table may have
+func validateConfigKey(section configSection, key string, val interface{}, where string) error {
+	check, ok := section[key]
+	if !ok {
+		keys := make([]string, 0, len(section))
+		for k := range section {
+			keys = append(keys, k)
+		}
+		if _, isTable := val.(*toml.Tree); isTable {
+			return fmt.Errorf("unexpected table '%s' in %s", key, where)
+		}
+		return fmt.Errorf("unknown key '%s' in %s%s", key, where, didYouMean(key, keys, "'%s'"))
+	}
+	if err := check(val); err != nil {
+		return fmt.Errorf("invalid value for '%s' in %s: %v", key, where, err)
+	}
+	return nil
+}
+
+// didYouMean suggests the candidate closest to a misspelled name, if one is close enough
+func didYouMean(name string, candidates []string, quote string) string {
+	sort.Strings(candidates)
+	best, bestDist := "", len(name)/3+1
+	for _, c := range candidates {
+		if d := editDistance(name, c); d <= bestDist && (best == "" || d < bestDist) {
+			best, bestDist = c, d
+		}
+	}
+	if best == "" {
+		return ""
+	}
+	return ", did you mean " + fmt.Sprintf(quote, best) + "?"
+}
+
+// editDistance returns the Levenshtein distance between a and b
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+func isString(val interface{}) error {
+	if _, ok := val.(string); !ok {
+		return fmt.Errorf("must be a string, e.g. \"%v\"", val)
+	}
+	return nil
+}
+
+func isBool(val interface{}) error {
+	switch fmt.Sprint(val) {
+	case "true", "false":
+		return nil
+	}
+	return fmt.Errorf("must be true or false")
+}
+
+func isPort(val interface{}) error {
+	if n, err := strconv.Atoi(fmt.Sprint(val)); err != nil || n < 1 || n > 65535 {
+		return fmt.Errorf("must be a port number")
+	}
+	return nil
+}
+
+func isCount(val interface{}) error {
+	if n, err := strconv.Atoi(fmt.Sprint(val)); err != nil || n < 0 {
+		return fmt.Errorf("must be a number, 0 or more")
+	}
+	return nil
+}
+
+func isDuration(val interface{}) error {
+	if _, err := time.ParseDuration(fmt.Sprint(val)); err != nil {
+		return fmt.Errorf("must be a duration, e.g. \"500ms\" or \"2s\"")
+	}
+	return nil
+}
+
+func isPacketSize(val interface{}) error {
+	_, err := parseMaxAllowedPacket(fmt.Sprint(val))
+	return err
+}
+
+func isRowLimit(val interface{}) error {
+	if _, err := parseRowLimit(fmt.Sprint(val)); err != nil {
+		return fmt.Errorf("must be a number of rows or \"off\"")
+	}
+	return nil
+}
+
+func isSSLMode(val interface{}) error {
+	_, err := parseSSLMode(fmt.Sprint(val))
+	return err
+}
+
+func oneOf(values ...string) configCheck {
+	return func(val interface{}) error {
+		s := strings.ToLower(fmt.Sprint(val))
+		for _, v := range values {
+			if s == v {
+				return nil
+			}
+		}
+		return fmt.Errorf("must be one of %s", strings.Join(values, ", "))
+	}
+}
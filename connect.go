@@ -0,0 +1,445 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand"
+	"net"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// proxyProtocolNet is the network name of the dialer that sends a PROXY protocol header
+const proxyProtocolNet = "tcp+proxy"
+
+func init() {
+	mysql.RegisterDialContext(proxyProtocolNet, dialWithProxyHeader)
+}
+
+// dialWithProxyHeader connects over TCP and announces the client address with a
+// PROXY protocol v1 header, as expected by HAProxy, ProxySQL or TiDB behind them
+func dialWithProxyHeader(ctx context.Context, addr string) (net.Conn, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	src := conn.LocalAddr().(*net.TCPAddr)
+	dst := conn.RemoteAddr().(*net.TCPAddr)
+	family := "TCP4"
+	if src.IP.To4() == nil {
+		family = "TCP6"
+	}
+	header := fmt.Sprintf("PROXY %s %s %s %d %d\r\n", family, src.IP, dst.IP, src.Port, dst.Port)
+	if _, err := conn.Write([]byte(header)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// connectionAttributes identifies tip sessions in performance_schema.session_connect_attrs
+// and in the logs of proxies that record them
+func connectionAttributes() string {
+	attrs := []string{"program_name:tip", "program_version:" + Version}
+	if u, err := user.Current(); err == nil {
+		attrs = append(attrs, "os_user:"+u.Username)
+	}
+	return strings.Join(attrs, ",")
+}
+
+const (
+	defaultRetries      = 3
+	defaultRetryBackoff = 500 * time.Millisecond
+	maxRetryBackoff     = 10 * time.Second
+)
+
+// retryPolicyFromConfig resolves the retry settings, values from flags (retries >= 0,
+// backoff > 0) take precedence over the retries and retry_backoff config keys
+func retryPolicyFromConfig(config ConnConfig, retries int, backoff time.Duration) (int, time.Duration) {
+	if retries < 0 {
+		retries = defaultRetries
+		if config.Retries != nil && *config.Retries >= 0 {
+			retries = int(*config.Retries)
+		}
+	}
+	if backoff <= 0 {
+		backoff = defaultRetryBackoff
+		if config.RetryBackoff > 0 {
+			backoff = config.RetryBackoff
+		}
+	}
+	return retries, backoff
+}
+
+// driverMaxAllowedPacket is the largest packet the driver sends by default
+const driverMaxAllowedPacket = 64 << 20
+
+// parseMaxAllowedPacket parses a packet size in bytes, with an optional K, M or G suffix,
+// up to the 1G the server allows. 0 or server stand for the max_allowed_packet of the
+// server, read on connecting, and are returned as -1; an empty string as 0, the default.
+func parseMaxAllowedPacket(s string) (int, error) {
+	s = strings.TrimSpace(s)
+	switch strings.ToLower(s) {
+	case "":
+		return 0, nil
+	case "0", "server":
+		return -1, nil
+	}
+	num := strings.TrimSuffix(strings.TrimSuffix(strings.ToUpper(s), "B"), "I")
+	unit := 1
+	switch {
+	case strings.HasSuffix(num, "K"):
+		unit = 1 << 10
+	case strings.HasSuffix(num, "M"):
+		unit = 1 << 20
+	case strings.HasSuffix(num, "G"):
+		unit = 1 << 30
+	}
+	if unit > 1 {
+		num = num[:len(num)-1]
+	}
+	n, err := strconv.Atoi(num)
+	if err != nil || n > (1<<30)/unit || n*unit < 1024 {
+		return 0, fmt.Errorf("invalid packet size %q, expected bytes from 1024 to 1G, e.g. 256M, or server", s)
+	}
+	return n * unit, nil
+}
+
+// copyDriverOptions sets the driver options of info that are set in from
+func copyDriverOptions(info *ConnInfo, from ConnInfo) {
+	if from.ReadTimeout != 0 {
+		info.ReadTimeout = from.ReadTimeout
+	}
+	if from.WriteTimeout != 0 {
+		info.WriteTimeout = from.WriteTimeout
+	}
+	if from.MaxAllowedPacket != 0 {
+		info.MaxAllowedPacket = from.MaxAllowedPacket
+	}
+	if from.InterpolateParams {
+		info.InterpolateParams = true
+	}
+}
+
+// connectError wraps a connection failure with the stage at which it failed
+type connectError struct {
+	kind string // dns, tcp, tls, auth or other
+	msg  string
+	err  error
+}
+
+func (e *connectError) Error() string {
+	return fmt.Sprintf("%s: %v", e.msg, e.err)
+}
+
+func (e *connectError) Unwrap() error {
+	return e.err
+}
+
+// retryable reports whether another attempt may succeed
+func (e *connectError) retryable() bool {
+	return e.kind == "dns" || e.kind == "tcp" || e.kind == "other"
+}
+
+// classifyConnectError tells DNS, TCP, TLS and authentication failures apart
+func classifyConnectError(err error, host string, port string) *connectError {
+	var dnsErr *net.DNSError
+	var opErr *net.OpError
+	var mysqlErr *mysql.MySQLError
+	var certErr *tls.CertificateVerificationError
+	var recordErr tls.RecordHeaderError
+	var unknownAuthErr x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+
+	switch {
+	case errors.As(err, &dnsErr):
+		kind := "dns"
+		if dnsErr.IsNotFound {
+			// A host that doesn't exist won't appear on retry
+			kind = "dns-not-found"
+		}
+		return &connectError{kind, fmt.Sprintf("cannot resolve host %q", host), err}
+	case errors.As(err, &mysqlErr):
+		switch mysqlErr.Number {
+		case 1045, 1044, 1698:
+			return &connectError{"auth", "authentication failed", err}
+		case 1049:
+			return &connectError{"auth", "unknown database", err}
+		}
+		return &connectError{"other", "server rejected the connection", err}
+	case errors.Is(err, mysql.ErrNoTLS), errors.As(err, &certErr), errors.As(err, &recordErr),
+		errors.As(err, &unknownAuthErr), errors.As(err, &hostnameErr), strings.Contains(err.Error(), "tls:"):
+		return &connectError{"tls", "TLS handshake failed", err}
+	case errors.As(err, &opErr):
+		return &connectError{"tcp", fmt.Sprintf("cannot reach %s:%s", host, port), err}
+	}
+	return &connectError{"other", "connection failed", err}
+}
+
+// backoffDelay returns the delay before the given retry (1-based): exponential
+// growth capped at maxRetryBackoff, with jitter in [delay/2, delay]
+func backoffDelay(base time.Duration, retry int) time.Duration {
+	delay := base << (retry - 1)
+	if delay > maxRetryBackoff || delay <= 0 {
+		delay = maxRetryBackoff
+	}
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+func connectWithRetry(cfg *mysql.Config, info ConnInfo, tlsConfig *tls.Config) (*sql.DB, error) {
+	cfg = cfg.Clone()
+	if tlsConfig != nil {
+		cfg.TLS = tlsConfig
+		// Cleartext passwords are only acceptable on an encrypted connection
+		cfg.AllowCleartextPasswords = info.AllowCleartextPasswords
+	} else if info.AllowCleartextPasswords {
+		log.Println("Warning: mysql_clear_password is disabled on connections without TLS")
+	}
+
+	connector, err := mysql.NewConnector(cfg)
+	if err != nil {
+		log.Println("Failed!")
+		return nil, err
+	}
+	db := sql.OpenDB(&sessionConnector{Connector: connector, session: info.Session, addr: cfg.Addr})
+
+	debugLog.Debug("connecting", "dsn", redactedDSN(cfg), "tls", tlsConfig != nil, "session", info.Session)
+	if tlsConfig != nil {
+		debugLog.Debug("TLS settings", "server_name", tlsConfig.ServerName, "verify", !tlsConfig.InsecureSkipVerify,
+			"ca", withDefault(info.SSLCA, "system roots"), "client_cert", info.SSLCert != "")
+	}
+	label := fmt.Sprintf("Connecting to TiDB at: %s...", cfg.Addr)
+	attempts := info.Retries + 1
+	var cerr *connectError
+	for attempt := 1; attempt <= attempts; attempt++ {
+		if attempt > 1 {
+			label = fmt.Sprintf("Connecting to TiDB at: %s... (attempt %d/%d)", cfg.Addr, attempt, attempts)
+		}
+		start := time.Now()
+		err = pingWithSpinner(db, label)
+		if err == nil {
+			debugLog.Debug("connected", "addr", cfg.Addr, "attempt", attempt, "duration", time.Since(start))
+			if tlsConfig != nil {
+				logTLSSession(db)
+			}
+			log.Println("Connected!")
+			return db, nil
+		}
+		cerr = classifyConnectError(err, info.Host, info.Port)
+		debugLog.Debug("connection attempt failed", "addr", cfg.Addr, "attempt", attempt, "kind", cerr.kind,
+			"duration", time.Since(start), "error", err)
+		if !cerr.retryable() || attempt == attempts {
+			break
+		}
+		delay := backoffDelay(info.RetryBackoff, attempt)
+		debugLog.Debug("retrying", "addr", cfg.Addr, "delay", delay)
+		log.Printf("%v, retrying in %s", cerr, delay.Round(time.Millisecond))
+		time.Sleep(delay)
+	}
+
+	db.Close()
+	log.Println("Failed!")
+	return nil, cerr
+}
+
+// pingWithSpinner pings db, animating label on stderr while it waits if stderr is a terminal
+func pingWithSpinner(db *sql.DB, label string) error {
+	if !isTerminal() {
+		log.Println(label)
+		return db.Ping()
+	}
+	done := make(chan bool)
+	finished := make(chan struct{})
+	go func() {
+		spinnerAnimation(os.Stderr, label, done)
+		close(finished)
+	}()
+	err := db.Ping()
+	done <- true
+	<-finished
+	fmt.Fprint(os.Stderr, "\r\033[K")
+	log.Println(label)
+	return err
+}
+
+// openDatabase opens a connection pool for the provided ConnInfo without touching the global connection.
+// When Host lists several hosts, the first one that accepts the connection is used.
+func openDatabase(info ConnInfo) (*sql.DB, error) {
+	db, _, err := openAnyHost(info, 0)
+	return db, err
+}
+
+// openHost opens a connection pool to a single host
+func openHost(info ConnInfo) (*sql.DB, error) {
+	cfg := mysql.NewConfig()
+	cfg.User = info.User
+	cfg.Passwd = info.Password
+	cfg.DBName = info.Database
+	cfg.Params = map[string]string{"charset": "utf8mb4"}
+	cfg.ConnectionAttributes = connectionAttributes()
+	cfg.Net = "tcp"
+	if info.ProxyProtocol {
+		cfg.Net = proxyProtocolNet
+	}
+	cfg.Addr = net.JoinHostPort(info.Host, info.Port)
+	cfg.ReadTimeout = info.ReadTimeout
+	cfg.WriteTimeout = info.WriteTimeout
+	cfg.InterpolateParams = info.InterpolateParams
+	switch {
+	case info.MaxAllowedPacket > 0:
+		cfg.MaxAllowedPacket = info.MaxAllowedPacket
+	case info.MaxAllowedPacket < 0:
+		// The driver reads max_allowed_packet from the server on connecting
+		cfg.MaxAllowedPacket = 0
+	}
+
+	if info.Socket != "" {
+		// With auth_socket the server identifies the OS user at the other end of the socket
+		cfg.Net = "unix"
+		cfg.Addr = info.Socket
+		if cfg.User == "" {
+			if u, err := user.Current(); err == nil {
+				cfg.User = u.Username
+			}
+		}
+		db, err := connectWithRetry(cfg, info, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to TiDB: %v", err)
+		}
+		setPoolSize(db, info)
+		return db, nil
+	}
+
+	mode, err := parseSSLMode(info.SSLMode)
+	if err != nil {
+		return nil, err
+	}
+	var tlsConfig *tls.Config
+	if mode != sslDisabled {
+		if tlsConfig, err = buildTLSConfig(info, mode); err != nil {
+			return nil, err
+		}
+	}
+
+	db, err := connectWithRetry(cfg, info, tlsConfig)
+	if err != nil {
+		var cerr *connectError
+		if mode != sslPreferred || !errors.As(err, &cerr) || cerr.kind != "tls" {
+			// Plaintext won't fix network or authentication problems, and
+			// isn't acceptable when TLS was asked for
+			return nil, fmt.Errorf("failed to connect to TiDB: %v", err)
+		}
+		log.Printf("Warning: %v, connecting without TLS (use -ssl-mode required to refuse plaintext)", err)
+		db, err = connectWithRetry(cfg, info, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to TiDB: %v", err)
+		}
+	}
+
+	setPoolSize(db, info)
+	return db, nil
+}
+
+// setPoolSize sizes the connection pool. The session runs on a single connection,
+// like the mysql client, so that USE, session variables, temporary tables and
+// transactions all apply to the statements that follow.
+func setPoolSize(db *sql.DB, info ConnInfo) {
+	if info.Session {
+		db.SetMaxOpenConns(1)
+		db.SetMaxIdleConns(1)
+		return
+	}
+	db.SetMaxOpenConns(100)
+	db.SetMaxIdleConns(100)
+}
+
+// TLS modes, named after the --ssl-mode values of the mysql client
+const (
+	sslDisabled       = "disabled"        // never use TLS
+	sslPreferred      = "preferred"       // verified TLS, falling back to plaintext if the handshake fails
+	sslRequired       = "required"        // TLS without verifying the server certificate
+	sslVerifyCA       = "verify-ca"       // TLS with a certificate signed by a trusted CA
+	sslVerifyIdentity = "verify-identity" // TLS with a trusted certificate issued for the host
+)
+
+// parseSSLMode validates a TLS mode, accepting the mysql client spelling (VERIFY_CA) too.
+// The default is preferred.
+func parseSSLMode(s string) (string, error) {
+	mode := strings.ReplaceAll(strings.ToLower(s), "_", "-")
+	switch mode {
+	case "":
+		return sslPreferred, nil
+	case sslDisabled, sslPreferred, sslRequired, sslVerifyCA, sslVerifyIdentity:
+		return mode, nil
+	}
+	return "", fmt.Errorf("invalid ssl mode %q, expected disabled, preferred, required, verify-ca or verify-identity", s)
+}
+
+// buildTLSConfig returns the TLS configuration for a connection in the given mode,
+// trusting the CA and presenting the client certificate of the connection settings
+func buildTLSConfig(info ConnInfo, mode string) (*tls.Config, error) {
+	config := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: info.Host,
+	}
+	if info.SSLCA != "" {
+		pem, err := os.ReadFile(info.SSLCA)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file: %v", err)
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA file %s", info.SSLCA)
+		}
+	}
+	if info.SSLCert != "" || info.SSLKey != "" {
+		if info.SSLCert == "" || info.SSLKey == "" {
+			return nil, fmt.Errorf("a client certificate needs both -ssl-cert and -ssl-key")
+		}
+		cert, err := tls.LoadX509KeyPair(info.SSLCert, info.SSLKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %v", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	switch mode {
+	case sslRequired:
+		config.InsecureSkipVerify = true
+	case sslVerifyCA:
+		// Verify the chain ourselves, leaving out the host name check
+		config.InsecureSkipVerify = true
+		roots := config.RootCAs
+		config.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			certs := make([]*x509.Certificate, len(rawCerts))
+			for i, raw := range rawCerts {
+				cert, err := x509.ParseCertificate(raw)
+				if err != nil {
+					return err
+				}
+				certs[i] = cert
+			}
+			if len(certs) == 0 {
+				return fmt.Errorf("server presented no certificate")
+			}
+			opts := x509.VerifyOptions{Roots: roots, Intermediates: x509.NewCertPool()}
+			for _, cert := range certs[1:] {
+				opts.Intermediates.AddCert(cert)
+			}
+			_, err := certs[0].Verify(opts)
+			return err
+		}
+	}
+	return config, nil
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// clipboardPrograms are the programs tried, in order, to put text on the clipboard
+var clipboardPrograms = map[string][][]string{
+	"darwin":  {{"pbcopy"}},
+	"windows": {{"clip"}},
+	"linux": {
+		{"wl-copy"},
+		{"xclip", "-selection", "clipboard"},
+		{"xsel", "--clipboard", "--input"},
+		{"clip.exe"}, // WSL
+	},
+}
+
+// copyToClipboard puts text on the system clipboard with the first clipboard program
+// found. Without one, e.g. over SSH, the terminal is asked to do it with the OSC 52
+// escape sequence, which most terminals support.
+func copyToClipboard(text string) error {
+	for _, program := range clipboardPrograms[runtime.GOOS] {
+		if runtime.GOOS == "linux" && program[0] == "wl-copy" && os.Getenv("WAYLAND_DISPLAY") == "" {
+			continue
+		}
+		path, err := exec.LookPath(program[0])
+		if err != nil {
+			continue
+		}
+		cmd := exec.Command(path, program[1:]...)
+		cmd.Stdin = strings.NewReader(text)
+		var stderr bytes.Buffer
+		cmd.Stderr = &stderr
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("%s failed: %v %s", program[0], err, strings.TrimSpace(stderr.String()))
+		}
+		return nil
+	}
+	if !isTerminal() {
+		return fmt.Errorf("no clipboard program found, install xclip, xsel or wl-clipboard")
+	}
+	fmt.Fprintf(os.Stdout, "\033]52;c;%s\a", base64.StdEncoding.EncodeToString([]byte(text)))
+	return nil
+}
+
+// clipboardTable writes rows with a header row of the column names, as tab-separated
+// values that spreadsheets split into cells when pasted, or as CSV with comma
+func clipboardTable(rows []RowResult, comma rune) (string, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Comma = comma
+	w.Write(rows[0].colNames)
+	record := make([]string, len(rows[0].colNames))
+	for _, row := range rows {
+		for i := range record {
+			record[i] = row.displayValue(i)
+		}
+		w.Write(record)
+	}
+	w.Flush()
+	return buf.String(), w.Error()
+}
+
+type CopyCmd struct{}
+
+func (cmd CopyCmd) Name() string {
+	return ".copy"
+}
+
+func (cmd CopyCmd) Description() string {
+	return "Copy the last result set, or the result of a query, to the clipboard as tab-separated values or CSV"
+}
+
+func (cmd CopyCmd) Usage() string {
+	return ".copy [-csv] [last|<sql>]"
+}
+
+func (cmd CopyCmd) Handle(args []string, resultWriter io.Writer) error {
+	comma, format := '\t', "tab-separated values"
+	if len(args) > 0 && args[0] == "-csv" {
+		comma, format = ',', "CSV"
+		args = args[1:]
+	}
+	rows := lastResult
+	if len(args) > 0 && args[0] != "last" {
+		db, err := requireDB()
+		if err != nil {
+			return err
+		}
+		query := strings.TrimSuffix(strings.TrimSpace(strings.Join(args, " ")), ";")
+		if isQ, err := isQuery(query); err != nil {
+			return fmt.Errorf("failed to parse SQL: %w", err)
+		} else if !isQ {
+			return fmt.Errorf("only the result of a query can be copied")
+		}
+		_, output, _, _, err := executeSQL(db, query, nil)
+		if err != nil {
+			return err
+		}
+		if len(output) == 0 {
+			return fmt.Errorf("the query returned no rows")
+		}
+		rows = output
+	} else if len(args) > 1 {
+		return fmt.Errorf("usage: %s", cmd.Usage())
+	}
+	if len(rows) == 0 {
+		return fmt.Errorf("no rows to copy, run a query first")
+	}
+
+	text, err := clipboardTable(rows, comma)
+	if err != nil {
+		return err
+	}
+	if err := copyToClipboard(text); err != nil {
+		return err
+	}
+	fmt.Fprintf(resultWriter, "Copied %d rows of %d columns to the clipboard as %s\n", len(rows), len(rows[0].colNames), format)
+	return nil
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"time"
+)
+
+// crashDumps enables the crash reports of reportCrash, see -crash-dump
+var crashDumps bool
+
+// runGuarded runs fn, the work of a command or statement of the REPL, so that a bug
+// in it is reported and the session carries on instead of crashing
+func runGuarded(what string, fn func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			reportCrash(what, r, debug.Stack())
+		}
+	}()
+	fn()
+}
+
+// reportCrash tells the user about a panic and saves the history right away in case
+// the session doesn't last. With -crash-dump it also writes a crash report next to
+// the history. The report holds the name of the command and the type of the panic
+// value, but not the value, the arguments or the statement, which may be confidential.
+func reportCrash(what string, r interface{}, stack []byte) {
+	// Leave the terminal usable, a pager or spinner may have been interrupted
+	fmt.Print("\033[?25h")
+	saveHistory()
+
+	log.Printf("Internal error while running %s: %v", what, r)
+	if !crashDumps {
+		log.Printf("This is a bug in tip, run tip with -crash-dump to write a report that helps fix it: https://github.com/c4pt0r/tip/issues")
+		return
+	}
+	path := filepath.Join(os.Getenv("HOME"), ".tip", fmt.Sprintf("crash-%s.txt", time.Now().Format("20060102-150405")))
+	report := fmt.Sprintf("tip %s, %s %s/%s\nwhile running %s\npanic: %T\n\n%s",
+		Version, runtime.Version(), runtime.GOOS, runtime.GOARCH, what, r, stack)
+	os.MkdirAll(filepath.Dir(path), 0700)
+	if err := os.WriteFile(path, []byte(report), 0600); err != nil {
+		log.Printf("Failed to write a crash report: %v", err)
+		return
+	}
+	log.Printf("This is a bug in tip, the report in %s helps fix it: https://github.com/c4pt0r/tip/issues", path)
+}
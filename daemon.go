@@ -0,0 +1,509 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/gob"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/pingcap/tidb/pkg/parser/ast"
+)
+
+// daemonKeepAlive is the interval at which the daemon pings its idle connections, so
+// that they are still open and authenticated when a statement comes
+const daemonKeepAlive = time.Minute
+
+// daemonDialTimeout bounds the time tip -e waits for the daemon before connecting itself
+const daemonDialTimeout = 200 * time.Millisecond
+
+func init() {
+	// Values scanned from the server that gob doesn't know
+	gob.Register(time.Time{})
+}
+
+func daemonSocketPath() string {
+	return filepath.Join(os.Getenv("HOME"), ".tip/daemon.sock")
+}
+
+// daemonRequest is sent by tip -e to the daemon, with the statements of -e. Key
+// identifies the connection settings of the client, the daemon runs the statements only
+// if it is connected with the same ones.
+type daemonRequest struct {
+	Key    string
+	Stmts  []string
+	Params []string
+	Stop   bool // stop the daemon instead
+	Status bool // describe the daemon instead
+}
+
+// daemonResult is the outcome of a statement run by the daemon
+type daemonResult struct {
+	IsQuery      bool
+	Columns      []string
+	Types        []string
+	Rows         [][]interface{}
+	HasRows      bool
+	AffectedRows int64
+	Duration     time.Duration
+}
+
+type daemonResponse struct {
+	Results  []daemonResult
+	Error    string // error of the statement after the last result
+	Mismatch bool   // the daemon is connected with other settings
+	Status   string
+}
+
+// connKey identifies connection settings without holding the password
+func connKey(info ConnInfo) string {
+	info.Session = false
+	data, _ := json.Marshal(info)
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// daemonConn is a warm connection of the daemon with the statements prepared on it
+type daemonConn struct {
+	conn  *sql.Conn
+	stmts map[string]*sql.Stmt
+}
+
+// tipDaemon holds warm connections and runs the statements of tip -e on them
+type tipDaemon struct {
+	db       *sql.DB
+	info     ConnInfo
+	key      string
+	conns    chan *daemonConn
+	served   atomic.Int64
+	started  time.Time
+	lastUsed atomic.Int64 // unix time of the last request
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+func runDaemon(args []string) int {
+	if len(args) > 0 && (args[0] == "stop" || args[0] == "status") {
+		resp, err := callDaemon(daemonRequest{Stop: args[0] == "stop", Status: args[0] == "status"})
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "tip daemon is not running")
+			return 1
+		}
+		fmt.Println(resp.Status)
+		return 0
+	}
+	fs := flag.NewFlagSet("tip daemon", flag.ExitOnError)
+	cf := registerConnFlags(fs)
+	pool := fs.Int("pool", 4, "Number of warm connections, and of tip -e invocations served at the same time")
+	idleTimeout := fs.Duration("idle-timeout", 30*time.Minute, "Exit after this long without requests, 0 to keep running")
+	if err := cf.parse(fs, args); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if *pool < 1 {
+		fmt.Fprintln(os.Stderr, "usage: tip daemon [connection flags] [-pool 4] [-idle-timeout 30m] | tip daemon stop|status")
+		return 2
+	}
+
+	globalConfigFile, globalProfile = *cf.configFile, *cf.profile
+	info, err := cf.connInfo()
+	if err != nil {
+		log.Println(err)
+		return 1
+	}
+	if info.ReadHost != "" {
+		log.Println("tip daemon doesn't route reads to a read endpoint, run it without -read-host")
+		return 2
+	}
+	if _, err := callDaemon(daemonRequest{Status: true}); err == nil {
+		log.Printf("tip daemon is already running on %s, stop it with tip daemon stop", daemonSocketPath())
+		return 1
+	}
+
+	db, err := openDatabase(info)
+	if err != nil {
+		log.Println(err)
+		return 1
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(*pool)
+	db.SetMaxIdleConns(*pool)
+	queryComment = info.QueryComment
+
+	d := &tipDaemon{db: db, info: info, key: connKey(info), conns: make(chan *daemonConn, *pool), started: time.Now(), stop: make(chan struct{})}
+	d.lastUsed.Store(time.Now().Unix())
+	for i := 0; i < *pool; i++ {
+		conn, err := d.openConn()
+		if err != nil {
+			log.Println(err)
+			return 1
+		}
+		d.conns <- conn
+	}
+
+	path := daemonSocketPath()
+	os.Remove(path) // Left by a daemon that didn't exit cleanly, no daemon answered on it
+	// Only the user can talk to the connections of the daemon. The socket is created
+	// with the permissions of the umask, so it goes in a directory only the user can
+	// enter, rather than being restricted once others could already connect.
+	if err := privateDir(filepath.Dir(path)); err != nil {
+		log.Println(err)
+		return 1
+	}
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		log.Printf("Failed to listen on %s: %v", path, err)
+		return 1
+	}
+	defer os.Remove(path)
+	if err := os.Chmod(path, 0600); err != nil {
+		log.Println(err)
+		return 1
+	}
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
+	defer signal.Stop(sigs)
+	go func() {
+		select {
+		case <-sigs:
+		case <-d.stop:
+		}
+		listener.Close()
+	}()
+	go d.keepAlive(*idleTimeout)
+
+	log.Printf("tip daemon serving %s@%s with %d connections on %s", info.User, info.Host, *pool, path)
+	for {
+		c, err := listener.Accept()
+		if err != nil {
+			break
+		}
+		go d.serve(c)
+	}
+	log.Println("tip daemon stopped")
+	return 0
+}
+
+// privateDir creates dir, or restricts it, so that only the user can enter it
+func privateDir(dir string) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	if err := os.Chmod(dir, 0700); err != nil {
+		return err
+	}
+	fi, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+	if fi.Mode().Perm()&0077 != 0 {
+		return fmt.Errorf("%s can be entered by other users (mode %v), the daemon socket can't be protected", dir, fi.Mode().Perm())
+	}
+	return nil
+}
+
+// openConn opens a connection and runs the init_sql statements of the profile on it,
+// as connecting does
+func (d *tipDaemon) openConn() (*daemonConn, error) {
+	conn, err := d.db.Conn(context.Background())
+	if err != nil {
+		return nil, fmt.Errorf("failed to open a connection: %w", err)
+	}
+	if d.info.InitSQL != "" {
+		stmts, err := splitStatements(d.info.InitSQL)
+		if err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed to parse init_sql: %w", err)
+		}
+		for _, stmt := range stmts {
+			if _, err := conn.ExecContext(context.Background(), stmt); err != nil {
+				log.Printf("init_sql: %s: %v", stmt, err)
+			}
+		}
+	}
+	return &daemonConn{conn: conn, stmts: map[string]*sql.Stmt{}}, nil
+}
+
+// discard closes a connection whose session was changed or broken, and opens another
+// one in its place
+func (d *tipDaemon) discard(c *daemonConn) {
+	// Returning ErrBadConn makes database/sql close the connection instead of pooling it
+	c.conn.Raw(func(interface{}) error { return driver.ErrBadConn })
+	c.conn.Close()
+	for {
+		conn, err := d.openConn()
+		if err == nil {
+			d.conns <- conn
+			return
+		}
+		log.Println(err)
+		select {
+		case <-d.stop:
+			return
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// keepAlive pings the idle connections, replacing the ones that were closed, and stops
+// the daemon once it has been idle for idleTimeout
+func (d *tipDaemon) keepAlive(idleTimeout time.Duration) {
+	ticker := time.NewTicker(daemonKeepAlive)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-d.stop:
+			return
+		case <-ticker.C:
+		}
+		if idleTimeout > 0 && time.Since(time.Unix(d.lastUsed.Load(), 0)) > idleTimeout {
+			log.Printf("No requests for %s, exiting", idleTimeout)
+			d.stopOnce.Do(func() { close(d.stop) })
+			return
+		}
+		for i := len(d.conns); i > 0; i-- {
+			var c *daemonConn
+			select {
+			case c = <-d.conns:
+			default:
+				continue
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			err := c.conn.PingContext(ctx)
+			cancel()
+			if err != nil {
+				debugLog.Debug("daemon connection lost", "error", err)
+				d.discard(c)
+			} else {
+				d.conns <- c
+			}
+		}
+	}
+}
+
+func (d *tipDaemon) serve(c net.Conn) {
+	defer c.Close()
+	var req daemonRequest
+	if err := gob.NewDecoder(c).Decode(&req); err != nil {
+		return
+	}
+	var resp daemonResponse
+	switch {
+	case req.Stop:
+		resp.Status = "tip daemon stopped"
+		d.stopOnce.Do(func() { close(d.stop) })
+	case req.Status:
+		resp.Status = fmt.Sprintf("tip daemon serving %s@%s:%s, %d connections, %d requests since %s",
+			d.info.User, d.info.Host, d.info.Port, cap(d.conns), d.served.Load(), d.started.Format(time.DateTime))
+	case req.Key != d.key:
+		resp.Mismatch = true
+	default:
+		d.lastUsed.Store(time.Now().Unix())
+		d.served.Add(1)
+		conn := <-d.conns
+		var dirty bool
+		resp, dirty = d.run(conn, req)
+		if dirty {
+			defer d.discard(conn)
+		} else {
+			defer func() { d.conns <- conn }()
+		}
+	}
+	gob.NewEncoder(c).Encode(resp)
+}
+
+// run runs the statements of a request on a connection. It reports whether the session
+// may differ from a new one afterwards, e.g. after SET or USE or a failed statement, as
+// the next request must not see it.
+func (d *tipDaemon) run(c *daemonConn, req daemonRequest) (daemonResponse, bool) {
+	var resp daemonResponse
+	ctx := context.Background()
+	args := make([]interface{}, len(req.Params))
+	for i, param := range req.Params {
+		args[i] = param
+	}
+	dirty := false
+	for _, stmt := range req.Stmts {
+		nodes, _, err := p.Parse(stmt, "", "")
+		if err != nil {
+			resp.Error = fmt.Sprintf("failed to parse SQL: %v", err)
+			return resp, dirty
+		}
+		for _, node := range nodes {
+			if changesSession(node) {
+				dirty = true
+			}
+		}
+		isQ := len(nodes) == 1 && isQueryStmt(nodes[0])
+		query := withQueryComment(stmt)
+		start := time.Now()
+		result := daemonResult{IsQuery: isQ}
+		if isQ {
+			var rows *sql.Rows
+			if len(args) > 0 {
+				var prepared *sql.Stmt
+				if prepared, err = c.prepare(ctx, query); err == nil {
+					rows, err = prepared.QueryContext(ctx, args...)
+				}
+			} else {
+				rows, err = c.conn.QueryContext(ctx, query)
+			}
+			if err != nil {
+				resp.Error = fmt.Sprintf("failed to execute SQL: %v", err)
+				return resp, true
+			}
+			// The columns are sent for an empty result too, the JSON envelope has them
+			if result.Columns, result.Types, err = columnsOf(rows); err != nil {
+				rows.Close()
+				resp.Error = err.Error()
+				return resp, true
+			}
+			output, hasRows, err := scanRows(rows, nil, false)
+			rows.Close()
+			if err != nil {
+				resp.Error = err.Error()
+				return resp, true
+			}
+			result.HasRows = hasRows
+			for _, row := range output {
+				result.Rows = append(result.Rows, row.colValues)
+			}
+		} else {
+			var res sql.Result
+			if len(args) > 0 {
+				var prepared *sql.Stmt
+				if prepared, err = c.prepare(ctx, query); err == nil {
+					res, err = prepared.ExecContext(ctx, args...)
+				}
+			} else {
+				res, err = c.conn.ExecContext(ctx, query)
+			}
+			if err != nil {
+				resp.Error = fmt.Sprintf("failed to execute SQL: %v", err)
+				return resp, true
+			}
+			result.AffectedRows, _ = res.RowsAffected()
+		}
+		result.Duration = time.Since(start)
+		resp.Results = append(resp.Results, result)
+	}
+	return resp, dirty
+}
+
+// columnsOf returns the names and database type names of the columns of rows
+func columnsOf(rows *sql.Rows) ([]string, []string, error) {
+	cols, err := rows.Columns()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get column info: %w", err)
+	}
+	colTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get column info: %w", err)
+	}
+	typeNames := make([]string, len(colTypes))
+	for i, ct := range colTypes {
+		typeNames[i] = ct.DatabaseTypeName()
+	}
+	return cols, typeNames, nil
+}
+
+// prepare returns the statement prepared on the connection for query, preparing it the
+// first time it is run
+func (c *daemonConn) prepare(ctx context.Context, query string) (*sql.Stmt, error) {
+	if stmt, ok := c.stmts[query]; ok {
+		return stmt, nil
+	}
+	stmt, err := c.conn.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	c.stmts[query] = stmt
+	return stmt, nil
+}
+
+// changesSession reports whether a statement leaves state in the session that a new one
+// wouldn't have: variables, the current database, a transaction, temporary tables or locks
+func changesSession(node ast.StmtNode) bool {
+	switch stmt := node.(type) {
+	case *ast.SetStmt, *ast.UseStmt, *ast.BeginStmt, *ast.SetRoleStmt, *ast.SetDefaultRoleStmt,
+		*ast.PrepareStmt, *ast.LockTablesStmt, *ast.SetResourceGroupStmt:
+		return true
+	case *ast.CreateTableStmt:
+		return stmt.TemporaryKeyword != ast.TemporaryNone
+	}
+	return false
+}
+
+func callDaemon(req daemonRequest) (daemonResponse, error) {
+	var resp daemonResponse
+	path := daemonSocketPath()
+	if _, err := os.Stat(path); err != nil {
+		return resp, err
+	}
+	c, err := net.DialTimeout("unix", path, daemonDialTimeout)
+	if err != nil {
+		return resp, err
+	}
+	defer c.Close()
+	if err := gob.NewEncoder(c).Encode(req); err != nil {
+		return resp, err
+	}
+	err = gob.NewDecoder(c).Decode(&resp)
+	return resp, err
+}
+
+// runViaDaemon runs the statements of tip -e on the connections of a running tip daemon
+// and prints their results. It reports false when there is no daemon, or one connected
+// with other settings, and tip has to connect itself.
+func runViaDaemon(info ConnInfo, query string, format OutputFormat, params []string) (int, bool) {
+	stmts, err := splitStatements(query)
+	if err != nil || (len(params) > 0 && len(stmts) != 1) {
+		// Reported the usual way
+		return 0, false
+	}
+	resp, err := callDaemon(daemonRequest{Key: connKey(info), Stmts: stmts, Params: params})
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			debugLog.Debug("tip daemon unavailable", "error", err)
+		}
+		return 0, false
+	}
+	if resp.Mismatch {
+		debugLog.Debug("tip daemon is connected with other settings")
+		return 0, false
+	}
+	for _, result := range resp.Results {
+		var output []RowResult
+		for _, values := range result.Rows {
+			output = append(output, RowResult{colNames: result.Columns, colValues: values, colTypes: result.Types})
+		}
+		if format == JSON && jsonEnvelope {
+			// The envelope has the columns of an empty result too
+			if err := writeJSONEnvelope(replOut, output, result.Columns, result.Types, result.IsQuery, result.Duration, result.AffectedRows); err != nil {
+				log.Printf("Failed to write results: %v", err)
+			}
+			continue
+		}
+		printResults(result.IsQuery, output, format, result.HasRows, result.Duration, result.AffectedRows)
+	}
+	if resp.Error != "" {
+		log.Printf("Failed to execute SQL: %s", resp.Error)
+		return 1, true
+	}
+	return 0, true
+}
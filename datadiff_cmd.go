@@ -0,0 +1,400 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+type DataDiffCmd struct{}
+
+func (cmd DataDiffCmd) Name() string {
+	return ".datadiff"
+}
+
+func (cmd DataDiffCmd) Description() string {
+	return "Compare the rows of a table with another cluster or a past snapshot by checksums of primary key ranges, and list the rows that differ"
+}
+
+func (cmd DataDiffCmd) Usage() string {
+	return ".datadiff <table> --against profile:<name>|snapshot:<time> [--chunk n] [--limit n] [--where <condition>]"
+}
+
+// diffSide is a table as read on one side of a comparison
+type diffSide struct {
+	conn  *sql.Conn
+	table string // quoted name of the table
+}
+
+// diffRow is a row of a chunk, by its primary key
+type diffRow struct {
+	key      []string
+	checksum int64
+}
+
+// diffResult is a row that is not the same on both sides
+type diffResult struct {
+	key  []string
+	kind string
+}
+
+func (cmd DataDiffCmd) Handle(args []string, resultWriter io.Writer) error {
+	if len(args) < 1 || strings.HasPrefix(args[0], "-") {
+		return fmt.Errorf("usage: %s", cmd.Usage())
+	}
+	table := args[0]
+	args = args[1:]
+
+	// Like .dump, --where takes the rest of the line
+	where := "1"
+	for i, arg := range args {
+		if arg == "--where" || arg == "-where" {
+			where = strings.Join(args[i+1:], " ")
+			args = args[:i]
+			if where == "" {
+				return fmt.Errorf("usage: %s", cmd.Usage())
+			}
+			break
+		}
+	}
+
+	fs := flag.NewFlagSet(cmd.Name(), flag.ContinueOnError)
+	fs.SetOutput(resultWriter)
+	against := fs.String("against", "", "profile:<name> to compare with the cluster of a profile, snapshot:<time> with the data as it was, e.g. snapshot:-1h")
+	chunkSize := fs.Int("chunk", 10000, "Rows per checksummed range of primary keys")
+	limit := fs.Int("limit", 100, "Number of differing rows to list")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	kind, target, _ := strings.Cut(*against, ":")
+	if fs.NArg() > 0 || target == "" || (kind != "profile" && kind != "snapshot") || *chunkSize < 1 || *limit < 0 {
+		return fmt.Errorf("usage: %s", cmd.Usage())
+	}
+	db, err := requireDB()
+	if err != nil {
+		return err
+	}
+	startTime := time.Now()
+	ctx := context.Background()
+
+	// The other side is a connection of its own, the session has a single one
+	var otherDB *sql.DB
+	var tso uint64
+	if kind == "profile" {
+		config, err := loadProfile(globalConfigFile, target)
+		if err != nil {
+			return err
+		}
+		otherDB, err = openDatabase(connInfoFromConfig(config))
+		if err != nil {
+			return err
+		}
+	} else {
+		if activeConnInfo == nil {
+			return fmt.Errorf("not connected")
+		}
+		if tso, err = resolveSnapshotTSO(db, target); err != nil {
+			return err
+		}
+		if otherDB, err = openDatabase(*activeConnInfo); err != nil {
+			return err
+		}
+	}
+	defer otherDB.Close()
+
+	var curDB sql.NullString
+	if err := db.QueryRow("SELECT DATABASE()").Scan(&curDB); err != nil {
+		return err
+	}
+	dbName, _ := schemaOf(table).(string)
+	if dbName == "" {
+		if !curDB.Valid {
+			return fmt.Errorf("no database selected, use <db>.<table>")
+		}
+		dbName = curDB.String
+	}
+	quoted := quoteName(dbName) + "." + quoteName(nameOf(table))
+
+	pk, cols, err := loadDiffColumns(db, dbName, nameOf(table))
+	if err != nil {
+		return err
+	}
+
+	source, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+	other, err := otherDB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer other.Close()
+	if tso != 0 {
+		if _, err := other.ExecContext(ctx, fmt.Sprintf("SET @@SESSION.tidb_snapshot = '%d'", tso)); err != nil {
+			return fmt.Errorf("failed to read at the snapshot: %v", err)
+		}
+	}
+	local, remote := diffSide{source, quoted}, diffSide{other, quoted}
+
+	d := &dataDiff{pk: pk, checksum: rowChecksumExpr(cols), where: where}
+	var diffs []diffResult
+	var chunks, mismatched int
+	var rows int64
+	var lower []string
+	for {
+		upper, err := d.nextBoundary(ctx, local, lower, *chunkSize)
+		if err != nil {
+			return err
+		}
+		chunks++
+		n, sum, err := d.chunkChecksum(ctx, local, lower, upper)
+		if err != nil {
+			return err
+		}
+		otherN, otherSum, err := d.chunkChecksum(ctx, remote, lower, upper)
+		if err != nil {
+			return fmt.Errorf("failed to read %s on the other side: %v", quoted, err)
+		}
+		rows += n
+		if n != otherN || sum != otherSum {
+			mismatched++
+			found, err := d.diffChunk(ctx, local, remote, lower, upper)
+			if err != nil {
+				return err
+			}
+			diffs = append(diffs, found...)
+		}
+		if upper == nil {
+			break
+		}
+		lower = upper
+	}
+
+	counts := map[string]int{}
+	for _, r := range diffs {
+		counts[r.kind]++
+	}
+	if len(diffs) > 0 && *limit > 0 {
+		cols := append(append([]string{}, pk...), "Difference")
+		var output []RowResult
+		for _, r := range diffs[:min(len(diffs), *limit)] {
+			values := make([]interface{}, 0, len(cols))
+			for _, v := range r.key {
+				values = append(values, v)
+			}
+			output = append(output, RowResult{colNames: cols, colValues: append(values, r.kind)})
+		}
+		printResults(true, output, *globalOutputFormat, true, time.Since(startTime), 0)
+		if len(diffs) > *limit {
+			fmt.Fprintf(resultWriter, "showing first %d differences (use --limit)\n", *limit)
+		}
+	}
+	fmt.Fprintf(resultWriter, "Compared %d rows in %d ranges, %d ranges differ: %d rows differ, %d only here, %d only in %s\n",
+		rows, chunks, mismatched, counts["differs"], counts["only here"], counts["only there"], *against)
+	return nil
+}
+
+// loadDiffColumns returns the primary key and the columns of a table, rows are matched
+// on the primary key as row ids differ between clusters
+func loadDiffColumns(db *sql.DB, dbName, table string) ([]string, []string, error) {
+	var pk, cols []string
+	rows, err := db.Query("SELECT COLUMN_NAME FROM INFORMATION_SCHEMA.COLUMNS "+
+		"WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ? ORDER BY ORDINAL_POSITION", dbName, table)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, nil, err
+		}
+		cols = append(cols, name)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, nil, err
+	}
+	if len(cols) == 0 {
+		return nil, nil, fmt.Errorf("table %s.%s doesn't exist", dbName, table)
+	}
+
+	// The key columns in the order of the key, not of the table
+	keyRows, err := db.Query("SELECT COLUMN_NAME FROM INFORMATION_SCHEMA.KEY_COLUMN_USAGE "+
+		"WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ? AND CONSTRAINT_NAME = 'PRIMARY' ORDER BY ORDINAL_POSITION", dbName, table)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer keyRows.Close()
+	for keyRows.Next() {
+		var name string
+		if err := keyRows.Scan(&name); err != nil {
+			return nil, nil, err
+		}
+		pk = append(pk, name)
+	}
+	if err := keyRows.Err(); err != nil {
+		return nil, nil, err
+	}
+	if len(pk) == 0 {
+		return nil, nil, fmt.Errorf("table %s.%s has no primary key to match rows on", dbName, table)
+	}
+	return pk, cols, nil
+}
+
+// rowChecksumExpr returns the SQL expression of the checksum of a row. NULL and the
+// empty string are told apart by the ISNULL flags.
+func rowChecksumExpr(cols []string) string {
+	values := make([]string, len(cols))
+	nulls := make([]string, len(cols))
+	for i, col := range cols {
+		values[i] = quoteName(col)
+		nulls[i] = "ISNULL(" + quoteName(col) + ")"
+	}
+	return fmt.Sprintf("CRC32(CONCAT_WS(',', %s, CONCAT(%s)))", strings.Join(values, ", "), strings.Join(nulls, ", "))
+}
+
+// dataDiff compares the rows of a table, a range of primary keys at a time
+type dataDiff struct {
+	pk       []string
+	checksum string
+	where    string
+}
+
+// keyRange returns the condition selecting the keys in (lower, upper], either bound
+// is left out when nil
+func (d *dataDiff) keyRange(lower, upper []string) (string, []interface{}) {
+	quoted := make([]string, len(d.pk))
+	marks := make([]string, len(d.pk))
+	for i, col := range d.pk {
+		quoted[i] = quoteName(col)
+		marks[i] = "?"
+	}
+	key, tuple := quoted[0], "?"
+	if len(d.pk) > 1 {
+		key, tuple = "("+strings.Join(quoted, ", ")+")", "("+strings.Join(marks, ", ")+")"
+	}
+	cond := "(" + d.where + ")"
+	var args []interface{}
+	if lower != nil {
+		cond += " AND " + key + " > " + tuple
+		for _, v := range lower {
+			args = append(args, v)
+		}
+	}
+	if upper != nil {
+		cond += " AND " + key + " <= " + tuple
+		for _, v := range upper {
+			args = append(args, v)
+		}
+	}
+	return cond, args
+}
+
+func (d *dataDiff) orderBy() string {
+	quoted := make([]string, len(d.pk))
+	for i, col := range d.pk {
+		quoted[i] = quoteName(col)
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// nextBoundary returns the key ending the range after lower, nil for the last range
+func (d *dataDiff) nextBoundary(ctx context.Context, side diffSide, lower []string, chunkSize int) ([]string, error) {
+	cond, args := d.keyRange(lower, nil)
+	key := make([]sql.NullString, len(d.pk))
+	dest := make([]interface{}, len(key))
+	for i := range key {
+		dest[i] = &key[i]
+	}
+	err := side.conn.QueryRowContext(ctx, fmt.Sprintf("SELECT %s FROM %s WHERE %s ORDER BY %s LIMIT 1 OFFSET %d",
+		d.orderBy(), side.table, cond, d.orderBy(), chunkSize-1), args...).Scan(dest...)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to split %s: %v", side.table, err)
+	}
+	values := make([]string, len(key))
+	for i, v := range key {
+		values[i] = v.String
+	}
+	return values, nil
+}
+
+// chunkChecksum returns the number of rows of a range and the XOR of their checksums
+func (d *dataDiff) chunkChecksum(ctx context.Context, side diffSide, lower, upper []string) (int64, int64, error) {
+	cond, args := d.keyRange(lower, upper)
+	var n, sum int64
+	err := side.conn.QueryRowContext(ctx, fmt.Sprintf("SELECT COUNT(*), IFNULL(BIT_XOR(%s), 0) FROM %s WHERE %s",
+		d.checksum, side.table, cond), args...).Scan(&n, &sum)
+	return n, sum, err
+}
+
+// chunkRows returns the keys and checksums of the rows of a range
+func (d *dataDiff) chunkRows(ctx context.Context, side diffSide, lower, upper []string) ([]diffRow, error) {
+	cond, args := d.keyRange(lower, upper)
+	rows, err := side.conn.QueryContext(ctx, fmt.Sprintf("SELECT %s, %s FROM %s WHERE %s ORDER BY %s",
+		d.orderBy(), d.checksum, side.table, cond, d.orderBy()), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var result []diffRow
+	key := make([]sql.NullString, len(d.pk))
+	var checksum int64
+	dest := make([]interface{}, len(key)+1)
+	for i := range key {
+		dest[i] = &key[i]
+	}
+	dest[len(key)] = &checksum
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		values := make([]string, len(key))
+		for i, v := range key {
+			values[i] = v.String
+		}
+		result = append(result, diffRow{values, checksum})
+	}
+	return result, rows.Err()
+}
+
+// diffChunk compares the rows of a range whose checksums differ, one by one
+func (d *dataDiff) diffChunk(ctx context.Context, local, remote diffSide, lower, upper []string) ([]diffResult, error) {
+	here, err := d.chunkRows(ctx, local, lower, upper)
+	if err != nil {
+		return nil, err
+	}
+	there, err := d.chunkRows(ctx, remote, lower, upper)
+	if err != nil {
+		return nil, err
+	}
+	others := make(map[string]int64, len(there))
+	for _, r := range there {
+		others[strings.Join(r.key, "\x00")] = r.checksum
+	}
+	var diffs []diffResult
+	for _, r := range here {
+		k := strings.Join(r.key, "\x00")
+		checksum, ok := others[k]
+		switch {
+		case !ok:
+			diffs = append(diffs, diffResult{r.key, "only here"})
+		case checksum != r.checksum:
+			diffs = append(diffs, diffResult{r.key, "differs"})
+		}
+		delete(others, k)
+	}
+	for _, r := range there {
+		if _, ok := others[strings.Join(r.key, "\x00")]; ok {
+			diffs = append(diffs, diffResult{r.key, "only there"})
+		}
+	}
+	return diffs, nil
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/fatih/color"
+)
+
+type DeadlocksCmd struct{}
+
+func (cmd DeadlocksCmd) Name() string {
+	return ".deadlocks"
+}
+
+func (cmd DeadlocksCmd) Description() string {
+	return "Show recent deadlocks with the transactions, keys and statements involved"
+}
+
+func (cmd DeadlocksCmd) Usage() string {
+	return ".deadlocks [cluster]"
+}
+
+// deadlockEdge is one row of INFORMATION_SCHEMA.DEADLOCKS: a transaction
+// waiting for a key locked by another transaction
+type deadlockEdge struct {
+	instance   string
+	id         int64
+	occurTime  string
+	retryable  bool
+	waiterTxn  uint64
+	digest     string
+	digestText string
+	key        string
+	keyInfo    string
+	holderTxn  uint64
+}
+
+func (cmd DeadlocksCmd) Handle(args []string, resultWriter io.Writer) error {
+	db, err := requireDB()
+	if err != nil {
+		return err
+	}
+
+	table := "INFORMATION_SCHEMA.DEADLOCKS"
+	instanceCol := "''"
+	if len(args) > 0 {
+		if args[0] != "cluster" {
+			return fmt.Errorf("usage: %s", cmd.Usage())
+		}
+		table = "INFORMATION_SCHEMA.CLUSTER_DEADLOCKS"
+		instanceCol = "INSTANCE"
+	}
+
+	rows, err := db.Query(fmt.Sprintf(`SELECT %s, DEADLOCK_ID, OCCUR_TIME, RETRYABLE, TRY_LOCK_TRX_ID,
+		IFNULL(CURRENT_SQL_DIGEST, ''), IFNULL(CURRENT_SQL_DIGEST_TEXT, ''), IFNULL(`+"`KEY`"+`, ''),
+		IFNULL(KEY_INFO, ''), TRX_HOLDING_LOCK
+		FROM %s ORDER BY OCCUR_TIME, DEADLOCK_ID`, instanceCol, table))
+	if err != nil {
+		return fmt.Errorf("failed to query deadlocks: %v", err)
+	}
+	defer rows.Close()
+
+	var edges []deadlockEdge
+	for rows.Next() {
+		var e deadlockEdge
+		if err := rows.Scan(&e.instance, &e.id, &e.occurTime, &e.retryable, &e.waiterTxn,
+			&e.digest, &e.digestText, &e.key, &e.keyInfo, &e.holderTxn); err != nil {
+			return fmt.Errorf("failed to read deadlocks: %v", err)
+		}
+		edges = append(edges, e)
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read deadlocks: %v", err)
+	}
+
+	if len(edges) == 0 {
+		resultWriter.Write([]byte("No deadlocks recorded.\n"))
+		return nil
+	}
+
+	bold := color.New(color.Bold).SprintFunc()
+	grey := color.New(color.FgHiBlack).SprintFunc()
+	red := color.New(color.FgRed).SprintFunc()
+
+	for i := 0; i < len(edges); {
+		// Rows of the same deadlock are adjacent, together they form the wait-for cycle
+		j := i
+		for j < len(edges) && edges[j].id == edges[i].id && edges[j].instance == edges[i].instance {
+			j++
+		}
+		first := edges[i]
+		header := fmt.Sprintf("Deadlock #%d at %s", first.id, first.occurTime)
+		if first.instance != "" {
+			header += " on " + first.instance
+		}
+		if first.retryable {
+			header += " (retryable)"
+		}
+		fmt.Fprintln(resultWriter, bold(header))
+		for _, e := range edges[i:j] {
+			fmt.Fprintf(resultWriter, "  txn %d %s txn %d on %s\n", e.waiterTxn, red("waits for"), e.holderTxn, formatDeadlockKey(e))
+			text := e.digestText
+			if text == "" && e.digest != "" {
+				text = decodeSQLDigest(db, e.digest)
+			}
+			if text != "" {
+				fmt.Fprintf(resultWriter, "    %s %s\n", grey("sql:"), text)
+			} else if e.digest != "" {
+				fmt.Fprintf(resultWriter, "    %s %s\n", grey("digest:"), e.digest)
+			}
+		}
+		fmt.Fprintln(resultWriter)
+		i = j
+	}
+	return nil
+}
+
+// formatDeadlockKey renders a human readable description of the locked key from
+// KEY_INFO, falling back to the raw hex key
+func formatDeadlockKey(e deadlockEdge) string {
+	var info map[string]interface{}
+	if e.keyInfo == "" || json.Unmarshal([]byte(e.keyInfo), &info) != nil {
+		return "key " + e.key
+	}
+	var parts []string
+	name := fmt.Sprint(info["table_name"])
+	if dbName, ok := info["db_name"]; ok {
+		name = fmt.Sprintf("%v.%s", dbName, name)
+	}
+	parts = append(parts, name)
+	if idx, ok := info["index_name"]; ok {
+		parts = append(parts, fmt.Sprintf("index %v %v", idx, info["index_values"]))
+	}
+	if handle, ok := info["handle_value"]; ok {
+		parts = append(parts, fmt.Sprintf("handle %v", handle))
+	}
+	return strings.Join(parts, " ")
+}
+
+// decodeSQLDigest resolves a SQL digest to its normalized text using the
+// statement history kept by TiDB, returning "" if it is no longer available
+func decodeSQLDigest(db *sql.DB, digest string) string {
+	var decoded sql.NullString
+	if err := db.QueryRow("SELECT tidb_decode_sql_digests(JSON_ARRAY(?))", digest).Scan(&decoded); err != nil || !decoded.Valid {
+		return ""
+	}
+	var texts []*string
+	if err := json.Unmarshal([]byte(decoded.String), &texts); err != nil || len(texts) == 0 || texts[0] == nil {
+		return ""
+	}
+	return *texts[0]
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"io"
+	"log"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/pingcap/tidb/pkg/parser/ast"
+)
+
+// debugLog records what tip does for troubleshooting, see -debug. Until it is enabled
+// it drops debug records without formatting them.
+var debugLog = slog.New(slog.NewTextHandler(io.Discard, nil))
+
+// defaultDebugLogPath returns the file -debug writes to unless -debug-file is given
+func defaultDebugLogPath() string {
+	return filepath.Join(os.Getenv("HOME"), ".tip/debug.log")
+}
+
+// enableDebugLog appends debug records to the file at path. The messages printed on
+// stderr go to the file as well, so that it tells the whole story, with the password
+// literals they quote masked.
+func enableDebugLog(path string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	// Errors of the server may quote the statement, including its password
+	w := maskingWriter{f}
+	debugLog = slog.New(slog.NewTextHandler(w, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	log.SetOutput(io.MultiWriter(os.Stderr, w))
+	// The command line is left out, it may hold the password
+	debugLog.Info("debug log started", "version", Version)
+	return nil
+}
+
+// debugEnabled reports whether debug records are kept, to skip work done only for them
+func debugEnabled() bool {
+	return debugLog.Enabled(context.Background(), slog.LevelDebug)
+}
+
+// redactedDSN returns the DSN of cfg with the password masked
+func redactedDSN(cfg *mysql.Config) string {
+	cfg = cfg.Clone()
+	if cfg.Passwd != "" {
+		cfg.Passwd = "********"
+	}
+	return cfg.FormatDSN()
+}
+
+// loggableSQL returns query as it may be written to the debug log, with the passwords
+// of statements such as CREATE USER masked
+func loggableSQL(query string) string {
+	stmtNodes, _, err := p.Parse(query, "", "")
+	if err != nil {
+		return maskPasswords(query)
+	}
+	secure := make([]string, len(stmtNodes))
+	var masked bool
+	for i, stmt := range stmtNodes {
+		secure[i] = stmt.Text()
+		if sensitive, ok := stmt.(ast.SensitiveStmtNode); ok {
+			secure[i], masked = sensitive.SecureText(), true
+		}
+	}
+	if !masked {
+		return query
+	}
+	return strings.Join(secure, "; ")
+}
+
+// passwordLiteral matches the string literal following IDENTIFIED BY, PASSWORD(
+// or PASSWORD = in a statement, or in an error message quoting one
+var passwordLiteral = regexp.MustCompile(`(?i)((?:identified(?:\s+with\s+\S+)?\s+(?:by|as)(?:\s+password)?|password\s*\(|password(?:\s+for\s+\S+)?\s*=)\s*)('(?:[^'\\]|\\.|'')*'|"(?:[^"\\]|\\.|"")*")`)
+
+// maskPasswords masks the password literals of text the parser can't make sense
+// of, such as a statement with a syntax error or the error message of the server
+func maskPasswords(text string) string {
+	return passwordLiteral.ReplaceAllString(text, "${1}'********'")
+}
+
+// maskingWriter masks the password literals of what is written to w
+type maskingWriter struct {
+	w io.Writer
+}
+
+func (m maskingWriter) Write(b []byte) (int, error) {
+	if _, err := io.WriteString(m.w, maskPasswords(string(b))); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// logTLSSession records the TLS version and cipher a connection negotiated
+func logTLSSession(db *sql.DB) {
+	if !debugEnabled() {
+		return
+	}
+	var name, version, cipher string
+	db.QueryRow("SHOW STATUS LIKE 'Ssl_version'").Scan(&name, &version)
+	db.QueryRow("SHOW STATUS LIKE 'Ssl_cipher'").Scan(&name, &cipher)
+	if cipher == "" {
+		debugLog.Debug("connection is not encrypted")
+		return
+	}
+	debugLog.Debug("TLS negotiated", "version", version, "cipher", cipher)
+}
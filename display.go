@@ -0,0 +1,384 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// nullDisplay is how NULL is shown in the table, plain and CSV output, set with .set nullvalue.
+// JSON keeps null, spreadsheets an empty cell.
+var nullDisplay = "NULL"
+
+// binaryDisplay is how binary values are shown in every output format: hex, base64 or
+// escape, set with .set binary
+var binaryDisplay = "escape"
+
+var binaryDisplayModes = []string{"hex", "base64", "escape"}
+
+// displayLocation is the time zone TIMESTAMP values are shown in, set with .set timezone;
+// nil shows them as the server sends them, in the time zone of the session,
+// sessionLocation. DATETIME values have no time zone and are never converted.
+var displayLocation, sessionLocation *time.Location
+
+// datetimeFormat is the DATE_FORMAT format DATETIME and TIMESTAMP values are shown with,
+// set with .set datetime; empty to show them as sent
+var datetimeFormat string
+
+// jsonDisplay is how JSON columns are shown in the table, plain and CSV output: compact,
+// as the server sends them, or pretty, indented over several lines
+var jsonDisplay = "compact"
+
+// isBinaryType reports whether a column of the type holds binary strings
+func isBinaryType(typeName string) bool {
+	switch typeName {
+	case "BINARY", "VARBINARY", "TINYBLOB", "BLOB", "MEDIUMBLOB", "LONGBLOB", "BIT", "GEOMETRY":
+		return true
+	}
+	return false
+}
+
+// colType returns the database type name of column i, empty when it is unknown
+func (r RowResult) colType(i int) string {
+	if r.colTypes == nil {
+		return ""
+	}
+	return r.colTypes[i]
+}
+
+// binaryValue returns the value of column i if it is binary: a value of a binary column,
+// or bytes that are not UTF-8 text
+func (r RowResult) binaryValue(i int) ([]byte, bool) {
+	b, ok := r.colValues[i].([]byte)
+	if !ok {
+		return nil, false
+	}
+	if isBinaryType(r.colType(i)) || !utf8.Valid(b) {
+		return b, true
+	}
+	return nil, false
+}
+
+// datetimeValue returns the value of column i in the format set with .set, if it is a
+// DATETIME or TIMESTAMP and either the format or the time zone is set. Only TIMESTAMP
+// values are converted to the time zone. Zero dates are left alone.
+func (r RowResult) datetimeValue(i int) (string, bool) {
+	if (displayLocation == nil && datetimeFormat == "") || r.colValues[i] == nil {
+		return "", false
+	}
+	if typeName := r.colType(i); typeName != "DATETIME" && typeName != "TIMESTAMP" {
+		return "", false
+	}
+	s := formatValue(r.colValues[i])
+	from := sessionLocation
+	if from == nil {
+		from = time.UTC
+	}
+	t, err := time.ParseInLocation("2006-01-02 15:04:05.999999", s, from)
+	if err != nil {
+		return "", false
+	}
+	if displayLocation != nil && r.colType(i) == "TIMESTAMP" {
+		t = t.In(displayLocation)
+	} else if datetimeFormat == "" {
+		return "", false
+	}
+	if datetimeFormat != "" {
+		return formatDatetime(t, datetimeFormat), true
+	}
+	// Keep the fractional digits sent
+	layout := "2006-01-02 15:04:05"
+	if dot := strings.IndexByte(s, '.'); dot >= 0 {
+		layout += "." + strings.Repeat("0", len(s)-dot-1)
+	}
+	return t.Format(layout), true
+}
+
+// displayValue renders column i of the row for the table, plain and CSV output
+func (r RowResult) displayValue(i int) string {
+	if r.colValues[i] == nil {
+		return nullDisplay
+	}
+	if b, ok := r.binaryValue(i); ok {
+		return displayBinary(b)
+	}
+	if s, ok := r.datetimeValue(i); ok {
+		return s
+	}
+	if jsonDisplay == "pretty" && r.colType(i) == "JSON" {
+		var buf bytes.Buffer
+		if json.Indent(&buf, []byte(formatValue(r.colValues[i])), "", "  ") == nil {
+			return buf.String()
+		}
+	}
+	return formatValue(r.colValues[i])
+}
+
+// formatDatetime formats t with the specifiers of MySQL's DATE_FORMAT, e.g. %Y-%m-%d %H:%i:%s
+func formatDatetime(t time.Time, format string) string {
+	hour12 := t.Hour() % 12
+	if hour12 == 0 {
+		hour12 = 12
+	}
+	var sb strings.Builder
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' || i+1 == len(format) {
+			sb.WriteByte(format[i])
+			continue
+		}
+		i++
+		switch format[i] {
+		case 'Y':
+			fmt.Fprintf(&sb, "%04d", t.Year())
+		case 'y':
+			fmt.Fprintf(&sb, "%02d", t.Year()%100)
+		case 'm':
+			fmt.Fprintf(&sb, "%02d", int(t.Month()))
+		case 'c':
+			fmt.Fprintf(&sb, "%d", int(t.Month()))
+		case 'M':
+			sb.WriteString(t.Month().String())
+		case 'b':
+			sb.WriteString(t.Month().String()[:3])
+		case 'd':
+			fmt.Fprintf(&sb, "%02d", t.Day())
+		case 'e':
+			fmt.Fprintf(&sb, "%d", t.Day())
+		case 'j':
+			fmt.Fprintf(&sb, "%03d", t.YearDay())
+		case 'W':
+			sb.WriteString(t.Weekday().String())
+		case 'a':
+			sb.WriteString(t.Weekday().String()[:3])
+		case 'H':
+			fmt.Fprintf(&sb, "%02d", t.Hour())
+		case 'k':
+			fmt.Fprintf(&sb, "%d", t.Hour())
+		case 'h', 'I':
+			fmt.Fprintf(&sb, "%02d", hour12)
+		case 'l':
+			fmt.Fprintf(&sb, "%d", hour12)
+		case 'i':
+			fmt.Fprintf(&sb, "%02d", t.Minute())
+		case 's', 'S':
+			fmt.Fprintf(&sb, "%02d", t.Second())
+		case 'f':
+			fmt.Fprintf(&sb, "%06d", t.Nanosecond()/1000)
+		case 'p':
+			sb.WriteString(t.Format("PM"))
+		case 'T':
+			sb.WriteString(t.Format("15:04:05"))
+		case 'r':
+			sb.WriteString(t.Format("03:04:05 PM"))
+		default:
+			// %% and unknown specifiers give the character, as in MySQL
+			sb.WriteByte(format[i])
+		}
+	}
+	return sb.String()
+}
+
+// parseTimeZone parses a time zone name such as Asia/Shanghai or UTC, or an offset such
+// as +08:00
+func parseTimeZone(name string) (*time.Location, error) {
+	if len(name) == 6 && (name[0] == '+' || name[0] == '-') && name[3] == ':' {
+		h, errH := strconv.Atoi(name[1:3])
+		m, errM := strconv.Atoi(name[4:])
+		if errH == nil && errM == nil {
+			offset := h*3600 + m*60
+			if name[0] == '-' {
+				offset = -offset
+			}
+			return time.FixedZone(name, offset), nil
+		}
+	}
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return nil, fmt.Errorf("unknown time zone %s, expected a name like Asia/Shanghai or an offset like +08:00", name)
+	}
+	return loc, nil
+}
+
+// querySessionLocation returns the time zone of the session, the one TIMESTAMP values are
+// sent in. A time zone the server names but Go doesn't know, such as SYSTEM, is taken as
+// its current offset from UTC.
+func querySessionLocation(db *sql.DB) (*time.Location, error) {
+	var name string
+	var minutes int
+	if err := db.QueryRow("SELECT @@session.time_zone, TIMESTAMPDIFF(MINUTE, UTC_TIMESTAMP(), NOW())").Scan(&name, &minutes); err != nil {
+		return nil, fmt.Errorf("failed to read the time zone of the session: %w", err)
+	}
+	if loc, err := parseTimeZone(name); err == nil {
+		return loc, nil
+	}
+	return time.FixedZone(name, minutes*60), nil
+}
+
+// refreshSessionLocation reads the time zone of the session again once it may have
+// changed, on a new connection or after SET time_zone, while TIMESTAMP values are
+// converted from it
+func refreshSessionLocation() {
+	db := GetDB()
+	if displayLocation == nil || db == nil {
+		return
+	}
+	loc, err := querySessionLocation(db)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	sessionLocation = loc
+}
+
+// displayBinary renders a binary value as hex, base64, or with the bytes that are not
+// printable text escaped as \xNN
+func displayBinary(b []byte) string {
+	switch binaryDisplay {
+	case "hex":
+		return "0x" + strings.ToUpper(hex.EncodeToString(b))
+	case "base64":
+		return base64.StdEncoding.EncodeToString(b)
+	}
+	var sb strings.Builder
+	for len(b) > 0 {
+		r, size := utf8.DecodeRune(b)
+		switch {
+		case r == utf8.RuneError && size <= 1:
+			fmt.Fprintf(&sb, `\x%02X`, b[0])
+		case r == '\\':
+			sb.WriteString(`\\`)
+		case r == '\n':
+			sb.WriteString(`\n`)
+		case r == '\t':
+			sb.WriteString(`\t`)
+		case r == '\r':
+			sb.WriteString(`\r`)
+		case !unicode.IsPrint(r):
+			for _, c := range b[:size] {
+				fmt.Fprintf(&sb, `\x%02X`, c)
+			}
+		default:
+			sb.Write(b[:size])
+		}
+		b = b[size:]
+	}
+	return sb.String()
+}
+
+// jsonSortKeys writes the keys of JSON rows sorted by name instead of in the order of the
+// columns, set with -json-sort-keys or .set jsonkeys sorted
+var jsonSortKeys bool
+
+type SetCmd struct{}
+
+func (cmd SetCmd) Name() string {
+	return ".set"
+}
+
+func (cmd SetCmd) Description() string {
+	return "Set or display how NULL, binary, date and JSON values are shown, and how CSV is written"
+}
+
+func (cmd SetCmd) Usage() string {
+	return ".set [nullvalue <text> | binary hex|base64|escape | timezone <zone>|off | datetime <format>|off | json pretty|compact | jsonkeys columns|sorted | header on|off | delimiter <char> | quote <char>]"
+}
+
+func (cmd SetCmd) Handle(args []string, resultWriter io.Writer) error {
+	if len(args) == 0 {
+		header := "on"
+		if csvOptions.skipColumnNames {
+			header = "off"
+		}
+		timezone, datetime, jsonKeys := "off", "off", "columns"
+		if displayLocation != nil {
+			timezone = displayLocation.String()
+		}
+		if datetimeFormat != "" {
+			datetime = quoteSQLString(datetimeFormat)
+		}
+		if jsonSortKeys {
+			jsonKeys = "sorted"
+		}
+		fmt.Fprintf(resultWriter, "nullvalue: %s\nbinary: %s\ntimezone: %s\ndatetime: %s\njson: %s\njsonkeys: %s\nheader: %s\ndelimiter: %q\nquote: %q\n",
+			quoteSQLString(nullDisplay), binaryDisplay, timezone, datetime, jsonDisplay, jsonKeys, header, csvOptions.delimiter, csvOptions.quote)
+		return nil
+	}
+	// The text of nullvalue and datetime may hold spaces and be quoted
+	value := strings.Join(args[1:], " ")
+	if len(value) >= 2 && (value[0] == '\'' || value[0] == '"') && value[len(value)-1] == value[0] {
+		value = value[1 : len(value)-1]
+	}
+	switch {
+	case args[0] == "nullvalue" && len(args) > 1:
+		nullDisplay = value
+		fmt.Fprintf(resultWriter, "NULL is shown as %s\n", quoteSQLString(nullDisplay))
+	case args[0] == "timezone" && len(args) == 2 && args[1] == "off":
+		displayLocation = nil
+		fmt.Fprintln(resultWriter, "TIMESTAMP values are shown in the time zone of the session")
+	case args[0] == "timezone" && len(args) == 2:
+		loc, err := parseTimeZone(args[1])
+		if err != nil {
+			return err
+		}
+		db := GetDB()
+		if db == nil {
+			return fmt.Errorf("not connected, the time zone of the session is needed")
+		}
+		if sessionLocation, err = querySessionLocation(db); err != nil {
+			return err
+		}
+		displayLocation = loc
+		fmt.Fprintf(resultWriter, "TIMESTAMP values are converted from %s to %s\n", sessionLocation, displayLocation)
+	case args[0] == "datetime" && len(args) > 1:
+		if value == "off" {
+			value = ""
+		}
+		datetimeFormat = value
+		if datetimeFormat == "" {
+			fmt.Fprintln(resultWriter, "DATETIME and TIMESTAMP values are shown as sent")
+		} else {
+			fmt.Fprintf(resultWriter, "DATETIME and TIMESTAMP values are shown as %s\n", formatDatetime(time.Now(), datetimeFormat))
+		}
+	case args[0] == "json" && len(args) == 2 && (args[1] == "pretty" || args[1] == "compact"):
+		jsonDisplay = args[1]
+		fmt.Fprintf(resultWriter, "JSON values are shown %s\n", jsonDisplay)
+	case args[0] == "jsonkeys" && len(args) == 2 && (args[1] == "columns" || args[1] == "sorted"):
+		jsonSortKeys = args[1] == "sorted"
+		if jsonSortKeys {
+			fmt.Fprintln(resultWriter, "The keys of JSON rows are sorted by name")
+		} else {
+			fmt.Fprintln(resultWriter, "The keys of JSON rows follow the order of the columns")
+		}
+	case args[0] == "binary" && len(args) == 2 && slices.Contains(binaryDisplayModes, strings.ToLower(args[1])):
+		binaryDisplay = strings.ToLower(args[1])
+		fmt.Fprintf(resultWriter, "Binary values are shown as %s\n", binaryDisplay)
+	case args[0] == "header" && len(args) == 2 && (args[1] == "on" || args[1] == "off"):
+		csvOptions.skipColumnNames = args[1] == "off"
+		fmt.Fprintf(resultWriter, "CSV header row %s\n", args[1])
+	case (args[0] == "delimiter" || args[0] == "quote") && len(args) == 2:
+		r, err := parseCSVChar(args[1])
+		if err != nil {
+			return err
+		}
+		if args[0] == "delimiter" {
+			csvOptions.delimiter = r
+		} else {
+			csvOptions.quote = r
+		}
+		fmt.Fprintf(resultWriter, "CSV %s set to %q\n", args[0], r)
+	default:
+		return fmt.Errorf("usage: %s", cmd.Usage())
+	}
+	return nil
+}
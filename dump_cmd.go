@@ -0,0 +1,327 @@
+package main
+
+import (
+	"bufio"
+	"database/sql"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// dumpBatchSize is the number of rows per INSERT statement written by .dump
+const dumpBatchSize = 500
+
+type DumpCmd struct{}
+
+func (cmd DumpCmd) Name() string {
+	return ".dump"
+}
+
+func (cmd DumpCmd) Description() string {
+	return "Dump a table or database as mysqldump-compatible SQL"
+}
+
+func (cmd DumpCmd) Usage() string {
+	return ".dump <table|db> [file] [--no-data] [--no-create] [--consistent] [--where <condition>]"
+}
+
+func (cmd DumpCmd) Handle(args []string, resultWriter io.Writer) error {
+	if len(args) < 1 || strings.HasPrefix(args[0], "-") {
+		return fmt.Errorf("usage: %s", cmd.Usage())
+	}
+	name := args[0]
+	args = args[1:]
+	var file string
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		file = args[0]
+		args = args[1:]
+	}
+
+	// The condition may contain spaces, so --where takes the rest of the line
+	var where string
+	for i, arg := range args {
+		if arg == "--where" || arg == "-where" {
+			where = strings.Join(args[i+1:], " ")
+			args = args[:i]
+			if where == "" {
+				return fmt.Errorf("usage: %s", cmd.Usage())
+			}
+			break
+		}
+	}
+
+	fs := flag.NewFlagSet(cmd.Name(), flag.ContinueOnError)
+	fs.SetOutput(resultWriter)
+	noData := fs.Bool("no-data", false, "Only dump the CREATE TABLE statements")
+	noCreate := fs.Bool("no-create", false, "Only dump the INSERT statements")
+	consistent := fs.Bool("consistent", false, "Read all tables at a single point in time")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	db, err := requireDB()
+	if err != nil {
+		return err
+	}
+	// The table list is read at the snapshot too
+	var tso uint64
+	if *consistent {
+		if txnOpen {
+			return fmt.Errorf("--consistent can't be used inside a transaction")
+		}
+		if snapshotTSO != 0 {
+			return fmt.Errorf("--consistent can't be used while .snapshot is on, every query already reads at TSO %d", snapshotTSO)
+		}
+		if tso, err = pinSnapshot(db); err != nil {
+			return err
+		}
+		defer unpinSnapshot(db)
+	}
+
+	// A name without a dot is a database if one exists by that name, otherwise a table
+	var dbName string
+	tables := []string{name}
+	var views []string
+	if !strings.Contains(name, ".") {
+		var found string
+		err := db.QueryRow("SELECT SCHEMA_NAME FROM INFORMATION_SCHEMA.SCHEMATA WHERE SCHEMA_NAME = ?", name).Scan(&found)
+		if err == nil {
+			dbName = name
+			if tables, err = getTableNamesOfType(db, dbName, "BASE TABLE"); err != nil {
+				return err
+			}
+			if views, err = getTableNamesOfType(db, dbName, "VIEW"); err != nil {
+				return err
+			}
+		} else if err != sql.ErrNoRows {
+			return err
+		}
+	}
+	// The condition names columns of one table, the other tables of a database may not have them
+	if dbName != "" && where != "" {
+		return fmt.Errorf("--where can only be used to dump a single table, not the database %s", dbName)
+	}
+
+	var out io.Writer = resultWriter
+	if file != "" {
+		f, err := os.Create(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+	w := bufio.NewWriter(out)
+
+	d := &dumper{db: db, w: w, noData: *noData, noCreate: *noCreate, where: where}
+	fmt.Fprintf(w, "-- tip dump %s\n-- Dumped at %s\n", Version, time.Now().Format("2006-01-02 15:04:05"))
+	if tso != 0 {
+		fmt.Fprintf(w, "-- Consistent snapshot at TSO %d\n", tso)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "/*!40101 SET NAMES utf8mb4 */;\n/*!40014 SET FOREIGN_KEY_CHECKS=0 */;\n\n")
+	if dbName != "" {
+		fmt.Fprintf(w, "CREATE DATABASE IF NOT EXISTS %s;\nUSE %s;\n\n", quoteName(dbName), quoteName(dbName))
+	}
+	var total int64
+	for _, table := range tables {
+		if dbName != "" {
+			table = dbName + "." + table
+		}
+		n, err := d.dumpTable(table)
+		if err != nil {
+			w.Flush()
+			return fmt.Errorf("failed to dump %s: %v", table, err)
+		}
+		total += n
+	}
+	if !*noCreate && len(views) > 0 {
+		if err := d.dumpViews(dbName, views); err != nil {
+			w.Flush()
+			return err
+		}
+	}
+	fmt.Fprintf(w, "/*!40014 SET FOREIGN_KEY_CHECKS=1 */;\n")
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if file != "" {
+		msg := fmt.Sprintf("Dumped %d tables, %d rows", len(tables), total)
+		if len(views) > 0 && !*noCreate {
+			msg += fmt.Sprintf(" and %d views", len(views))
+		}
+		resultWriter.Write([]byte(fmt.Sprintf("%s to %s.\n", msg, file)))
+	}
+	return nil
+}
+
+// getTableNamesOfType lists the tables of a database of a type of INFORMATION_SCHEMA.TABLES,
+// BASE TABLE or VIEW
+func getTableNamesOfType(db *sql.DB, dbName string, tableType string) ([]string, error) {
+	rows, err := db.Query("SELECT TABLE_NAME FROM INFORMATION_SCHEMA.TABLES "+
+		"WHERE TABLE_SCHEMA = ? AND TABLE_TYPE = ? ORDER BY TABLE_NAME", dbName, tableType)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var tables []string
+	for rows.Next() {
+		var table string
+		if err := rows.Scan(&table); err != nil {
+			return nil, err
+		}
+		tables = append(tables, table)
+	}
+	return tables, rows.Err()
+}
+
+// dumper writes tables as CREATE TABLE and INSERT statements
+type dumper struct {
+	db       *sql.DB
+	w        io.Writer
+	noData   bool
+	noCreate bool
+	where    string
+}
+
+// dumpTable writes one table and returns the number of rows dumped. Like mysqldump,
+// the statements name the table without its database so that the dump can be
+// loaded into another one.
+func (d *dumper) dumpTable(table string) (int64, error) {
+	name := strings.Trim(table[strings.LastIndex(table, ".")+1:], "`")
+
+	if !d.noCreate {
+		var tableName, createTable string
+		if err := d.db.QueryRow("SHOW CREATE TABLE "+quoteIdentifier(table)).Scan(&tableName, &createTable); err != nil {
+			return 0, err
+		}
+		fmt.Fprintf(d.w, "DROP TABLE IF EXISTS %s;\n%s;\n\n", quoteIdentifier(name), createTable)
+	}
+	if d.noData {
+		return 0, nil
+	}
+
+	query := "SELECT * FROM " + quoteIdentifier(table)
+	if d.where != "" {
+		query += " WHERE " + d.where
+	}
+	rows, err := d.db.Query(query)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	colTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return 0, err
+	}
+	cols := make([]string, len(colTypes))
+	numeric := make([]bool, len(colTypes))
+	for i, ct := range colTypes {
+		cols[i] = quoteName(ct.Name())
+		numeric[i] = isNumericType(ct.DatabaseTypeName())
+	}
+	prefix := fmt.Sprintf("INSERT INTO %s (%s) VALUES\n  ", quoteIdentifier(name), strings.Join(cols, ", "))
+
+	values := make([]interface{}, len(cols))
+	valuePtrs := make([]interface{}, len(cols))
+	for i := range values {
+		valuePtrs[i] = &values[i]
+	}
+	var n int64
+	for rows.Next() {
+		if err := rows.Scan(valuePtrs...); err != nil {
+			return n, err
+		}
+		if n%dumpBatchSize == 0 {
+			if n > 0 {
+				io.WriteString(d.w, ";\n")
+			}
+			io.WriteString(d.w, prefix)
+		} else {
+			io.WriteString(d.w, ",\n  ")
+		}
+		io.WriteString(d.w, "("+strings.Join(rowLiterals(values, numeric), ", ")+")")
+		n++
+	}
+	if err := rows.Err(); err != nil {
+		return n, err
+	}
+	if n > 0 {
+		io.WriteString(d.w, ";\n\n")
+	}
+	return n, nil
+}
+
+// dumpViews writes the CREATE VIEW statements of the views of a database, after its
+// tables. A view selecting from another view is written after it, so that the dump
+// loads in order.
+func (d *dumper) dumpViews(dbName string, views []string) error {
+	qualifier := quoteName(dbName) + "."
+	creates := make(map[string]string, len(views))
+	for _, view := range views {
+		create, err := showCreate(d.db, "SHOW CREATE VIEW "+quoteName(dbName)+"."+quoteName(view))
+		if err != nil {
+			return fmt.Errorf("failed to dump view %s: %v", view, err)
+		}
+		creates[view] = strings.ReplaceAll(create, qualifier, "")
+	}
+
+	written := map[string]bool{}
+	write := func(view string) {
+		fmt.Fprintf(d.w, "DROP VIEW IF EXISTS %s;\n%s;\n\n", quoteName(view), creates[view])
+		written[view] = true
+	}
+	waiting := func(view string) bool {
+		for _, other := range views {
+			if other != view && !written[other] && strings.Contains(creates[view], quoteName(other)) {
+				return true
+			}
+		}
+		return false
+	}
+	for len(written) < len(views) {
+		progress := false
+		for _, view := range views {
+			if !written[view] && !waiting(view) {
+				write(view)
+				progress = true
+			}
+		}
+		// Views that seem to select from each other are written in name order
+		if !progress {
+			for _, view := range views {
+				if !written[view] {
+					write(view)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// rowLiterals formats the values of a row as SQL literals, numeric columns without quotes
+func rowLiterals(values []interface{}, numeric []bool) []string {
+	literals := make([]string, len(values))
+	for i, val := range values {
+		if b, ok := val.([]byte); ok && numeric[i] {
+			literals[i] = string(b)
+		} else {
+			literals[i] = formatSQLValue(val)
+		}
+	}
+	return literals
+}
+
+// isNumericType reports whether values of a column type can be written without quotes
+func isNumericType(typeName string) bool {
+	switch strings.TrimPrefix(typeName, "UNSIGNED ") {
+	case "TINYINT", "SMALLINT", "MEDIUMINT", "INT", "BIGINT", "DECIMAL", "FLOAT", "DOUBLE", "YEAR":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/htmlindex"
+	"golang.org/x/text/encoding/japanese"
+	"golang.org/x/text/encoding/korean"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/traditionalchinese"
+)
+
+// mysqlCharsets maps the names of MySQL character sets to their encodings.
+// MySQL's latin1 is really cp1252.
+var mysqlCharsets = map[string]encoding.Encoding{
+	"latin1":  charmap.Windows1252,
+	"latin2":  charmap.ISO8859_2,
+	"cp1250":  charmap.Windows1250,
+	"cp1251":  charmap.Windows1251,
+	"cp1256":  charmap.Windows1256,
+	"cp1257":  charmap.Windows1257,
+	"koi8r":   charmap.KOI8R,
+	"koi8u":   charmap.KOI8U,
+	"greek":   charmap.ISO8859_7,
+	"hebrew":  charmap.ISO8859_8,
+	"latin5":  charmap.ISO8859_9,
+	"latin7":  charmap.ISO8859_13,
+	"gbk":     simplifiedchinese.GBK,
+	"gb2312":  simplifiedchinese.GBK, // EUC-CN, a subset of GBK
+	"gb18030": simplifiedchinese.GB18030,
+	"big5":    traditionalchinese.Big5,
+	"sjis":    japanese.ShiftJIS,
+	"cp932":   japanese.ShiftJIS,
+	"ujis":    japanese.EUCJP,
+	"eucjpms": japanese.EUCJP,
+	"euckr":   korean.EUCKR,
+}
+
+// lookupEncoding returns the encoding of a MySQL character set or WHATWG encoding
+// name, e.g. gbk or latin1. It returns nil for UTF-8, which needs no conversion.
+func lookupEncoding(name string) (encoding.Encoding, error) {
+	name = strings.ToLower(name)
+	switch name {
+	case "", "utf8", "utf8mb4", "utf-8":
+		return nil, nil
+	}
+	if enc, ok := mysqlCharsets[name]; ok {
+		return enc, nil
+	}
+	enc, err := htmlindex.Get(name)
+	if err != nil {
+		return nil, fmt.Errorf("unknown encoding %q", name)
+	}
+	return enc, nil
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/mattn/go-runewidth"
+)
+
+// highActRows is the number of actual rows above which an operator is highlighted
+const highActRows = 100000
+
+type ExplainCmd struct{}
+
+func (cmd ExplainCmd) Name() string {
+	return ".explain"
+}
+
+func (cmd ExplainCmd) Description() string {
+	return "Show the execution plan of a statement as a tree, highlighting full scans and misestimates"
+}
+
+func (cmd ExplainCmd) Usage() string {
+	return ".explain [analyze] <sql>"
+}
+
+// planRow is one operator of a TiDB execution plan
+type planRow struct {
+	id       string // operator name prefixed with the tree drawing characters
+	estRows  string
+	actRows  string
+	task     string
+	access   string
+	info     string
+	execInfo string
+}
+
+func (cmd ExplainCmd) Handle(args []string, resultWriter io.Writer) error {
+	analyze := len(args) > 0 && strings.EqualFold(args[0], "analyze")
+	if analyze {
+		args = args[1:]
+	}
+	query := strings.TrimSuffix(strings.TrimSpace(strings.Join(args, " ")), ";")
+	if query == "" {
+		return fmt.Errorf("usage: %s", cmd.Usage())
+	}
+	db, err := requireDB()
+	if err != nil {
+		return err
+	}
+
+	plan, err := explainPlan(db, query, analyze)
+	if err != nil {
+		return err
+	}
+	renderPlan(resultWriter, plan, analyze)
+	return nil
+}
+
+// explainPlan runs EXPLAIN (ANALYZE) and maps the columns by name, as they differ between TiDB versions
+func explainPlan(db *sql.DB, query string, analyze bool) ([]planRow, error) {
+	stmt := "EXPLAIN "
+	if analyze {
+		stmt = "EXPLAIN ANALYZE "
+	}
+	rows, err := db.Query(stmt + query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to explain: %v", err)
+	}
+	defer rows.Close()
+
+	output, _, err := scanRows(rows, nil, false)
+	if err != nil {
+		return nil, err
+	}
+
+	var plan []planRow
+	for _, row := range output {
+		get := func(names ...string) string {
+			for i, col := range row.colNames {
+				for _, name := range names {
+					if strings.EqualFold(col, name) {
+						return formatValue(row.colValues[i])
+					}
+				}
+			}
+			return ""
+		}
+		plan = append(plan, planRow{
+			id:       get("id"),
+			estRows:  get("estRows", "count"),
+			actRows:  get("actRows"),
+			task:     get("task"),
+			access:   get("access object"),
+			info:     get("operator info"),
+			execInfo: get("execution info"),
+		})
+	}
+	return plan, nil
+}
+
+func renderPlan(w io.Writer, plan []planRow, analyze bool) {
+	red := color.New(color.FgRed, color.Bold).SprintFunc()
+	yellow := color.New(color.FgYellow).SprintFunc()
+	grey := color.New(color.FgHiBlack).SprintFunc()
+
+	width := 0
+	for _, row := range plan {
+		width = max(width, runewidth.StringWidth(row.id))
+	}
+
+	for _, row := range plan {
+		name := row.id
+		var notes []string
+		if strings.Contains(name, "FullScan") {
+			name = red(name)
+			notes = append(notes, "full scan")
+		}
+
+		rowsInfo := "est " + row.estRows
+		if analyze {
+			act := row.actRows
+			est, errEst := strconv.ParseFloat(row.estRows, 64)
+			actual, errAct := strconv.ParseFloat(row.actRows, 64)
+			if errEst == nil && errAct == nil {
+				if actual >= highActRows {
+					act = yellow(act)
+				}
+				// Flag estimates off by more than 10x in either direction
+				if (actual > 10*est && actual > 100) || (est > 10*actual && est > 100) {
+					notes = append(notes, "misestimate")
+				}
+			}
+			rowsInfo += " / act " + act
+		}
+
+		padding := strings.Repeat(" ", width-runewidth.StringWidth(row.id))
+		line := fmt.Sprintf("%s%s  %s  %s", name, padding, rowsInfo, grey(row.task))
+		if row.access != "" {
+			line += "  " + row.access
+		}
+		if len(notes) > 0 {
+			line += "  " + red("["+strings.Join(notes, ", ")+"]")
+		}
+		fmt.Fprintln(w, line)
+
+		// Details go on their own line, aligned under the operator
+		prefix := row.id[:len(row.id)-len(strings.TrimLeft(row.id, "│├└─ "))]
+		indent := strings.Repeat(" ", runewidth.StringWidth(prefix))
+		if row.info != "" {
+			fmt.Fprintf(w, "%s    %s\n", indent, grey(row.info))
+		}
+		if analyze && row.execInfo != "" {
+			fmt.Fprintf(w, "%s    %s\n", indent, grey(row.execInfo))
+		}
+	}
+}
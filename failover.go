@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// reconnectTimeout bounds the wait for the server after the connection was lost
+const reconnectTimeout = 10 * time.Second
+
+var (
+	// activeConnInfo holds the settings of the global connection, used to fail over to another of its hosts
+	activeConnInfo *ConnInfo
+	// activeHost is the index of the host of activeConnInfo the global connection uses
+	activeHost int
+	// sessionDatabase is the database selected with USE, restored after failing over
+	sessionDatabase string
+)
+
+// hostList splits the comma-separated hosts of info into one ConnInfo per host.
+// Each host may carry its own port, e.g. "tidb-0:4000,tidb-1:4001".
+func hostList(info ConnInfo) []ConnInfo {
+	if info.Socket != "" || !strings.Contains(info.Host, ",") {
+		return []ConnInfo{info}
+	}
+	var hosts []ConnInfo
+	for _, h := range strings.Split(info.Host, ",") {
+		h = strings.TrimSpace(h)
+		if h == "" {
+			continue
+		}
+		hostInfo := info
+		hostInfo.Host = h
+		if host, port, err := net.SplitHostPort(h); err == nil {
+			hostInfo.Host, hostInfo.Port = host, port
+		}
+		hosts = append(hosts, hostInfo)
+	}
+	return hosts
+}
+
+// hostAddr returns the address shown to the user for a single host
+func hostAddr(info ConnInfo) string {
+	if info.Socket != "" {
+		return info.Socket
+	}
+	return net.JoinHostPort(info.Host, info.Port)
+}
+
+// openAnyHost tries the hosts of info in order starting at start, wrapping around,
+// and returns the connection to the first one that answers along with its index
+func openAnyHost(info ConnInfo, start int) (*sql.DB, int, error) {
+	hosts := hostList(info)
+	var lastErr error
+	for i := 0; i < len(hosts); i++ {
+		idx := (start + i) % len(hosts)
+		db, err := openHost(hosts[idx])
+		if err == nil {
+			return db, idx, nil
+		}
+		lastErr = err
+		var cerr *connectError
+		if errors.As(err, &cerr) && cerr.kind == "auth" {
+			// The other hosts share the credentials, they would refuse them as well
+			break
+		}
+		if len(hosts) > 1 {
+			log.Printf("%s: %v", hostAddr(hosts[idx]), err)
+		}
+	}
+	return nil, 0, lastErr
+}
+
+// isConnectionLost reports whether err means the server can no longer be reached
+func isConnectionLost(err error) bool {
+	var opErr *net.OpError
+	return errors.Is(err, driver.ErrBadConn) || errors.Is(err, mysql.ErrInvalidConn) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.As(err, &opErr)
+}
+
+// reconnect checks whether the server of the current connection answers again. The
+// connection is replaced on the way, restoring the session state, see sessionConnector.
+func reconnect() bool {
+	db := GetDB()
+	if db == nil {
+		return false
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), reconnectTimeout)
+	defer cancel()
+	if err := db.PingContext(ctx); err != nil {
+		log.Printf("Failed to reconnect: %v", err)
+		return false
+	}
+	connHealth.Store(healthOK)
+	return true
+}
+
+// failover replaces the global connection with one to the next reachable host
+// of the connection settings, if they list more than one
+func failover() error {
+	if activeConnInfo == nil || len(hostList(*activeConnInfo)) < 2 {
+		return fmt.Errorf("no other host to fail over to")
+	}
+	hosts := hostList(*activeConnInfo)
+	lost := hostAddr(hosts[activeHost])
+
+	info := *activeConnInfo
+	if sessionDatabase != "" {
+		info.Database = sessionDatabase
+	}
+	db, idx, err := openAnyHost(info, activeHost+1)
+	if err != nil {
+		return fmt.Errorf("failed to fail over from %s: %v", lost, err)
+	}
+
+	if old := GetDB(); old != nil {
+		old.Close()
+	}
+	SetDB(db)
+	activeHost = idx
+	writeAddr = hostAddr(hosts[idx])
+	invalidateCompletionCache()
+	if n := len(sessionVarAssignments()); n > 0 {
+		log.Printf("Lost connection to %s, failed over to %s and restored %d session variables", lost, writeAddr, n)
+	} else {
+		log.Printf("Lost connection to %s, failed over to %s", lost, writeAddr)
+	}
+	return nil
+}
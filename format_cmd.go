@@ -0,0 +1,291 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/pingcap/tidb/pkg/parser/ast"
+	"github.com/pingcap/tidb/pkg/parser/format"
+)
+
+// formatIndent is the indentation of a nested query or list in a formatted statement
+const formatIndent = "  "
+
+// sqlClauses start a line of a formatted statement, unless they are part of an expression
+// such as EXTRACT(DAY FROM d). The statement is restored by the parser, so keywords are
+// upper case and separated by single spaces.
+var sqlClauses = []string{
+	"SELECT", "FROM", "WHERE", "GROUP BY", "HAVING", "WINDOW", "ORDER BY", "LIMIT",
+	"UNION", "EXCEPT", "INTERSECT",
+	"JOIN", "LEFT JOIN", "LEFT OUTER JOIN", "RIGHT JOIN", "RIGHT OUTER JOIN", "INNER JOIN",
+	"CROSS JOIN", "NATURAL JOIN", "NATURAL LEFT JOIN", "NATURAL RIGHT JOIN", "STRAIGHT_JOIN",
+	"SET", "VALUES", "ON DUPLICATE KEY UPDATE", "PARTITION BY",
+}
+
+type FormatCmd struct{}
+
+func (cmd FormatCmd) Name() string {
+	return ".format"
+}
+
+func (cmd FormatCmd) Description() string {
+	return "Pretty-print SQL statements with upper case keywords and one clause per line"
+}
+
+func (cmd FormatCmd) Usage() string {
+	return ".format <sql>"
+}
+
+func (cmd FormatCmd) Handle(args []string, resultWriter io.Writer) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: %s", cmd.Usage())
+	}
+	formatted, err := formatSQLText(strings.Join(args, " "))
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(resultWriter, formatted)
+	return nil
+}
+
+// formatSQLText formats every statement of text, each ending with a semicolon. The
+// parser drops comments, so they are not kept.
+func formatSQLText(text string) (string, error) {
+	var out []string
+	for _, stmt := range splitSQLText(text) {
+		nodes, _, err := p.Parse(stmt.text, "", "")
+		if err != nil {
+			pb := syntaxProblem(stmt, err)
+			return "", fmt.Errorf("line %d, column %d: %s", pb.line, pb.column, pb.message)
+		}
+		for _, node := range nodes {
+			formatted, err := formatStatement(node)
+			if err != nil {
+				return "", err
+			}
+			out = append(out, formatted+";")
+		}
+	}
+	return strings.Join(out, "\n\n"), nil
+}
+
+// formatStatement restores a statement with upper case keywords and quoted names, and
+// lays it out with one clause per line, nested queries indented and the columns of
+// CREATE TABLE one per line
+func formatStatement(node ast.StmtNode) (string, error) {
+	restored, err := restoreStatement(node)
+	if err != nil {
+		return "", err
+	}
+	_, isCreateTable := node.(*ast.CreateTableStmt)
+	return layoutSQL(restored, isCreateTable), nil
+}
+
+// restoreStatement writes a statement back on one line with upper case keywords and
+// quoted names
+func restoreStatement(node ast.StmtNode) (string, error) {
+	var sb strings.Builder
+	flags := format.RestoreKeyWordUppercase | format.RestoreNameBackQuotes | format.RestoreStringSingleQuotes | format.RestoreStringWithoutCharset
+	if err := node.Restore(format.NewRestoreCtx(flags, &sb)); err != nil {
+		return "", fmt.Errorf("failed to format %q: %v", node.Text(), err)
+	}
+	return sb.String(), nil
+}
+
+// formatSQLLine formats the line being typed in the REPL on Ctrl+F. The line editor
+// edits a single line, so the statements keep to one line, without the layout of
+// .format, and the line keeps its final semicolon, or the lack of one.
+func formatSQLLine(line string) (string, error) {
+	nodes, _, err := p.Parse(line, "", "")
+	if err != nil {
+		return "", err
+	}
+	if len(nodes) == 0 {
+		return line, nil
+	}
+	var out []string
+	for _, node := range nodes {
+		restored, err := restoreStatement(node)
+		if err != nil {
+			return "", err
+		}
+		out = append(out, restored)
+	}
+	formatted := strings.Join(out, "; ")
+	if strings.HasSuffix(strings.TrimSpace(line), ";") {
+		formatted += ";"
+	}
+	return formatted, nil
+}
+
+// sqlLevel is a parenthesis of a statement being laid out
+type sqlLevel struct {
+	kind    byte   // 'q' query, 'g' group of joined tables, 'l' list broken one item per line, 'e' expression
+	indent  int    // indentation of the lines of the level
+	outer   int    // indentation of the line the level opened on, where it closes
+	start   int    // length of the output when the level started
+	clause  string // last clause of the level
+	between bool   // a BETWEEN waits for its AND
+}
+
+// layoutSQL breaks a restored statement into lines. Clauses start a line when they are
+// not within an expression, as do the AND and OR of WHERE and HAVING, and the queries
+// in parentheses are indented. With columns, the first parenthesis holds the columns of
+// CREATE TABLE, which go one per line.
+func layoutSQL(s string, columns bool) string {
+	var out strings.Builder
+	levels := []*sqlLevel{{kind: 'q'}}
+	lineIndent := 0
+	newline := func(indent int) {
+		lineIndent = indent
+		trimmed := strings.TrimRight(out.String(), " ")
+		out.Reset()
+		out.WriteString(trimmed)
+		out.WriteString("\n" + strings.Repeat(formatIndent, indent))
+	}
+	lastWord := ""
+	for i := 0; i < len(s); {
+		level := levels[len(levels)-1]
+		c := s[i]
+		switch {
+		case c == '\'' || c == '`':
+			j := i + 1
+			for j < len(s) {
+				if s[j] == '\\' && c == '\'' {
+					j += 2
+					continue
+				}
+				if s[j] == c {
+					if j+1 < len(s) && s[j+1] == c {
+						j += 2
+						continue
+					}
+					break
+				}
+				j++
+			}
+			end := min(j+1, len(s))
+			out.WriteString(s[i:end])
+			i = end
+			continue
+		case c == '(':
+			next := &sqlLevel{kind: 'e', indent: level.indent, outer: lineIndent}
+			rest := s[i+1:]
+			switch {
+			case strings.HasPrefix(rest, "SELECT ") || strings.HasPrefix(rest, "WITH "):
+				next.kind, next.indent = 'q', lineIndent+1
+			case columns:
+				next.kind, next.indent = 'l', lineIndent+1
+				columns = false
+			case level.kind != 'e' && (level.clause == "FROM" || strings.HasSuffix(level.clause, "JOIN")) &&
+				(lastWord == "FROM" || strings.HasSuffix(lastWord, "JOIN") || lastWord == "," || lastWord == "("):
+				next.kind = 'g'
+			}
+			out.WriteByte('(')
+			if next.kind == 'q' || next.kind == 'l' {
+				newline(next.indent)
+			}
+			next.start = out.Len()
+			levels = append(levels, next)
+			lastWord = "("
+			i++
+			continue
+		case c == ')' && len(levels) > 1:
+			levels = levels[:len(levels)-1]
+			if level.kind == 'q' || level.kind == 'l' {
+				newline(level.outer)
+			}
+			out.WriteByte(')')
+			lastWord = ")"
+			i++
+			continue
+		case c == ',':
+			out.WriteByte(',')
+			i++
+			if level.kind == 'l' || (level.kind == 'q' && level.clause == "VALUES") {
+				indent := level.indent
+				if level.kind == 'q' {
+					indent++
+				}
+				newline(indent)
+				for i < len(s) && s[i] == ' ' {
+					i++
+				}
+			} else if i < len(s) && s[i] != ' ' {
+				out.WriteByte(' ')
+			}
+			lastWord = ","
+			continue
+		case isWordByte(c) && (i == 0 || !isWordByte(s[i-1])):
+			j := i
+			for j < len(s) && isWordByte(s[j]) {
+				j++
+			}
+			word := s[i:j]
+			if level.kind != 'e' {
+				if clause := matchClause(s[i:]); clause != "" {
+					// DELETE FROM stays on one line
+					if out.Len() > level.start && !(clause == "FROM" && level.clause == "") {
+						newline(level.indent)
+					}
+					level.clause, level.between = clause, false
+					out.WriteString(clause)
+					lastWord = clause[strings.LastIndexByte(clause, ' ')+1:]
+					i += len(clause)
+					continue
+				}
+				switch {
+				case word == "BETWEEN":
+					level.between = true
+				case word == "AND" && level.between:
+					level.between = false
+				case (word == "AND" || word == "OR") && (level.clause == "WHERE" || level.clause == "HAVING"):
+					newline(level.indent + 1)
+				}
+			}
+			out.WriteString(word)
+			lastWord = word
+			i = j
+			continue
+		}
+		out.WriteByte(c)
+		i++
+	}
+	return out.String()
+}
+
+// matchClause returns the clause s starts with, if any
+func matchClause(s string) string {
+	var match string
+	for _, clause := range sqlClauses {
+		if strings.HasPrefix(s, clause) && (len(s) == len(clause) || s[len(clause)] == ' ') && len(clause) > len(match) {
+			match = clause
+		}
+	}
+	return match
+}
+
+func isWordByte(c byte) bool {
+	return c == '_' || c == '$' || c == '@' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// runFormatSQL formats the statements of a SQL file, or of the standard input when
+// file is empty or "-", to the standard output
+func runFormatSQL(file string) int {
+	data, err := readSQLFile(file)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	formatted, err := formatSQLText(string(data))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if formatted != "" {
+		fmt.Println(formatted)
+	}
+	return 0
+}
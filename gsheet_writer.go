@@ -0,0 +1,294 @@
+package main
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	gsheetURLPrefix = "gsheet://"
+	sheetsAPIURL    = "https://sheets.googleapis.com/v4/spreadsheets/"
+	sheetsScope     = "https://www.googleapis.com/auth/spreadsheets"
+	// gsheetBatchRows is the number of rows sent to the Sheets API at once
+	gsheetBatchRows = 5000
+)
+
+// GSheetResultIOWriter writes results into a tab of a Google Sheets spreadsheet, replacing
+// what the tab held. The results of the statements after the first go to their own tabs,
+// named after the first one, as with XLSX.
+type GSheetResultIOWriter struct {
+	spreadsheetID string
+	tab           string
+	token         string
+	sheets        int             // statements started, see NextSheet
+	current       string          // tab being written, created on the first rows
+	pending       [][]interface{} // rows not sent yet
+}
+
+// parseGSheetURL splits gsheet://<spreadsheet-id>/<tab> into its parts, the tab
+// defaults to Sheet1
+func parseGSheetURL(s string) (spreadsheetID, tab string, err error) {
+	rest := strings.TrimPrefix(s, gsheetURLPrefix)
+	spreadsheetID, tab, _ = strings.Cut(rest, "/")
+	if spreadsheetID == "" {
+		return "", "", fmt.Errorf("invalid Google Sheets output %q, use %s<spreadsheet-id>/<tab>", s, gsheetURLPrefix)
+	}
+	return spreadsheetID, withDefault(tab, "Sheet1"), nil
+}
+
+// NewGSheetResultIOWriter authenticates to Google with the gsheet section of the config
+// file, or the environment, and returns a writer into the tab of the spreadsheet
+func NewGSheetResultIOWriter(spreadsheetID, tab string) (*GSheetResultIOWriter, error) {
+	config, err := loadConfig(globalConfigFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read gsheet config: %v", err)
+	}
+	token := withDefault(config.GSheet.AccessToken, os.Getenv("GOOGLE_OAUTH_ACCESS_TOKEN"))
+	if token == "" {
+		credentials := withDefault(config.GSheet.CredentialsFile, os.Getenv("GOOGLE_APPLICATION_CREDENTIALS"))
+		if credentials == "" {
+			return nil, fmt.Errorf("no Google credentials: set gsheet.credentials_file in the config file or GOOGLE_APPLICATION_CREDENTIALS " +
+				"to a service account key, or GOOGLE_OAUTH_ACCESS_TOKEN to an OAuth access token")
+		}
+		if token, err = serviceAccountToken(credentials, sheetsScope); err != nil {
+			return nil, fmt.Errorf("failed to authenticate to Google: %v", err)
+		}
+	}
+	return &GSheetResultIOWriter{spreadsheetID: spreadsheetID, tab: tab, token: token}, nil
+}
+
+func (w *GSheetResultIOWriter) NextSheet() error {
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	w.sheets++
+	w.current = ""
+	return nil
+}
+
+func (w *GSheetResultIOWriter) Write(rows []RowResult) error {
+	if len(rows) == 0 {
+		return nil
+	}
+	if w.current == "" {
+		tab := w.tab
+		if w.sheets > 1 {
+			tab = fmt.Sprintf("%s %d", w.tab, w.sheets)
+		}
+		if err := w.resetTab(tab); err != nil {
+			return err
+		}
+		w.current = tab
+		header := make([]interface{}, len(rows[0].colNames))
+		for i, col := range rows[0].colNames {
+			header[i] = col
+		}
+		w.pending = append(w.pending, header)
+	}
+	for _, row := range rows {
+		values := make([]interface{}, len(row.colValues))
+		for i, val := range row.colValues {
+			values[i] = gsheetCellValue(val)
+		}
+		w.pending = append(w.pending, values)
+	}
+	if len(w.pending) >= gsheetBatchRows {
+		return w.Flush()
+	}
+	return nil
+}
+
+// Flush appends the pending rows to the tab
+func (w *GSheetResultIOWriter) Flush() error {
+	if len(w.pending) == 0 {
+		return nil
+	}
+	endpoint := w.valuesURL(w.current) + ":append?valueInputOption=RAW&insertDataOption=INSERT_ROWS"
+	if err := w.call("POST", endpoint, map[string]interface{}{"values": w.pending}, nil); err != nil {
+		return fmt.Errorf("failed to write to Google Sheets: %v", err)
+	}
+	w.pending = w.pending[:0]
+	return nil
+}
+
+// resetTab creates the tab if the spreadsheet doesn't have it, or clears it if it does
+func (w *GSheetResultIOWriter) resetTab(tab string) error {
+	var spreadsheet struct {
+		Sheets []struct {
+			Properties struct {
+				Title string `json:"title"`
+			} `json:"properties"`
+		} `json:"sheets"`
+	}
+	err := w.call("GET", sheetsAPIURL+url.PathEscape(w.spreadsheetID)+"?fields=sheets.properties.title", nil, &spreadsheet)
+	if err != nil {
+		return fmt.Errorf("failed to open spreadsheet %s: %v", w.spreadsheetID, err)
+	}
+	for _, sheet := range spreadsheet.Sheets {
+		if sheet.Properties.Title == tab {
+			if err := w.call("POST", w.valuesURL(tab)+":clear", map[string]interface{}{}, nil); err != nil {
+				return fmt.Errorf("failed to clear tab %q: %v", tab, err)
+			}
+			return nil
+		}
+	}
+	err = w.call("POST", sheetsAPIURL+url.PathEscape(w.spreadsheetID)+":batchUpdate", map[string]interface{}{
+		"requests": []interface{}{
+			map[string]interface{}{"addSheet": map[string]interface{}{"properties": map[string]string{"title": tab}}},
+		},
+	}, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create tab %q: %v", tab, err)
+	}
+	return nil
+}
+
+// valuesURL returns the URL of the values of a whole tab
+func (w *GSheetResultIOWriter) valuesURL(tab string) string {
+	a1 := "'" + strings.ReplaceAll(tab, "'", "''") + "'"
+	return sheetsAPIURL + url.PathEscape(w.spreadsheetID) + "/values/" + url.PathEscape(a1)
+}
+
+// call sends a request to the Sheets API and decodes the JSON response into out, if not nil
+func (w *GSheetResultIOWriter) call(method, endpoint string, body interface{}, out interface{}) error {
+	var reqBody io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reqBody = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, endpoint, reqBody)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+w.token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("request failed with status %s: %s", resp.Status, strings.TrimSpace(string(respBody)))
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(respBody, out)
+}
+
+// gsheetCellValue converts a value read from the database to a cell value, numbers stay
+// numbers and everything else is written as text, as typed
+func gsheetCellValue(val interface{}) interface{} {
+	switch v := xlsxCellValue(val).(type) {
+	case nil:
+		return ""
+	case int64:
+		// Sheets keeps numbers as doubles, larger integers would lose digits
+		if v > 1<<53 || v < -(1<<53) {
+			return strconv.FormatInt(v, 10)
+		}
+		return v
+	case float64:
+		return v
+	case xlsxNumber:
+		if f, err := strconv.ParseFloat(string(v), 64); err == nil {
+			return f
+		}
+	}
+	return formatValue(val)
+}
+
+// serviceAccountToken returns an OAuth access token for a Google service account, given
+// the file of its JSON key, see https://developers.google.com/identity/protocols/oauth2/service-account
+func serviceAccountToken(keyFile, scope string) (string, error) {
+	data, err := os.ReadFile(keyFile)
+	if err != nil {
+		return "", err
+	}
+	var key struct {
+		ClientEmail string `json:"client_email"`
+		PrivateKey  string `json:"private_key"`
+		TokenURI    string `json:"token_uri"`
+	}
+	if err := json.Unmarshal(data, &key); err != nil {
+		return "", fmt.Errorf("invalid service account key %s: %v", keyFile, err)
+	}
+	block, _ := pem.Decode([]byte(key.PrivateKey))
+	if block == nil || key.ClientEmail == "" {
+		return "", fmt.Errorf("invalid service account key %s: no client_email or private_key", keyFile)
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return "", fmt.Errorf("invalid private key in %s: %v", keyFile, err)
+	}
+	rsaKey, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return "", fmt.Errorf("invalid private key in %s: not an RSA key", keyFile)
+	}
+	tokenURI := withDefault(key.TokenURI, "https://oauth2.googleapis.com/token")
+
+	// Sign a JWT asserting the service account and exchange it for an access token
+	now := time.Now()
+	claims, err := json.Marshal(map[string]interface{}{
+		"iss":   key.ClientEmail,
+		"scope": scope,
+		"aud":   tokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+	enc := base64.RawURLEncoding
+	unsigned := enc.EncodeToString([]byte(`{"alg":"RS256","typ":"JWT"}`)) + "." + enc.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(nil, rsaKey, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+	resp, err := http.PostForm(tokenURI, url.Values{
+		"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":  {unsigned + "." + enc.EncodeToString(signature)},
+	})
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode/100 != 2 {
+		return "", fmt.Errorf("token request failed with status %s: %s", resp.Status, strings.TrimSpace(string(respBody)))
+	}
+	var token struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.Unmarshal(respBody, &token); err != nil {
+		return "", fmt.Errorf("error unmarshaling token response: %v", err)
+	}
+	return token.AccessToken, nil
+}
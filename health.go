@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/fatih/color"
+)
+
+// Health of the connection as shown in front of the REPL prompt
+const (
+	healthUnknown int32 = iota
+	healthOK
+	healthSlow
+	healthDown
+)
+
+const (
+	healthCheckInterval = 5 * time.Second
+	healthCheckTimeout  = 3 * time.Second
+	// slowPingThreshold is the ping time above which the connection is shown as slow
+	slowPingThreshold = 500 * time.Millisecond
+)
+
+// connHealth holds the result of the last background ping
+var connHealth atomic.Int32
+
+// checkHealth pings the current connection and records how it went
+func checkHealth() {
+	db := GetDB()
+	if db == nil {
+		connHealth.Store(healthUnknown)
+		return
+	}
+	// The session has a single connection, don't queue behind a running statement
+	if db.Stats().InUse > 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), healthCheckTimeout)
+	defer cancel()
+	start := time.Now()
+	switch err := db.PingContext(ctx); {
+	case err != nil:
+		connHealth.Store(healthDown)
+	case time.Since(start) > slowPingThreshold:
+		connHealth.Store(healthSlow)
+	default:
+		connHealth.Store(healthOK)
+	}
+}
+
+// startHealthCheck pings the connection in the background until the returned function is called
+func startHealthCheck() (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(healthCheckInterval)
+		defer ticker.Stop()
+		for {
+			checkHealth()
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+// healthIndicator returns the dot shown in front of the prompt. The prompt can't
+// hold escape sequences, so colored emoji are used instead of colored text.
+func healthIndicator() string {
+	if color.NoColor {
+		return ""
+	}
+	switch connHealth.Load() {
+	case healthOK:
+		return "🟢 "
+	case healthSlow:
+		return "🟡 "
+	case healthDown:
+		return "🔴 "
+	}
+	return ""
+}
@@ -0,0 +1,392 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/mattn/go-runewidth"
+)
+
+// helpWidth is the column help topics are wrapped at
+const helpWidth = 80
+
+// helpTopic is a page of tip help <name>, or of .help <name> in the REPL
+type helpTopic struct {
+	names []string
+	// text is wrapped at helpWidth, except for indented lines such as examples
+	text string
+}
+
+// helpTopics explain the settings, subcommands and REPL commands that a line of
+// usage doesn't cover
+var helpTopics = []helpTopic{
+	{[]string{"connection"}, `
+A connection string, such as the one shown in the TiDB Cloud console, can be given instead of (or together with) the connection flags; flags take precedence over its parts. The port defaults to 4000, and tls=true|false|skip-verify|preferred or ssl-mode, ssl-ca, ssl-cert and ssl-key query parameters set the TLS options, and maxAllowedPacket, readTimeout, writeTimeout and interpolateParams the driver options described by tip help config. .connect mysql://... accepts the same strings in the REPL, prompting for the password when the string has none.
+
+-host: TiDB Serverless hostname, or a comma-separated list of hosts (each optionally with its own port, e.g. tidb-0,tidb-1:4001). The first reachable host is used, and when it goes away mid-session tip fails over to the next one, keeping the current database and re-running the statement if it only reads data. Session and user variables set with SET (or .txn-mode and .isolation) are replayed whenever a new connection is made, so a reconnect or failover doesn't silently change the session's behavior
+
+-retries, -retry-backoff: Connection retries (default 3) and the delay before the first retry (default 500ms), which doubles after each attempt with jitter. Also configurable as retries and retry_backoff in the configuration file
+
+-socket: Connect through a Unix socket instead of host and port, e.g. for auth_socket authentication (the user defaults to the current OS user). Also configurable as socket
+
+-allow-cleartext-passwords: Allow the mysql_clear_password auth plugin, as needed by LDAP-backed or proxy authentication. The password is only ever sent this way over TLS. Also configurable as allow_cleartext_passwords = true
+
+-proxy-protocol: Send a PROXY protocol v1 header when connecting, for HAProxy or ProxySQL setups that expect one. Also configurable as proxy_protocol = true
+
+-query-comment: Comment prepended to every statement, e.g. -query-comment 'app=tip', to match proxy routing rules or find tip in the slow query log. Also configurable as query_comment
+
+-ssl-mode: TLS mode, one of disabled, preferred (default: TLS with a verified certificate, falling back to plaintext with a warning if the handshake fails), required (TLS without certificate verification), verify-ca (certificate signed by a trusted CA) or verify-identity (trusted certificate issued for the host). Anything but preferred never falls back to plaintext
+
+-ssl-ca, -ssl-cert, -ssl-key: PEM files of the CA to trust instead of the system roots, and of a client certificate and its key. The TLS settings are also configurable as ssl_mode, ssl_ca, ssl_cert and ssl_key
+
+tip identifies itself with the program_name, program_version and os_user connection attributes, which show up in performance_schema.session_connect_attrs and in proxy logs.
+`},
+	{[]string{"config"}, `
+tip -init (or .setup in the REPL) asks for the host, port, user, password, database and TLS mode, tests the connection and writes them to the configuration file, either as the default connection or as a named profile. The previous file is kept as config.toml.bak, since comments don't survive the rewrite.
+
+To write it by hand, create a file named config.toml in the ~/.tip/ directory with the following format:
+
+  host="127.0.0.1"
+  port="4000"
+  user="root"
+  password="your_password"
+  database="test"
+
+The file is checked when it is loaded: a misspelled key or section, or a value of the wrong kind, stops tip with an error pointing at it, e.g. unknown key 'pasword' in profile 'prod', did you mean 'password'?, rather than the setting being silently ignored. tip config shows the settings a file resolves to.
+
+Additional connections can be defined as named profiles, used by commands that work across clusters (e.g. .to-insert --profile staging):
+
+  [profiles.staging]
+  host="staging.example.com"
+  port="4000"
+  user="root"
+  password="your_password"
+  database="test"
+
+A profile can also set up the REPL for the way the cluster is used, and run statements on connecting. With -profile analytics the results below come out as CSV without the row limit, while -profile prod refuses an UPDATE or DELETE without WHERE or LIMIT:
+
+  [profiles.analytics]
+  host="tidb-olap.example.com"
+  output_format="csv"        # plain, table, json, jsonl, csv, batch or chart; -o still wins
+  safe_row_limit="off"       # rows shown for a SELECT without LIMIT, see .limit
+  pager=false                # see .pager
+  init_sql="SET @@tidb_isolation_read_engines='tiflash,tidb'; SET @@tidb_mem_quota_query=8589934592"
+
+  [profiles.prod]
+  host="tidb-primary.example.com"
+  safe_mode=true             # see .safe-mode
+
+init_sql runs once the connection is established, for -e as well as the REPL, and the variables it sets are restored after a reconnect like those set by hand. .safe-mode on|off turns safe mode on or off in the REPL.
+
+The options of the MySQL driver can be tuned per connection for workloads with large rows or slow networks:
+
+  [profiles.etl]
+  host="tidb.example.com"
+  max_allowed_packet="256M"  # largest packet tip sends, default 64M; "server" uses the server's max_allowed_packet
+  read_timeout="5m"          # I/O timeouts, none by default
+  write_timeout="30s"
+  interpolate_params=true    # send arguments inline instead of preparing statements on the server
+
+max_allowed_packet bounds the size of the statements tip sends, such as the INSERTs of tip import or any statement with large values; the server refuses packets over its own max_allowed_packet either way, so raise both together. read_timeout applies to every read, so a query that takes longer than it to return its first row fails with an i/o timeout. interpolate_params saves the prepare round trip of statements with arguments. A connection string accepts the same options as maxAllowedPacket, readTimeout, writeTimeout and interpolateParams parameters, as in a Go MySQL driver DSN, and .status shows those in use next to the server's limit.
+
+The REPL checks the configuration file before every prompt. When it has changed, output_format, pager, safe_row_limit and safe_mode of the connection in use are applied right away and tip prints what changed; other connection settings take effect the next time tip starts, and the [ai] settings are read by every .ask.
+
+You can also set the following environment variables. tip's own variables win over the TIDB_* ones, which win over the MYSQL_* variables used by the mysql client:
+
+  | Setting  | tip           | TiDB            | MySQL            |
+  | host     | DB_HOST     | TIDB_HOST     | MYSQL_HOST     |
+  | port     | DB_PORT     | TIDB_PORT     | MYSQL_TCP_PORT |
+  | user     | DB_USERNAME | TIDB_USER     | MYSQL_USER     |
+  | password | DB_PASSWORD | TIDB_PASSWORD | MYSQL_PWD      |
+  | database | DB_DATABASE | TIDB_DATABASE | MYSQL_DATABASE |
+
+Settings are resolved in this order of precedence: command-line flags, then the configuration file, then environment variables.
+`},
+	{[]string{"scripting"}, `
+-param: Value bound to the next ? placeholder of the -e statement, repeatable: tip -e "SELECT * FROM t WHERE id = ? AND name = ?" -param 42 -param 'abc'. The values are sent separately from the SQL, so they need no quoting or escaping. Also accepted by tip query and tip export
+
+-f: Execute the SQL statements of a file and exit, -f - reads them from standard input
+
+-force: Keep running the statements read from a pipe after one fails. Without it tip stops at the first failing statement, as mysql does; either way it exits with status 1 when a statement failed
+
+-check: Check the syntax of the -f statements (or of standard input) without connecting or running them, see .check. Errors are printed as file:line:column: message and the exit status is 1 if there are any, e.g. tip -check -f migrations/0042_add_index.sql in CI. With -explain the queries and DML statements are also run through EXPLAIN on the server
+
+-format-sql: Pretty-print the -f statements, or those of standard input, and exit without connecting: tip -format-sql < query.sql, see .format
+
+-watch: Re-run the -e statement every given number of seconds, showing the change of numeric columns (Ctrl+C to stop)
+
+-offline: Start the REPL without connecting; the connection is made on the first statement (the prompt shows tip(offline)> until then)
+`},
+	{[]string{"output"}, `
+tip supports these output formats:
+1. Plain: Simple text output
+2. Table: Formatted table output (default)
+3. JSON: JSON-formatted output, an array of rows or, with -json-envelope, an object per statement and line that also has the column types and timing. The keys of a row follow the order of the columns, so that the output of two runs can be diffed; -json-sort-keys or .set jsonkeys sorted sorts them by name
+4. JSONL: One JSON object per row and line, streamed as the rows arrive so results can be piped into jq or bulk loaders
+5. CSV: Comma-separated values
+6. XLSX: Excel workbook, written to the file given with -O, e.g. tip -e "SELECT ...; SELECT ..." -o xlsx -O report.xlsx. Each statement that returns a result set gets its own sheet, with a header row even when it has no rows. Numbers and dates are written as typed cells, with DECIMAL values as the server sent them; those with more than the 15 significant digits spreadsheets keep are written as text
+7. Parquet: Parquet file for Spark, DuckDB or pandas, written to the file given with -O, e.g. tip -e "SELECT ..." -o parquet -O out.parquet. Integer, floating point, DECIMAL, DATE and DATETIME/TIMESTAMP columns keep their types, other columns are written as strings. DECIMAL columns of more than 38 digits, which Spark and most Parquet readers reject, are written as strings with a warning, and zero dates such as 0000-00-00 as NULL. A value that can't be converted to its column's type stops the export with an error naming the row and column
+8. Batch: Tab-separated values like mysql --batch, with a header row unless -N and no output for statements that return no rows, so that tip can stand in for mysql in shell pipelines: tip -B -N -e "SELECT id FROM users" | xargs .... Tabs, newlines and backslashes within values are escaped as \t, \n and \\ unless -raw is given
+9. Chart: Bar charts of results with labels in the first column and numbers in the second, such as those of a GROUP BY, drawn across the terminal; other results are shown as a table. .chart line draws them as a line instead
+
+You can specify the output format using the -o flag. Table and chart output are only shown on the terminal, so -O needs one of the other formats, e.g. -o csv -O out.csv.
+
+-B (or --batch), -raw: Print results as tab-separated values like mysql --batch, with tabs, newlines and backslashes escaped unless -raw is given
+
+CSV is written with a header row of the column names, and fields holding the delimiter, the quote character or a line break are quoted, with quotes within them doubled. -skip-column-names leaves the header out, -csv-delimiter ';' (or \t for tab-separated values) and -csv-quote "'" change the delimiter and quote character, on the terminal as in files written with -O. In the REPL, .set header off, .set delimiter <char> and .set quote <char> do the same.
+
+-json-envelope gives tools reading the JSON output the schema and timing of a result without parsing stderr. Each statement is written on its own line, with the columns even when there are no rows, and affected_rows in the stats of statements other than queries:
+
+  $ tip -o json -json-envelope -e "SELECT id, name FROM users LIMIT 1"
+  {"columns":[{"name":"id","type":"BIGINT"},{"name":"name","type":"VARCHAR"}],"rows":[{"id":"1","name":"alice"}],"stats":{"duration_ms":1.234,"row_count":1}}
+
+-O gsheet://<spreadsheet-id>/<tab> writes the results into a tab of a Google Sheets spreadsheet instead of a file, e.g. tip -e "SELECT ..." -O gsheet://1BxiMVs0XRA5nFMdKvBdBZjgmUUqptlbs74OgvE2upms/Daily. The tab is created if the spreadsheet doesn't have it and cleared if it does, the first row holds the column names and numbers are written as numbers; the results of further statements go to tabs named Daily 2, Daily 3 and so on. tip authenticates as a service account whose JSON key is in credentials_file of a [gsheet] section of the config file or in GOOGLE_APPLICATION_CREDENTIALS, and the spreadsheet must be shared with the service account's email. To write as yourself, put an OAuth access token with the spreadsheets scope in access_token of [gsheet] or in GOOGLE_OAUTH_ACCESS_TOKEN, e.g. from gcloud auth print-access-token.
+`},
+	{[]string{"session"}, `
+Statements run on a single connection, like with the mysql client, so USE, session variables, temporary tables and transactions apply to the statements that follow. When the server closes the connection (e.g. after wait_timeout), tip reconnects right away, restores the current database and the session variables and runs the statement again, printing a notice instead of an error. Only statements that never reached the server, or that only read (SELECT without a locking clause or INTO, SHOW, EXPLAIN without ANALYZE), are run again. Anything else interrupted mid-flight, such as DML, LOAD DATA, DDL or ANALYZE, may already have taken effect, as may anything inside a lost transaction; tip says so instead of running it again. Temporary tables and locks of the lost session are gone.
+
+While a transaction started with BEGIN (or .begin) is open the prompt ends in *, e.g. test*>, until COMMIT, ROLLBACK or a DDL statement ends it. .commit and .rollback are shortcuts for ending it, and leaving the REPL with an open transaction asks for confirmation, since its changes would be rolled back.
+
+The dot in front of the prompt shows the health of the connection, which is pinged in the background: 🟢 connected, 🟡 slow to answer, 🔴 unreachable. Set NO_COLOR to hide it.
+
+Should a command or statement hit a bug in tip, the REPL reports it and returns to the prompt instead of exiting, after saving the history. With -crash-dump, the stack trace also goes to ~/.tip/crash-<time>.txt, with the name of the command and the type of the panic but not its value, the arguments or the statement; attaching it to an issue helps fix the bug.
+
+When tip is terminated (SIGTERM), its terminal hangs up (SIGHUP) or it gets a SIGINT while waiting at the prompt, it exits as cleanly as with Ctrl+D: the history is saved, the terminal restored, an open transaction rolled back with a warning, materialized tables dropped and the connection closed. Statements still queued by .queue are printed since they are lost. A statement still running after 3 seconds leaves the rest to the server.
+`},
+	{[]string{"debug"}, `
+To troubleshoot a connection or an environment that behaves oddly, -debug appends a log to ~/.tip/debug.log (or the file given with -debug-file): the DSN with the password masked, the TLS settings and the version and cipher negotiated, every connection attempt and retry with its error, the duration of every statement, and the requests sent to the AI backend (without their API keys), along with the messages tip prints. The passwords of statements such as CREATE USER or SET PASSWORD, and those that error messages quote, are masked.
+`},
+	{[]string{"export"}, `
+  tip export -e "<sql>" -O out.csv
+  tip export -t <table> -O out.csv
+
+Export results to a file (csv by default). -output-encoding gbk|latin1|... writes the file in a legacy encoding instead of UTF-8. -manifest also writes out.meta.json with the SQL, host, database, server and tip versions, session variables, and the row count, duration and snapshot TSO of each statement, so that the extract can be audited or reproduced with SET tidb_snapshot. -consistent runs all statements of -e at the TSO current when the export starts. If the file can't be written, e.g. when the disk is full, tip reports how many rows it had sent to the writer (the last of them may not have reached the file, which is written through a buffer), renames the file to out.csv.partial and exits with status 3, while a statement that fails midway exits with status 1 and leaves the rows written so far in a well-formed file
+`},
+	{[]string{"import"}, `
+  tip import -t <table> -f data.csv
+
+Import a CSV file (with a header row unless -no-header) into a table. On a terminal it shows the rows, bytes and rows/sec loaded so far with the percentage and ETA of the file, -max-rate <rows/s> throttles the load. Rows that can't be imported are written with their line number and error to data.rejected.csv (or the file given with -rejects) and the import goes on; rows that aren't valid CSV are written as they appear in the file. When reading standard input, a bad row stops the import unless -rejects <file> is given. -input-encoding gbk|latin1|... converts a file in a legacy encoding to UTF-8 while loading it. -null, -trim and -rules convert fields as described by tip help .import
+`},
+	{[]string{"replay-log"}, `
+  tip replay-log <tidb-slow-log-file>
+
+Replay the statements of a TiDB slow log against the cluster for capacity testing. Each connection of the log is replayed on a connection of its own, with the statements started at their original pace, -speed 2x twice as fast. -filter digest=<digest> (or db=, user=, conn=, repeatable) selects statements, -read-only skips writes and -dry-run lists what would be replayed. It ends with the replayed latencies next to the logged ones and the errors met
+`},
+	{[]string{"bench"}, `
+  tip bench -e "<sql>" -concurrency 16 -duration 30s
+
+Run a statement over and over on concurrent connections for a quick smoke test, then print the QPS, the average, p50, p95, p99 and max latency, and the errors by message. -param binds placeholders as for tip query, -warmup 10s runs before measuring and -report-interval 5s prints the throughput while running. It exits non-zero when any statement failed
+
+  tip bench ... -save before
+
+Also save the results as JSON in ~/.tip/bench/before.json (or to a given .json file). After changing an index or a setting, run the benchmark again with -save after and compare the runs with tip bench compare before after, or .bench compare before after in the REPL: the QPS, average, percentile and max latencies and errors side by side with the change, flagged better or worse past 5%. .bench list lists the saved runs
+`},
+	{[]string{"workload"}, `
+  tip workload run oltp_read_write -tables 10 -rows 100000 -threads 32 -duration 5m -d sbtest
+
+Run a sysbench-like OLTP workload and print the transactions and statements per second, the average, p50, p95, p99 and max latency of the transactions, and the errors. The tables sbtest1 to sbtestN are laid out as sysbench lays them out, and run creates and loads the missing ones first; tip workload prepare only loads them and tip workload cleanup drops them. The presets are oltp_read_write, oltp_read_only, oltp_write_only (sysbench's transaction mixes of point selects, range queries, updates, and a delete followed by an insert), oltp_point_select, oltp_update_index, oltp_update_non_index and oltp_insert. The statements are prepared on each connection, -range-size sets the rows read by the range queries and -report-interval how often the throughput is printed while running (10s)
+`},
+	{[]string{"daemon"}, `
+  tip daemon
+
+Hold warm, authenticated connections (-pool 4) for scripts that call tip -e many times. While it runs, tip -e with the same connection settings sends its statements to the daemon over ~/.tip/daemon.sock, which only the user can open, instead of connecting, saving the TCP, TLS and authentication round trips of every invocation; statements with -param are prepared once per connection and reused. Every invocation still gets a session of its own: a connection whose session was changed by SET, USE, BEGIN, temporary tables or a failed statement is closed and replaced. Settings that differ from those of the daemon, -O, -watch and -no-daemon make tip -e connect itself. The daemon pings its connections every minute and exits after -idle-timeout (30m) without requests; tip daemon status shows what it serves and tip daemon stop stops it. Reads aren't routed to a read endpoint by the daemon
+`},
+	{[]string{".status"}, `
+.status shows the server and read endpoint in use, the connection id, the user and the account it authenticated as, the current database, TLS version and cipher, the server and TiDB release, uptime, character sets, time zone, the packet size, I/O timeouts and parameter handling of the driver, round trip time, and whether a transaction is open or a snapshot is pinned, all of which the greeting only shows at connect time, if at all.
+`},
+	{[]string{".tables", ".describe"}, `
+.tables lists the tables of the current database with their type: table, view, sequence, or temporary table for the local temporary tables created in the session, which tip keeps track of since no metadata query lists them. .describe <table> shows the columns of any of them, preceded by the definition of a view or sequence. For tables it lists the expression of each generated column, whether it is stored or virtual, and the definitions of expression indexes, which the column list doesn't show. Temporary tables are offered by completion too.
+`},
+	{[]string{".materialize"}, `
+.materialize <name> <query> runs an expensive query once and keeps its result in a local temporary table of the session, so that the follow-up queries read the table instead: .materialize active_users SELECT user_id, COUNT(*) AS n FROM events WHERE ts > NOW() - INTERVAL 1 DAY GROUP BY user_id. The table gets the column types of the result, with strings as TEXT, and materializing again under the same name refreshes it. .materialize alone lists the tables with their row counts and queries. They are dropped when tip exits.
+`},
+	{[]string{".snapshot"}, `
+.snapshot <time> switches the session to reading the data as it was at an earlier point in time, through tidb_snapshot, to see e.g. what a row looked like before it was changed: .snapshot -1h, .snapshot '2024-05-01 09:30:00' (in the session time zone) or .snapshot <tso>. The prompt shows the time read at, such as test@2024-05-01 09:30:00>, writes fail until .snapshot off, and .snapshot alone tells which data is read. The time must be within the GC life time of the cluster (tidb_gc_life_time, 10 minutes by default).
+`},
+	{[]string{".partitions"}, `
+.partitions <table> lists the partitions of a table with their bounds and estimated row counts. --query <where clause> (last on the line) explains SELECT * FROM <table> WHERE <clause> and marks each partition as scanned or pruned, to check that a partitioning design prunes for the queries it is meant for: .partitions orders --query created_at >= '2024-06-01'.
+`},
+	{[]string{".regions", ".hotspots"}, `
+.regions <table> lists the regions holding the rows and indexes of a table, from SHOW TABLE ... REGIONS, with their leader store, size, keys and recent traffic, followed by the number of leaders on each TiKV store and whether they are scattered over the stores or piled up on one, the sign of a hotspot waiting to happen (--summary shows only the latter). .hotspots [read|write] lists the hottest regions of the cluster from TIDB_HOT_REGIONS with the table and index each belongs to, and the tables taking most of the traffic; --limit <n> changes the number of regions listed (20).
+`},
+	{[]string{".id-capacity"}, `
+.id-capacity [db] shows for each table with an AUTO_INCREMENT or AUTO_RANDOM column the next id, the largest id its type (and the shard bits of AUTO_RANDOM) allows, how much of the range is used and when it runs out at the current pace, tables closest to running out first. The pace is measured from the ids seen by a previous run within the last day, kept in ~/.tip/id_samples.json, or else from the table's creation time.
+`},
+	{[]string{".upgrade-check"}, `
+.upgrade-check <target-version> checks the cluster before an upgrade to a TiDB release such as v8.1.0: deprecated or removed settings still in use in the releases between the current and the target version (TiDB Binlog, Fast Analyze, static partition pruning, sql_mode values MySQL 8.0 removed), tables with version 1 statistics and unfinished DDL jobs. Each finding has a severity: blocker, warning or info.
+`},
+	{[]string{".compat-check"}, `
+.compat-check <file.sql|db> checks a schema migrating from MySQL: the statements of a SQL file such as a mysqldump, or the tables, views and stored programs of a database on the connected server. It reports what TiDB can't parse or run (stored procedures, triggers, spatial types, CREATE TABLE ... SELECT), what it accepts but ignores (storage engines, FULLTEXT indexes, foreign keys before v6.6.0) and queries whose results differ from MySQL (LIMIT or GROUP BY without ORDER BY, SQL_CALC_FOUND_ROWS, LOCK IN SHARE MODE).
+`},
+	{[]string{".check"}, `
+.check [--explain] <sql|file.sql> parses statements, or the statements of a file, with the bundled TiDB parser and reports syntax errors with their line and column, without running anything. --explain also runs EXPLAIN for the queries and DML statements, which catches unknown tables and columns without executing them; USE statements of the script are followed, DDL statements and the statements using a table the script creates itself are only parsed.
+`},
+	{[]string{".format"}, `
+.format <sql> pretty-prints statements as the TiDB parser reads them: keywords in upper case, names quoted, one clause per line, the AND and OR of WHERE and HAVING on lines of their own, subqueries indented and the columns of CREATE TABLE one per line. Comments are not kept, and the parser's canonical forms are used, e.g. COUNT(1) for COUNT(*). In the REPL, Ctrl+F formats the line being typed the same way, kept on one line.
+`},
+	{[]string{".latency"}, `
+.latency <digest|query> [--days n] draws the latency of a statement over the last days (7 by default) as a day by hour heatmap from CLUSTER_STATEMENTS_SUMMARY_HISTORY, so that a slowdown coming back at the same hour every day stands out. The statement is given by its digest or as SQL, whose digest is computed locally. The statements summary keeps no percentiles, so each cell shows the slowest execution of the hour, the closest to a p99 it has; --avg shows the average instead. The history only goes as far back as tidb_stmt_summary_history_size windows, or longer with persisted statements summary.
+`},
+	{[]string{".top"}, `
+.top [by latency|calls|mem] answers "what is hammering my cluster": it lists the statement digests of the current statements summary window across all TiDB instances, heaviest first by total latency (default), number of executions or peak memory, with their average and max latency and a sparkline of their average latency over the last 12 windows, e.g. ▁▁▂▁▁▃▇█ for a statement getting slower. --limit <n> changes the number of digests shown (10), and .latency <digest> goes into one of them.
+`},
+	{[]string{".pager"}, `
+In table format, results taller than the terminal are shown a page at a time with the column names repeated at the top of every page: space shows the next page, enter the next line and q skips the rest. .pager off prints results in one go.
+`},
+	{[]string{".tee", ".notee"}, `
+.tee <file> appends everything the session prints from then on to a file, like the mysql client's tee: the statements with their prompt, results, errors and execution times, without colors. Passwords in CREATE USER, SET PASSWORD or .connect are masked, and paged results are written in full. .notee stops it, .tee alone shows the file in use, and -tee <file> starts the session with it, e.g. to keep an audit trail of changes made by hand on production.
+`},
+	{[]string{".limit"}, `
+To keep a stray SELECT * FROM big_table from flooding the terminal, a single SELECT typed in the REPL without a LIMIT shows at most 1000 rows, followed by showing first 1000 rows (use .limit off) when there were more. .limit <n> changes the number and .limit off lifts it; safe_row_limit = 200 (or "off") in the configuration file sets it at startup. Statements run with -e and exports are never limited.
+`},
+	{[]string{".set"}, `
+NULL is shown as NULL in the table, plain and CSV output; .set nullvalue '' shows it as an empty field instead (.set nullvalue \N as LOAD DATA writes it), JSON keeps null. Values of BINARY, VARBINARY, BLOB, BIT and GEOMETRY columns, and any bytes that are not UTF-8 text, are never written to the terminal raw: by default the bytes that are not printable are escaped as \xNN, .set binary hex shows 0x0A1B... and .set binary base64 base64. The settings apply to every output format and to exports, .set alone shows them. Dumps and .to-insert keep the exact values.
+
+Values are shown according to the types of their columns: DECIMAL and UNSIGNED BIGINT values keep all their digits, and doubles are printed without rounding. .set timezone Asia/Shanghai (or +08:00) shows TIMESTAMP values converted from the time zone of the session to the given one (DATETIME values carry no time zone and are left as they are), .set datetime '%Y/%m/%d %H:%i' formats them with the specifiers of DATE_FORMAT, and .set json pretty indents the values of JSON columns over several lines in the table, plain and CSV output. off and compact go back to the values as the server sends them. The time zone of the session is read again after SET time_zone and on every new connection.
+`},
+	{[]string{".processlist", ".kill"}, `
+.processlist [full] lists the connections of every TiDB instance from CLUSTER_PROCESSLIST, longest running statements first; statements running for 10 seconds are shown in yellow and for a minute in red, and full shows them without cutting them short. .kill <id> kills a connection and .kill query <id> only the statement it is running.
+`},
+	{[]string{".dump"}, `
+.dump <table|db> [file] writes a table or a whole database as mysqldump-compatible SQL (CREATE TABLE and batched INSERT statements, then the CREATE VIEW statements of the database's views), streaming the rows so large tables can be dumped. --no-data and --no-create leave out the rows or the table and view definitions, and --where <condition> (last on the line) selects the rows to dump of a single table. --consistent pins tidb_snapshot to the current TSO for the whole dump, so that all tables reflect a single point in time; the TSO is noted in the dump header.
+`},
+	{[]string{".export-subset"}, `
+.export-subset <table> [file] --follow-fk --where <condition> exports the rows of a table matching the condition as INSERT statements, and with --follow-fk walks the foreign keys to bring in the rows referencing them (recursively) and every row those reference, so that the subset loads without dangling references. It is meant for pulling, say, one tenant's data into a staging database: .export-subset tenants tenant42.sql --follow-fk --consistent --where id = 42. The selected rows are collected in memory before they are written.
+`},
+	{[]string{".share"}, `
+.share uploads the last statement to a secret GitHub gist and prints its URL, to pass a query on to a colleague; --rows <n> adds the first rows of its result as a Markdown table and --public makes the gist public. It needs a token with the gist scope, in github_token of a [share] section of the config file or in GITHUB_TOKEN. --cloud is refused, as the TiDB Cloud console has no API for share links.
+`},
+	{[]string{".copy"}, `
+.copy puts the last result set on the clipboard as tab-separated values with a header row, ready to paste into a spreadsheet, and .copy SELECT ... does the same with the result of a query without printing it. .copy -csv copies CSV instead. tip uses pbcopy on macOS, clip on Windows and wl-copy, xclip, xsel or WSL's clip.exe on Linux; without any of them, e.g. over SSH, it asks the terminal to set the clipboard with the OSC 52 escape sequence.
+`},
+	{[]string{".chart"}, `
+.chart bar|line draws the last result set, and .chart bar|line SELECT ... the result of a query, as a chart on the terminal: the first column holds the labels and the second the numbers. A bar chart has a bar per row, scaled to the largest value; a line chart plots the rows from left to right in braille characters, with the lowest and highest values on the left and the first and last labels below. -o chart or .output_format chart draws every result that fits as a bar chart, which goes well with -watch:
+
+  tip> .chart bar SELECT status, COUNT(*) FROM orders GROUP BY status;
+  cancelled │███▍ 412
+  paid      │████████████████████████████████████████████████████████ 6731
+  pending   │████████▋ 1043
+`},
+	{[]string{".clone-schema"}, `
+.clone-schema <src_db> <dst_db> creates the sequences, tables and views of a database in another, new or empty, one without their rows, e.g. to spin up a structural copy for testing. References to the source database are rewritten and auto increment counters start over. --profile <name> creates the copy on the cluster of a profile instead.
+`},
+	{[]string{".datadiff"}, `
+.datadiff <table> --against profile:<name>|snapshot:<time> compares the rows of a table with the same table on the cluster of a profile, or with its data at an earlier time (snapshot:-1h, a TSO or a date and time), to validate a migration or a CDC pipeline. The primary keys are split in ranges of --chunk rows (10000 by default) whose row counts and checksums are compared on both sides, and only the rows of the ranges that differ are compared one by one. The rows that differ or exist on one side only are listed by primary key, up to --limit (100). --where <condition>, which takes the rest of the line, restricts the rows compared, e.g. to those updated before the replication lag. Tables without a primary key can't be compared, their row ids differ between clusters.
+`},
+	{[]string{".import"}, `
+.import <file.csv> <table> loads a CSV file in batches, showing the progress and ETA while it runs; --max-rate <rows/s> throttles it. Rows that fail to insert or aren't valid CSV are written with their line number and the error to <file>.rejected.csv (e.g. data.rejected.csv) and the import continues, with the number of rejected rows in the final summary. --input-encoding gbk|latin1|... reads files in a legacy encoding; MySQL character set names and the usual encoding labels are accepted.
+
+Messy files can be cleaned up while loading: --null <token> (repeatable, e.g. --null \N --null NULL) inserts matching fields as NULL and --trim strips spaces around fields. --rules <file> takes these settings per column, along with date formats and boolean tokens; column sections are named after the header, or numbered from 1 for files without one, and start from the top-level settings. Rows whose fields don't match a date format are rejected like other bad rows:
+
+  null = ["\\N", "NULL"]
+  trim = true
+
+  [columns.created_at]
+  date_format = "%d/%m/%Y %H:%M"
+
+  [columns.active]
+  true = ["yes", "Y"]
+  false = ["no", "N"]
+
+--validate-only reads the whole file and checks every row against the columns of the table (types, ranges, lengths, NULLs, ENUM values and dates) without inserting anything, then lists the errors the import would hit and the INSERT statements it would run. tip import -validate-only exits non-zero when any row would be rejected.
+`},
+	{[]string{".queue"}, `
+With .queue on, statements entered while the connection is down are queued instead of rejected. So are reads that lose the connection, but not other statements that reached the server before it went away, since they may have taken effect; tip reports those as errors. Once the connection answers a ping again, tip lists them and asks whether to replay them. .queue shows the queue and .queue clear empties it.
+`},
+	{[]string{".highlight"}, `
+Keywords, strings, numbers and comments are colored as statements are typed at the prompt. .highlight off turns it off, as does NO_COLOR.
+`},
+	{[]string{".history"}, `
+Statements are kept in ~/.tip/history. Press Ctrl+R in the prompt to search it incrementally, list it with .history [n], search it with .history search <term> and re-run an entry with .history run <n> or !n.
+`},
+	{[]string{".autoexplain"}, `
+With .autoexplain on, tip runs EXPLAIN after every SELECT in the session and keeps the plan with the history entry in ~/.tip/history_plans (the last 500 plans). After noticing a slow result, .history explain <n> shows the plan the statement got when it ran, even if statistics have changed since.
+`},
+	{[]string{".ask"}, `
+.ask uses tidb.ai (https://tidb.ai) by default. An OpenAI compatible endpoint, Azure OpenAI or a local Ollama (https://ollama.com) server can be configured instead:
+
+  [ai]
+  provider="openai"          # tidbai (default), openai, azure or ollama
+  base_url="https://api.openai.com/v1"
+  api_key="sk-..."           # defaults to $OPENAI_API_KEY / $AZURE_OPENAI_API_KEY
+  model="gpt-4o-mini"
+  # api_version="2024-02-01" # azure only
+  # stream=false             # wait for the whole answer instead of rendering it as it arrives
+`},
+	{[]string{".telemetry"}, `
+tip reports nothing unless you opt in with .telemetry on, .telemetry off turns it off again and deletes the counts not sent yet. While it is on, tip counts the names of the commands and subcommands used, the statements run, and the classes of the errors met: the number of a server error, a lost connection, a wrong command line or other. SQL text, arguments, names of databases and tables, hosts and users are never recorded. The counts are kept in ~/.tip/telemetry.json and posted once a day to the endpoint of the [telemetry] section of the configuration file; without one they are never sent. .telemetry status prints the next report, which has this schema:
+
+  {
+    "schema": 1,                             // version of the payload
+    "install_id": "3f2a...",                 // random, drawn anew by every .telemetry on
+    "version": "v0.9.0", "os": "linux", "arch": "amd64",
+    "since": "2024-05-01T09:00:00Z",         // start of the period counted, to the hour
+    "usage": {".explain": 12, "statement": 340, "tip export": 2},
+    "errors": {"mysql-1146": 3, "connection": 1, "usage": 2, "other": 1}
+  }
+`},
+	{[]string{".route"}, `
+A connection can send read-only statements to a separate endpoint, e.g. TiProxy or a follower-read setup, with read_host (and read_port if it differs). SELECTs without a locking clause or INTO, SHOW and EXPLAIN (without ANALYZE) go to the read endpoint, and every other statement to the write endpoint. While a transaction is open, all statements go to the write endpoint so that they see its changes. Statements on the temporary tables of the session, including those of .materialize, go there too, since the read endpoint doesn't have them. USE and SET of session or user variables are repeated on the read endpoint. .route shows the endpoints, .route read|write sends everything to one of them and .route auto restores the default:
+
+  [profiles.prod]
+  host="tidb-primary.example.com"
+  read_host="tidb-follower.example.com"
+`},
+}
+
+// findHelpTopic returns the topic of a name, with or without the dot of a REPL command
+func findHelpTopic(name string) *helpTopic {
+	for _, candidate := range []string{name, "." + name} {
+		for i := range helpTopics {
+			for _, n := range helpTopics[i].names {
+				if n == candidate {
+					return &helpTopics[i]
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// helpTopicNames returns the first name of every topic
+func helpTopicNames() []string {
+	var names []string
+	for _, topic := range helpTopics {
+		names = append(names, topic.names[0])
+	}
+	return names
+}
+
+// listItemRe matches the start of an item of a list, "- " or "1. "
+var listItemRe = regexp.MustCompile(`^(- |\d+\. )`)
+
+// printHelpText writes text wrapped at helpWidth columns. Indented lines are written
+// as they are, and the lines of a list item are indented under its text.
+func printHelpText(w io.Writer, text string) {
+	for _, line := range strings.Split(strings.Trim(text, "\n"), "\n") {
+		if line == "" || strings.HasPrefix(line, " ") {
+			fmt.Fprintln(w, line)
+			continue
+		}
+		indent := ""
+		if m := listItemRe.FindString(line); m != "" {
+			indent = strings.Repeat(" ", len(m))
+		}
+		width := 0
+		for i, word := range strings.Fields(line) {
+			n := runewidth.StringWidth(word)
+			if i > 0 && width+1+n > helpWidth {
+				fmt.Fprint(w, "\n"+indent)
+				width = len(indent)
+			} else if i > 0 {
+				fmt.Fprint(w, " ")
+				width++
+			}
+			fmt.Fprint(w, word)
+			width += n
+		}
+		fmt.Fprintln(w)
+	}
+}
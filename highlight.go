@@ -0,0 +1,140 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+
+	"github.com/fatih/color"
+)
+
+// highlightEnabled controls SQL syntax highlighting in the REPL, color.NoColor
+// already accounts for NO_COLOR and non-terminal output
+var highlightEnabled = true
+
+var (
+	keywordColor = color.New(color.FgBlue, color.Bold)
+	stringColor  = color.New(color.FgGreen)
+	numberColor  = color.New(color.FgMagenta)
+	commentColor = color.New(color.FgHiBlack)
+)
+
+var highlightKeywords = map[string]bool{}
+
+func init() {
+	for _, kw := range KEYWORDS {
+		for _, w := range strings.Fields(kw) {
+			highlightKeywords[w] = true
+		}
+	}
+	for _, w := range []string{
+		"BY", "GROUP", "ORDER", "INTO", "VALUES", "TABLE", "DATABASE", "INDEX", "PRIMARY", "KEY",
+		"DISTINCT", "HAVING", "UNION", "ALL", "CASE", "WHEN", "THEN", "ELSE", "END", "LEFT", "RIGHT",
+		"INNER", "OUTER", "CROSS", "ASC", "DESC", "EXPLAIN", "ANALYZE", "BEGIN", "COMMIT", "ROLLBACK",
+		"WITH", "REPLACE", "IF", "TRUE", "FALSE", "DEFAULT", "UNIQUE", "DESCRIBE", "TRUNCATE", "COUNT",
+	} {
+		highlightKeywords[w] = true
+	}
+}
+
+// highlightSQL colorizes keywords, strings, numbers and comments of a SQL text
+func highlightSQL(s string) string {
+	var sb strings.Builder
+	runes := []rune(s)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case r == '-' && i+1 < len(runes) && runes[i+1] == '-', r == '#':
+			sb.WriteString(commentColor.Sprint(string(runes[i:])))
+			i = len(runes)
+		case r == '/' && i+1 < len(runes) && runes[i+1] == '*':
+			j := i + 2
+			for j+1 < len(runes) && !(runes[j] == '*' && runes[j+1] == '/') {
+				j++
+			}
+			j = min(j+2, len(runes))
+			sb.WriteString(commentColor.Sprint(string(runes[i:j])))
+			i = j
+		case r == '\'' || r == '"':
+			j := i + 1
+			for j < len(runes) && runes[j] != r {
+				if runes[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j < len(runes) {
+				j++
+			} else {
+				j = len(runes)
+			}
+			sb.WriteString(stringColor.Sprint(string(runes[i:j])))
+			i = j
+		case unicode.IsDigit(r) && (i == 0 || !isIdentRune(runes[i-1])):
+			j := i
+			for j < len(runes) && (unicode.IsDigit(runes[j]) || runes[j] == '.') {
+				j++
+			}
+			sb.WriteString(numberColor.Sprint(string(runes[i:j])))
+			i = j
+		case isIdentRune(r):
+			j := i
+			for j < len(runes) && isIdentRune(runes[j]) {
+				j++
+			}
+			word := string(runes[i:j])
+			if highlightKeywords[strings.ToUpper(word)] {
+				sb.WriteString(keywordColor.Sprint(word))
+			} else {
+				sb.WriteString(word)
+			}
+			i = j
+		default:
+			sb.WriteRune(r)
+			i++
+		}
+	}
+	return sb.String()
+}
+
+func isIdentRune(r rune) bool {
+	return r == '_' || r == '$' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+type HighlightCmd struct{}
+
+func (cmd HighlightCmd) Name() string {
+	return ".highlight"
+}
+
+func (cmd HighlightCmd) Description() string {
+	return "Toggle SQL syntax highlighting of statements as they are typed in the REPL"
+}
+
+func (cmd HighlightCmd) Usage() string {
+	return ".highlight [on|off]"
+}
+
+func (cmd HighlightCmd) Handle(args []string, resultWriter io.Writer) error {
+	if len(args) == 0 {
+		state := "off"
+		if highlightEnabled {
+			state = "on"
+		}
+		resultWriter.Write([]byte(fmt.Sprintf("Highlighting is %s\n", state)))
+		return nil
+	}
+	switch args[0] {
+	case "on":
+		highlightEnabled = true
+		if color.NoColor {
+			resultWriter.Write([]byte("Colors are disabled (NO_COLOR is set or output is not a terminal), highlighting has no effect\n"))
+		}
+	case "off":
+		highlightEnabled = false
+	default:
+		return fmt.Errorf("usage: %s", cmd.Usage())
+	}
+	return nil
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultHistoryListSize is the number of entries .history lists without an argument
+const defaultHistoryListSize = 20
+
+// replLine is the line editor of the running REPL, it holds the history of the session
+var replLine *lineEditor
+
+// historyRefRe matches the !n shorthand for .history run n
+var historyRefRe = regexp.MustCompile(`^!(\d+)$`)
+
+// historyFilePath returns the path of the file the REPL history is kept in
+func historyFilePath() string {
+	return filepath.Join(os.Getenv("HOME"), ".tip/history")
+}
+
+// historyEntries returns the history, oldest first. Within the REPL it includes
+// the entries of the current session, otherwise it is read from the history file.
+func historyEntries() ([]string, error) {
+	var r io.Reader
+	if replLine != nil {
+		var buf bytes.Buffer
+		if _, err := replLine.WriteHistory(&buf); err != nil {
+			return nil, err
+		}
+		r = &buf
+	} else {
+		f, err := os.Open(historyFilePath())
+		if os.IsNotExist(err) {
+			return nil, nil
+		} else if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	var entries []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		entries = append(entries, scanner.Text())
+	}
+	return entries, scanner.Err()
+}
+
+type HistoryCmd struct{}
+
+func (cmd HistoryCmd) Name() string {
+	return ".history"
+}
+
+func (cmd HistoryCmd) Description() string {
+	return "List, search or re-run previous statements (!n re-runs entry n, Ctrl+R searches in the prompt)"
+}
+
+func (cmd HistoryCmd) Usage() string {
+	return ".history [n | search <term> | run <n> | explain <n>]"
+}
+
+func (cmd HistoryCmd) Handle(args []string, resultWriter io.Writer) error {
+	entries, err := historyEntries()
+	if err != nil {
+		return fmt.Errorf("failed to read history: %v", err)
+	}
+
+	switch {
+	case len(args) == 0:
+		printHistory(resultWriter, entries, len(entries)-defaultHistoryListSize, nil)
+	case args[0] == "search" && len(args) > 1:
+		term := strings.ToLower(strings.Join(args[1:], " "))
+		printHistory(resultWriter, entries, 0, func(entry string) bool {
+			return strings.Contains(strings.ToLower(entry), term)
+		})
+	case args[0] == "run" && len(args) == 2:
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n < 1 || n > len(entries) {
+			return fmt.Errorf("no history entry %s", args[1])
+		}
+		resultWriter.Write([]byte(entries[n-1] + "\n"))
+		return runHistoryEntry(entries[n-1], resultWriter)
+	case args[0] == "explain" && len(args) == 2:
+		n, err := strconv.Atoi(args[1])
+		if err != nil || n < 1 || n > len(entries) {
+			return fmt.Errorf("no history entry %s", args[1])
+		}
+		resultWriter.Write([]byte(entries[n-1] + "\n"))
+		return printCapturedPlan(resultWriter, entries[n-1])
+	case len(args) == 1:
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n < 0 {
+			return fmt.Errorf("usage: %s", cmd.Usage())
+		}
+		printHistory(resultWriter, entries, len(entries)-n, nil)
+	default:
+		return fmt.Errorf("usage: %s", cmd.Usage())
+	}
+	return nil
+}
+
+// printHistory writes the entries from index start on that match filter, numbered from 1
+func printHistory(w io.Writer, entries []string, start int, filter func(string) bool) {
+	if start < 0 {
+		start = 0
+	}
+	for i := start; i < len(entries); i++ {
+		if filter == nil || filter(entries[i]) {
+			fmt.Fprintf(w, "%5d  %s\n", i+1, entries[i])
+		}
+	}
+}
+
+// runHistoryEntry executes a dot command or SQL statement taken from the history or the queue
+func runHistoryEntry(entry string, resultWriter io.Writer) error {
+	if strings.HasPrefix(entry, ".") {
+		if strings.HasPrefix(entry, ".history run") {
+			return fmt.Errorf("refusing to re-run a .history run entry")
+		}
+		return handleCmd(entry, resultWriter)
+	}
+
+	db, err := requireDB()
+	if err != nil {
+		return err
+	}
+	if err := checkSafeMode(entry); err != nil {
+		return err
+	}
+	startTime := time.Now()
+	isQ, output, hasRows, affectedRows, err := executeSQL(db, entry, nil)
+	if err != nil {
+		return err
+	}
+	if isQ {
+		lastResult = output
+	}
+	recordExecutedSQL(entry)
+	if isQ {
+		capturePlan(entry, entry)
+	}
+	printResults(isQ, output, *globalOutputFormat, hasRows, time.Since(startTime), affectedRows)
+	return nil
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// idSampleMaxAge is how long a sample of the next ids is kept before it is replaced.
+// Growth is measured since the sample, so this is the window the estimates look at.
+const idSampleMaxAge = 24 * time.Hour
+
+// autoRandomRe matches the AUTO_RANDOM(shard bits[, range bits]) attribute in SHOW CREATE TABLE
+var autoRandomRe = regexp.MustCompile(`(?i)AUTO_RANDOM\((\d+)(?:,\s*(\d+))?\)`)
+
+type IDCapacityCmd struct{}
+
+func (cmd IDCapacityCmd) Name() string {
+	return ".id-capacity"
+}
+
+func (cmd IDCapacityCmd) Description() string {
+	return "Show how much of the AUTO_INCREMENT and AUTO_RANDOM range of each table is used and when it runs out"
+}
+
+func (cmd IDCapacityCmd) Usage() string {
+	return ".id-capacity [db]"
+}
+
+// idSample is the next id of a table at a point in time
+type idSample struct {
+	Next int64     `json:"next"`
+	At   time.Time `json:"at"`
+}
+
+// idUsage is the auto id column of a table and how much of its range is used
+type idUsage struct {
+	table, column, kind, colType string
+	next                         int64
+	max                          *big.Int
+	created                      sql.NullInt64 // creation time of the table, in Unix seconds
+}
+
+func (cmd IDCapacityCmd) Handle(args []string, resultWriter io.Writer) error {
+	if len(args) > 1 {
+		return fmt.Errorf("usage: %s", cmd.Usage())
+	}
+	db, err := requireDB()
+	if err != nil {
+		return err
+	}
+	var dbName string
+	if len(args) == 1 {
+		dbName = strings.Trim(args[0], "`")
+	} else if err := db.QueryRow("SELECT IFNULL(DATABASE(), '')").Scan(&dbName); err != nil {
+		return err
+	}
+	if dbName == "" {
+		return fmt.Errorf("no database selected, use %s", cmd.Usage())
+	}
+	startTime := time.Now()
+
+	usages, err := loadIDUsages(db, dbName)
+	if err != nil {
+		return err
+	}
+	if len(usages) == 0 {
+		resultWriter.Write([]byte(fmt.Sprintf("No table of %s has an AUTO_INCREMENT or AUTO_RANDOM column.\n", dbName)))
+		return nil
+	}
+
+	samples := loadIDSamples()
+	now := time.Now()
+	cols := []string{"Table", "Column", "Kind", "Type", "Next ID", "Max ID", "Used", "Exhausted in"}
+	output := make([]RowResult, len(usages))
+	used := make([]float64, len(usages))
+	for i, u := range usages {
+		used[i], _ = new(big.Float).Quo(new(big.Float).SetInt64(u.next), new(big.Float).SetInt(u.max)).Float64()
+		key := writeAddr + "/" + dbName + "." + u.table
+		output[i] = RowResult{colNames: cols, colValues: []interface{}{
+			u.table, u.column, u.kind, u.colType, u.next, u.max.String(),
+			fmt.Sprintf("%.2f%%", used[i]*100), estimateExhaustion(u, samples[key], now),
+		}}
+		if s, ok := samples[key]; !ok || now.Sub(s.At) > idSampleMaxAge || u.next < s.Next {
+			samples[key] = idSample{Next: u.next, At: now}
+		}
+	}
+	saveIDSamples(samples)
+
+	// Closest to running out first
+	idx := make([]int, len(output))
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.SliceStable(idx, func(a, b int) bool { return used[idx[a]] > used[idx[b]] })
+	sorted := make([]RowResult, len(output))
+	for i, j := range idx {
+		sorted[i] = output[j]
+	}
+	printResults(true, sorted, *globalOutputFormat, true, time.Since(startTime), 0)
+	return nil
+}
+
+// loadIDUsages returns the AUTO_INCREMENT and AUTO_RANDOM columns of the tables of a database
+func loadIDUsages(db *sql.DB, dbName string) ([]idUsage, error) {
+	// An AUTO_RANDOM column is the bigint primary key of a table sharded with PK_AUTO_RANDOM_BITS
+	rows, err := db.Query("SELECT t.TABLE_NAME, c.COLUMN_NAME, c.COLUMN_TYPE, IFNULL(t.TIDB_ROW_ID_SHARDING_INFO, ''), "+
+		"UNIX_TIMESTAMP(t.CREATE_TIME) FROM INFORMATION_SCHEMA.TABLES t JOIN INFORMATION_SCHEMA.COLUMNS c "+
+		"ON c.TABLE_SCHEMA = t.TABLE_SCHEMA AND c.TABLE_NAME = t.TABLE_NAME "+
+		"WHERE t.TABLE_SCHEMA = ? AND t.TABLE_TYPE = 'BASE TABLE' AND (c.EXTRA LIKE '%auto_increment%' "+
+		"OR (t.TIDB_ROW_ID_SHARDING_INFO LIKE 'PK_AUTO_RANDOM_BITS%' AND c.COLUMN_KEY = 'PRI' AND c.DATA_TYPE = 'bigint')) "+
+		"ORDER BY t.TABLE_NAME", dbName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the auto id columns: %v", err)
+	}
+	var usages []idUsage
+	for rows.Next() {
+		var u idUsage
+		var sharding string
+		if err := rows.Scan(&u.table, &u.column, &u.colType, &sharding, &u.created); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		u.kind = "AUTO_INCREMENT"
+		if strings.HasPrefix(sharding, "PK_AUTO_RANDOM_BITS") {
+			u.kind = "AUTO_RANDOM"
+		}
+		usages = append(usages, u)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range usages {
+		u := &usages[i]
+		table := quoteName(dbName) + "." + quoteName(u.table)
+		if u.next, err = nextAutoID(db, table, u.kind); err != nil {
+			return nil, fmt.Errorf("%s: %v", u.table, err)
+		}
+		if u.kind == "AUTO_RANDOM" {
+			create, err := showCreate(db, "SHOW CREATE TABLE "+table)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %v", u.table, err)
+			}
+			u.max = autoRandomMax(create, u.colType)
+		} else {
+			u.max = integerTypeMax(u.colType)
+		}
+	}
+	return usages, nil
+}
+
+// nextAutoID returns the next id the allocator of a table hands out for the given id type
+func nextAutoID(db *sql.DB, table, kind string) (int64, error) {
+	rows, err := db.Query("SHOW TABLE " + table + " NEXT_ROW_ID")
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	output, _, err := scanRows(rows, nil, false)
+	if err != nil {
+		return 0, err
+	}
+	for _, row := range output {
+		var next, idType string
+		for i, col := range row.colNames {
+			switch strings.ToUpper(col) {
+			case "NEXT_GLOBAL_ROW_ID":
+				next = formatValue(row.colValues[i])
+			case "ID_TYPE":
+				idType = formatValue(row.colValues[i])
+			}
+		}
+		if strings.EqualFold(idType, kind) {
+			return strconv.ParseInt(next, 10, 64)
+		}
+	}
+	return 0, fmt.Errorf("no %s allocator", kind)
+}
+
+// integerTypeMax returns the largest value of an integer column type such as "int(11) unsigned"
+func integerTypeMax(colType string) *big.Int {
+	bits := map[string]uint{"tinyint": 8, "smallint": 16, "mediumint": 24, "int": 32, "bigint": 64}
+	name := strings.ToLower(colType)
+	if i := strings.IndexAny(name, "( "); i >= 0 {
+		name = name[:i]
+	}
+	n, ok := bits[name]
+	if !ok {
+		// Float columns can be AUTO_INCREMENT too, their integers are exact up to 2^53
+		n = 54
+	}
+	if !strings.Contains(strings.ToLower(colType), "unsigned") {
+		n--
+	}
+	return new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), n), big.NewInt(1))
+}
+
+// autoRandomMax returns the largest incremental part of an AUTO_RANDOM column: the
+// range bits, 64 by default, less the shard bits and the sign bit of a signed column
+func autoRandomMax(create, colType string) *big.Int {
+	shardBits, rangeBits := 5, 64
+	if m := autoRandomRe.FindStringSubmatch(create); m != nil {
+		shardBits, _ = strconv.Atoi(m[1])
+		if m[2] != "" {
+			rangeBits, _ = strconv.Atoi(m[2])
+		}
+	}
+	n := rangeBits - shardBits
+	if !strings.Contains(strings.ToLower(colType), "unsigned") {
+		n--
+	}
+	return new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), uint(n)), big.NewInt(1))
+}
+
+// estimateExhaustion projects when the ids of a table run out from their growth since
+// the stored sample, or since the table was created when there is no usable sample
+func estimateExhaustion(u idUsage, sample idSample, now time.Time) string {
+	var grown int64
+	var elapsed time.Duration
+	if !sample.At.IsZero() && u.next > sample.Next && now.Sub(sample.At) >= time.Minute {
+		grown, elapsed = u.next-sample.Next, now.Sub(sample.At)
+	} else if u.created.Valid && u.next > 1 {
+		grown, elapsed = u.next-1, now.Sub(time.Unix(u.created.Int64, 0))
+	}
+	if grown <= 0 || elapsed <= 0 {
+		return "-"
+	}
+	left, _ := new(big.Float).SetInt(new(big.Int).Sub(u.max, big.NewInt(u.next))).Float64()
+	secs := left / (float64(grown) / elapsed.Seconds())
+	switch {
+	case secs <= 0:
+		return "exhausted"
+	case secs < 48*3600:
+		return fmt.Sprintf("%.0f hours", secs/3600)
+	case secs < 365*24*3600:
+		return fmt.Sprintf("%.0f days", secs/(24*3600))
+	case secs < 1000*365*24*3600:
+		return fmt.Sprintf("%.1f years", secs/(365*24*3600))
+	}
+	return "never"
+}
+
+// idSamplesPath returns the file the samples of next ids are kept in between runs
+func idSamplesPath() string {
+	return filepath.Join(os.Getenv("HOME"), ".tip/id_samples.json")
+}
+
+func loadIDSamples() map[string]idSample {
+	samples := map[string]idSample{}
+	if data, err := os.ReadFile(idSamplesPath()); err == nil {
+		json.Unmarshal(data, &samples)
+	}
+	return samples
+}
+
+func saveIDSamples(samples map[string]idSample) {
+	data, err := json.Marshal(samples)
+	if err != nil {
+		return
+	}
+	os.MkdirAll(filepath.Dir(idSamplesPath()), 0755)
+	os.WriteFile(idSamplesPath(), data, 0644)
+}
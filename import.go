@@ -0,0 +1,493 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/term"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/transform"
+)
+
+// maxPlaceholders is the maximum number of placeholders in a prepared statement
+const maxPlaceholders = 65535
+
+// csvImporter loads CSV records into a table with batched multi-row INSERT statements
+type csvImporter struct {
+	db        *sql.DB
+	table     string
+	batchSize int
+	header    bool
+	maxRate   int               // rows per second, 0 for no limit
+	progress  *importProgress   // nil for no progress report
+	rejects   *rejectWriter     // nil to stop at the first row that can't be imported
+	encoding  encoding.Encoding // encoding of the input, nil for UTF-8
+	rules     *importRules      // how fields are converted, nil to insert them as they are
+	validator *importValidator  // checks the rows against the table instead of inserting them
+}
+
+// importRow is a CSV record on its way into the table
+type importRow struct {
+	line   int
+	record []string
+	values []interface{} // the fields converted by the import rules
+}
+
+// Import reads all records from r and returns the number of rows inserted
+func (imp *csvImporter) Import(r io.Reader) (int64, error) {
+	if imp.progress != nil {
+		counter := &countingReader{r: r}
+		imp.progress.read = &counter.n
+		r = counter
+		defer imp.progress.finish()
+	}
+	if imp.encoding != nil {
+		r = transform.NewReader(r, imp.encoding.NewDecoder())
+	}
+	start := time.Now()
+
+	// The parser returns no fields for a row it can't parse, the rejects get its text instead
+	var recorder *lineRecorder
+	if imp.rejects != nil {
+		recorder = newLineRecorder(r)
+		r = recorder
+	}
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+
+	var columns []string
+	if imp.header {
+		header, err := reader.Read()
+		if err == io.EOF {
+			return 0, nil
+		}
+		if err != nil {
+			return 0, fmt.Errorf("failed to read header: %v", err)
+		}
+		columns = header
+	}
+	if imp.rejects != nil {
+		imp.rejects.columns = columns
+	}
+	if imp.validator != nil {
+		if err := imp.validator.checkColumns(columns); err != nil {
+			return 0, err
+		}
+	}
+
+	var total int64
+	var batch []importRow
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		var n int64
+		var err error
+		if imp.validator != nil {
+			n = imp.validator.check(columns, batch)
+		} else {
+			n, err = imp.insert(columns, batch)
+		}
+		if err != nil && imp.rejects != nil && !isConnectionLost(err) {
+			// Insert the rows one by one to find the ones that are rejected
+			n, err = imp.insertEach(columns, batch)
+		}
+		total += n
+		batch = batch[:0]
+		if imp.progress != nil {
+			imp.progress.update(total)
+		}
+		// Hold back until the rows inserted so far are within the rate limit
+		if imp.maxRate > 0 && imp.validator == nil {
+			if ahead := time.Duration(float64(total)/float64(imp.maxRate)*float64(time.Second)) - time.Since(start); ahead > 0 {
+				time.Sleep(ahead)
+			}
+		}
+		return err
+	}
+
+	batchSize := imp.batchSize
+	// A batch larger than the rate would go out at once each second, then wait
+	if imp.maxRate > 0 && imp.validator == nil && batchSize > imp.maxRate {
+		batchSize = imp.maxRate
+	}
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) && (imp.rejects != nil || imp.validator != nil) {
+			if recorder != nil {
+				record = []string{recorder.text(parseErr.StartLine, parseErr.Line)}
+				recorder.forget(parseErr.Line + 1)
+			}
+			if err := imp.reject(parseErr.StartLine, parseErr.Err, record); err != nil {
+				return total, err
+			}
+			continue
+		}
+		if err != nil {
+			return total, fmt.Errorf("failed to read CSV: %v", err)
+		}
+		line, _ := reader.FieldPos(0)
+		if recorder != nil {
+			recorder.forget(line)
+		}
+		var values []interface{}
+		if columns != nil && len(record) != len(columns) {
+			err = fmt.Errorf("expected %d fields, got %d", len(columns), len(record))
+		} else {
+			values, err = imp.rules.convert(columns, record)
+		}
+		if err != nil {
+			if err := imp.reject(line, err, record); err != nil {
+				return total, err
+			}
+			continue
+		}
+		// Keep the statement within the placeholder limit
+		if len(record) > 0 && batchSize*len(record) > maxPlaceholders {
+			batchSize = maxPlaceholders / len(record)
+		}
+		batch = append(batch, importRow{line: line, record: record, values: values})
+		if len(batch) >= batchSize {
+			if err := flush(); err != nil {
+				return total, err
+			}
+		}
+	}
+	return total, flush()
+}
+
+// lineRecorder keeps the lines read through it until they are forgotten, so that a
+// row the CSV parser rejects can be set aside as it was written. The parser reads
+// ahead, only the lines of the rows it hasn't returned yet are kept.
+type lineRecorder struct {
+	r       io.Reader
+	lines   map[int]string // complete lines by number, from 1
+	first   int            // first line not forgotten
+	next    int            // number of the line being read
+	partial bytes.Buffer   // start of the line being read
+}
+
+func newLineRecorder(r io.Reader) *lineRecorder {
+	return &lineRecorder{r: r, lines: map[int]string{}, first: 1, next: 1}
+}
+
+func (lr *lineRecorder) Read(p []byte) (int, error) {
+	n, err := lr.r.Read(p)
+	data := p[:n]
+	for len(data) > 0 {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			lr.partial.Write(data)
+			break
+		}
+		lr.partial.Write(data[:i])
+		lr.lines[lr.next] = strings.TrimSuffix(lr.partial.String(), "\r")
+		lr.partial.Reset()
+		lr.next++
+		data = data[i+1:]
+	}
+	return n, err
+}
+
+// text returns the lines from one line to another, the last line of the input may
+// have no line break
+func (lr *lineRecorder) text(from, to int) string {
+	lines := make([]string, 0, to-from+1)
+	for l := from; l <= to; l++ {
+		if text, ok := lr.lines[l]; ok {
+			lines = append(lines, text)
+		} else if l == lr.next {
+			lines = append(lines, strings.TrimSuffix(lr.partial.String(), "\r"))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// forget drops the lines before line
+func (lr *lineRecorder) forget(line int) {
+	for ; lr.first < line; lr.first++ {
+		delete(lr.lines, lr.first)
+	}
+}
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	r io.Reader
+	n atomic.Int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n.Add(int64(n))
+	return n, err
+}
+
+// importProgress reports the progress of an import on a single, repainted line
+type importProgress struct {
+	w         io.Writer
+	size      int64         // size of the input, 0 if unknown
+	read      *atomic.Int64 // bytes read from the input
+	start     time.Time
+	lastPrint time.Time
+}
+
+// newImportProgress returns a progress report for an input of the given size,
+// or nil when stderr is not a terminal to repaint the line on
+func newImportProgress(size int64) *importProgress {
+	if !term.IsTerminal(int(os.Stderr.Fd())) {
+		return nil
+	}
+	return &importProgress{w: os.Stderr, size: size, start: time.Now()}
+}
+
+func (p *importProgress) update(rows int64) {
+	if time.Since(p.lastPrint) < 200*time.Millisecond {
+		return
+	}
+	p.lastPrint = time.Now()
+	elapsed := time.Since(p.start).Seconds()
+	read := p.read.Load()
+
+	line := fmt.Sprintf("%d rows, %s", rows, formatBytes(read))
+	if p.size > 0 {
+		line += fmt.Sprintf(" of %s (%.0f%%)", formatBytes(p.size), float64(read)*100/float64(p.size))
+	}
+	if elapsed > 0 {
+		line += fmt.Sprintf(", %.0f rows/s", float64(rows)/elapsed)
+	}
+	if p.size > 0 && read > 0 && read < p.size {
+		eta := time.Duration(elapsed * float64(p.size-read) / float64(read) * float64(time.Second))
+		line += fmt.Sprintf(", ETA %s", eta.Round(time.Second))
+	}
+	fmt.Fprintf(p.w, "\r\033[K%s", line)
+}
+
+// finish clears the progress line
+func (p *importProgress) finish() {
+	fmt.Fprint(p.w, "\r\033[K")
+}
+
+// formatBytes formats a byte count with a binary unit
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// reject sets a record aside: it is reported when validating, written to the rejects
+// if there are any, and otherwise ends the import with an error
+func (imp *csvImporter) reject(line int, reason error, record []string) error {
+	switch {
+	case imp.validator != nil:
+		imp.validator.fail(line, reason)
+		return nil
+	case imp.rejects != nil:
+		return imp.rejects.reject(line, reason, record)
+	}
+	return fmt.Errorf("line %d: %v (rows read from standard input are only set aside with -rejects <file>)", line, reason)
+}
+
+// insertEach inserts records one at a time, writing the ones that fail to the rejects
+func (imp *csvImporter) insertEach(columns []string, rows []importRow) (int64, error) {
+	var total int64
+	for i, row := range rows {
+		n, err := imp.insert(columns, rows[i:i+1])
+		if err != nil {
+			if isConnectionLost(err) {
+				return total, err
+			}
+			if err := imp.reject(row.line, errors.Unwrap(err), row.record); err != nil {
+				return total, err
+			}
+			continue
+		}
+		total += n
+	}
+	return total, nil
+}
+
+// rejectWriter writes the records an import rejects, with their line number and
+// the reason, to a CSV file next to the imported one. The file is created on the
+// first rejected record. A row that isn't valid CSV is written as its text, in the
+// field of the first column.
+type rejectWriter struct {
+	path    string
+	columns []string // columns of the imported file, written as header
+	file    *os.File
+	csv     *csv.Writer
+	count   int64
+}
+
+// newRejectWriter returns a rejectWriter for the imported file, data.csv rejects go to data.rejected.csv
+func newRejectWriter(input string) *rejectWriter {
+	return &rejectWriter{path: strings.TrimSuffix(input, filepath.Ext(input)) + ".rejected.csv"}
+}
+
+func (rw *rejectWriter) reject(line int, reason error, record []string) error {
+	if rw.file == nil {
+		f, err := os.Create(rw.path)
+		if err != nil {
+			return fmt.Errorf("failed to create %s: %v", rw.path, err)
+		}
+		rw.file = f
+		rw.csv = csv.NewWriter(f)
+		rw.csv.Write(append([]string{"line", "error"}, rw.columns...))
+	}
+	rw.count++
+	rw.csv.Write(append([]string{strconv.Itoa(line), reason.Error()}, record...))
+	return rw.csv.Error()
+}
+
+// Close flushes and closes the file of rejected records, if one was created
+func (rw *rejectWriter) Close() error {
+	if rw.file == nil {
+		return nil
+	}
+	f := rw.file
+	rw.file = nil
+	rw.csv.Flush()
+	if err := rw.csv.Error(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// summary describes how many records were rejected and where they went
+func (rw *rejectWriter) summary() string {
+	if rw.count == 0 {
+		return ""
+	}
+	return fmt.Sprintf(", %d rows rejected (written to %s)", rw.count, rw.path)
+}
+
+func (imp *csvImporter) insert(columns []string, rows []importRow) (int64, error) {
+	var sb strings.Builder
+	sb.WriteString("INSERT INTO " + quoteIdentifier(imp.table))
+	if len(columns) > 0 {
+		quoted := make([]string, len(columns))
+		for i, col := range columns {
+			quoted[i] = quoteName(col)
+		}
+		sb.WriteString(" (" + strings.Join(quoted, ", ") + ")")
+	}
+	sb.WriteString(" VALUES ")
+
+	var args []interface{}
+	for i, row := range rows {
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		sb.WriteString("(" + strings.TrimSuffix(strings.Repeat("?, ", len(row.values)), ", ") + ")")
+		args = append(args, row.values...)
+	}
+
+	result, err := imp.db.Exec(sb.String(), args...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to insert rows: %w", err)
+	}
+	return result.RowsAffected()
+}
+
+type ImportCmd struct{}
+
+func (cmd ImportCmd) Name() string {
+	return ".import"
+}
+
+func (cmd ImportCmd) Description() string {
+	return "Import a CSV file into a table"
+}
+
+func (cmd ImportCmd) Usage() string {
+	return ".import <file.csv> <table> [--batch 500] [--no-header] [--max-rate rows/s] [--input-encoding gbk|latin1|...] [--rules <file>] [--null <token>]... [--trim] [--validate-only]"
+}
+
+func (cmd ImportCmd) Handle(args []string, resultWriter io.Writer) error {
+	if len(args) < 2 {
+		return fmt.Errorf("usage: %s", cmd.Usage())
+	}
+	fs := flag.NewFlagSet(cmd.Name(), flag.ContinueOnError)
+	fs.SetOutput(resultWriter)
+	batch := fs.Int("batch", 500, "Number of rows per INSERT statement")
+	noHeader := fs.Bool("no-header", false, "The CSV file has no header row")
+	maxRate := fs.Int("max-rate", 0, "Maximum number of rows inserted per second, 0 for no limit")
+	inputEncoding := fs.String("input-encoding", "", "Encoding of the CSV file, e.g. gbk or latin1 (default utf8)")
+	rulesFile := fs.String("rules", "", "File of per-column conversion rules: null tokens, trimming, date formats, boolean tokens")
+	var nulls stringList
+	fs.Var(&nulls, "null", "Field inserted as NULL, e.g. \\N (repeatable)")
+	trim := fs.Bool("trim", false, "Trim spaces around fields")
+	validateOnly := fs.Bool("validate-only", false, "Check the file against the table and report the errors, without inserting anything")
+	if err := fs.Parse(args[2:]); err != nil {
+		return err
+	}
+	rules, err := newImportRules(*rulesFile, nulls, *trim)
+	if err != nil {
+		return err
+	}
+	if *batch <= 0 {
+		return fmt.Errorf("batch size must be positive")
+	}
+	enc, err := lookupEncoding(*inputEncoding)
+	if err != nil {
+		return err
+	}
+
+	db, err := requireDB()
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(args[0])
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	imp := &csvImporter{db: db, table: args[1], batchSize: *batch, header: !*noHeader, maxRate: *maxRate, encoding: enc, rules: rules}
+	if info, err := f.Stat(); err == nil {
+		imp.progress = newImportProgress(info.Size())
+	}
+	if *validateOnly {
+		if imp.validator, err = newImportValidator(db, args[1]); err != nil {
+			return err
+		}
+		if _, err := imp.Import(f); err != nil {
+			return fmt.Errorf("validation failed: %v", err)
+		}
+		imp.validator.report(resultWriter)
+		return nil
+	}
+	imp.rejects = newRejectWriter(args[0])
+	defer imp.rejects.Close()
+	n, err := imp.Import(f)
+	if err != nil {
+		return fmt.Errorf("import failed after %d rows%s: %v", n, imp.rejects.summary(), err)
+	}
+	if err := imp.rejects.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %v", imp.rejects.path, err)
+	}
+	resultWriter.Write([]byte(fmt.Sprintf("Imported %d rows into %s%s.\n", n, args[1], imp.rejects.summary())))
+	return nil
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml"
+)
+
+// columnRule describes how the fields of a CSV column are converted before they are inserted
+type columnRule struct {
+	trim       bool
+	nulls      []string // fields inserted as NULL, e.g. \N or NULL
+	dateFormat string   // Go layout of the dates in the column, converted from strftime
+	trues      []string // fields inserted as 1
+	falses     []string // fields inserted as 0
+}
+
+// importRules holds the conversion rules of an import: the defaults for every column,
+// overridden per column by name, or by 1-based position for files without header
+type importRules struct {
+	defaults columnRule
+	columns  map[string]columnRule
+}
+
+// loadImportRules reads a rules file like
+//
+//	null = ["\\N", "NULL"]
+//	trim = true
+//
+//	[columns.created_at]
+//	date_format = "%d/%m/%Y %H:%M"
+//
+//	[columns.active]
+//	true = ["yes", "Y"]
+//	false = ["no", "N"]
+//
+// Column sections start from the top-level settings and override the keys they set.
+func loadImportRules(path string) (*importRules, error) {
+	tree, err := toml.LoadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rules file: %v", err)
+	}
+	rules := &importRules{columns: map[string]columnRule{}}
+	if rules.defaults, err = parseColumnRule(tree, columnRule{}); err != nil {
+		return nil, err
+	}
+	if cols, ok := tree.Get("columns").(*toml.Tree); ok {
+		for _, name := range cols.Keys() {
+			sub, ok := cols.Get(name).(*toml.Tree)
+			if !ok {
+				return nil, fmt.Errorf("rules for column %s must be a table", name)
+			}
+			if rules.columns[name], err = parseColumnRule(sub, rules.defaults); err != nil {
+				return nil, fmt.Errorf("column %s: %v", name, err)
+			}
+		}
+	}
+	return rules, nil
+}
+
+// newImportRules combines the rules file, if any, with the null tokens and trimming
+// given as flags, which apply to every column. It returns nil when there are no rules.
+func newImportRules(path string, nulls []string, trim bool) (*importRules, error) {
+	if path == "" && len(nulls) == 0 && !trim {
+		return nil, nil
+	}
+	rules := &importRules{columns: map[string]columnRule{}}
+	if path != "" {
+		var err error
+		if rules, err = loadImportRules(path); err != nil {
+			return nil, err
+		}
+	}
+	override := func(rule columnRule) columnRule {
+		if len(nulls) > 0 {
+			rule.nulls = nulls
+		}
+		rule.trim = rule.trim || trim
+		return rule
+	}
+	rules.defaults = override(rules.defaults)
+	for name, rule := range rules.columns {
+		rules.columns[name] = override(rule)
+	}
+	return rules, nil
+}
+
+// parseColumnRule reads the keys of a rules table on top of base
+func parseColumnRule(tree *toml.Tree, base columnRule) (columnRule, error) {
+	rule := base
+	for _, key := range tree.Keys() {
+		val := tree.Get(key)
+		var err error
+		switch key {
+		case "columns":
+		case "trim":
+			b, ok := val.(bool)
+			if !ok {
+				return rule, fmt.Errorf("trim must be true or false")
+			}
+			rule.trim = b
+		case "null":
+			rule.nulls, err = tomlStrings(key, val)
+		case "true":
+			rule.trues, err = tomlStrings(key, val)
+		case "false":
+			rule.falses, err = tomlStrings(key, val)
+		case "date_format":
+			s, ok := val.(string)
+			if !ok {
+				return rule, fmt.Errorf("date_format must be a string")
+			}
+			rule.dateFormat = strftimeToLayout(s)
+		default:
+			return rule, fmt.Errorf("unknown rule %q", key)
+		}
+		if err != nil {
+			return rule, err
+		}
+	}
+	return rule, nil
+}
+
+// tomlStrings accepts a string or an array of strings
+func tomlStrings(key string, val interface{}) ([]string, error) {
+	switch v := val.(type) {
+	case string:
+		return []string{v}, nil
+	case []interface{}:
+		strs := make([]string, len(v))
+		for i, item := range v {
+			s, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("%s must be a list of strings", key)
+			}
+			strs[i] = s
+		}
+		return strs, nil
+	}
+	return nil, fmt.Errorf("%s must be a string or a list of strings", key)
+}
+
+// strftimeLayouts maps strftime directives to the Go layout elements
+var strftimeLayouts = map[byte]string{
+	'Y': "2006", 'y': "06", 'm': "01", 'd': "02", 'e': "_2", 'b': "Jan", 'B': "January",
+	'H': "15", 'I': "03", 'M': "04", 'S': "05", 'f': "000000", 'p': "PM", 'z': "-0700", '%': "%",
+}
+
+// strftimeToLayout converts a strftime format like %d/%m/%Y to a Go time layout
+func strftimeToLayout(format string) string {
+	var sb strings.Builder
+	for i := 0; i < len(format); i++ {
+		if format[i] == '%' && i+1 < len(format) {
+			if layout, ok := strftimeLayouts[format[i+1]]; ok {
+				sb.WriteString(layout)
+				i++
+				continue
+			}
+		}
+		sb.WriteByte(format[i])
+	}
+	return sb.String()
+}
+
+// rule returns the rule of the column at index i
+func (r *importRules) rule(columns []string, i int) columnRule {
+	if i < len(columns) {
+		if rule, ok := r.columns[columns[i]]; ok {
+			return rule
+		}
+	}
+	if rule, ok := r.columns[strconv.Itoa(i+1)]; ok {
+		return rule
+	}
+	return r.defaults
+}
+
+// convert applies the rules to the fields of a record, returning the values to insert.
+// Without rules the fields are inserted as they are.
+func (r *importRules) convert(columns []string, record []string) ([]interface{}, error) {
+	values := make([]interface{}, len(record))
+	for i, field := range record {
+		if r == nil {
+			values[i] = field
+			continue
+		}
+		val, err := r.rule(columns, i).apply(field)
+		if err != nil {
+			name := strconv.Itoa(i + 1)
+			if i < len(columns) {
+				name = columns[i]
+			}
+			return nil, fmt.Errorf("column %s: %v", name, err)
+		}
+		values[i] = val
+	}
+	return values, nil
+}
+
+func (rule columnRule) apply(field string) (interface{}, error) {
+	if rule.trim {
+		field = strings.TrimSpace(field)
+	}
+	for _, null := range rule.nulls {
+		if field == null {
+			return nil, nil
+		}
+	}
+	for _, t := range rule.trues {
+		if strings.EqualFold(field, t) {
+			return 1, nil
+		}
+	}
+	for _, f := range rule.falses {
+		if strings.EqualFold(field, f) {
+			return 0, nil
+		}
+	}
+	if rule.dateFormat != "" {
+		t, err := time.Parse(rule.dateFormat, field)
+		if err != nil {
+			return nil, fmt.Errorf("%q doesn't match the date format", field)
+		}
+		return t.Format("2006-01-02 15:04:05.999999"), nil
+	}
+	return field, nil
+}
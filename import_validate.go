@@ -0,0 +1,270 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// maxValidationErrors is the number of errors a validation run lists, the others are only counted
+const maxValidationErrors = 100
+
+// schemaColumn is a column of the target table, as described by information_schema
+type schemaColumn struct {
+	name      string
+	dataType  string // e.g. int, varchar, decimal
+	unsigned  bool
+	nullable  bool
+	maxLength int64 // characters of string columns, bytes of binary ones
+	precision int64
+	scale     int64
+	values    []string // members of ENUM and SET columns
+}
+
+// importValidator checks the rows of an import against the columns of the target
+// table, collecting the errors the import would run into, without writing anything
+type importValidator struct {
+	table   []schemaColumn
+	byName  map[string]schemaColumn
+	targets []schemaColumn // the columns the fields of a record go to
+
+	rows     int64 // rows that would be inserted
+	batches  int   // INSERT statements the import would run
+	maxBatch int
+	failed   int64
+	errors   []string
+}
+
+var enumValueRe = regexp.MustCompile(`'((?:[^']|'')*)'`)
+
+// newImportValidator loads the columns of the table to validate against
+func newImportValidator(db *sql.DB, table string) (*importValidator, error) {
+	schemaExpr, name := "DATABASE()", table
+	args := []interface{}{}
+	if i := strings.Index(table, "."); i >= 0 {
+		schemaExpr, name = "?", table[i+1:]
+		args = append(args, table[:i])
+	}
+	args = append(args, name)
+	rows, err := db.Query(`SELECT COLUMN_NAME, DATA_TYPE, COLUMN_TYPE, IS_NULLABLE,
+		IFNULL(CHARACTER_MAXIMUM_LENGTH, 0), IFNULL(NUMERIC_PRECISION, 0), IFNULL(NUMERIC_SCALE, 0)
+		FROM information_schema.COLUMNS WHERE TABLE_SCHEMA = `+schemaExpr+` AND TABLE_NAME = ?
+		ORDER BY ORDINAL_POSITION`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the columns of %s: %v", table, err)
+	}
+	defer rows.Close()
+
+	v := &importValidator{byName: map[string]schemaColumn{}}
+	for rows.Next() {
+		var col schemaColumn
+		var columnType, nullable string
+		if err := rows.Scan(&col.name, &col.dataType, &columnType, &nullable, &col.maxLength, &col.precision, &col.scale); err != nil {
+			return nil, err
+		}
+		col.dataType = strings.ToLower(col.dataType)
+		col.unsigned = strings.Contains(strings.ToLower(columnType), "unsigned")
+		col.nullable = nullable == "YES"
+		if col.dataType == "enum" || col.dataType == "set" {
+			for _, m := range enumValueRe.FindAllStringSubmatch(columnType, -1) {
+				col.values = append(col.values, strings.ReplaceAll(m[1], "''", "'"))
+			}
+		}
+		v.table = append(v.table, col)
+		v.byName[strings.ToLower(col.name)] = col
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(v.table) == 0 {
+		return nil, fmt.Errorf("table %s doesn't exist", table)
+	}
+	return v, nil
+}
+
+// checkColumns maps the header of the file to the columns of the table, without
+// header the fields go to the columns in table order
+func (v *importValidator) checkColumns(header []string) error {
+	if header == nil {
+		v.targets = v.table
+		return nil
+	}
+	v.targets = make([]schemaColumn, len(header))
+	for i, name := range header {
+		col, ok := v.byName[strings.ToLower(name)]
+		if !ok {
+			return fmt.Errorf("column %s doesn't exist in the table", name)
+		}
+		v.targets[i] = col
+	}
+	return nil
+}
+
+// check validates a batch of rows and returns the number of valid ones
+func (v *importValidator) check(columns []string, rows []importRow) int64 {
+	var valid int64
+	for _, row := range rows {
+		if err := v.checkRow(row.values); err != nil {
+			v.fail(row.line, err)
+			continue
+		}
+		valid++
+	}
+	v.rows += valid
+	v.batches++
+	if len(rows) > v.maxBatch {
+		v.maxBatch = len(rows)
+	}
+	return valid
+}
+
+func (v *importValidator) checkRow(values []interface{}) error {
+	if len(values) > len(v.targets) {
+		return fmt.Errorf("%d fields for %d columns", len(values), len(v.targets))
+	}
+	for i, val := range values {
+		col := v.targets[i]
+		if val == nil {
+			if !col.nullable {
+				return fmt.Errorf("column %s can't be NULL", col.name)
+			}
+			continue
+		}
+		s := fmt.Sprint(val)
+		if err := col.check(s); err != nil {
+			return fmt.Errorf("column %s: %v", col.name, err)
+		}
+	}
+	return nil
+}
+
+// intBits are the sizes of the integer types
+var intBits = map[string]int{"tinyint": 8, "smallint": 16, "mediumint": 24, "int": 32, "integer": 32, "bigint": 64}
+
+// check reports whether the server would accept s for the column in strict mode
+func (col schemaColumn) check(s string) error {
+	switch col.dataType {
+	case "tinyint", "smallint", "mediumint", "int", "integer", "bigint":
+		bits := intBits[col.dataType]
+		n, ok := new(big.Int).SetString(s, 10)
+		if !ok {
+			return fmt.Errorf("%q is not an integer", s)
+		}
+		min, max := new(big.Int).Lsh(big.NewInt(-1), uint(bits-1)), new(big.Int).Lsh(big.NewInt(1), uint(bits-1))
+		if col.unsigned {
+			min, max = big.NewInt(0), new(big.Int).Lsh(big.NewInt(1), uint(bits))
+		}
+		if n.Cmp(min) < 0 || n.Cmp(max) >= 0 {
+			return fmt.Errorf("%s is out of range for %s", s, col.typeName())
+		}
+	case "decimal":
+		r, ok := new(big.Rat).SetString(s)
+		if !ok {
+			return fmt.Errorf("%q is not a number", s)
+		}
+		if col.unsigned && r.Sign() < 0 {
+			return fmt.Errorf("%s is out of range for %s", s, col.typeName())
+		}
+		intPart := new(big.Int).Quo(r.Num(), r.Denom())
+		if digits := len(strings.TrimLeft(intPart.String(), "-0")); int64(digits) > col.precision-col.scale {
+			return fmt.Errorf("%s is out of range for decimal(%d,%d)", s, col.precision, col.scale)
+		}
+	case "float", "double", "real":
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return fmt.Errorf("%q is not a number", s)
+		}
+		if col.unsigned && f < 0 {
+			return fmt.Errorf("%s is out of range for %s", s, col.typeName())
+		}
+	case "year":
+		n, err := strconv.Atoi(s)
+		if err != nil || (n != 0 && (n < 1901 || n > 2155)) {
+			return fmt.Errorf("%q is not a year", s)
+		}
+	case "date", "datetime", "timestamp":
+		if !isSQLDateTime(s) {
+			return fmt.Errorf("%q is not a date", s)
+		}
+	case "char", "varchar", "tinytext", "text", "mediumtext", "longtext":
+		if n := utf8.RuneCountInString(s); col.maxLength > 0 && int64(n) > col.maxLength {
+			return fmt.Errorf("%d characters are too long for %s(%d)", n, col.dataType, col.maxLength)
+		}
+	case "binary", "varbinary", "tinyblob", "blob", "mediumblob", "longblob":
+		if col.maxLength > 0 && int64(len(s)) > col.maxLength {
+			return fmt.Errorf("%d bytes are too long for %s(%d)", len(s), col.dataType, col.maxLength)
+		}
+	case "json":
+		if !json.Valid([]byte(s)) {
+			return fmt.Errorf("invalid JSON")
+		}
+	case "enum":
+		if !col.hasValue(s) {
+			return fmt.Errorf("%q is not one of the values of the enum", s)
+		}
+	case "set":
+		if s == "" {
+			return nil
+		}
+		for _, member := range strings.Split(s, ",") {
+			if !col.hasValue(member) {
+				return fmt.Errorf("%q is not one of the values of the set", member)
+			}
+		}
+	}
+	return nil
+}
+
+func (col schemaColumn) typeName() string {
+	if col.unsigned {
+		return col.dataType + " unsigned"
+	}
+	return col.dataType
+}
+
+// hasValue reports whether s is a member of an ENUM or SET column, compared without case
+func (col schemaColumn) hasValue(s string) bool {
+	for _, v := range col.values {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// isSQLDateTime reports whether s is written like a DATE or DATETIME value
+func isSQLDateTime(s string) bool {
+	for _, layout := range []string{"2006-01-02", "2006-01-02 15:04:05.999999", "2006-01-02T15:04:05.999999"} {
+		if _, err := time.Parse(layout, s); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// fail records a row the import would reject
+func (v *importValidator) fail(line int, reason error) {
+	v.failed++
+	if len(v.errors) < maxValidationErrors {
+		v.errors = append(v.errors, fmt.Sprintf("line %d: %v", line, reason))
+	}
+}
+
+// report writes the errors found and the batches the import would run
+func (v *importValidator) report(w io.Writer) {
+	for _, e := range v.errors {
+		fmt.Fprintln(w, e)
+	}
+	if v.failed > int64(len(v.errors)) {
+		fmt.Fprintf(w, "... and %d more errors\n", v.failed-int64(len(v.errors)))
+	}
+	fmt.Fprintf(w, "%d rows would be imported and %d rejected, in %d INSERT statements of up to %d rows.\n",
+		v.rows, v.failed, v.batches, v.maxBatch)
+}
@@ -2,43 +2,197 @@ package main
 
 import (
 	"bufio"
+	"database/sql"
 	"encoding/csv"
 	"encoding/json"
 	"fmt"
 	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
 )
 
+// ResultIOWriter writes streamed rows. The rows given to Write, and their values, are
+// reused for the rows that follow, so Write must not keep them after it returns.
 type ResultIOWriter interface {
 	Write(rows []RowResult) error
 	Flush() error
 }
 
+// outputError is a failure to write results, as opposed to one of the statement
+type outputError struct {
+	err error
+}
+
+func (e *outputError) Error() string {
+	return "failed to write data: " + e.err.Error()
+}
+
+func (e *outputError) Unwrap() error {
+	return e.err
+}
+
+// csvOptions control how CSV is written, on the standard output and to files. They are
+// set with -csv-delimiter, -csv-quote and -skip-column-names, or .set in the REPL. The
+// header row of batch output is left out with skipColumnNames too.
+var csvOptions = struct {
+	delimiter       rune
+	quote           rune
+	skipColumnNames bool
+}{delimiter: ',', quote: '"'}
+
+// parseCSVChar parses a delimiter or quote character, \t or tab stands for a tab
+func parseCSVChar(s string) (rune, error) {
+	if s == `\t` || strings.EqualFold(s, "tab") {
+		return '\t', nil
+	}
+	r, size := utf8.DecodeRuneInString(s)
+	if size == 0 || size != len(s) || r == utf8.RuneError || r == '\r' || r == '\n' {
+		return 0, fmt.Errorf("invalid CSV character: %q, expected a single character", s)
+	}
+	return r, nil
+}
+
+// CSVResultIOWriter writes rows as CSV with encoding/csv, after a header row with the
+// column names unless -skip-column-names is given
 type CSVResultIOWriter struct {
-	writer *csv.Writer
+	out        *bufio.Writer
+	writer     *csv.Writer // nil when the quote isn't '"', which encoding/csv always uses
+	headerDone bool
 }
 
 func NewCSVResultIOWriter(writer io.Writer) *CSVResultIOWriter {
-	return &CSVResultIOWriter{
-		writer: csv.NewWriter(writer),
+	w := &CSVResultIOWriter{out: bufio.NewWriter(writer)}
+	if csvOptions.quote == '"' {
+		w.writer = csv.NewWriter(w.out)
+		w.writer.Comma = csvOptions.delimiter
+	}
+	return w
+}
+
+// SetColumnTypes writes the header row, so that an empty result still has one
+func (w *CSVResultIOWriter) SetColumnTypes(colTypes []*sql.ColumnType) error {
+	cols := make([]string, len(colTypes))
+	for i, ct := range colTypes {
+		cols[i] = ct.Name()
+	}
+	return w.writeHeader(cols)
+}
+
+func (w *CSVResultIOWriter) writeHeader(cols []string) error {
+	if w.headerDone {
+		return nil
+	}
+	w.headerDone = true
+	if csvOptions.skipColumnNames {
+		return nil
 	}
+	return w.writeRecord(cols)
 }
 
 func (w *CSVResultIOWriter) Write(rows []RowResult) error {
 	for _, row := range rows {
+		if err := w.writeHeader(row.colNames); err != nil {
+			return err
+		}
 		record := make([]string, len(row.colValues))
-		for i, val := range row.colValues {
-			record[i] = formatCSVValue(val)
+		for i := range row.colValues {
+			record[i] = row.displayValue(i)
 		}
-		if err := w.writer.Write(record); err != nil {
+		if err := w.writeRecord(record); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
+func (w *CSVResultIOWriter) writeRecord(record []string) error {
+	if w.writer != nil {
+		return w.writer.Write(record)
+	}
+	if csvOptions.delimiter == csvOptions.quote {
+		return fmt.Errorf("the CSV delimiter and quote can't be the same character")
+	}
+	for i, field := range record {
+		if i > 0 {
+			w.out.WriteRune(csvOptions.delimiter)
+		}
+		// Quote as encoding/csv does, with the quote character doubled within a field
+		if field == "" || !strings.ContainsAny(field, string([]rune{csvOptions.delimiter, csvOptions.quote, '\r', '\n'})) && field[0] != ' ' && field[0] != '\t' {
+			w.out.WriteString(field)
+			continue
+		}
+		q := string(csvOptions.quote)
+		w.out.WriteString(q + strings.ReplaceAll(field, q, q+q) + q)
+	}
+	_, err := w.out.WriteString("\n")
+	return err
+}
+
 func (w *CSVResultIOWriter) Flush() error {
-	w.writer.Flush()
-	return w.writer.Error()
+	if w.writer != nil {
+		w.writer.Flush()
+		if err := w.writer.Error(); err != nil {
+			return err
+		}
+	}
+	return w.out.Flush()
+}
+
+// rawOutput leaves the values of batch output unescaped, set with -raw
+var rawOutput bool
+
+// batchEscaper escapes the values of batch output as mysql --batch does, so that every
+// line holds a row
+var batchEscaper = strings.NewReplacer("\\", "\\\\", "\x00", "\\0", "\t", "\\t", "\n", "\\n")
+
+// BatchResultIOWriter writes rows as tab-separated values like mysql --batch, after a
+// header row with the column names unless -N is given
+type BatchResultIOWriter struct {
+	writer     *bufio.Writer
+	headerDone bool
+}
+
+func NewBatchResultIOWriter(writer io.Writer) *BatchResultIOWriter {
+	return &BatchResultIOWriter{writer: bufio.NewWriter(writer)}
+}
+
+func (w *BatchResultIOWriter) writeLine(fields []string) error {
+	for i, field := range fields {
+		if i > 0 {
+			w.writer.WriteByte('\t')
+		}
+		if !rawOutput {
+			field = batchEscaper.Replace(field)
+		}
+		w.writer.WriteString(field)
+	}
+	return w.writer.WriteByte('\n')
+}
+
+func (w *BatchResultIOWriter) Write(rows []RowResult) error {
+	for _, row := range rows {
+		if !w.headerDone {
+			w.headerDone = true
+			if !csvOptions.skipColumnNames {
+				if err := w.writeLine(row.colNames); err != nil {
+					return err
+				}
+			}
+		}
+		fields := make([]string, len(row.colValues))
+		for i := range row.colValues {
+			fields[i] = row.displayValue(i)
+		}
+		if err := w.writeLine(fields); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *BatchResultIOWriter) Flush() error {
+	return w.writer.Flush()
 }
 
 type PlainResultIOWriter struct {
@@ -54,8 +208,7 @@ func NewPlainResultIOWriter(writer io.Writer) *PlainResultIOWriter {
 func (w *PlainResultIOWriter) Write(rows []RowResult) error {
 	for _, row := range rows {
 		for i, col := range row.colNames {
-			val := row.colValues[i]
-			_, err := fmt.Fprintf(w.writer, "%s: %s ", col, formatValue(val))
+			_, err := fmt.Fprintf(w.writer, "%s: %s ", col, row.displayValue(i))
 			if err != nil {
 				return err
 			}
@@ -86,38 +239,200 @@ func NewJSONResultIOWriter(writer io.Writer) *JSONResultIOWriter {
 
 func (w *JSONResultIOWriter) Write(rows []RowResult) error {
 	for _, row := range rows {
+		// The row is encoded first, so that a row that can't be leaves the array well-formed
+		jsonData, err := json.Marshal(row)
+		if err != nil {
+			return err
+		}
+		sep := ","
 		if w.first {
-			_, err := w.writer.WriteString("[")
-			if err != nil {
-				return err
-			}
+			sep = "["
 			w.first = false
-		} else {
-			_, err := w.writer.WriteString(",")
-			if err != nil {
+		}
+		if _, err := w.writer.WriteString(sep); err != nil {
+			return err
+		}
+		if _, err := w.writer.Write(jsonData); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Flush ends the array, an empty one if there were no rows
+func (w *JSONResultIOWriter) Flush() error {
+	end := "]"
+	if w.first {
+		end = "[]"
+	}
+	if _, err := w.writer.WriteString(end); err != nil {
+		return err
+	}
+	return w.writer.Flush()
+}
+
+// jsonEnvelope wraps the JSON output of each statement with its columns and stats, set
+// with -json-envelope
+var jsonEnvelope bool
+
+// statsWriter is implemented by result writers that write the outcome of every
+// statement, not only its rows
+type statsWriter interface {
+	EndStatement(isQuery bool, execTime time.Duration, affectedRows int64) error
+}
+
+type jsonEnvelopeColumn struct {
+	Name string `json:"name"`
+	Type string `json:"type,omitempty"`
+}
+
+type jsonEnvelopeStats struct {
+	DurationMS   float64 `json:"duration_ms"`
+	RowCount     int64   `json:"row_count"`
+	AffectedRows *int64  `json:"affected_rows,omitempty"` // only for statements other than queries
+}
+
+// JSONEnvelopeResultIOWriter writes the result of each statement as a JSON object on its
+// own line, with the names and types of the columns and the execution stats:
+//
+//	{"columns":[{"name":"id","type":"BIGINT"}],"rows":[{"id":1}],"stats":{"duration_ms":0.8,"row_count":1}}
+type JSONEnvelopeResultIOWriter struct {
+	writer  *bufio.Writer
+	started bool // the columns of the current statement are written
+	rows    int64
+}
+
+func NewJSONEnvelopeResultIOWriter(writer io.Writer) *JSONEnvelopeResultIOWriter {
+	return &JSONEnvelopeResultIOWriter{
+		writer: bufio.NewWriter(writer),
+	}
+}
+
+func (w *JSONEnvelopeResultIOWriter) SetColumnTypes(colTypes []*sql.ColumnType) error {
+	names := make([]string, len(colTypes))
+	types := make([]string, len(colTypes))
+	for i, ct := range colTypes {
+		names[i], types[i] = ct.Name(), ct.DatabaseTypeName()
+	}
+	return w.begin(names, types)
+}
+
+// begin starts the object of a statement with its columns, types may be nil
+func (w *JSONEnvelopeResultIOWriter) begin(names, types []string) error {
+	columns := make([]jsonEnvelopeColumn, len(names))
+	for i, name := range names {
+		columns[i].Name = name
+		if i < len(types) {
+			columns[i].Type = types[i]
+		}
+	}
+	data, err := json.Marshal(columns)
+	if err != nil {
+		return err
+	}
+	w.writer.WriteString(`{"columns":`)
+	w.writer.Write(data)
+	_, err = w.writer.WriteString(`,"rows":[`)
+	w.started, w.rows = true, 0
+	return err
+}
+
+func (w *JSONEnvelopeResultIOWriter) Write(rows []RowResult) error {
+	for _, row := range rows {
+		if !w.started {
+			// Without column types the columns are those of the first row
+			if err := w.begin(row.colNames, row.colTypes); err != nil {
 				return err
 			}
 		}
-
 		jsonData, err := json.Marshal(row)
 		if err != nil {
 			return err
 		}
-
-		_, err = w.writer.Write(jsonData)
-		if err != nil {
+		if w.rows > 0 {
+			w.writer.WriteByte(',')
+		}
+		if _, err := w.writer.Write(jsonData); err != nil {
 			return err
 		}
+		w.rows++
 	}
 	return nil
 }
 
-func (w *JSONResultIOWriter) Flush() error {
-	if !w.first {
-		_, err := w.writer.WriteString("]")
+// EndStatement ends the object of a statement with its stats, and flushes it
+func (w *JSONEnvelopeResultIOWriter) EndStatement(isQuery bool, execTime time.Duration, affectedRows int64) error {
+	if !w.started {
+		if err := w.begin(nil, nil); err != nil {
+			return err
+		}
+	}
+	stats := jsonEnvelopeStats{DurationMS: float64(execTime.Microseconds()) / 1000, RowCount: w.rows}
+	if !isQuery {
+		stats.AffectedRows = &affectedRows
+	}
+	data, err := json.Marshal(stats)
+	if err != nil {
+		return err
+	}
+	w.writer.WriteString(`],"stats":`)
+	w.writer.Write(data)
+	w.writer.WriteString("}\n")
+	w.started = false
+	return w.writer.Flush()
+}
+
+func (w *JSONEnvelopeResultIOWriter) Flush() error {
+	if w.started {
+		// The statement failed after its first rows, close the object without stats
+		w.writer.WriteString("]}\n")
+		w.started = false
+	}
+	return w.writer.Flush()
+}
+
+// writeJSONEnvelope writes the collected result of a statement as a JSON envelope. The
+// columns are those of the first row when names is nil.
+func writeJSONEnvelope(out io.Writer, output []RowResult, names, types []string, isQuery bool, execTime time.Duration, affectedRows int64) error {
+	w := NewJSONEnvelopeResultIOWriter(out)
+	if names != nil || len(output) == 0 {
+		if err := w.begin(names, types); err != nil {
+			return err
+		}
+	}
+	if err := w.Write(output); err != nil {
+		return err
+	}
+	return w.EndStatement(isQuery, execTime, affectedRows)
+}
+
+// JSONLResultIOWriter writes each row as a JSON object on its own line
+type JSONLResultIOWriter struct {
+	writer *bufio.Writer
+}
+
+func NewJSONLResultIOWriter(writer io.Writer) *JSONLResultIOWriter {
+	return &JSONLResultIOWriter{
+		writer: bufio.NewWriter(writer),
+	}
+}
+
+func (w *JSONLResultIOWriter) Write(rows []RowResult) error {
+	for _, row := range rows {
+		jsonData, err := json.Marshal(row)
 		if err != nil {
 			return err
 		}
+		if _, err := w.writer.Write(jsonData); err != nil {
+			return err
+		}
+		if err := w.writer.WriteByte('\n'); err != nil {
+			return err
+		}
 	}
+	return nil
+}
+
+func (w *JSONLResultIOWriter) Flush() error {
 	return w.writer.Flush()
 }
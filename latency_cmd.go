@@ -0,0 +1,176 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/pingcap/tidb/pkg/parser"
+)
+
+// digestRe matches a statement digest as shown in statements_summary
+var digestRe = regexp.MustCompile(`^[0-9a-fA-F]{64}$`)
+
+// latencyShades are the cells of the heatmap from the lowest latency to the highest
+var latencyShades = []struct {
+	cell  string
+	color *color.Color
+}{
+	{"░░", color.New(color.FgGreen)},
+	{"▒▒", color.New(color.FgYellow)},
+	{"▓▓", color.New(color.FgHiRed)},
+	{"██", color.New(color.FgRed, color.Bold)},
+}
+
+type LatencyCmd struct{}
+
+func (cmd LatencyCmd) Name() string {
+	return ".latency"
+}
+
+func (cmd LatencyCmd) Description() string {
+	return "Show the latency of a statement by day and hour as a heatmap, from the statements summary history"
+}
+
+func (cmd LatencyCmd) Usage() string {
+	return ".latency <digest|query> [--days n] [--avg]"
+}
+
+func (cmd LatencyCmd) Handle(args []string, resultWriter io.Writer) error {
+	days, avg := 7, false
+	var rest []string
+	for i := 0; i < len(args); i++ {
+		switch args[i] {
+		case "--days", "-days":
+			if i+1 == len(args) {
+				return fmt.Errorf("usage: %s", cmd.Usage())
+			}
+			n, err := strconv.Atoi(args[i+1])
+			if err != nil || n <= 0 {
+				return fmt.Errorf("invalid number of days: %s", args[i+1])
+			}
+			days = n
+			i++
+		case "--avg", "-avg":
+			avg = true
+		default:
+			rest = append(rest, args[i])
+		}
+	}
+	target := strings.TrimSuffix(strings.TrimSpace(strings.Join(rest, " ")), ";")
+	if target == "" {
+		return fmt.Errorf("usage: %s", cmd.Usage())
+	}
+	digest := target
+	if !digestRe.MatchString(target) {
+		_, d := parser.NormalizeDigest(target)
+		digest = d.String()
+	}
+	db, err := requireDB()
+	if err != nil {
+		return err
+	}
+
+	// The current window isn't in the history yet. Statements summary keeps no
+	// percentiles, so the slowest execution of each hour stands in for its p99.
+	metric := "MAX(MAX_LATENCY)"
+	if avg {
+		metric = "SUM(SUM_LATENCY) / SUM(EXEC_COUNT)"
+	}
+	rows, err := db.Query("SELECT DATE_FORMAT(SUMMARY_BEGIN_TIME, '%Y-%m-%d'), HOUR(SUMMARY_BEGIN_TIME), "+metric+", "+
+		"SUM(EXEC_COUNT), MAX(DIGEST_TEXT) FROM ("+
+		"SELECT SUMMARY_BEGIN_TIME, MAX_LATENCY, SUM_LATENCY, EXEC_COUNT, DIGEST_TEXT FROM INFORMATION_SCHEMA.CLUSTER_STATEMENTS_SUMMARY_HISTORY "+
+		"WHERE DIGEST = ? AND SUMMARY_BEGIN_TIME >= NOW() - INTERVAL ? DAY UNION ALL "+
+		"SELECT SUMMARY_BEGIN_TIME, MAX_LATENCY, SUM_LATENCY, EXEC_COUNT, DIGEST_TEXT FROM INFORMATION_SCHEMA.CLUSTER_STATEMENTS_SUMMARY "+
+		"WHERE DIGEST = ?) s GROUP BY 1, 2 ORDER BY 1, 2", digest, days, digest)
+	if err != nil {
+		return fmt.Errorf("failed to read the statements summary: %v", err)
+	}
+	defer rows.Close()
+
+	type hourKey struct {
+		day  string
+		hour int
+	}
+	latencies := map[hourKey]float64{}
+	var dayList []string
+	var digestText string
+	var execs int64
+	lo, hi := -1.0, 0.0
+	for rows.Next() {
+		var k hourKey
+		var ns float64
+		var n int64
+		var text string
+		if err := rows.Scan(&k.day, &k.hour, &ns, &n, &text); err != nil {
+			return fmt.Errorf("failed to read the statements summary: %v", err)
+		}
+		if len(dayList) == 0 || dayList[len(dayList)-1] != k.day {
+			dayList = append(dayList, k.day)
+		}
+		latencies[k] = ns
+		digestText, execs = text, execs+n
+		if lo < 0 || ns < lo {
+			lo = ns
+		}
+		if ns > hi {
+			hi = ns
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read the statements summary: %v", err)
+	}
+	if len(latencies) == 0 {
+		return fmt.Errorf("no executions of digest %s in the statements summary of the last %d days", digest, days)
+	}
+
+	// Shades split the range between the fastest and the slowest hour evenly
+	step := (hi - lo) / float64(len(latencyShades))
+	shade := func(ns float64) int {
+		if step == 0 {
+			return 0
+		}
+		return min(int((ns-lo)/step), len(latencyShades)-1)
+	}
+
+	what := "max latency"
+	if avg {
+		what = "average latency"
+	}
+	fmt.Fprintf(resultWriter, "%s\ndigest %s, %d executions, %s by hour\n\n", digestText, digest, execs, what)
+	fmt.Fprint(resultWriter, strings.Repeat(" ", 11))
+	for h := 0; h < 24; h++ {
+		fmt.Fprintf(resultWriter, " %02d", h)
+	}
+	fmt.Fprintln(resultWriter)
+	var worst hourKey
+	for _, day := range dayList {
+		fmt.Fprintf(resultWriter, "%-11s", day)
+		for h := 0; h < 24; h++ {
+			ns, ok := latencies[hourKey{day, h}]
+			if !ok {
+				fmt.Fprint(resultWriter, "  ·")
+				continue
+			}
+			s := latencyShades[shade(ns)]
+			fmt.Fprint(resultWriter, " "+s.color.Sprint(s.cell))
+			if ns == hi {
+				worst = hourKey{day, h}
+			}
+		}
+		fmt.Fprintln(resultWriter)
+	}
+
+	fmt.Fprintln(resultWriter)
+	for i, s := range latencyShades {
+		from := time.Duration(lo + step*float64(i))
+		fmt.Fprintf(resultWriter, "%s ≥ %s  ", s.color.Sprint(s.cell), from.Round(time.Microsecond))
+	}
+	fmt.Fprintf(resultWriter, "·  no executions\n")
+	fmt.Fprintf(resultWriter, "Slowest hour: %s %02d:00, %s\n", worst.day, worst.hour, time.Duration(hi).Round(time.Microsecond))
+	return nil
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/chzyer/readline"
+	"github.com/fatih/color"
+)
+
+// historyLimit is the number of entries the REPL history keeps
+const historyLimit = 1000
+
+// lineEditor reads the lines of the REPL. On a terminal it is a readline instance that
+// completes words on Tab, highlights SQL as it is typed and formats the line on Ctrl+F;
+// from a pipe the lines are read as they are. It keeps the history of the session either way.
+type lineEditor struct {
+	rl      *readline.Instance // nil when stdin is not a terminal
+	in      *bufio.Reader
+	history []string
+}
+
+// newLineEditor returns the line editor of the REPL, completing words with complete
+func newLineEditor(complete wordCompleter) (*lineEditor, error) {
+	if !isTerminal() {
+		return &lineEditor{in: bufio.NewReader(os.Stdin)}, nil
+	}
+	rl, err := readline.NewEx(&readline.Config{
+		AutoComplete:           complete,
+		Painter:                sqlPainter{},
+		HistoryLimit:           historyLimit,
+		DisableAutoSaveHistory: true,
+		HistorySearchFold:      true,
+		Listener:               readline.FuncListener(formatOnCtrlF),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &lineEditor{rl: rl}, nil
+}
+
+// Prompt reads a line after showing prompt. Ctrl+C clears the line being typed and
+// reads it again, Ctrl+D on an empty line returns io.EOF.
+func (e *lineEditor) Prompt(prompt string) (string, error) {
+	return e.PromptWithSuggestion(prompt, "")
+}
+
+// PromptWithSuggestion is Prompt with text already typed, ready to be edited
+func (e *lineEditor) PromptWithSuggestion(prompt, text string) (string, error) {
+	if e.rl == nil {
+		line, err := e.in.ReadString('\n')
+		if err == io.EOF && line != "" {
+			err = nil
+		}
+		return strings.TrimRight(line, "\r\n"), err
+	}
+	e.rl.SetPrompt(prompt)
+	for {
+		line, err := e.rl.ReadlineWithDefault(text)
+		if errors.Is(err, readline.ErrInterrupt) {
+			text = ""
+			continue
+		}
+		return line, err
+	}
+}
+
+// AppendHistory adds an entry to the history, unless it repeats the last one
+func (e *lineEditor) AppendHistory(entry string) {
+	if entry == "" || (len(e.history) > 0 && e.history[len(e.history)-1] == entry) {
+		return
+	}
+	e.history = append(e.history, entry)
+	if len(e.history) > historyLimit {
+		e.history = e.history[len(e.history)-historyLimit:]
+	}
+	if e.rl != nil {
+		e.rl.SaveHistory(entry)
+	}
+}
+
+// ReadHistory adds the entries of r, one per line, to the history
+func (e *lineEditor) ReadHistory(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		e.AppendHistory(scanner.Text())
+	}
+	return scanner.Err()
+}
+
+// WriteHistory writes the history to w, one entry per line, and returns the number of entries
+func (e *lineEditor) WriteHistory(w io.Writer) (int, error) {
+	bw := bufio.NewWriter(w)
+	for _, entry := range e.history {
+		if _, err := bw.WriteString(entry + "\n"); err != nil {
+			return 0, err
+		}
+	}
+	return len(e.history), bw.Flush()
+}
+
+// Close restores the terminal
+func (e *lineEditor) Close() error {
+	if e.rl == nil {
+		return nil
+	}
+	return e.rl.Close()
+}
+
+// wordCompleter completes the word at pos of line, returning the line up to the word,
+// the candidates for the word and the line after pos
+type wordCompleter func(line string, pos int) (head string, completions []string, tail string)
+
+// Do implements readline.AutoCompleter: readline appends the rest of a candidate to the
+// word typed so far, so the candidates are cut to what follows it. Keywords are completed
+// in lower case after a word typed in lower case.
+func (c wordCompleter) Do(line []rune, pos int) ([][]rune, int) {
+	before := string(line[:pos])
+	head, completions, _ := c(string(line), len(before))
+	typed := []rune(before[len(head):])
+	lower := len(typed) > 0 && strings.ToLower(string(typed)) == string(typed)
+	var rest [][]rune
+	for _, candidate := range completions {
+		if lower && strings.ToUpper(candidate) == candidate {
+			candidate = strings.ToLower(candidate)
+		}
+		runes := []rune(candidate)
+		if len(runes) < len(typed) || !strings.EqualFold(string(runes[:len(typed)]), string(typed)) {
+			continue
+		}
+		rest = append(rest, runes[len(typed):])
+	}
+	return rest, len(typed)
+}
+
+// sqlPainter highlights the line being typed, see highlightSQL
+type sqlPainter struct{}
+
+func (sqlPainter) Paint(line []rune, pos int) []rune {
+	if !highlightEnabled || color.NoColor || strings.HasPrefix(strings.TrimSpace(string(line)), ".") {
+		return line
+	}
+	return []rune(highlightSQL(string(line)))
+}
+
+// formatOnCtrlF replaces the line with its statements formatted when Ctrl+F is pressed,
+// see formatSQLLine. A line that doesn't parse, such as a part of a statement spanning
+// several lines, is left as it is.
+func formatOnCtrlF(line []rune, pos int, key rune) ([]rune, int, bool) {
+	if key != readline.CharForward || strings.HasPrefix(strings.TrimSpace(string(line)), ".") {
+		return nil, 0, false
+	}
+	formatted, err := formatSQLLine(string(line))
+	if err != nil {
+		return nil, 0, false
+	}
+	runes := []rune(formatted)
+	return runes, len(runes), true
+}
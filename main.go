@@ -1,27 +1,29 @@
 package main
 
 import (
-	"bufio"
-	"crypto/tls"
+	"bytes"
 	"database/sql"
+	"database/sql/driver"
 	"encoding/json"
-	"flag"
+	"errors"
 	"fmt"
 	"log"
 	"os"
 	"path/filepath"
 	"runtime/debug"
+	"slices"
+	"sort"
+	"strconv"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
+	"unicode/utf8"
 
 	"github.com/fatih/color"
-	"github.com/go-sql-driver/mysql"
 	_ "github.com/go-sql-driver/mysql"
 	"github.com/joho/godotenv"
 	"github.com/olekukonko/tablewriter"
-	"github.com/pelletier/go-toml"
-	"github.com/peterh/liner"
 	"golang.org/x/term"
 )
 
@@ -32,10 +34,15 @@ const (
 	JSON
 	Table
 	CSV
+	XLSX
+	JSONL
+	Parquet
+	Batch
+	Chart
 )
 
 func (f OutputFormat) String() string {
-	return [...]string{"plain", "json", "table", "csv"}[f]
+	return [...]string{"plain", "json", "table", "csv", "xlsx", "jsonl", "parquet", "batch", "chart"}[f]
 }
 
 func parseOutputFormat(format string) OutputFormat {
@@ -46,60 +53,232 @@ func parseOutputFormat(format string) OutputFormat {
 		return Table
 	case "csv":
 		return CSV
+	case "xlsx":
+		return XLSX
+	case "jsonl":
+		return JSONL
+	case "parquet":
+		return Parquet
+	case "batch":
+		return Batch
+	case "chart":
+		return Chart
 	default:
 		return Plain
 	}
 }
 
-// Load configuration from a file
-func loadConfigFromFile(configPath string) (map[string]string, error) {
-	config := make(map[string]string)
-	file, err := os.ReadFile(configPath)
+// loadConfig reads the configuration file, an empty path yields an empty configuration
+func loadConfig(configPath string) (Config, error) {
+	if configPath == "" {
+		return Config{}, nil
+	}
+	tree, err := loadConfigTree(configPath)
+	if err != nil {
+		return Config{}, err
+	}
+	config, err := decodeConfig(tree)
 	if err != nil {
-		return config, err
+		return Config{}, fmt.Errorf("%s: %v", configPath, err)
 	}
+	return config, nil
+}
 
-	err = toml.Unmarshal(file, &config)
+// Load the settings of the default connection from a file
+func loadConfigFromFile(configPath string) (ConnConfig, error) {
+	config, err := loadConfig(configPath)
+	return config.ConnConfig, err
+}
+
+// loadProfile loads a named profile, defined as a [profiles.<name>] section in the configuration file
+func loadProfile(configPath string, name string) (ConnConfig, error) {
+	if configPath == "" {
+		return ConnConfig{}, fmt.Errorf("no configuration file to load profile %q from", name)
+	}
+	config, err := loadConfig(configPath)
 	if err != nil {
-		return config, err
+		return ConnConfig{}, err
+	}
+	profile, ok := config.Profiles[name]
+	if !ok {
+		return ConnConfig{}, fmt.Errorf("profile %q not found in %s", name, configPath)
 	}
+	return profile, nil
+}
 
-	return config, nil
+// connInfoFromConfig builds the connection information described by the settings of a connection
+func connInfoFromConfig(config ConnConfig) ConnInfo {
+	info := ConnInfo{
+		Host:     config.Host,
+		Port:     string(config.Port),
+		User:     config.User,
+		Password: config.Password,
+		Database: config.Database,
+	}
+	if info.Database == "" {
+		info.Database = "test"
+	}
+	applyConnOptions(&info, config)
+	info.Retries, info.RetryBackoff = retryPolicyFromConfig(config, -1, 0)
+	return info
+}
+
+// applyConnOptions sets the connection options beyond address and credentials from the settings of a connection
+func applyConnOptions(info *ConnInfo, config ConnConfig) {
+	info.Socket = config.Socket
+	info.AllowCleartextPasswords = bool(config.AllowCleartextPasswords)
+	info.ProxyProtocol = bool(config.ProxyProtocol)
+	info.QueryComment = config.QueryComment
+	info.ReadHost = config.ReadHost
+	info.ReadPort = string(config.ReadPort)
+	info.SafeRowLimit = string(config.SafeRowLimit)
+	info.OutputFormat = config.OutputFormat
+	info.Pager = ""
+	if config.Pager != nil {
+		info.Pager = strconv.FormatBool(bool(*config.Pager))
+	}
+	info.SafeMode = bool(config.SafeMode)
+	info.InitSQL = config.InitSQL
+	info.SSLMode = config.SSLMode
+	info.SSLCA = config.SSLCA
+	info.SSLCert = config.SSLCert
+	info.SSLKey = config.SSLKey
+	info.ReadTimeout = config.ReadTimeout
+	info.WriteTimeout = config.WriteTimeout
+	info.MaxAllowedPacket, _ = parseMaxAllowedPacket(string(config.MaxAllowedPacket))
+	info.InterpolateParams = bool(config.InterpolateParams)
 }
 
-// Load configuration from environment variables or .env file
-func loadConfigFromEnv() (string, string, string, string, string, error) {
-	godotenv.Load(".env") // Optionally load .env file
-	host := os.Getenv("DB_HOST")
-	port := os.Getenv("DB_PORT")
-	user := os.Getenv("DB_USERNAME")
-	password := os.Getenv("DB_PASSWORD")
+// Load configuration from environment variables or .env file.
+// tip's own DB_* variables take precedence over TIDB_* ones, which take
+// precedence over the MYSQL_* variables understood by the mysql client.
+// envFiles replace the default ./.env, later files override earlier ones but
+// never variables already set in the environment.
+func loadConfigFromEnv(envFiles []string) (string, string, string, string, string, error) {
+	if len(envFiles) == 0 {
+		godotenv.Load(".env") // Optionally load .env file
+	}
+	for i := len(envFiles) - 1; i >= 0; i-- {
+		if err := godotenv.Load(envFiles[i]); err != nil {
+			return "", "", "", "", "", fmt.Errorf("failed to load env file %s: %v", envFiles[i], err)
+		}
+	}
+	host := firstEnv("DB_HOST", "TIDB_HOST", "MYSQL_HOST")
+	port := firstEnv("DB_PORT", "TIDB_PORT", "MYSQL_TCP_PORT")
+	user := firstEnv("DB_USERNAME", "TIDB_USER", "MYSQL_USER")
+	password := firstEnv("DB_PASSWORD", "TIDB_PASSWORD", "MYSQL_PWD")
 
-	defaultDatabase := os.Getenv("DB_DATABASE")
+	defaultDatabase := firstEnv("DB_DATABASE", "TIDB_DATABASE", "MYSQL_DATABASE")
 	if defaultDatabase == "" {
 		defaultDatabase = "test"
 	}
 	return host, port, user, password, defaultDatabase, nil
 }
 
+// firstEnv returns the value of the first environment variable that is set and not empty
+func firstEnv(names ...string) string {
+	for _, name := range names {
+		if val := os.Getenv(name); val != "" {
+			return val
+		}
+	}
+	return ""
+}
+
 // RowResult represents a single row of query results
 type RowResult struct {
 	colNames  []string
 	colValues []interface{}
+	colTypes  []string // database type names of the columns, nil if they are unknown
 }
 
-// MarshalJSON customizes the JSON serialization of RowResult
+// MarshalJSON writes the row as an object with the columns as keys, in the order of the
+// columns unless jsonSortKeys is set, so that the output of two runs can be diffed. Of
+// columns with the same name, the last one is kept.
 func (r RowResult) MarshalJSON() ([]byte, error) {
-	converted := make(map[string]interface{})
+	keys, err := r.jsonKeys()
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	buf.WriteByte('{')
+	for n, i := range keys.order {
+		if n > 0 {
+			buf.WriteByte(',')
+		}
+		buf.Write(keys.encoded[n])
+		if err := enc.Encode(r.jsonValue(i)); err != nil {
+			return nil, err
+		}
+		// Encode ends every value with a newline
+		buf.Truncate(buf.Len() - 1)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// jsonKeys are the keys of the JSON objects written for the rows of a result set: the
+// columns written and their names, encoded as "name":
+type jsonKeys struct {
+	colNames []string
+	sorted   bool
+	order    []int
+	encoded  [][]byte
+}
+
+var (
+	// lastJSONKeys are the keys of the result set written last, whose rows share their colNames
+	lastJSONKeys     *jsonKeys
+	lastJSONKeysLock sync.Mutex
+)
+
+// jsonKeys returns the keys of the result set of the row, computed once for its rows
+func (r RowResult) jsonKeys() (*jsonKeys, error) {
+	lastJSONKeysLock.Lock()
+	defer lastJSONKeysLock.Unlock()
+	if k := lastJSONKeys; k != nil && k.sorted == jsonSortKeys && len(k.colNames) == len(r.colNames) &&
+		(len(r.colNames) == 0 || &k.colNames[0] == &r.colNames[0]) {
+		return k, nil
+	}
+
+	last := make(map[string]int, len(r.colNames))
 	for i, col := range r.colNames {
-		val := r.colValues[i]
-		if byteVal, ok := val.([]byte); ok {
-			converted[col] = string(byteVal)
-		} else {
-			converted[col] = val
+		last[col] = i
+	}
+	k := &jsonKeys{colNames: r.colNames, sorted: jsonSortKeys, order: make([]int, 0, len(last))}
+	for i, col := range r.colNames {
+		if last[col] == i {
+			k.order = append(k.order, i)
 		}
 	}
-	return json.Marshal(converted)
+	if jsonSortKeys {
+		sort.Slice(k.order, func(a, b int) bool { return r.colNames[k.order[a]] < r.colNames[k.order[b]] })
+	}
+	k.encoded = make([][]byte, len(k.order))
+	for n, i := range k.order {
+		key, err := json.Marshal(r.colNames[i])
+		if err != nil {
+			return nil, err
+		}
+		k.encoded[n] = append(key, ':')
+	}
+	lastJSONKeys = k
+	return k, nil
+}
+
+// jsonValue returns the value of column i as it is written in JSON
+func (r RowResult) jsonValue(i int) interface{} {
+	if b, ok := r.binaryValue(i); ok {
+		return displayBinary(b)
+	}
+	if s, ok := r.datetimeValue(i); ok {
+		return s
+	}
+	if b, ok := r.colValues[i].([]byte); ok {
+		return string(b)
+	}
+	return r.colValues[i]
 }
 
 func isTerminal() bool {
@@ -107,7 +286,102 @@ func isTerminal() bool {
 	return term.IsTerminal(fd)
 }
 
-func executeSQL(db *sql.DB, query string, resultIOWriter ResultIOWriter) (bool, []RowResult, bool, int64, error) {
+// readPassword prompts on stderr and reads a password from the terminal with echo disabled
+func readPassword(prompt string) (string, error) {
+	if !isTerminal() {
+		return "", fmt.Errorf("cannot prompt for password: stdin is not a terminal")
+	}
+	fmt.Fprint(os.Stderr, prompt)
+	pass, err := term.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return "", fmt.Errorf("failed to read password: %w", err)
+	}
+	return string(pass), nil
+}
+
+// extractPasswordPrompt handles a bare -p flag, one without an attached value. The
+// argument after it is its value, as in -p secret, unless it is another flag or a
+// connection string, in which case -p is removed from args and the password is
+// prompted for.
+func extractPasswordPrompt(args []string) ([]string, bool) {
+	var out []string
+	prompt := false
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			out = append(out, args[i:]...)
+			break
+		}
+		if arg == "-p" || arg == "--p" {
+			if i+1 < len(args) && !strings.HasPrefix(args[i+1], "-") && !isConnURL(args[i+1]) {
+				out = append(out, "-p="+args[i+1])
+				i++
+				continue
+			}
+			prompt = true
+			continue
+		}
+		out = append(out, arg)
+	}
+	return out, prompt
+}
+
+// errMayHaveRun is wrapped into the error of a statement lost with the connection when
+// it may have taken effect anyway, so that it must not be run again without checking
+var errMayHaveRun = errors.New("check whether it took effect")
+
+// mayHaveRun reports whether a statement that failed with err as the connection was
+// lost may have taken effect: it reached the server and isn't known to only read
+func mayHaveRun(query string, err error) bool {
+	return !errors.Is(err, driver.ErrBadConn) && !isReadOnly(query)
+}
+
+// executeSQL runs query on db, binding args to its ? placeholders. If db is the global
+// connection and its host went away, it fails over to the next host and runs the
+// statement again if it never reached the server, or if isReadOnly accepts it.
+func executeSQL(db *sql.DB, query string, resultIOWriter ResultIOWriter, args ...interface{}) (bool, []RowResult, bool, int64, error) {
+	start := time.Now()
+	isQ, output, hasRows, affectedRows, err := executeStatement(db, query, resultIOWriter, args...)
+	if debugEnabled() {
+		debugLog.Debug("statement", "sql", loggableSQL(query), "duration", time.Since(start), "rows", len(output), "affected", affectedRows, "error", err)
+	}
+	if err != nil && db == GetDB() && isConnectionLost(err) {
+		lostTxn := txnOpen
+		if txnOpen {
+			txnOpen = false
+			log.Printf("The open transaction was lost with the connection, its changes were rolled back")
+		}
+		ran := lostTxn || mayHaveRun(query, err)
+		// Move to another host if there is one, otherwise reconnect to the same one
+		if ferr := failover(); ferr != nil && !reconnect() {
+			connHealth.Store(healthDown)
+			if ran {
+				err = fmt.Errorf("%w (%w)", err, errMayHaveRun)
+			}
+			return false, nil, false, 0, err
+		}
+		// Run the statement once more, unless it may have taken effect already, was part
+		// of the lost transaction or already wrote part of its results
+		if ran {
+			return false, nil, false, 0, fmt.Errorf("%w (not run again after reconnecting, %w)", err, errMayHaveRun)
+		}
+		if resultIOWriter != nil {
+			return false, nil, false, 0, fmt.Errorf("%w (not run again after reconnecting, part of its results were written)", err)
+		}
+		isQ, output, hasRows, affectedRows, err = executeStatement(GetDB(), query, resultIOWriter, args...)
+		db = GetDB()
+		if err != nil && isConnectionLost(err) && mayHaveRun(query, err) {
+			err = fmt.Errorf("%w (%w)", err, errMayHaveRun)
+		}
+	}
+	if err == nil && db == GetDB() {
+		trackSession(query)
+	}
+	return isQ, output, hasRows, affectedRows, err
+}
+
+func executeStatement(db *sql.DB, query string, resultIOWriter ResultIOWriter, args ...interface{}) (bool, []RowResult, bool, int64, error) {
 	var output []RowResult
 	var hasRows bool
 	var affectedRows int64
@@ -116,48 +390,22 @@ func executeSQL(db *sql.DB, query string, resultIOWriter ResultIOWriter) (bool,
 	if err != nil {
 		return false, nil, false, 0, fmt.Errorf("failed to parse SQL: %w", err)
 	}
+	query = withQueryComment(query)
+	target := routeStatement(db, query)
 
 	if isQ {
-		rows, err := db.Query(query)
+		rows, err := target.Query(query, args...)
 		if err != nil {
 			return false, nil, false, 0, fmt.Errorf("failed to execute SQL: %w", err)
 		}
 		defer rows.Close()
 
-		cols, err := rows.Columns()
+		output, hasRows, err = scanRows(rows, resultIOWriter, len(args) == 0)
 		if err != nil {
-			return false, nil, false, 0, fmt.Errorf("failed to get column info: %w", err)
-		}
-
-		results := make([]interface{}, len(cols))
-		pointers := make([]interface{}, len(cols))
-		for i := range results {
-			pointers[i] = &results[i]
-		}
-
-		for rows.Next() {
-			hasRows = true
-			if err := rows.Scan(pointers...); err != nil {
-				return false, nil, false, 0, fmt.Errorf("failed to read data: %w", err)
-			}
-			rowData := RowResult{
-				colNames:  cols,
-				colValues: make([]interface{}, len(cols)),
-			}
-			for i := range cols {
-				rowData.colValues[i] = results[i]
-			}
-			if resultIOWriter != nil {
-				if err := resultIOWriter.Write([]RowResult{rowData}); err != nil {
-					return false, nil, false, 0, fmt.Errorf("failed to write data: %w", err)
-				}
-			} else {
-				output = append(output, rowData)
-			}
-
+			return false, nil, false, 0, err
 		}
 	} else {
-		result, err := db.Exec(query)
+		result, err := target.Exec(query, args...)
 		if err != nil {
 			return false, nil, false, 0, fmt.Errorf("failed to execute SQL: %w", err)
 		}
@@ -165,27 +413,183 @@ func executeSQL(db *sql.DB, query string, resultIOWriter ResultIOWriter) (bool,
 		if err != nil {
 			return false, nil, false, 0, fmt.Errorf("failed to get affected rows: %w", err)
 		}
+		if isDDL(query) {
+			invalidateCompletionCache()
+		}
+		followSession(target, query)
 	}
 
 	return isQ, output, hasRows, affectedRows, nil
 }
 
+// queryComment is prepended to the statements run by executeSQL when not empty
+var queryComment string
+
+// withQueryComment prefixes query with the configured comment so that proxies and
+// the slow query log can tell statements sent by tip apart
+func withQueryComment(query string) string {
+	if queryComment == "" {
+		return query
+	}
+	return "/* " + strings.ReplaceAll(queryComment, "*/", "* /") + " */ " + query
+}
+
+// scanBuffers are the destinations rows are scanned into, pooled so that the statements
+// of a script or a watch don't allocate them again
+type scanBuffers struct {
+	values   []interface{}
+	raw      []sql.RawBytes
+	pointers []interface{}
+}
+
+var scanBufferPool = sync.Pool{New: func() interface{} { return new(scanBuffers) }}
+
+// scanInto points the buffers at n values, or at n raw values with raw
+func (b *scanBuffers) scanInto(n int, raw bool) []interface{} {
+	b.values = slices.Grow(b.values[:0], n)[:n]
+	b.raw = slices.Grow(b.raw[:0], n)[:n]
+	b.pointers = slices.Grow(b.pointers[:0], n)[:n]
+	for i := range b.pointers {
+		if raw {
+			b.pointers[i] = &b.raw[i]
+		} else {
+			b.pointers[i] = &b.values[i]
+		}
+	}
+	return b.pointers
+}
+
+// release clears the values scanned, so that the pool doesn't keep them alive
+func (b *scanBuffers) release() {
+	clear(b.values)
+	clear(b.raw)
+	scanBufferPool.Put(b)
+}
+
+// rowSlabSize is the number of rows whose values are allocated at once when rows are
+// collected
+const rowSlabSize = 256
+
+// scanRows reads all rows, streaming them to resultIOWriter if it is not nil,
+// otherwise collecting them into the returned slice. A streamed row and its values are
+// reused for the next row, so resultIOWriter must not keep them. With raw the values are
+// scanned as sql.RawBytes, without copying them, which is only equivalent to scanning
+// them into interfaces when the query used the text protocol, that is had no args.
+func scanRows(rows *sql.Rows, resultIOWriter ResultIOWriter, raw bool) ([]RowResult, bool, error) {
+	var output []RowResult
+	var hasRows bool
+
+	cols, err := rows.Columns()
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to get column info: %w", err)
+	}
+	colTypes, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to get column info: %w", err)
+	}
+	typeNames := make([]string, len(colTypes))
+	for i, ct := range colTypes {
+		typeNames[i] = ct.DatabaseTypeName()
+	}
+	if tw, ok := resultIOWriter.(columnTypeWriter); ok {
+		if err := tw.SetColumnTypes(colTypes); err != nil {
+			return nil, false, &outputError{err}
+		}
+	}
+
+	raw = raw && resultIOWriter != nil
+	buf := scanBufferPool.Get().(*scanBuffers)
+	defer buf.release()
+	pointers := buf.scanInto(len(cols), raw)
+
+	// a streamed row is written as a batch of one, reusing the same row
+	batch := []RowResult{{colNames: cols, colValues: make([]interface{}, len(cols)), colTypes: typeNames}}
+	var slab []interface{}
+	for rows.Next() {
+		hasRows = true
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, false, fmt.Errorf("failed to read data: %w", err)
+		}
+		if resultIOWriter == nil {
+			if len(slab) < len(cols) {
+				slab = make([]interface{}, len(cols)*rowSlabSize)
+			}
+			colValues := slab[:len(cols):len(cols)]
+			slab = slab[len(cols):]
+			copy(colValues, buf.values)
+			output = append(output, RowResult{colNames: cols, colValues: colValues, colTypes: typeNames})
+			continue
+		}
+		colValues := batch[0].colValues
+		for i := range colValues {
+			switch {
+			case !raw:
+				colValues[i] = buf.values[i]
+			case buf.raw[i] == nil:
+				colValues[i] = nil
+			default:
+				colValues[i] = []byte(buf.raw[i])
+			}
+		}
+		if err := resultIOWriter.Write(batch); err != nil {
+			return nil, false, &outputError{err}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, false, fmt.Errorf("failed to read data: %w", err)
+	}
+	return output, hasRows, nil
+}
+
+// queryAndPrint runs a query with args and prints the result in the current output format
+func queryAndPrint(db *sql.DB, query string, args ...interface{}) error {
+	startTime := time.Now()
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return fmt.Errorf("failed to execute SQL: %w", err)
+	}
+	defer rows.Close()
+
+	output, hasRows, err := scanRows(rows, nil, false)
+	if err != nil {
+		return err
+	}
+	printResults(true, output, *globalOutputFormat, hasRows, time.Since(startTime), 0)
+	return nil
+}
+
 var globalOutputFormat *OutputFormat
-var replSuggestion string // Add global variable for REPL suggestion
+var globalConfigFile string
+var globalProfile string   // Profile of the configuration file connected with, if any
+var replSuggestion string  // Add global variable for REPL suggestion
+var lastResult []RowResult // Rows of the last query run in the REPL
 
-func repl(db *sql.DB, outputFormat *OutputFormat) {
+func repl(outputFormat *OutputFormat) {
 	if isTerminal() {
 		showExecDetails = true
 	}
-	line := liner.NewLiner()
+	var queryBuilder string
+	var stmtPrompt string // prompt of the first line of the statement being typed
+	var curDB string
+	line, err := newLineEditor(func(line string, pos int) (head string, completions []string, tail string) {
+		return completeSQL(GetDB(), curDB, queryBuilder, line, pos)
+	})
+	if err != nil {
+		log.Printf("Failed to start the line editor: %v", err)
+		return
+	}
+	replLine = line
+	stopShutdownSignals := watchShutdownSignals(syscall.SIGTERM, syscall.SIGHUP)
 	defer func() {
+		stopShutdownSignals()
+		dropMaterializedTables()
+		replLine = nil
 		line.Close()
 		// show cursor
 		fmt.Print("\033[?25h")
 	}()
 
-	var curDB string
-	historyFile := filepath.Join(os.Getenv("HOME"), ".tip/history")
+	historyFile := historyFilePath()
 	// ensure directory exists
 	if _, err := os.Stat(historyFile); os.IsNotExist(err) {
 		os.MkdirAll(filepath.Dir(historyFile), 0o755)
@@ -195,80 +599,66 @@ func repl(db *sql.DB, outputFormat *OutputFormat) {
 		f.Close()
 	}
 
-	var queryBuilder string
-	completer := func(line string, pos int) (head string, completions []string, tail string) {
-		databases, err := getDatabases(db)
-		if err != nil {
-			log.Println(err)
-			return
-		}
-		tables, err := getTableNames(db, curDB)
-		if err != nil {
-			log.Println(err)
-			return
-		}
-		cols, err := getAllColumnNames(db, curDB)
-		if err != nil {
-			log.Println(err)
-			return
-		}
-		words := strings.Fields(line[:pos])
-		lastWord := ""
-		if len(words) > 0 {
-			lastWord = strings.ToLower(words[len(words)-1])
-		}
-		keywords := append(KEYWORDS, append(databases, append(tables, cols...)...)...)
-		keywords = append(keywords, SystemCmdNames()...)
+	sendTelemetryIfDue()
 
-		for _, item := range keywords {
-			if strings.HasPrefix(strings.ToLower(item), lastWord) {
-				completions = append(completions, item)
-			}
-		}
-		if len(completions) == 0 {
-			return
-		}
-		if pos > 0 && line[pos-1] == ' ' {
-			completions = []string{}
-			head = line[:pos]
-			tail = line[pos:]
-		} else {
-			head = line[:pos-len(lastWord)]
-			tail = line[pos:]
-		}
-		return
+	if isTerminal() {
+		stopHealthCheck := startHealthCheck()
+		defer stopHealthCheck()
 	}
-	line.SetWordCompleter(completer)
-	line.SetTabCompletionStyle(liner.TabPrints)
 
 	for {
+		if queryBuilder == "" {
+			reloadConfigIfChanged(replOut)
+		}
+		if len(queuedStatements) > 0 {
+			offerQueuedReplay(line)
+		}
+
+		db := GetDB()
 		var prompt string
 		if isTerminal() {
 			if db == nil {
-				prompt = "tip> "
+				prompt = "tip(offline)> "
 			} else {
-				db.QueryRow("SELECT DATABASE()").Scan(&curDB)
+				// Don't wait on a connection known to be down, keep the last database name
+				if connHealth.Load() != healthDown || curDB == "" {
+					db.QueryRow("SELECT DATABASE()").Scan(&curDB)
+				}
 				if curDB == "" {
 					curDB = "(none)"
 				}
+				// A * marks an open transaction
+				txnMark := ""
+				if txnOpen {
+					txnMark = "*"
+				}
+				// Reading a snapshot shows the time read at, as writes then fail
+				if snapshotTSO != 0 {
+					txnMark += "@" + tsoTime(snapshotTSO).Format("2006-01-02 15:04:05")
+				}
 				if queryBuilder == "" {
-					prompt = fmt.Sprintf("%s> ", curDB)
+					prompt = fmt.Sprintf("%s%s%s> ", healthIndicator(), curDB, txnMark)
 				} else {
-					prompt = fmt.Sprintf("%s>>> ", curDB)
+					prompt = fmt.Sprintf("%s%s%s>>> ", healthIndicator(), curDB, txnMark)
 				}
 			}
 		}
 		var input string
 		var err error
+		stopInterrupt := watchShutdownSignals(os.Interrupt)
 		if replSuggestion != "" {
 			// Use PromptWithSuggestion when replSuggestion is not empty
-			input, err = line.PromptWithSuggestion(prompt, replSuggestion, len(replSuggestion))
+			input, err = line.PromptWithSuggestion(prompt, replSuggestion)
 		} else {
 			// Use regular Prompt when replSuggestion is empty
 			input, err = line.Prompt(prompt)
 		}
+		stopInterrupt()
 
 		if err != nil {
+			if txnOpen && !confirmExitInTransaction(line) {
+				continue
+			}
 			break
 		}
 
@@ -277,27 +667,52 @@ func repl(db *sql.DB, outputFormat *OutputFormat) {
 
 		trimmedInput := strings.TrimSpace(input)
 
+		// !n is a shorthand for re-running history entry n
+		if m := historyRefRe.FindStringSubmatch(trimmedInput); m != nil && queryBuilder == "" {
+			trimmedInput = ".history run " + m[1]
+		}
+
 		// Check if it's a system command
 		if strings.HasPrefix(trimmedInput, ".") {
-			if err := handleCmd(trimmedInput, os.Stdout); err != nil {
-				log.Println(err)
-			}
+			teeInput(prompt, trimmedInput)
+			var err error
+			runGuarded(strings.Fields(trimmedInput)[0], func() {
+				if err = handleCmd(trimmedInput, replOut); err != nil {
+					log.Println(err)
+				}
+			})
 			line.AppendHistory(trimmedInput)
+			if err != nil && pipeFailure() {
+				break
+			}
 			continue
 		}
 
-		// Check if database connection is established
-		if db == nil {
-			log.Println("Error: Not connected to any database. Use .connect to establish a connection.")
-			continue
+		// Check if database connection is established, dialing now if the connection was deferred.
+		// Statements are queued instead when queueing is on, see .queue
+		if db == nil && !queueEnabled {
+			if err := ensureConnected(); err != nil {
+				log.Printf("Error: %v", err)
+				if pipeFailure() {
+					break
+				}
+				continue
+			}
+			db = GetDB()
 		}
 
+		if queryBuilder == "" {
+			stmtPrompt = prompt
+		}
 		queryBuilder += input + "\n"
 
 		// Check if input is from a pipe and ends with a semicolon
 		if !isTerminal() && (len(trimmedInput) == 0 || trimmedInput[len(trimmedInput)-1] != ';') {
 			log.Println("Error: Input from pipe must end with a semicolon.")
 			queryBuilder = "" // Reset the query builder
+			if pipeFailure() {
+				break
+			}
 			continue
 		}
 
@@ -305,25 +720,100 @@ func repl(db *sql.DB, outputFormat *OutputFormat) {
 		if len(trimmedInput) > 0 && trimmedInput[len(trimmedInput)-1] == ';' {
 			startTime := time.Now() // Start timing the query execution
 			queryBuilder = strings.TrimSpace(queryBuilder)
-			line.AppendHistory(queryBuilder)
-			isQ, output, hasRows, affectedRows, err := executeSQL(db, queryBuilder, nil)
-			if err != nil {
-				log.Println(err)
-				queryBuilder = "" // Reset the query builder
+			// Keep multi-line statements on one line so that history entries stay numbered
+			line.AppendHistory(strings.ReplaceAll(queryBuilder, "\n", " "))
+			if db == nil && ensureConnected() == nil {
+				db = GetDB()
+			}
+			if queueEnabled && (db == nil || connHealth.Load() == healthDown) {
+				queueStatement(queryBuilder)
+				queryBuilder = ""
 				continue
 			}
-			execTime := time.Since(startTime)
-			printResults(isQ, output, *outputFormat, hasRows, execTime, affectedRows)
-			queryBuilder = "" // Reset the query builder after execution
+			stmt := queryBuilder
+			queryBuilder = "" // Reset the query builder
+			teeInput(stmtPrompt, stmt)
+			var err error
+			runGuarded("a statement", func() {
+				err = runReplStatement(db, stmt, *outputFormat, startTime)
+			})
+			if err != nil && pipeFailure() {
+				break
+			}
 		}
 	}
 
-	if f, err := os.Create(historyFile); err != nil {
+	saveHistory()
+}
+
+// pipeFailed is set when a statement or command read from a pipe fails, tip then exits 1
+var pipeFailed bool
+
+// forceMode keeps running the statements read from a pipe after one fails, set with -force
+var forceMode bool
+
+// pipeFailure records the failure of a statement or command read from a pipe, and
+// reports whether the REPL stops there, as mysql does unless -force is given. Failures
+// typed on a terminal are only reported.
+func pipeFailure() bool {
+	if isTerminal() {
+		return false
+	}
+	pipeFailed = true
+	return !forceMode
+}
+
+// runReplStatement runs a statement typed in the REPL and prints its results. The
+// error returned is already reported.
+func runReplStatement(db *sql.DB, stmt string, outputFormat OutputFormat, startTime time.Time) error {
+	if err := checkSafeMode(stmt); err != nil {
+		log.Println(err)
+		return err
+	}
+	query, limited := applyRowLimit(stmt)
+	countUsage("statement")
+	isQ, output, hasRows, affectedRows, err := executeSQL(db, query, nil)
+	if err != nil {
+		countError(err)
+		// Statements that may have taken effect aren't queued, replaying them could run them twice
+		if queueEnabled && isConnectionLost(err) && !errors.Is(err, errMayHaveRun) {
+			queueStatement(stmt)
+			return nil
+		}
+		log.Println(err)
+		return err
+	}
+	cut := limited && len(output) > safeRowLimit
+	if cut {
+		output = output[:safeRowLimit]
+	}
+	if isQ {
+		lastResult = output
+	}
+	recordExecutedSQL(stmt)
+	execTime := time.Since(startTime)
+	if isQ {
+		capturePlan(strings.ReplaceAll(stmt, "\n", " "), query)
+	}
+	printResults(isQ, output, outputFormat, hasRows, execTime, affectedRows)
+	if cut {
+		fmt.Fprintf(replOut, "showing first %d rows (use .limit off)\n", safeRowLimit)
+	}
+	return nil
+}
+
+// saveHistory writes the history of the REPL to the history file
+func saveHistory() {
+	if replLine == nil {
+		return
+	}
+	f, err := os.Create(historyFilePath())
+	if err != nil {
 		log.Printf("Error writing history file: %v", err)
-	} else {
-		line.WriteHistory(f)
-		f.Close()
+		return
 	}
+	defer f.Close()
+	replLine.WriteHistory(f)
 }
 
 func formatValue(val interface{}) string {
@@ -335,7 +825,11 @@ func formatValue(val interface{}) string {
 	case int, int64:
 		return fmt.Sprintf("%d", v)
 	case float64:
-		return fmt.Sprintf("%f", v)
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 32)
+	case uint64:
+		return strconv.FormatUint(v, 10)
 	case string:
 		return v
 	case []byte:
@@ -347,34 +841,59 @@ func formatValue(val interface{}) string {
 	}
 }
 
-func formatCSVValue(val interface{}) string {
+// formatSQLValue renders a value as a SQL literal
+func formatSQLValue(val interface{}) string {
 	switch v := val.(type) {
 	case nil:
-		return ""
+		return "NULL"
 	case bool:
-		return fmt.Sprintf("%t", v)
+		if v {
+			return "1"
+		}
+		return "0"
 	case int, int64:
 		return fmt.Sprintf("%d", v)
 	case float64:
-		return fmt.Sprintf("%f", v)
+		return strconv.FormatFloat(v, 'g', -1, 64)
 	case string:
-		return fmt.Sprintf("\"%s\"", strings.ReplaceAll(v, "\"", "\"\""))
+		return quoteSQLString(v)
 	case []byte:
-		return fmt.Sprintf("\"%s\"", strings.ReplaceAll(string(v), "\"", "\"\""))
+		if !utf8.Valid(v) {
+			return fmt.Sprintf("X'%x'", v)
+		}
+		return quoteSQLString(string(v))
 	case time.Time:
-		return fmt.Sprintf("\"%s\"", v.Format("2006-01-02 15:04:05"))
+		return "'" + v.Format("2006-01-02 15:04:05.999999") + "'"
 	default:
-		return fmt.Sprintf("\"%v\"", v)
+		return quoteSQLString(fmt.Sprintf("%v", v))
 	}
 }
 
+var sqlStringEscaper = strings.NewReplacer(
+	"\\", "\\\\",
+	"'", "\\'",
+	"\x00", "\\0",
+	"\n", "\\n",
+	"\r", "\\r",
+	"\x1a", "\\Z",
+)
+
+func quoteSQLString(s string) string {
+	return "'" + sqlStringEscaper.Replace(s) + "'"
+}
+
 func printResults(isQ bool, output []RowResult, outputFormat OutputFormat, hasRows bool, execTime time.Duration, affectedRows int64) {
-	if outputFormat == JSON {
+	if outputFormat == JSON && jsonEnvelope {
+		if err := writeJSONEnvelope(replOut, output, nil, nil, isQ, execTime, affectedRows); err != nil {
+			log.Printf("Failed to write results: %v", err)
+			return
+		}
+	} else if outputFormat == JSON {
 		if len(output) == 0 {
 			if !isQ {
-				fmt.Println("{\"status\": \"OK\", \"affected_rows\": " + fmt.Sprintf("%d", affectedRows) + "}")
+				fmt.Fprintln(replOut, "{\"status\": \"OK\", \"affected_rows\": "+fmt.Sprintf("%d", affectedRows)+"}")
 			} else {
-				fmt.Println("[]")
+				fmt.Fprintln(replOut, "[]")
 			}
 			goto I
 		}
@@ -383,41 +902,40 @@ func printResults(isQ bool, output []RowResult, outputFormat OutputFormat, hasRo
 			log.Printf("Failed to marshal JSON: %v", err)
 			return
 		}
-		fmt.Println(string(jsonOutput))
+		fmt.Fprintln(replOut, string(jsonOutput))
 	} else if outputFormat == Plain {
 		if len(output) == 0 {
 			if !isQ {
-				fmt.Println("OK, affected_rows:", affectedRows)
+				fmt.Fprintln(replOut, "OK, affected_rows:", affectedRows)
 			} else {
-				fmt.Println("(empty result)")
+				fmt.Fprintln(replOut, "(empty result)")
 			}
 			goto I
 		}
 		for _, row := range output {
 			for i, col := range row.colNames {
-				val := row.colValues[i]
-				fmt.Printf("%s: %s ", col, formatValue(val))
+				fmt.Fprintf(replOut, "%s: %s ", col, row.displayValue(i))
 			}
-			fmt.Println()
+			fmt.Fprintln(replOut)
 		}
 	} else if outputFormat == Table {
 		if len(output) == 0 {
 			if !isQ {
-				fmt.Println("OK, affected_rows:", affectedRows)
+				fmt.Fprintln(replOut, "OK, affected_rows:", affectedRows)
 			} else {
-				fmt.Println("(empty result)")
+				fmt.Fprintln(replOut, "(empty result)")
 			}
 			goto I
 		}
 		cols := output[0].colNames
-		table := tablewriter.NewWriter(os.Stdout)
+		var buf bytes.Buffer
+		table := tablewriter.NewWriter(&buf)
 		table.SetHeader(cols)
 
 		for _, row := range output {
 			rowData := make([]string, len(cols))
 			for i := range cols {
-				val := row.colValues[i]
-				rowData[i] = formatValue(val)
+				rowData[i] = row.displayValue(i)
 			}
 			table.Append(rowData)
 		}
@@ -426,24 +944,60 @@ func printResults(isQ bool, output []RowResult, outputFormat OutputFormat, hasRo
 		table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
 		table.SetAlignment(tablewriter.ALIGN_LEFT)
 		table.Render()
+		pageOutput(buf.String(), tableHeaderLines)
 	} else if outputFormat == CSV {
 		if len(output) == 0 {
 			if !isQ {
-				fmt.Printf("status,affected_rows\nOK,%d\n", affectedRows)
+				fmt.Fprintf(replOut, "status,affected_rows\nOK,%d\n", affectedRows)
 			} else {
-				fmt.Println("(empty result)")
+				fmt.Fprintln(replOut, "(empty result)")
 			}
 			goto I
 		}
-		cols := output[0].colNames
-		fmt.Println(strings.Join(cols, ","))
+		w := NewCSVResultIOWriter(replOut)
+		if err := w.Write(output); err != nil {
+			log.Printf("Failed to write CSV: %v", err)
+			return
+		}
+		if err := w.Flush(); err != nil {
+			log.Printf("Failed to write CSV: %v", err)
+			return
+		}
+	} else if outputFormat == Batch {
+		// Like mysql --batch, nothing is printed for an empty result or another statement
+		if len(output) == 0 {
+			goto I
+		}
+		w := NewBatchResultIOWriter(replOut)
+		if err := w.Write(output); err != nil {
+			log.Printf("Failed to write results: %v", err)
+			return
+		}
+		if err := w.Flush(); err != nil {
+			log.Printf("Failed to write results: %v", err)
+			return
+		}
+	} else if outputFormat == Chart {
+		if err := renderChart(replOut, output, chartBar); err != nil {
+			// Results that can't be charted, and the outcome of other statements, are shown as a table
+			if len(output) > 0 {
+				fmt.Fprintf(replErr, "%v, showing a table\n", err)
+			}
+			printResults(isQ, output, Table, hasRows, execTime, affectedRows)
+			return
+		}
+	} else if outputFormat == JSONL {
+		if !isQ {
+			fmt.Fprintf(replOut, "{\"status\": \"OK\", \"affected_rows\": %d}\n", affectedRows)
+			goto I
+		}
 		for _, row := range output {
-			rowData := make([]string, len(cols))
-			for i := range cols {
-				val := row.colValues[i]
-				rowData[i] = formatCSVValue(val)
+			jsonOutput, err := json.Marshal(row)
+			if err != nil {
+				log.Printf("Failed to marshal JSON: %v", err)
+				return
 			}
-			fmt.Println(strings.Join(rowData, ","))
+			fmt.Fprintln(replOut, string(jsonOutput))
 		}
 	} else {
 		log.Fatal("Invalid output format: " + outputFormat.String())
@@ -494,37 +1048,6 @@ func greeting(db *sql.DB) {
 	log.Println("-------------------------")
 }
 
-func connectWithRetry(dsn string, host string, useTLS bool) (*sql.DB, error) {
-	var db *sql.DB
-	var err error
-
-	log.Printf("Connecting to TiDB at: %s...", host)
-
-	if useTLS {
-		mysql.RegisterTLSConfig("tidb", &tls.Config{
-			MinVersion: tls.VersionTLS12,
-			ServerName: host,
-		})
-		dsn += "&tls=tidb"
-	}
-
-	db, err = sql.Open("mysql", dsn)
-	if err != nil {
-		log.Println("Failed!")
-		return nil, err
-	}
-
-	err = db.Ping()
-	if err != nil {
-		db.Close()
-		log.Println("Failed!")
-		return nil, err
-	}
-
-	log.Println("Connected!")
-	return db, nil
-}
-
 // ConnInfo represents the connection information for a database
 type ConnInfo struct {
 	Host     string
@@ -532,6 +1055,35 @@ type ConnInfo struct {
 	User     string
 	Password string
 	Database string
+
+	Socket                  string // Unix socket path, used instead of Host and Port when set
+	AllowCleartextPasswords bool   // Allow the mysql_clear_password plugin, only ever used over TLS
+	ProxyProtocol           bool   // Send a PROXY protocol header when connecting
+	QueryComment            string // Comment prepended to every statement, e.g. for proxy routing rules
+	ReadHost                string // Endpoint read-only statements are routed to, see .route
+	ReadPort                string // Port of the read endpoint, defaults to Port
+	SafeRowLimit            string // Rows shown for a SELECT without LIMIT in the REPL, a number or off
+	OutputFormat            string // Output format the REPL starts with, unless given with -o
+	Pager                   string // Whether the REPL pages tall results, true or false
+	SafeMode                bool   // Start the REPL in safe mode, see .safe-mode
+	InitSQL                 string // Statements run on connecting, before anything else
+
+	SSLMode string // disabled, preferred (default), required, verify-ca or verify-identity
+	SSLCA   string // PEM file of the CA to trust instead of the system roots
+	SSLCert string // PEM file of the client certificate
+	SSLKey  string // PEM file of the client certificate key
+
+	Retries      int           // Number of retries after a failed connection attempt
+	RetryBackoff time.Duration // Delay before the first retry, doubled after each attempt
+
+	ReadTimeout       time.Duration // I/O read timeout of the driver, 0 for none
+	WriteTimeout      time.Duration // I/O write timeout of the driver, 0 for none
+	MaxAllowedPacket  int           // Largest packet the driver sends, 0 for its default, -1 for the server's max_allowed_packet
+	InterpolateParams bool          // Interpolate the arguments of statements instead of preparing them on the server
+
+	// Session marks the connection of the interactive session: a single connection
+	// that keeps the session state and restores it when it has to reconnect
+	Session bool
 }
 
 var (
@@ -553,185 +1105,96 @@ func SetDB(db *sql.DB) {
 	globalDB = db
 }
 
+// pendingConnInfo holds the connection settings when connecting was deferred
+// with -offline, the connection is made on first use
+var pendingConnInfo *ConnInfo
+
+// ensureConnected dials the deferred connection if there is no connection yet
+func ensureConnected() error {
+	if GetDB() != nil {
+		return nil
+	}
+	if pendingConnInfo == nil {
+		return fmt.Errorf("not connected to any database, use .connect to establish a connection")
+	}
+	if err := connectToDatabase(*pendingConnInfo); err != nil {
+		return err
+	}
+	pendingConnInfo = nil
+	return nil
+}
+
 // connectToDatabase attempts to connect to the database using the provided ConnInfo
 func connectToDatabase(info ConnInfo) error {
-	dsn := fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?charset=utf8mb4",
-		info.User, info.Password, info.Host, info.Port, info.Database)
-
-	// Try connecting with TLS
-	db, err := connectWithRetry(dsn, info.Host, true)
+	// Variables set on the previous connection don't carry over to a new session
+	resetSession()
+	info.Session = true
+	db, host, err := openAnyHost(info, 0)
 	if err != nil {
-		fmt.Println("Attempting connection without TLS...")
-		// Try connecting without TLS
-		db, err = connectWithRetry(dsn, info.Host, false)
-		if err != nil {
-			return fmt.Errorf("failed to connect to TiDB: %v", err)
-		}
+		return err
 	}
 
-	if db != nil {
-		db.SetMaxOpenConns(100)
-		db.SetMaxIdleConns(100)
-
-		if err := db.Ping(); err != nil {
-			return fmt.Errorf("failed to ping TiDB: %v", err)
-		}
+	if err := connectReadEndpoint(info); err != nil {
+		db.Close()
+		return err
 	}
 
 	// Update global DB variable
 	SetDB(db)
+	queryComment = info.QueryComment
+	activeConnInfo, activeHost = &info, host
+	writeAddr = hostAddr(hostList(info)[host])
+	invalidateCompletionCache()
+	runInitSQL(db, info.InitSQL)
+	refreshSessionLocation()
 	return nil
 }
 
+// runInitSQL runs the init_sql statements of a connection. The session state they
+// set is remembered like that of statements typed in the REPL, so that it survives
+// reconnects. A failing statement is reported and the others still run.
+func runInitSQL(db *sql.DB, initSQL string) {
+	if strings.TrimSpace(initSQL) == "" {
+		return
+	}
+	stmts, err := splitStatements(initSQL)
+	if err != nil {
+		log.Printf("Failed to parse init_sql: %v", err)
+		return
+	}
+	for _, stmt := range stmts {
+		if _, err := db.Exec(stmt); err != nil {
+			log.Printf("init_sql: %s: %v", stmt, err)
+			continue
+		}
+		trackSession(stmt)
+	}
+}
+
 func printExecutionDetails(execTime time.Duration, hasRows bool, output []RowResult, affectedRows int64) {
 	grey := color.New(color.FgHiBlack).SprintFunc()
 
-	fmt.Fprintf(os.Stderr, "%s\n", grey(fmt.Sprintf("Execution time: %s", execTime)))
+	fmt.Fprintf(replErr, "%s\n", grey(fmt.Sprintf("Execution time: %s", execTime)))
 	if hasRows {
-		fmt.Fprintf(os.Stderr, "%s\n", grey(fmt.Sprintf("Rows in result: %d", len(output))))
+		fmt.Fprintf(replErr, "%s\n", grey(fmt.Sprintf("Rows in result: %d", len(output))))
 	}
 	if affectedRows > 0 {
-		fmt.Fprintf(os.Stderr, "%s\n", grey(fmt.Sprintf("Affected rows: %d", affectedRows)))
+		fmt.Fprintf(replErr, "%s\n", grey(fmt.Sprintf("Affected rows: %d", affectedRows)))
 	}
 }
 
 func main() {
-	// Command-line flags
-	host := flag.String("host", "", "TiDB Serverless hostname")
-	port := flag.String("port", "", "TiDB port")
-	user := flag.String("u", "", "TiDB username")
-	dbName := flag.String("d", "", "TiDB database")
-	configFile := flag.String("c", getDefaultConfigFilePath(), "Path to configuration file")
-	outputFormat := flag.String("o", "table", "Output format: plain, table(default) or json")
-	execSQL := flag.String("e", "", "Execute SQL statement and exit")
-	version := flag.Bool("version", false, "Display version information")
-	verbose := flag.Bool("v", false, "Display execution details")
-	outputFile := flag.String("O", "", "Output file for results")
-
-	// Add a flag to check if -p was explicitly set
-	var passSet bool
-	var pass string
-	flag.Func("p", "TiDB password", func(s string) error {
-		passSet = true
-		pass = s
-		return nil
-	})
-
-	flag.Parse()
-
-	showExecDetails = *verbose
-
-	// Load config from environment variables
-	envHost, envPort, envUser, envPass, defaultDatabase, _ := loadConfigFromEnv()
-
-	// Load config from file if provided
-	if *configFile != "" {
-		config, err := loadConfigFromFile(*configFile)
-		if err != nil {
-			log.Fatalf("Failed to read config file: %v", err)
-		}
-		if *host == "" && config["host"] != "" {
-			*host = config["host"]
-		}
-		if *port == "" && config["port"] != "" {
-			*port = config["port"]
-		}
-		if *user == "" && config["user"] != "" {
-			*user = config["user"]
+	args := os.Args[1:]
+	if len(args) > 0 {
+		if sub := findSubcommand(args[0]); sub != nil {
+			countUsage("tip " + sub.Name)
+			code := sub.Run(args[1:])
+			flushTelemetry()
+			os.Exit(code)
 		}
-		if !passSet && config["password"] != "" {
-			pass = config["password"]
-		}
-		if *dbName == "" && config["database"] != "" {
-			*dbName = config["database"]
-		}
-	}
-
-	// Use environment variables if command line and config file are not set
-	if *host == "" {
-		*host = envHost
-	}
-	if *port == "" {
-		*port = envPort
-	}
-	if *user == "" {
-		*user = envUser
-	}
-	if !passSet && pass == "" {
-		pass = envPass
-	}
-	if *dbName == "" {
-		*dbName = defaultDatabase
-	}
-
-	// Create ConnInfo struct
-	connInfo := ConnInfo{
-		Host:     *host,
-		Port:     *port,
-		User:     *user,
-		Password: pass,
-		Database: *dbName,
-	}
-
-	// Connect to the database
-	err := connectToDatabase(connInfo)
-	if err != nil {
-		log.Println("Failed to connect to TiDB:", err)
-		// Continue with db as nil
-	}
-	if GetDB() != nil {
-		defer GetDB().Close()
-		greeting(GetDB()) // Call greeting after successful connection
 	}
-
-	var resultIOWriter ResultIOWriter
-	if *outputFile != "" {
-		file, err := os.Create(*outputFile)
-		if err != nil {
-			log.Fatalf("Failed to create output file: %v", err)
-		}
-		defer file.Close()
-
-		bufferedWriter := bufio.NewWriter(file)
-		switch parseOutputFormat(*outputFormat) {
-		case CSV:
-			resultIOWriter = NewCSVResultIOWriter(bufferedWriter)
-		case Plain:
-			resultIOWriter = NewPlainResultIOWriter(bufferedWriter)
-		case JSON:
-			resultIOWriter = NewJSONResultIOWriter(bufferedWriter)
-		}
-	}
-
-	// Check if -e flag is provided
-	if *execSQL != "" {
-		startTime := time.Now() // Start timing the query execution
-		isQ, output, hasRows, affectedRows, err := executeSQL(GetDB(), *execSQL, resultIOWriter)
-		if err != nil {
-			log.Fatalf("Failed to execute SQL: %v", err)
-		}
-
-		if resultIOWriter != nil {
-			resultIOWriter.Flush()
-		} else {
-			execTime := time.Since(startTime)
-			printResults(isQ, output, parseOutputFormat(*outputFormat), hasRows, execTime, affectedRows)
-		}
-
-		return
-	}
-	if *version {
-		if info, ok := debug.ReadBuildInfo(); ok && Version == "dev" {
-			Version = info.Main.Version
-		}
-		fmt.Printf("tip version: %s\n", Version)
-		os.Exit(0)
-	}
-
-	// Initialize the global output format
-	initialOutputFormat := parseOutputFormat(*outputFormat)
-	globalOutputFormat = &initialOutputFormat
-
-	// Modify the repl function call to use the global output format
-	repl(GetDB(), globalOutputFormat)
+	// Bare tip keeps the flat flag layout for backward compatibility
+	code := runDefault(args)
+	flushTelemetry()
+	os.Exit(code)
 }
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// exportManifest describes how an output file was produced, so that the export
+// can be reproduced or audited later. It is written next to the file as .meta.json.
+type exportManifest struct {
+	OutputFile       string              `json:"output_file"`
+	Format           string              `json:"format"`
+	Host             string              `json:"host,omitempty"`
+	Database         string              `json:"database,omitempty"`
+	ServerVersion    string              `json:"server_version,omitempty"`
+	TipVersion       string              `json:"tip_version"`
+	SessionVariables []string            `json:"session_variables"`
+	StartedAt        time.Time           `json:"started_at"`
+	Duration         string              `json:"duration"`
+	Statements       []manifestStatement `json:"statements"`
+}
+
+// manifestStatement records one statement of the export
+type manifestStatement struct {
+	SQL      string `json:"sql"`
+	Rows     int64  `json:"rows"`
+	Duration string `json:"duration"`
+	// SnapshotTSO is the start TSO the statement read at, SET tidb_snapshot to it
+	// to read the same data again (within the GC life time)
+	SnapshotTSO uint64 `json:"snapshot_tso,omitempty"`
+}
+
+// manifestPath returns the path of the manifest of an output file, out.csv has out.meta.json
+func manifestPath(file string) string {
+	return strings.TrimSuffix(file, filepath.Ext(file)) + ".meta.json"
+}
+
+// newExportManifest starts the manifest of an export, recording the server and the session
+func newExportManifest(db *sql.DB, file string, format string) *exportManifest {
+	m := &exportManifest{
+		OutputFile:       file,
+		Format:           format,
+		Host:             writeAddr,
+		TipVersion:       Version,
+		SessionVariables: sessionVarAssignments(),
+		StartedAt:        time.Now(),
+	}
+	var database sql.NullString
+	db.QueryRow("SELECT DATABASE(), VERSION()").Scan(&database, &m.ServerVersion)
+	m.Database = database.String
+	return m
+}
+
+// addStatement records a statement that ran, reading the TSO it used from the
+// session it ran in. The TSO is left out on servers other than TiDB.
+func (m *exportManifest) addStatement(db *sql.DB, query string, rows int64, duration time.Duration) {
+	stmt := manifestStatement{SQL: query, Rows: rows, Duration: duration.String()}
+	var info string
+	if err := routeStatement(db, query).QueryRow("SELECT @@tidb_last_query_info").Scan(&info); err == nil {
+		var queryInfo struct {
+			StartTS uint64 `json:"start_ts"`
+		}
+		if json.Unmarshal([]byte(info), &queryInfo) == nil {
+			stmt.SnapshotTSO = queryInfo.StartTS
+		}
+	}
+	m.Statements = append(m.Statements, stmt)
+}
+
+// write saves the manifest next to the output file
+func (m *exportManifest) write() error {
+	m.Duration = time.Since(m.StartedAt).String()
+	if m.SessionVariables == nil {
+		m.SessionVariables = []string{}
+	}
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	path := manifestPath(m.OutputFile)
+	if err := os.WriteFile(path, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("failed to write manifest %s: %v", path, err)
+	}
+	return nil
+}
+
+// rowCounter counts the rows passed on to a ResultIOWriter, for the manifest and to
+// report how far the output got when writing it fails
+type rowCounter struct {
+	ResultIOWriter
+	rows  int64 // rows of the current statement
+	total int64 // rows the writer took without error, some may still be buffered
+}
+
+func (c *rowCounter) Write(rows []RowResult) error {
+	c.rows += int64(len(rows))
+	if err := c.ResultIOWriter.Write(rows); err != nil {
+		return err
+	}
+	c.total += int64(len(rows))
+	return nil
+}
+
+// sent returns the rows the writer took without error, 0 without a writer. Writers
+// buffer rows, so when the output fails the last of them may not have reached it.
+func (c *rowCounter) sent() int64 {
+	if c == nil {
+		return 0
+	}
+	return c.total
+}
+
+func (c *rowCounter) NextSheet() error {
+	if sw, ok := c.ResultIOWriter.(sheetWriter); ok {
+		return sw.NextSheet()
+	}
+	return nil
+}
+
+func (c *rowCounter) EndStatement(isQuery bool, execTime time.Duration, affectedRows int64) error {
+	if sw, ok := c.ResultIOWriter.(statsWriter); ok {
+		return sw.EndStatement(isQuery, execTime, affectedRows)
+	}
+	return nil
+}
+
+func (c *rowCounter) SetColumnTypes(colTypes []*sql.ColumnType) error {
+	if tw, ok := c.ResultIOWriter.(columnTypeWriter); ok {
+		return tw.SetColumnTypes(colTypes)
+	}
+	return nil
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"strings"
+	"time"
+)
+
+// materializedTables holds the query each table created by .materialize was filled
+// with, keyed like sessionTempTables. Those gone with a lost session are skipped.
+var materializedTables = map[string]string{}
+
+type MaterializeCmd struct{}
+
+func (cmd MaterializeCmd) Name() string {
+	return ".materialize"
+}
+
+func (cmd MaterializeCmd) Description() string {
+	return "Keep the result of a query in a temporary table of the session, or list the tables kept"
+}
+
+func (cmd MaterializeCmd) Usage() string {
+	return ".materialize [<name> <query>]"
+}
+
+func (cmd MaterializeCmd) Handle(args []string, resultWriter io.Writer) error {
+	if len(args) == 0 {
+		return listMaterializedTables(resultWriter)
+	}
+	if len(args) < 2 {
+		return fmt.Errorf("usage: %s", cmd.Usage())
+	}
+	name := args[0]
+	query := strings.TrimSuffix(strings.TrimSpace(strings.Join(args[1:], " ")), ";")
+	if ok, err := isQuery(query); err != nil || !ok {
+		return fmt.Errorf("not a query: %s", query)
+	}
+	db, err := requireDB()
+	if err != nil {
+		return err
+	}
+	key := materializedKey(name)
+	startTime := time.Now()
+
+	columns, err := resultColumnDefs(db, query)
+	if err != nil {
+		return err
+	}
+	// Materializing again under the same name refreshes the table
+	sessionVarsLock.Lock()
+	_, live := sessionTempTables[key]
+	sessionVarsLock.Unlock()
+	if _, ok := materializedTables[key]; ok && live {
+		if _, _, _, _, err := executeSQL(db, "DROP TEMPORARY TABLE "+quoteIdentifier(name), nil); err != nil {
+			return err
+		}
+	}
+	// TiDB has no CREATE TABLE ... SELECT, the table is created from the columns of the result
+	create := "CREATE TEMPORARY TABLE " + quoteIdentifier(name) + " (\n  " + strings.Join(columns, ",\n  ") + "\n)"
+	if _, _, _, _, err := executeSQL(db, create, nil); err != nil {
+		return err
+	}
+	_, _, _, n, err := executeSQL(db, "INSERT INTO "+quoteIdentifier(name)+" SELECT * FROM ("+query+") tip_materialize", nil)
+	if err != nil {
+		executeSQL(db, "DROP TEMPORARY TABLE "+quoteIdentifier(name), nil)
+		return err
+	}
+	materializedTables[key] = query
+	fmt.Fprintf(resultWriter, "Materialized %d rows into temporary table %s (%s)\n", n, name, time.Since(startTime).Round(time.Millisecond))
+	return nil
+}
+
+// materializedKey returns the key of a table, qualified or in the current database
+func materializedKey(table string) string {
+	var dbName string
+	if dot := strings.LastIndex(table, "."); dot >= 0 {
+		dbName, table = table[:dot], table[dot+1:]
+	}
+	return tempTableKey(strings.Trim(dbName, "`"), strings.Trim(table, "`"))
+}
+
+// resultColumnDefs returns the column definitions of a table holding the result of query,
+// from the types of its result set. Lengths aren't known, so strings are kept as TEXT.
+func resultColumnDefs(db *sql.DB, query string) ([]string, error) {
+	rows, err := db.Query("SELECT * FROM (" + query + ") tip_materialize LIMIT 0")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	types, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, err
+	}
+	seen := map[string]bool{}
+	defs := make([]string, len(types))
+	for i, ct := range types {
+		if seen[strings.ToLower(ct.Name())] {
+			return nil, fmt.Errorf("the query has two columns named %s, give them distinct aliases", ct.Name())
+		}
+		seen[strings.ToLower(ct.Name())] = true
+		defs[i] = quoteName(ct.Name()) + " " + columnTypeDef(ct)
+	}
+	return defs, nil
+}
+
+// columnTypeDef returns the SQL type of a column of a result set
+func columnTypeDef(ct *sql.ColumnType) string {
+	name := ct.DatabaseTypeName()
+	if base, ok := strings.CutPrefix(name, "UNSIGNED "); ok {
+		return base + " UNSIGNED"
+	}
+	switch name {
+	case "DECIMAL":
+		if precision, scale, ok := ct.DecimalSize(); ok && precision > 0 {
+			return fmt.Sprintf("DECIMAL(%d,%d)", precision, scale)
+		}
+	case "DATETIME", "TIMESTAMP", "TIME":
+		if fsp, _, ok := ct.DecimalSize(); ok && fsp > 0 && fsp <= 6 {
+			return fmt.Sprintf("%s(%d)", name, fsp)
+		}
+	case "CHAR", "VARCHAR", "ENUM", "SET", "NULL", "":
+		return "TEXT"
+	case "BINARY", "VARBINARY":
+		return "BLOB"
+	case "BIT":
+		return "BIT(64)"
+	}
+	return name
+}
+
+// listMaterializedTables prints the tables materialized in this session with their row counts
+func listMaterializedTables(w io.Writer) error {
+	tables := liveMaterializedTables()
+	if len(tables) == 0 {
+		fmt.Fprintln(w, "No materialized tables in this session.")
+		return nil
+	}
+	db, err := requireDB()
+	if err != nil {
+		return err
+	}
+	startTime := time.Now()
+	cols := []string{"Table", "Rows", "Query"}
+	output := make([]RowResult, len(tables))
+	for i, t := range tables {
+		var n int64
+		if err := db.QueryRow("SELECT COUNT(*) FROM " + t.name).Scan(&n); err != nil {
+			return err
+		}
+		output[i] = RowResult{colNames: cols, colValues: []interface{}{t.name, n, materializedTables[t.key]}}
+	}
+	printResults(true, output, *globalOutputFormat, true, time.Since(startTime), 0)
+	return nil
+}
+
+// materializedTable is a table created by .materialize, name is quoted and qualified
+type materializedTable struct {
+	key, name string
+}
+
+// liveMaterializedTables returns the materialized tables the session still has
+func liveMaterializedTables() []materializedTable {
+	sessionVarsLock.Lock()
+	defer sessionVarsLock.Unlock()
+	var tables []materializedTable
+	for key := range materializedTables {
+		table, ok := sessionTempTables[key]
+		if !ok {
+			delete(materializedTables, key)
+			continue
+		}
+		dbName := key[:len(key)-len(table)-1]
+		tables = append(tables, materializedTable{key, quoteName(dbName) + "." + quoteName(table)})
+	}
+	sort.Slice(tables, func(i, j int) bool { return tables[i].key < tables[j].key })
+	return tables
+}
+
+// dropMaterializedTables drops the tables materialized in this session. Closing the
+// connection drops them too, unless a proxy keeps the server session around.
+func dropMaterializedTables() {
+	db := GetDB()
+	if db == nil {
+		return
+	}
+	for _, t := range liveMaterializedTables() {
+		if _, err := db.Exec("DROP TEMPORARY TABLE " + t.name); err != nil {
+			log.Printf("Failed to drop materialized table %s: %v", t.name, err)
+		}
+		delete(materializedTables, t.key)
+	}
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// quoteIdentifier quotes a (possibly db-qualified) identifier with backticks
+func quoteIdentifier(name string) string {
+	parts := strings.Split(name, ".")
+	for i, part := range parts {
+		parts[i] = quoteName(strings.Trim(part, "`"))
+	}
+	return strings.Join(parts, ".")
+}
+
+// quoteName quotes a single identifier with backticks
+func quoteName(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
+
+type TablesCmd struct{}
+
+func (cmd TablesCmd) Name() string {
+	return ".tables"
+}
+
+func (cmd TablesCmd) Description() string {
+	return "List the tables, views, sequences and temporary tables of the current database, optionally filtered by a LIKE pattern"
+}
+
+func (cmd TablesCmd) Usage() string {
+	return ".tables [pattern]"
+}
+
+func (cmd TablesCmd) Handle(args []string, resultWriter io.Writer) error {
+	db, err := requireDB()
+	if err != nil {
+		return err
+	}
+	pattern := "%"
+	if len(args) > 0 {
+		pattern = args[0]
+	}
+	var curDB sql.NullString
+	if err := db.QueryRow("SELECT DATABASE()").Scan(&curDB); err != nil {
+		return err
+	}
+	query := "SELECT TABLE_NAME AS `Table`, " + tableTypeLabel + " AS `Type` FROM INFORMATION_SCHEMA.TABLES " +
+		"WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME LIKE ?"
+	queryArgs := []interface{}{pattern}
+	for _, name := range sessionTempTableNames(curDB.String) {
+		query += " UNION ALL SELECT ?, 'temporary table' FROM DUAL WHERE ? LIKE ?"
+		queryArgs = append(queryArgs, name, name, pattern)
+	}
+	return queryAndPrint(db, query+" ORDER BY `Table`", queryArgs...)
+}
+
+// tableTypeLabel turns the TABLE_TYPE of INFORMATION_SCHEMA.TABLES into the label shown in listings
+const tableTypeLabel = "CASE TABLE_TYPE WHEN 'BASE TABLE' THEN 'table' WHEN 'VIEW' THEN 'view' " +
+	"WHEN 'SEQUENCE' THEN 'sequence' ELSE LOWER(TABLE_TYPE) END"
+
+// tableKind returns the label of a table, view, sequence or temporary table, or an error if there is none by the name
+func tableKind(db *sql.DB, table string) (string, error) {
+	var curDB sql.NullString
+	if err := db.QueryRow("SELECT DATABASE()").Scan(&curDB); err != nil {
+		return "", err
+	}
+	if isSessionTempTable(curDB.String, table) {
+		return "temporary table", nil
+	}
+	var kind string
+	err := db.QueryRow("SELECT "+tableTypeLabel+" FROM INFORMATION_SCHEMA.TABLES "+
+		"WHERE TABLE_SCHEMA = IFNULL(?, DATABASE()) AND TABLE_NAME = ?", schemaOf(table), nameOf(table)).Scan(&kind)
+	if err == sql.ErrNoRows {
+		return "", fmt.Errorf("no table %s", table)
+	}
+	return kind, err
+}
+
+type DatabasesCmd struct{}
+
+func (cmd DatabasesCmd) Name() string {
+	return ".databases"
+}
+
+func (cmd DatabasesCmd) Description() string {
+	return "List all databases"
+}
+
+func (cmd DatabasesCmd) Usage() string {
+	return ".databases"
+}
+
+func (cmd DatabasesCmd) Handle(args []string, resultWriter io.Writer) error {
+	db, err := requireDB()
+	if err != nil {
+		return err
+	}
+	return queryAndPrint(db, "SHOW DATABASES")
+}
+
+type DescribeCmd struct{}
+
+func (cmd DescribeCmd) Name() string {
+	return ".describe"
+}
+
+func (cmd DescribeCmd) Description() string {
+	return "Show the columns of a table, temporary table or view, with the definition of a view or sequence and the expressions of generated columns and expression indexes"
+}
+
+func (cmd DescribeCmd) Usage() string {
+	return ".describe <table>"
+}
+
+func (cmd DescribeCmd) Handle(args []string, resultWriter io.Writer) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: %s", cmd.Usage())
+	}
+	db, err := requireDB()
+	if err != nil {
+		return err
+	}
+	kind, err := tableKind(db, args[0])
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(resultWriter, "%s (%s)\n", args[0], kind)
+	switch kind {
+	case "sequence":
+		return queryAndPrint(db, "SHOW CREATE SEQUENCE "+quoteIdentifier(args[0]))
+	case "view":
+		var definition string
+		if err := db.QueryRow("SELECT VIEW_DEFINITION FROM INFORMATION_SCHEMA.VIEWS "+
+			"WHERE TABLE_SCHEMA = IFNULL(?, DATABASE()) AND TABLE_NAME = ?", schemaOf(args[0]), nameOf(args[0])).Scan(&definition); err == nil {
+			fmt.Fprintf(resultWriter, "AS %s\n", definition)
+		}
+	}
+	if err := queryAndPrint(db, "SHOW COLUMNS FROM "+quoteIdentifier(args[0])); err != nil {
+		return err
+	}
+	if kind == "table" {
+		return describeExpressions(db, resultWriter, args[0])
+	}
+	return nil
+}
+
+// describeExpressions writes the expressions of the generated columns and expression
+// indexes of a table, which the column list doesn't show
+func describeExpressions(db *sql.DB, w io.Writer, table string) error {
+	rows, err := db.Query("SELECT COLUMN_NAME, EXTRA, GENERATION_EXPRESSION FROM INFORMATION_SCHEMA.COLUMNS "+
+		"WHERE TABLE_SCHEMA = IFNULL(?, DATABASE()) AND TABLE_NAME = ? AND GENERATION_EXPRESSION <> '' "+
+		"ORDER BY ORDINAL_POSITION", schemaOf(table), nameOf(table))
+	if err != nil {
+		return err
+	}
+	var generated [][3]string
+	for rows.Next() {
+		var col, extra, expr string
+		if err := rows.Scan(&col, &extra, &expr); err != nil {
+			rows.Close()
+			return err
+		}
+		storage := "virtual"
+		if strings.Contains(strings.ToUpper(extra), "STORED") {
+			storage = "stored"
+		}
+		generated = append(generated, [3]string{col, storage, expr})
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	// The columns of an expression index are listed one row per key part
+	rows, err = db.Query("SELECT INDEX_NAME, NON_UNIQUE, IFNULL(COLUMN_NAME, ''), IFNULL(EXPRESSION, '') "+
+		"FROM INFORMATION_SCHEMA.STATISTICS WHERE TABLE_SCHEMA = IFNULL(?, DATABASE()) AND TABLE_NAME = ? "+
+		"ORDER BY INDEX_NAME, SEQ_IN_INDEX", schemaOf(table), nameOf(table))
+	if err != nil {
+		return err
+	}
+	var indexes []string
+	parts := map[string][]string{}
+	hasExpr := map[string]bool{}
+	unique := map[string]bool{}
+	for rows.Next() {
+		var name, col, expr string
+		var nonUnique int
+		if err := rows.Scan(&name, &nonUnique, &col, &expr); err != nil {
+			rows.Close()
+			return err
+		}
+		if _, ok := parts[name]; !ok {
+			indexes = append(indexes, name)
+		}
+		if expr != "" {
+			parts[name] = append(parts[name], "("+expr+")")
+			hasExpr[name] = true
+		} else {
+			parts[name] = append(parts[name], quoteName(col))
+		}
+		unique[name] = nonUnique == 0
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if len(generated) > 0 {
+		fmt.Fprintln(w, "Generated columns:")
+		for _, g := range generated {
+			fmt.Fprintf(w, "  %s %s AS (%s)\n", g[0], g[1], g[2])
+		}
+	}
+	first := true
+	for _, name := range indexes {
+		if !hasExpr[name] {
+			continue
+		}
+		if first {
+			fmt.Fprintln(w, "Expression indexes:")
+			first = false
+		}
+		kind := "index"
+		if unique[name] {
+			kind = "unique index"
+		}
+		fmt.Fprintf(w, "  %s %s (%s)\n", kind, name, strings.Join(parts[name], ", "))
+	}
+	return nil
+}
+
+// schemaOf returns the database a qualified table name is in, nil when it is not qualified
+func schemaOf(table string) interface{} {
+	if dot := strings.LastIndex(table, "."); dot >= 0 {
+		return strings.Trim(table[:dot], "`")
+	}
+	return nil
+}
+
+// nameOf returns a table name without its database
+func nameOf(table string) string {
+	return strings.Trim(table[strings.LastIndex(table, ".")+1:], "`")
+}
+
+type SchemaCmd struct{}
+
+func (cmd SchemaCmd) Name() string {
+	return ".schema"
+}
+
+func (cmd SchemaCmd) Description() string {
+	return "Show the CREATE TABLE statement of a table"
+}
+
+func (cmd SchemaCmd) Usage() string {
+	return ".schema <table>"
+}
+
+func (cmd SchemaCmd) Handle(args []string, resultWriter io.Writer) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: %s", cmd.Usage())
+	}
+	db, err := requireDB()
+	if err != nil {
+		return err
+	}
+	return queryAndPrint(db, "SHOW CREATE TABLE "+quoteIdentifier(args[0]))
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/mattn/go-runewidth"
+	"golang.org/x/term"
+)
+
+// pagerEnabled controls paging of table results taller than the terminal in the REPL
+var pagerEnabled = true
+
+// tableHeaderLines is the number of lines of a rendered table kept at the top of every page:
+// the top border, the column names and the line under them
+const tableHeaderLines = 3
+
+// pageOutput writes text to stdout, a screen at a time when it is taller than the
+// terminal. The first frozen lines are repeated at the top of every page. Space shows
+// the next page, enter the next line, and q stops without showing the rest.
+func pageOutput(text string, frozen int) {
+	stdin, stdout := int(os.Stdin.Fd()), int(os.Stdout.Fd())
+	if !pagerEnabled || replLine == nil || !term.IsTerminal(stdin) || !term.IsTerminal(stdout) {
+		fmt.Fprint(replOut, text)
+		return
+	}
+	width, height, err := term.GetSize(stdout)
+	lines := strings.Split(strings.TrimSuffix(text, "\n"), "\n")
+	if err != nil || width <= 0 || len(lines) <= frozen || screenRows(lines, width) < height {
+		fmt.Fprint(replOut, text)
+		return
+	}
+	state, err := term.MakeRaw(stdin)
+	if err != nil {
+		fmt.Fprint(replOut, text)
+		return
+	}
+	defer term.Restore(stdin, state)
+	// The tee file gets the whole result, however much of it is paged through
+	teeOnly(text)
+
+	header, body := lines[:frozen], lines[frozen:]
+	// One row of the screen is left for the status line
+	pageRows := height - 1 - screenRows(header, width)
+	if pageRows < 1 {
+		pageRows = 1
+	}
+	out := newlineWriter{os.Stdout}
+	next := 0
+	showPage := func() {
+		for _, line := range header {
+			fmt.Fprintln(out, line)
+		}
+		used := 0
+		for next < len(body) {
+			rows := screenRows(body[next:next+1], width)
+			if used > 0 && used+rows > pageRows {
+				break
+			}
+			fmt.Fprintln(out, body[next])
+			used += rows
+			next++
+		}
+	}
+
+	showPage()
+	key := make([]byte, 1)
+	for next < len(body) {
+		fmt.Fprintf(out, "\033[7m-- %d of %d lines, space: next page, enter: next line, q: quit --\033[0m", next+frozen, len(lines))
+		if _, err := os.Stdin.Read(key); err != nil {
+			key[0] = 'q'
+		}
+		fmt.Fprint(out, "\r\033[K")
+		switch key[0] {
+		case ' ', 'f':
+			showPage()
+		case '\r', '\n', 'j':
+			fmt.Fprintln(out, body[next])
+			next++
+		case 'q', 'Q', 3, 4:
+			// Close the table so that the cut is visible
+			fmt.Fprintln(out, header[0])
+			fmt.Fprintf(out, "(%d more lines not shown)\n", len(body)-next)
+			return
+		}
+	}
+}
+
+// screenRows returns the number of terminal rows lines take when wrapped at width
+func screenRows(lines []string, width int) int {
+	rows := 0
+	for _, line := range lines {
+		rows += 1 + (runewidth.StringWidth(line)-1)/width
+	}
+	return rows
+}
+
+// newlineWriter turns \n into \r\n, as the terminal doesn't in raw mode
+type newlineWriter struct {
+	w io.Writer
+}
+
+func (nw newlineWriter) Write(p []byte) (int, error) {
+	if _, err := nw.w.Write([]byte(strings.ReplaceAll(string(p), "\n", "\r\n"))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -1,6 +1,9 @@
 package main
 
-import "io"
+import (
+	"fmt"
+	"io"
+)
 
 type PagerCmd struct{}
 
@@ -9,13 +12,29 @@ func (cmd PagerCmd) Name() string {
 }
 
 func (cmd PagerCmd) Description() string {
-	return "Toggle pager mode"
+	return "Toggle paging of table results taller than the terminal"
 }
 
 func (cmd PagerCmd) Usage() string {
-	return ".pager [vim|less|...|off]"
+	return ".pager [on|off]"
 }
 
 func (cmd PagerCmd) Handle(args []string, resultWriter io.Writer) error {
+	if len(args) == 0 {
+		state := "off"
+		if pagerEnabled {
+			state = "on"
+		}
+		resultWriter.Write([]byte(fmt.Sprintf("Paging is %s\n", state)))
+		return nil
+	}
+	switch args[0] {
+	case "on":
+		pagerEnabled = true
+	case "off":
+		pagerEnabled = false
+	default:
+		return fmt.Errorf("usage: %s", cmd.Usage())
+	}
 	return nil
 }
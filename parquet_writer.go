@@ -0,0 +1,500 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// parquetRowGroupRows is the number of rows buffered before they are written out as a row group
+const parquetRowGroupRows = 50000
+
+// parquetMaxDecimalPrecision is the largest DECIMAL precision Spark and most other
+// Parquet readers accept, wider DECIMAL columns are written as strings
+const parquetMaxDecimalPrecision = 38
+
+// Parquet physical types, converted types and other enums of parquet.thrift
+const (
+	parquetInt32     int32 = 1
+	parquetInt64     int32 = 2
+	parquetDouble    int32 = 5
+	parquetByteArray int32 = 6
+
+	parquetNoConversion    int32 = -1
+	parquetUTF8            int32 = 0
+	parquetDecimal         int32 = 5
+	parquetDate            int32 = 6
+	parquetTimestampMicros int32 = 10
+
+	parquetOptional      int32 = 1
+	parquetEncodingPlain int32 = 0
+	parquetEncodingRLE   int32 = 3
+	parquetDataPage      int32 = 0
+	parquetUncompressed  int32 = 0
+)
+
+// columnTypeWriter is implemented by result writers that need the column types of the result
+type columnTypeWriter interface {
+	SetColumnTypes(colTypes []*sql.ColumnType) error
+}
+
+// parquetColumn holds the definition of a column and its values in the current row group
+type parquetColumn struct {
+	name      string
+	physical  int32
+	converted int32
+	precision int32
+	scale     int32
+
+	values    bytes.Buffer // PLAIN encoded values, NULLs are left out
+	defLevels []byte       // 1 for a value, 0 for NULL
+}
+
+// parquetColumnFor maps a MySQL column type to the Parquet type it is written as
+func parquetColumnFor(ct *sql.ColumnType) *parquetColumn {
+	col := &parquetColumn{name: ct.Name(), physical: parquetByteArray, converted: parquetUTF8}
+	switch typeName := ct.DatabaseTypeName(); typeName {
+	case "UNSIGNED BIGINT":
+		// Doesn't fit into INT64
+		col.converted, col.precision = parquetDecimal, 20
+	case "TINYINT", "SMALLINT", "MEDIUMINT", "INT", "BIGINT", "YEAR",
+		"UNSIGNED TINYINT", "UNSIGNED SMALLINT", "UNSIGNED MEDIUMINT", "UNSIGNED INT":
+		col.physical, col.converted = parquetInt64, parquetNoConversion
+	case "FLOAT", "DOUBLE":
+		col.physical, col.converted = parquetDouble, parquetNoConversion
+	case "DECIMAL":
+		precision, scale, ok := ct.DecimalSize()
+		if !ok || precision > parquetMaxDecimalPrecision {
+			log.Printf("Column %s is a DECIMAL of more than %d digits, which Parquet readers reject, writing it as strings", col.name, parquetMaxDecimalPrecision)
+			break
+		}
+		col.converted, col.precision, col.scale = parquetDecimal, int32(precision), int32(scale)
+	case "DATE":
+		col.physical, col.converted = parquetInt32, parquetDate
+	case "DATETIME", "TIMESTAMP":
+		col.physical, col.converted = parquetInt64, parquetTimestampMicros
+	default:
+		if strings.Contains(typeName, "BLOB") || strings.Contains(typeName, "BINARY") || typeName == "BIT" {
+			col.converted = parquetNoConversion
+		}
+	}
+	return col
+}
+
+// add appends a value to the column. The zero dates of MySQL, which no Parquet date
+// can hold, are written as NULL.
+func (c *parquetColumn) add(val interface{}) error {
+	if val == nil || (c.physical != parquetByteArray && isZeroDate(val)) {
+		c.defLevels = append(c.defLevels, 0)
+		return nil
+	}
+	if err := c.encode(val); err != nil {
+		return fmt.Errorf("can't write %s of column %s as %s: %v", formatValue(val), c.name, c.typeName(), err)
+	}
+	c.defLevels = append(c.defLevels, 1)
+	return nil
+}
+
+// typeName names the Parquet type of the column for error messages
+func (c *parquetColumn) typeName() string {
+	switch {
+	case c.converted == parquetTimestampMicros:
+		return "a timestamp"
+	case c.converted == parquetDate:
+		return "a date"
+	case c.converted == parquetDecimal:
+		return fmt.Sprintf("DECIMAL(%d,%d)", c.precision, c.scale)
+	case c.physical == parquetInt64:
+		return "an integer"
+	case c.physical == parquetDouble:
+		return "a double"
+	default:
+		return "a string"
+	}
+}
+
+// isZeroDate reports whether val is a zero DATE or DATETIME, such as 0000-00-00
+func isZeroDate(val interface{}) bool {
+	b, ok := val.([]byte)
+	return ok && len(b) >= len("0000-00-00") && string(b[:len("0000-00-00")]) == "0000-00-00"
+}
+
+func (c *parquetColumn) encode(val interface{}) error {
+	s := formatValue(val)
+	if b, ok := val.([]byte); ok {
+		s = string(b)
+	}
+	var buf [8]byte
+	switch {
+	case c.physical == parquetInt64 && c.converted == parquetTimestampMicros:
+		t, err := parseParquetTime(val, s)
+		if err != nil {
+			return err
+		}
+		binary.LittleEndian.PutUint64(buf[:], uint64(t.UnixMicro()))
+		c.values.Write(buf[:8])
+	case c.physical == parquetInt64:
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return err
+		}
+		binary.LittleEndian.PutUint64(buf[:], uint64(n))
+		c.values.Write(buf[:8])
+	case c.physical == parquetInt32:
+		t, err := parseParquetTime(val, s)
+		if err != nil {
+			return err
+		}
+		days := int32(math.Floor(float64(t.Unix()) / 86400))
+		binary.LittleEndian.PutUint32(buf[:], uint32(days))
+		c.values.Write(buf[:4])
+	case c.physical == parquetDouble:
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return err
+		}
+		binary.LittleEndian.PutUint64(buf[:], math.Float64bits(f))
+		c.values.Write(buf[:8])
+	case c.converted == parquetDecimal:
+		b, err := decimalBytes(s, int(c.scale))
+		if err != nil {
+			return err
+		}
+		c.writeByteArray(b)
+	default:
+		c.writeByteArray([]byte(s))
+	}
+	return nil
+}
+
+func (c *parquetColumn) writeByteArray(b []byte) {
+	var length [4]byte
+	binary.LittleEndian.PutUint32(length[:], uint32(len(b)))
+	c.values.Write(length[:])
+	c.values.Write(b)
+}
+
+// parseParquetTime reads DATE, DATETIME and TIMESTAMP values, which are kept as they are, without a time zone
+func parseParquetTime(val interface{}, s string) (time.Time, error) {
+	if t, ok := val.(time.Time); ok {
+		return t, nil
+	}
+	if len(s) == len("2006-01-02") {
+		return time.Parse("2006-01-02", s)
+	}
+	return time.Parse("2006-01-02 15:04:05.999999", s)
+}
+
+// decimalBytes encodes a decimal as the big-endian two's complement of its unscaled value
+func decimalBytes(s string, scale int) ([]byte, error) {
+	intPart, frac, _ := strings.Cut(s, ".")
+	if len(frac) > scale {
+		frac = frac[:scale]
+	}
+	unscaled, ok := new(big.Int).SetString(intPart+frac+strings.Repeat("0", scale-len(frac)), 10)
+	if !ok {
+		return nil, fmt.Errorf("invalid decimal: %s", s)
+	}
+	if unscaled.Sign() >= 0 {
+		b := unscaled.Bytes()
+		if len(b) == 0 || b[0]&0x80 != 0 {
+			b = append([]byte{0}, b...)
+		}
+		return b, nil
+	}
+	n := len(unscaled.Bytes()) + 1
+	twos := new(big.Int).Lsh(big.NewInt(1), uint(8*n))
+	twos.Add(twos, unscaled)
+	return twos.FillBytes(make([]byte, n)), nil
+}
+
+// page returns the data page of the column: its definition levels, RLE/bit-packed
+// hybrid encoded with a bit width of 1, followed by the values
+func (c *parquetColumn) page() []byte {
+	var levels bytes.Buffer
+	groups := (len(c.defLevels) + 7) / 8
+	levels.Write(binary.AppendUvarint(nil, uint64(groups)<<1|1))
+	packed := make([]byte, groups)
+	for i, level := range c.defLevels {
+		packed[i/8] |= level << (i % 8)
+	}
+	levels.Write(packed)
+
+	var page bytes.Buffer
+	var length [4]byte
+	binary.LittleEndian.PutUint32(length[:], uint32(levels.Len()))
+	page.Write(length[:])
+	page.Write(levels.Bytes())
+	page.Write(c.values.Bytes())
+	return page.Bytes()
+}
+
+// ParquetResultIOWriter writes results to a Parquet file. Rows are written out in
+// row groups as they arrive, only the rows of the current group are held in memory.
+type ParquetResultIOWriter struct {
+	writer    io.Writer
+	offset    int64
+	columns   []*parquetColumn
+	rows      int   // rows in the current row group
+	totalRows int64 // rows written in previous row groups
+	rowGroups [][]parquetChunk
+	marks     []int // sizes of the values of the columns before the row being added
+	err       error
+}
+
+// parquetChunk is where a column chunk of a row group was written
+type parquetChunk struct {
+	offset    int64
+	size      int64
+	numValues int64
+}
+
+func NewParquetResultIOWriter(writer io.Writer) *ParquetResultIOWriter {
+	w := &ParquetResultIOWriter{writer: writer}
+	w.write([]byte("PAR1"))
+	return w
+}
+
+func (w *ParquetResultIOWriter) write(b []byte) {
+	if w.err != nil {
+		return
+	}
+	n, err := w.writer.Write(b)
+	w.offset += int64(n)
+	w.err = err
+}
+
+func (w *ParquetResultIOWriter) SetColumnTypes(colTypes []*sql.ColumnType) error {
+	if w.columns != nil {
+		return fmt.Errorf("parquet output holds a single result set, run one query")
+	}
+	w.columns = make([]*parquetColumn, len(colTypes))
+	for i, ct := range colTypes {
+		w.columns[i] = parquetColumnFor(ct)
+	}
+	w.marks = make([]int, len(w.columns))
+	return nil
+}
+
+func (w *ParquetResultIOWriter) Write(rows []RowResult) error {
+	for _, row := range rows {
+		if w.columns == nil {
+			// Without column types every column is written as text
+			for _, name := range row.colNames {
+				w.columns = append(w.columns, &parquetColumn{name: name, physical: parquetByteArray, converted: parquetUTF8})
+			}
+			w.marks = make([]int, len(w.columns))
+		}
+		for i, val := range row.colValues {
+			w.marks[i] = w.columns[i].values.Len()
+			if err := w.columns[i].add(val); err != nil {
+				// Leave the whole row out, the file written so far stays readable
+				for j, col := range w.columns[:i] {
+					col.values.Truncate(w.marks[j])
+					col.defLevels = col.defLevels[:len(col.defLevels)-1]
+				}
+				return fmt.Errorf("row %d: %v", w.totalRows+int64(w.rows)+1, err)
+			}
+		}
+		w.rows++
+		if w.rows >= parquetRowGroupRows {
+			w.writeRowGroup()
+		}
+	}
+	return w.err
+}
+
+func (w *ParquetResultIOWriter) writeRowGroup() {
+	chunks := make([]parquetChunk, len(w.columns))
+	for i, col := range w.columns {
+		page := col.page()
+		t := &thriftCompact{}
+		t.begin()
+		t.i32(1, parquetDataPage)
+		t.i32(2, int32(len(page)))
+		t.i32(3, int32(len(page)))
+		t.structField(5)
+		t.i32(1, int32(len(col.defLevels)))
+		t.i32(2, parquetEncodingPlain)
+		t.i32(3, parquetEncodingRLE)
+		t.i32(4, parquetEncodingRLE)
+		t.end()
+		t.end()
+
+		chunks[i].offset = w.offset
+		w.write(t.buf.Bytes())
+		w.write(page)
+		chunks[i].size = w.offset - chunks[i].offset
+		chunks[i].numValues = int64(len(col.defLevels))
+
+		col.values.Reset()
+		col.defLevels = col.defLevels[:0]
+	}
+	w.rowGroups = append(w.rowGroups, chunks)
+	w.totalRows += int64(w.rows)
+	w.rows = 0
+}
+
+// Flush writes the last row group and the file footer
+func (w *ParquetResultIOWriter) Flush() error {
+	if w.rows > 0 {
+		w.writeRowGroup()
+	}
+
+	t := &thriftCompact{}
+	t.begin()
+	t.i32(1, 1)
+	t.list(2, thriftStruct, len(w.columns)+1)
+	t.begin()
+	t.binary(4, []byte("schema"))
+	t.i32(5, int32(len(w.columns)))
+	t.end()
+	for _, col := range w.columns {
+		t.begin()
+		t.i32(1, col.physical)
+		t.i32(3, parquetOptional)
+		t.binary(4, []byte(col.name))
+		if col.converted != parquetNoConversion {
+			t.i32(6, col.converted)
+		}
+		if col.converted == parquetDecimal {
+			t.i32(7, col.scale)
+			t.i32(8, col.precision)
+		}
+		t.end()
+	}
+	t.i64(3, w.totalRows)
+	t.list(4, thriftStruct, len(w.rowGroups))
+	for _, chunks := range w.rowGroups {
+		t.begin()
+		t.list(1, thriftStruct, len(chunks))
+		var groupSize, numRows int64
+		for i, chunk := range chunks {
+			col := w.columns[i]
+			groupSize += chunk.size
+			numRows = chunk.numValues
+			t.begin()
+			t.i64(2, chunk.offset)
+			t.structField(3)
+			t.i32(1, col.physical)
+			t.list(2, thriftI32, 2)
+			t.listI32(parquetEncodingPlain)
+			t.listI32(parquetEncodingRLE)
+			t.list(3, thriftBinary, 1)
+			t.listBinary([]byte(col.name))
+			t.i32(4, parquetUncompressed)
+			t.i64(5, chunk.numValues)
+			t.i64(6, chunk.size)
+			t.i64(7, chunk.size)
+			t.i64(9, chunk.offset)
+			t.end()
+			t.end()
+		}
+		t.i64(2, groupSize)
+		t.i64(3, numRows)
+		t.end()
+	}
+	t.binary(6, []byte("tip "+Version))
+	t.end()
+
+	w.write(t.buf.Bytes())
+	var length [4]byte
+	binary.LittleEndian.PutUint32(length[:], uint32(t.buf.Len()))
+	w.write(length[:])
+	w.write([]byte("PAR1"))
+	if w.err != nil {
+		return w.err
+	}
+	if f, ok := w.writer.(interface{ Flush() error }); ok {
+		return f.Flush()
+	}
+	return nil
+}
+
+// Element types of the Thrift compact protocol
+const (
+	thriftI32    byte = 5
+	thriftI64    byte = 6
+	thriftBinary byte = 8
+	thriftList   byte = 9
+	thriftStruct byte = 12
+)
+
+// thriftCompact encodes the Parquet metadata with the Thrift compact protocol.
+// Fields of a struct have to be written in increasing order of their ids.
+type thriftCompact struct {
+	buf  bytes.Buffer
+	last []int16 // id of the last field written in each open struct
+}
+
+func (t *thriftCompact) begin() {
+	t.last = append(t.last, 0)
+}
+
+func (t *thriftCompact) end() {
+	t.buf.WriteByte(0)
+	t.last = t.last[:len(t.last)-1]
+}
+
+func (t *thriftCompact) field(id int16, typ byte) {
+	last := &t.last[len(t.last)-1]
+	if delta := id - *last; delta > 0 && delta <= 15 {
+		t.buf.WriteByte(byte(delta)<<4 | typ)
+	} else {
+		t.buf.WriteByte(typ)
+		t.varint(int64(id))
+	}
+	*last = id
+}
+
+func (t *thriftCompact) varint(v int64) {
+	t.buf.Write(binary.AppendUvarint(nil, uint64(v<<1^v>>63)))
+}
+
+func (t *thriftCompact) i32(id int16, v int32) {
+	t.field(id, thriftI32)
+	t.varint(int64(v))
+}
+
+func (t *thriftCompact) i64(id int16, v int64) {
+	t.field(id, thriftI64)
+	t.varint(v)
+}
+
+func (t *thriftCompact) binary(id int16, b []byte) {
+	t.field(id, thriftBinary)
+	t.listBinary(b)
+}
+
+func (t *thriftCompact) structField(id int16) {
+	t.field(id, thriftStruct)
+	t.begin()
+}
+
+// list writes the header of a list field, its elements follow with listI32, listBinary or begin/end
+func (t *thriftCompact) list(id int16, elemType byte, size int) {
+	t.field(id, thriftList)
+	if size < 15 {
+		t.buf.WriteByte(byte(size)<<4 | elemType)
+	} else {
+		t.buf.WriteByte(0xf0 | elemType)
+		t.buf.Write(binary.AppendUvarint(nil, uint64(size)))
+	}
+}
+
+func (t *thriftCompact) listI32(v int32) {
+	t.varint(int64(v))
+}
+
+func (t *thriftCompact) listBinary(b []byte) {
+	t.buf.Write(binary.AppendUvarint(nil, uint64(len(b))))
+	t.buf.Write(b)
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+type PartitionsCmd struct{}
+
+func (cmd PartitionsCmd) Name() string {
+	return ".partitions"
+}
+
+func (cmd PartitionsCmd) Description() string {
+	return "List the partitions of a table with their row counts, and with --query which ones a predicate scans"
+}
+
+func (cmd PartitionsCmd) Usage() string {
+	return ".partitions <table> [--query <where clause>]"
+}
+
+func (cmd PartitionsCmd) Handle(args []string, resultWriter io.Writer) error {
+	if len(args) < 1 || strings.HasPrefix(args[0], "-") {
+		return fmt.Errorf("usage: %s", cmd.Usage())
+	}
+	table := args[0]
+	// The predicate may contain spaces, so --query takes the rest of the line
+	var predicate string
+	if len(args) > 1 {
+		if args[1] != "--query" && args[1] != "-query" {
+			return fmt.Errorf("usage: %s", cmd.Usage())
+		}
+		predicate = strings.TrimSpace(strings.Join(args[2:], " "))
+		if len(predicate) >= 2 && (predicate[0] == '"' || predicate[0] == '\'') && predicate[len(predicate)-1] == predicate[0] {
+			predicate = predicate[1 : len(predicate)-1]
+		}
+		predicate = strings.TrimSuffix(strings.TrimSpace(predicate), ";")
+		if len(predicate) > 6 && strings.EqualFold(predicate[:6], "where ") {
+			predicate = predicate[6:]
+		}
+		if predicate == "" {
+			return fmt.Errorf("usage: %s", cmd.Usage())
+		}
+	}
+	db, err := requireDB()
+	if err != nil {
+		return err
+	}
+	startTime := time.Now()
+
+	rows, err := db.Query("SELECT PARTITION_NAME, PARTITION_METHOD, IFNULL(PARTITION_EXPRESSION, ''), "+
+		"IFNULL(PARTITION_DESCRIPTION, ''), TABLE_ROWS FROM INFORMATION_SCHEMA.PARTITIONS "+
+		"WHERE TABLE_SCHEMA = IFNULL(?, DATABASE()) AND TABLE_NAME = ? ORDER BY PARTITION_ORDINAL_POSITION",
+		schemaOf(table), nameOf(table))
+	if err != nil {
+		return fmt.Errorf("failed to read partitions: %v", err)
+	}
+	defer rows.Close()
+
+	cols := []string{"Partition", "Method", "Expression", "Values", "Rows"}
+	if predicate != "" {
+		cols = append(cols, "Scanned")
+	}
+	var output []RowResult
+	var names []string
+	for rows.Next() {
+		var name, method, expr, values *string
+		var tableRows sql.NullInt64
+		if err := rows.Scan(&name, &method, &expr, &values, &tableRows); err != nil {
+			return fmt.Errorf("failed to read partitions: %v", err)
+		}
+		if name == nil {
+			return fmt.Errorf("%s is not partitioned", table)
+		}
+		names = append(names, *name)
+		output = append(output, RowResult{colNames: cols, colValues: []interface{}{*name, *method, *expr, *values, tableRows.Int64}})
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read partitions: %v", err)
+	}
+	if len(output) == 0 {
+		return fmt.Errorf("no table %s", table)
+	}
+
+	var summary string
+	if predicate != "" {
+		plan, err := explainPlan(db, "SELECT * FROM "+quoteIdentifier(table)+" WHERE "+predicate, false)
+		if err != nil {
+			return err
+		}
+		scanned, all, known := scannedPartitions(plan)
+		var n int
+		for i := range output {
+			mark := "?"
+			if known {
+				mark = "pruned"
+				if all || scanned[strings.ToLower(names[i])] {
+					mark = "scanned"
+					n++
+				}
+			}
+			output[i].colValues = append(output[i].colValues, mark)
+		}
+		summary = fmt.Sprintf("%d of %d partitions scanned", n, len(names))
+		if !known {
+			summary = "The plan doesn't say which partitions are scanned"
+		}
+	}
+	printResults(true, output, *globalOutputFormat, true, time.Since(startTime), 0)
+	if summary != "" {
+		fmt.Fprintln(resultWriter, summary)
+	}
+	return nil
+}
+
+// scannedPartitions collects the partitions the operators of a plan access, from access
+// objects like "table:t, partition:p0,p1". all is set when every partition is scanned, and
+// known is false when no operator names partitions.
+func scannedPartitions(plan []planRow) (scanned map[string]bool, all, known bool) {
+	scanned = map[string]bool{}
+	for _, row := range plan {
+		for _, part := range strings.Split(row.access, ", ") {
+			list, ok := strings.CutPrefix(strings.TrimSpace(part), "partition:")
+			if !ok {
+				continue
+			}
+			known = true
+			for _, name := range strings.Split(list, ",") {
+				switch name {
+				case "all":
+					all = true
+				case "dual":
+					// Nothing to scan
+				default:
+					scanned[strings.ToLower(name)] = true
+				}
+			}
+		}
+	}
+	return scanned, all, known
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/olekukonko/tablewriter"
+)
+
+// Statements running at least this many seconds are highlighted by .processlist
+const (
+	processSlowSecs = 10
+	processLongSecs = 60
+)
+
+// processInfoWidth is the length statements are cut to unless .processlist full is used
+const processInfoWidth = 80
+
+type ProcesslistCmd struct{}
+
+func (cmd ProcesslistCmd) Name() string {
+	return ".processlist"
+}
+
+func (cmd ProcesslistCmd) Description() string {
+	return "Show the connections of all TiDB instances, longest running statements first"
+}
+
+func (cmd ProcesslistCmd) Usage() string {
+	return ".processlist [full]"
+}
+
+func (cmd ProcesslistCmd) Handle(args []string, resultWriter io.Writer) error {
+	full := false
+	if len(args) > 0 {
+		if args[0] != "full" || len(args) > 1 {
+			return fmt.Errorf("usage: %s", cmd.Usage())
+		}
+		full = true
+	}
+	db, err := requireDB()
+	if err != nil {
+		return err
+	}
+
+	rows, err := db.Query("SELECT INSTANCE, ID, USER, IFNULL(HOST, ''), IFNULL(DB, ''), COMMAND, TIME, " +
+		"IFNULL(STATE, ''), IFNULL(INFO, '') FROM INFORMATION_SCHEMA.CLUSTER_PROCESSLIST " +
+		"ORDER BY COMMAND = 'Sleep', TIME DESC, ID")
+	if err != nil {
+		return fmt.Errorf("failed to query the process list: %v", err)
+	}
+	defer rows.Close()
+
+	yellow := color.New(color.FgYellow).SprintFunc()
+	red := color.New(color.FgRed, color.Bold).SprintFunc()
+	table := tablewriter.NewWriter(resultWriter)
+	table.SetHeader([]string{"Instance", "Id", "User", "Host", "Db", "Command", "Time", "State", "Info"})
+	var n int
+	for rows.Next() {
+		var instance, user, host, dbName, command, state, info string
+		var id uint64
+		var secs int64
+		if err := rows.Scan(&instance, &id, &user, &host, &dbName, &command, &secs, &state, &info); err != nil {
+			return fmt.Errorf("failed to read the process list: %v", err)
+		}
+		info = strings.Join(strings.Fields(info), " ")
+		if !full && len(info) > processInfoWidth {
+			info = info[:processInfoWidth-3] + "..."
+		}
+		row := []string{instance, strconv.FormatUint(id, 10), user, host, dbName, command, strconv.FormatInt(secs, 10), state, info}
+		if command != "Sleep" && secs >= processSlowSecs {
+			highlight := yellow
+			if secs >= processLongSecs {
+				highlight = red
+			}
+			for i := range row {
+				row[i] = highlight(row[i])
+			}
+		}
+		table.Append(row)
+		n++
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read the process list: %v", err)
+	}
+
+	table.SetAutoWrapText(false)
+	table.SetAutoFormatHeaders(false)
+	table.SetHeaderAlignment(tablewriter.ALIGN_LEFT)
+	table.SetAlignment(tablewriter.ALIGN_LEFT)
+	table.Render()
+	fmt.Fprintf(resultWriter, "%d connections\n", n)
+	return nil
+}
+
+type KillCmd struct{}
+
+func (cmd KillCmd) Name() string {
+	return ".kill"
+}
+
+func (cmd KillCmd) Description() string {
+	return "Kill a connection, or with query only the statement it is running"
+}
+
+func (cmd KillCmd) Usage() string {
+	return ".kill [query] <id>"
+}
+
+func (cmd KillCmd) Handle(args []string, resultWriter io.Writer) error {
+	queryOnly := len(args) == 2 && strings.EqualFold(args[0], "query")
+	if len(args) != 1 && !queryOnly {
+		return fmt.Errorf("usage: %s", cmd.Usage())
+	}
+	id, err := strconv.ParseUint(args[len(args)-1], 10, 64)
+	if err != nil {
+		return fmt.Errorf("usage: %s", cmd.Usage())
+	}
+	db, err := requireDB()
+	if err != nil {
+		return err
+	}
+
+	var own uint64
+	if err := db.QueryRow("SELECT CONNECTION_ID()").Scan(&own); err == nil && own == id {
+		return fmt.Errorf("%d is the connection of this session", id)
+	}
+	// With global kill (TiDB 6.1 and later) KILL reaches connections of any instance
+	stmt := "KILL "
+	if queryOnly {
+		stmt += "QUERY "
+	}
+	if _, err := db.Exec(stmt + strconv.FormatUint(id, 10)); err != nil {
+		return err
+	}
+	if queryOnly {
+		resultWriter.Write([]byte(fmt.Sprintf("Killed the statement running on connection %d.\n", id)))
+	} else {
+		resultWriter.Write([]byte(fmt.Sprintf("Killed connection %d.\n", id)))
+	}
+	return nil
+}
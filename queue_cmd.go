@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync/atomic"
+)
+
+var (
+	// queueEnabled makes the REPL queue statements while the connection is down instead of rejecting them
+	queueEnabled bool
+	// queuedStatements are the statements waiting for the connection to come back
+	queuedStatements []string
+)
+
+// queueStatement keeps a statement that never reached the server, or only reads, for
+// when the connection is back. The connection counts as down until a ping answers.
+func queueStatement(query string) {
+	queuedStatements = append(queuedStatements, query)
+	connHealth.Store(healthDown)
+	log.Printf("Not connected, statement queued (%d pending). It will be offered for replay once the connection is back.", len(queuedStatements))
+}
+
+// queuePing is set while offerQueuedReplay waits for a ping of the connection
+var queuePing atomic.Bool
+
+// offerQueuedReplay asks whether to run the queued statements once the connection answers again.
+// Declined statements are dropped, a failing one stops the replay and is dropped with it.
+// Until a ping has answered, it starts one in the background and returns, so that the
+// prompt doesn't wait for it; the replay is offered at a later prompt.
+func offerQueuedReplay(line *lineEditor) {
+	if GetDB() == nil {
+		return
+	}
+	if health := connHealth.Load(); health != healthOK && health != healthSlow {
+		if queuePing.CompareAndSwap(false, true) {
+			go func() {
+				defer queuePing.Store(false)
+				checkHealth()
+			}()
+		}
+		return
+	}
+
+	fmt.Printf("Connection restored, %d statements were queued:\n", len(queuedStatements))
+	for i, stmt := range queuedStatements {
+		fmt.Printf("%5d  %s\n", i+1, stmt)
+	}
+	answer, err := line.Prompt("Replay them? [y/N] ")
+	if err != nil || !strings.EqualFold(strings.TrimSpace(answer), "y") {
+		fmt.Printf("Discarded %d queued statements.\n", len(queuedStatements))
+		queuedStatements = nil
+		return
+	}
+
+	for len(queuedStatements) > 0 {
+		stmt := queuedStatements[0]
+		queuedStatements = queuedStatements[1:]
+		fmt.Println(stmt)
+		if err := runHistoryEntry(stmt, os.Stdout); err != nil {
+			log.Printf("Replay stopped: %v", err)
+			if len(queuedStatements) > 0 {
+				log.Printf("%d statements are still queued, see .queue", len(queuedStatements))
+			}
+			return
+		}
+	}
+}
+
+type QueueCmd struct{}
+
+func (cmd QueueCmd) Name() string {
+	return ".queue"
+}
+
+func (cmd QueueCmd) Description() string {
+	return "Queue statements entered while disconnected and offer to replay them once reconnected"
+}
+
+func (cmd QueueCmd) Usage() string {
+	return ".queue [on|off|clear]"
+}
+
+func (cmd QueueCmd) Handle(args []string, resultWriter io.Writer) error {
+	if len(args) > 1 {
+		return fmt.Errorf("usage: %s", cmd.Usage())
+	}
+	if len(args) == 1 {
+		switch args[0] {
+		case "on":
+			queueEnabled = true
+		case "off":
+			queueEnabled = false
+		case "clear":
+			queuedStatements = nil
+		default:
+			return fmt.Errorf("usage: %s", cmd.Usage())
+		}
+	}
+
+	state := "off"
+	if queueEnabled {
+		state = "on"
+	}
+	fmt.Fprintf(resultWriter, "Queueing is %s, %d statements queued.\n", state, len(queuedStatements))
+	for i, stmt := range queuedStatements {
+		fmt.Fprintf(resultWriter, "%5d  %s\n", i+1, stmt)
+	}
+	return nil
+}
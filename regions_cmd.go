@@ -0,0 +1,301 @@
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type RegionsCmd struct{}
+
+func (cmd RegionsCmd) Name() string {
+	return ".regions"
+}
+
+func (cmd RegionsCmd) Description() string {
+	return "List the regions of a table with their leaders, sizes and traffic, and how the leaders spread over the stores"
+}
+
+func (cmd RegionsCmd) Usage() string {
+	return ".regions <table> [--summary]"
+}
+
+func (cmd RegionsCmd) Handle(args []string, resultWriter io.Writer) error {
+	if len(args) < 1 || strings.HasPrefix(args[0], "-") {
+		return fmt.Errorf("usage: %s", cmd.Usage())
+	}
+	table := args[0]
+	fs := flag.NewFlagSet(cmd.Name(), flag.ContinueOnError)
+	fs.SetOutput(resultWriter)
+	summaryOnly := fs.Bool("summary", false, "Only show the summary, not every region")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("usage: %s", cmd.Usage())
+	}
+	db, err := requireDB()
+	if err != nil {
+		return err
+	}
+	startTime := time.Now()
+
+	regions, err := loadTableRegions(db, table)
+	if err != nil {
+		return err
+	}
+	if len(regions) == 0 {
+		return fmt.Errorf("no regions found for %s", table)
+	}
+	if !*summaryOnly {
+		cols := []string{"Region", "Start key", "End key", "Leader store", "Peers", "Size (MB)", "Keys", "Written", "Read"}
+		output := make([]RowResult, len(regions))
+		for i, r := range regions {
+			output[i] = RowResult{colNames: cols, colValues: []interface{}{
+				r.id, r.startKey, r.endKey, r.leaderStore, r.peers, r.sizeMB, r.keys,
+				formatBytes(r.written), formatBytes(r.read),
+			}}
+		}
+		printResults(true, output, *globalOutputFormat, true, time.Since(startTime), 0)
+	}
+
+	stores, err := countTiKVStores(db)
+	if err != nil {
+		return err
+	}
+	printRegionSummary(resultWriter, regions, stores)
+	return nil
+}
+
+// tableRegion is a region of a table as listed by SHOW TABLE REGIONS
+type tableRegion struct {
+	id          int64
+	startKey    string
+	endKey      string
+	leaderStore int64
+	peers       string
+	scattering  bool
+	written     int64
+	read        int64
+	sizeMB      int64
+	keys        int64
+}
+
+// loadTableRegions lists the regions of the rows and indexes of a table. Columns are
+// looked up by name, as releases add columns to SHOW TABLE REGIONS.
+func loadTableRegions(db *sql.DB, table string) ([]tableRegion, error) {
+	rows, err := db.Query("SHOW TABLE " + quoteIdentifier(table) + " REGIONS")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list regions: %v", err)
+	}
+	defer rows.Close()
+	cols, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	index := map[string]int{}
+	for i, col := range cols {
+		index[strings.ToUpper(col)] = i
+	}
+	values := make([]sql.NullString, len(cols))
+	dest := make([]interface{}, len(cols))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	str := func(col string) string {
+		if i, ok := index[col]; ok {
+			return values[i].String
+		}
+		return ""
+	}
+	num := func(col string) int64 {
+		n, _ := strconv.ParseInt(str(col), 10, 64)
+		return n
+	}
+
+	var regions []tableRegion
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return nil, fmt.Errorf("failed to read regions: %v", err)
+		}
+		regions = append(regions, tableRegion{
+			id:          num("REGION_ID"),
+			startKey:    str("START_KEY"),
+			endKey:      str("END_KEY"),
+			leaderStore: num("LEADER_STORE_ID"),
+			peers:       str("PEERS"),
+			scattering:  num("SCATTERING") != 0,
+			written:     num("WRITTEN_BYTES"),
+			read:        num("READ_BYTES"),
+			sizeMB:      num("APPROXIMATE_SIZE(MB)"),
+			keys:        num("APPROXIMATE_KEYS"),
+		})
+	}
+	return regions, rows.Err()
+}
+
+// countTiKVStores returns the number of TiKV stores that are up, TiFlash stores don't lead regions
+func countTiKVStores(db *sql.DB) (int, error) {
+	var n int
+	err := db.QueryRow("SELECT COUNT(*) FROM INFORMATION_SCHEMA.TIKV_STORE_STATUS " +
+		"WHERE STORE_STATE_NAME = 'Up' AND IFNULL(LABEL, '') NOT LIKE '%\"tiflash\"%'").Scan(&n)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read the stores: %v", err)
+	}
+	return n, nil
+}
+
+// printRegionSummary prints the size of the regions, the number of leaders per store
+// and whether the leaders are spread over the stores or piled up on one
+func printRegionSummary(w io.Writer, regions []tableRegion, stores int) {
+	var sizeMB, keys int64
+	var scattering int
+	leaders := map[int64]int{}
+	for _, r := range regions {
+		sizeMB += r.sizeMB
+		keys += r.keys
+		leaders[r.leaderStore]++
+		if r.scattering {
+			scattering++
+		}
+	}
+	storeIDs := make([]int64, 0, len(leaders))
+	for id := range leaders {
+		storeIDs = append(storeIDs, id)
+	}
+	sort.Slice(storeIDs, func(i, j int) bool {
+		if leaders[storeIDs[i]] != leaders[storeIDs[j]] {
+			return leaders[storeIDs[i]] > leaders[storeIDs[j]]
+		}
+		return storeIDs[i] < storeIDs[j]
+	})
+
+	fmt.Fprintf(w, "Regions:      %d, about %d MB and %d keys\n", len(regions), sizeMB, keys)
+	fmt.Fprintf(w, "Leaders:      ")
+	for i, id := range storeIDs {
+		if i > 0 {
+			fmt.Fprint(w, ", ")
+		}
+		fmt.Fprintf(w, "store %d: %d", id, leaders[id])
+	}
+	fmt.Fprintln(w)
+	if scattering > 0 {
+		fmt.Fprintf(w, "Scattering:   %d regions\n", scattering)
+	}
+
+	// A region is led by one store, so the leaders can only spread over as many stores as there are regions
+	spread := min(len(regions), stores)
+	top := leaders[storeIDs[0]]
+	switch {
+	case spread <= 1:
+		fmt.Fprintf(w, "Distribution: a single region or store, nothing to spread\n")
+	case top*2 > len(regions):
+		fmt.Fprintf(w, "Distribution: contiguous, store %d leads %d of %d regions, its traffic is not spread; "+
+			"consider SPLIT TABLE or a SHARD_ROW_ID_BITS/AUTO_RANDOM key\n", storeIDs[0], top, len(regions))
+	case len(leaders) < spread:
+		fmt.Fprintf(w, "Distribution: leaders on %d of %d stores\n", len(leaders), stores)
+	default:
+		fmt.Fprintf(w, "Distribution: scattered over %d stores\n", len(leaders))
+	}
+}
+
+type HotspotsCmd struct{}
+
+func (cmd HotspotsCmd) Name() string {
+	return ".hotspots"
+}
+
+func (cmd HotspotsCmd) Description() string {
+	return "List the hottest regions of the cluster by read or write traffic, with the tables and indexes they hold"
+}
+
+func (cmd HotspotsCmd) Usage() string {
+	return ".hotspots [read|write] [--limit n]"
+}
+
+func (cmd HotspotsCmd) Handle(args []string, resultWriter io.Writer) error {
+	fs := flag.NewFlagSet(cmd.Name(), flag.ContinueOnError)
+	fs.SetOutput(resultWriter)
+	limit := fs.Int("limit", 20, "Number of regions to list")
+	var kind string
+	if len(args) > 0 && (args[0] == "read" || args[0] == "write") {
+		kind, args = args[0], args[1:]
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 || *limit < 1 {
+		return fmt.Errorf("usage: %s", cmd.Usage())
+	}
+	db, err := requireDB()
+	if err != nil {
+		return err
+	}
+	startTime := time.Now()
+
+	query := "SELECT TYPE, IFNULL(DB_NAME, ''), IFNULL(TABLE_NAME, ''), IFNULL(INDEX_NAME, ''), REGION_ID, " +
+		"MAX_HOT_DEGREE, FLOW_BYTES FROM INFORMATION_SCHEMA.TIDB_HOT_REGIONS"
+	var queryArgs []interface{}
+	if kind != "" {
+		query += " WHERE TYPE = ?"
+		queryArgs = append(queryArgs, kind)
+	}
+	query += " ORDER BY FLOW_BYTES DESC LIMIT ?"
+	queryArgs = append(queryArgs, *limit)
+	rows, err := db.Query(query, queryArgs...)
+	if err != nil {
+		return fmt.Errorf("failed to read the hot regions: %v", err)
+	}
+	defer rows.Close()
+
+	cols := []string{"Type", "Table", "Index", "Region", "Hot degree", "Flow/s"}
+	var output []RowResult
+	flows := map[string]float64{}
+	var tables []string
+	for rows.Next() {
+		var typ, dbName, tableName, indexName string
+		var region, degree int64
+		var flow float64
+		if err := rows.Scan(&typ, &dbName, &tableName, &indexName, &region, &degree, &flow); err != nil {
+			return fmt.Errorf("failed to read the hot regions: %v", err)
+		}
+		name := tableName
+		if dbName != "" {
+			name = dbName + "." + tableName
+		}
+		if _, ok := flows[name]; !ok {
+			tables = append(tables, name)
+		}
+		flows[name] += flow
+		output = append(output, RowResult{colNames: cols, colValues: []interface{}{
+			typ, name, indexName, region, degree, formatBytes(int64(flow)),
+		}})
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read the hot regions: %v", err)
+	}
+	if len(output) == 0 {
+		fmt.Fprintln(resultWriter, "No hot regions")
+		return nil
+	}
+	printResults(true, output, *globalOutputFormat, true, time.Since(startTime), 0)
+
+	sort.SliceStable(tables, func(i, j int) bool { return flows[tables[i]] > flows[tables[j]] })
+	fmt.Fprintf(resultWriter, "Hottest tables: ")
+	for i, name := range tables {
+		if i == 5 {
+			break
+		}
+		if i > 0 {
+			fmt.Fprint(resultWriter, ", ")
+		}
+		fmt.Fprintf(resultWriter, "%s (%s/s)", name, formatBytes(int64(flows[name])))
+	}
+	fmt.Fprintln(resultWriter)
+	return nil
+}
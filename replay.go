@@ -0,0 +1,409 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// slowLogEntry is a statement of a TiDB slow log
+type slowLogEntry struct {
+	start     time.Time // when the statement started, its logged end time less its query time
+	queryTime time.Duration
+	connID    string
+	db        string
+	user      string
+	digest    string
+	internal  bool
+	sql       string
+}
+
+// parseSlowLog reads the statements of a TiDB slow log. Each entry is a block of
+// "# Key: value" header lines, a header line holding several fields, followed by
+// the statement, itself preceded by a "use db;" line when a database is selected.
+func parseSlowLog(r io.Reader) ([]slowLogEntry, error) {
+	var entries []slowLogEntry
+	var cur slowLogEntry
+	var end time.Time
+	var stmt strings.Builder
+	flush := func() {
+		if text := strings.TrimSpace(stmt.String()); text != "" && !end.IsZero() {
+			cur.sql = text
+			cur.start = end.Add(-cur.queryTime)
+			entries = append(entries, cur)
+		}
+		stmt.Reset()
+	}
+
+	scanner := bufio.NewScanner(r)
+	// Statements can be long, e.g. multi-row inserts
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "# ") {
+			if strings.HasPrefix(strings.ToLower(line), "use ") && stmt.Len() == 0 {
+				// Already known from the DB field
+				continue
+			}
+			stmt.WriteString(line)
+			stmt.WriteByte('\n')
+			continue
+		}
+		if strings.HasPrefix(line, "# Time: ") {
+			flush()
+			cur = slowLogEntry{}
+			t, err := time.Parse(time.RFC3339Nano, strings.TrimSpace(line[len("# Time: "):]))
+			if err != nil {
+				return nil, fmt.Errorf("invalid time in %q: %v", line, err)
+			}
+			end = t
+			continue
+		}
+		if stmt.Len() > 0 {
+			// A comment line within the statement
+			stmt.WriteString(line)
+			stmt.WriteByte('\n')
+			continue
+		}
+		if user, ok := strings.CutPrefix(line, "# User@Host: "); ok {
+			if i := strings.IndexByte(user, '['); i >= 0 {
+				user = user[:i]
+			}
+			cur.user = strings.TrimSpace(user)
+			continue
+		}
+		fields := strings.Fields(line[2:])
+		for i := 0; i+1 < len(fields); i += 2 {
+			key, value := strings.TrimSuffix(fields[i], ":"), fields[i+1]
+			switch key {
+			case "Conn_ID":
+				cur.connID = value
+			case "Query_time":
+				secs, _ := strconv.ParseFloat(value, 64)
+				cur.queryTime = time.Duration(secs * float64(time.Second))
+			case "DB":
+				cur.db = value
+			case "Digest":
+				cur.digest = value
+			case "Is_internal":
+				cur.internal = value == "true"
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	flush()
+	return entries, nil
+}
+
+// parseReplaySpeed accepts a speed factor such as "2", "2x" or "0.5x"
+func parseReplaySpeed(s string) (float64, error) {
+	speed, err := strconv.ParseFloat(strings.TrimSuffix(strings.ToLower(s), "x"), 64)
+	if err != nil || speed <= 0 {
+		return 0, fmt.Errorf("invalid speed: %s", s)
+	}
+	return speed, nil
+}
+
+// replayFilter selects the entries of a slow log to replay from key=value conditions
+type replayFilter map[string]string
+
+func parseReplayFilters(filters []string) (replayFilter, error) {
+	f := replayFilter{}
+	for _, s := range filters {
+		key, value, ok := strings.Cut(s, "=")
+		switch key = strings.ToLower(strings.TrimSpace(key)); {
+		case !ok:
+			return nil, fmt.Errorf("invalid filter %q, expected key=value", s)
+		case key != "digest" && key != "db" && key != "user" && key != "conn":
+			return nil, fmt.Errorf("unknown filter %q, use digest, db, user or conn", key)
+		}
+		f[key] = strings.TrimSpace(value)
+	}
+	return f, nil
+}
+
+func (f replayFilter) match(e slowLogEntry) bool {
+	for key, value := range f {
+		var got string
+		switch key {
+		case "digest":
+			got = e.digest
+		case "db":
+			got = e.db
+		case "user":
+			got = e.user
+		case "conn":
+			got = e.connID
+		}
+		if !strings.EqualFold(got, value) {
+			return false
+		}
+	}
+	return true
+}
+
+// apply returns the entries to replay: the user statements that match f, and with
+// readOnly only those the strict read-only check accepts, so that DDL, LOAD DATA
+// or privilege changes never reach the target cluster
+func (f replayFilter) apply(all []slowLogEntry, readOnly bool) []slowLogEntry {
+	var entries []slowLogEntry
+	for _, e := range all {
+		if e.internal || !f.match(e) || (readOnly && !isReadOnly(e.sql)) {
+			continue
+		}
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+// replayResult is the outcome of a replayed statement
+type replayResult struct {
+	original, replayed time.Duration
+	err                error
+}
+
+// replayStats collects the outcomes of a replay
+type replayStats struct {
+	mu      sync.Mutex
+	results []replayResult
+	errors  map[string]int
+}
+
+func (s *replayStats) add(r replayResult) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.results = append(s.results, r)
+	if r.err != nil {
+		s.errors[r.err.Error()]++
+	}
+}
+
+// replaySession replays the statements of an original connection in order on a connection
+// of its own, so that the concurrency of the replay follows the one of the log
+func replaySession(db *sql.DB, entries <-chan slowLogEntry, stats *replayStats, wg *sync.WaitGroup) {
+	defer wg.Done()
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		for e := range entries {
+			stats.add(replayResult{original: e.queryTime, err: err})
+		}
+		return
+	}
+	defer conn.Close()
+	var curDB string
+	for e := range entries {
+		if e.db != "" && e.db != curDB {
+			if _, err := conn.ExecContext(ctx, "USE "+quoteName(e.db)); err != nil {
+				stats.add(replayResult{original: e.queryTime, err: err})
+				continue
+			}
+			curDB = e.db
+		}
+		start := time.Now()
+		err := runDrained(ctx, conn, e.sql)
+		stats.add(replayResult{original: e.queryTime, replayed: time.Since(start), err: err})
+	}
+}
+
+// runDrained runs a statement on conn and reads its results as a client would, discarding them
+func runDrained(ctx context.Context, conn *sql.Conn, query string, args ...interface{}) error {
+	rows, err := conn.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+	}
+	return rows.Err()
+}
+
+// replayLog runs entries against db at their original pace divided by speed, and stops
+// dispatching on interrupt. It returns the time the replay took.
+func replayLog(db *sql.DB, entries []slowLogEntry, speed float64, stats *replayStats) time.Duration {
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+
+	var wg sync.WaitGroup
+	sessions := map[string]chan slowLogEntry{}
+	startTime := time.Now()
+	first := entries[0].start
+dispatch:
+	for _, e := range entries {
+		due := startTime.Add(time.Duration(float64(e.start.Sub(first)) / speed))
+		if wait := time.Until(due); wait > 0 {
+			select {
+			case <-interrupt:
+				log.Println("Interrupted, waiting for the running statements")
+				break dispatch
+			case <-time.After(wait):
+			}
+		}
+		session, ok := sessions[e.connID]
+		if !ok {
+			session = make(chan slowLogEntry, 1024)
+			sessions[e.connID] = session
+			wg.Add(1)
+			go replaySession(db, session, stats, &wg)
+		}
+		session <- e
+	}
+	for _, session := range sessions {
+		close(session)
+	}
+	wg.Wait()
+	return time.Since(startTime)
+}
+
+// percentile returns the p-th percentile of sorted durations
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(float64(len(sorted)-1) * p)
+	return sorted[i]
+}
+
+// printReplayReport prints the latencies of the replay next to the original ones
+func printReplayReport(w io.Writer, stats *replayStats, span, elapsed time.Duration) {
+	var original, replayed []time.Duration
+	failed := 0
+	for _, r := range stats.results {
+		if r.err != nil {
+			failed++
+			continue
+		}
+		original = append(original, r.original)
+		replayed = append(replayed, r.replayed)
+	}
+	sort.Slice(original, func(i, j int) bool { return original[i] < original[j] })
+	sort.Slice(replayed, func(i, j int) bool { return replayed[i] < replayed[j] })
+
+	fmt.Fprintf(w, "Statements:  %d replayed, %d failed\n", len(stats.results), failed)
+	fmt.Fprintf(w, "Duration:    %s (%s in the log)\n", elapsed.Round(time.Millisecond), span.Round(time.Millisecond))
+	if len(replayed) > 0 {
+		fmt.Fprintf(w, "Latency:     %-10s %-12s %-12s %s\n", "", "p50", "p99", "max")
+		for _, l := range []struct {
+			name string
+			d    []time.Duration
+		}{{"original", original}, {"replayed", replayed}} {
+			fmt.Fprintf(w, "             %-10s %-12s %-12s %s\n", l.name,
+				percentile(l.d, 0.5).Round(time.Microsecond), percentile(l.d, 0.99).Round(time.Microsecond), l.d[len(l.d)-1].Round(time.Microsecond))
+		}
+	}
+	if len(stats.errors) > 0 {
+		msgs := make([]string, 0, len(stats.errors))
+		for msg := range stats.errors {
+			msgs = append(msgs, msg)
+		}
+		sort.Slice(msgs, func(i, j int) bool { return stats.errors[msgs[i]] > stats.errors[msgs[j]] })
+		fmt.Fprintln(w, "Errors:")
+		for i, msg := range msgs {
+			if i == 10 {
+				fmt.Fprintf(w, "  ... and %d more\n", len(msgs)-i)
+				break
+			}
+			fmt.Fprintf(w, "  %6d  %s\n", stats.errors[msg], msg)
+		}
+	}
+}
+
+func runReplayLog(args []string) int {
+	fs := flag.NewFlagSet("tip replay-log", flag.ExitOnError)
+	cf := registerConnFlags(fs)
+	speedFlag := fs.String("speed", "1x", "Replay speed relative to the log, e.g. 2x replays twice as fast")
+	var filters stringList
+	fs.Var(&filters, "filter", "Only replay the statements matching key=value, with key digest, db, user or conn (repeatable)")
+	readOnly := fs.Bool("read-only", false, "Only replay the statements that read data")
+	dryRun := fs.Bool("dry-run", false, "Print what would be replayed, without connecting")
+	// The log file may come before the flags
+	var file string
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		file, args = args[0], args[1:]
+	}
+	if err := cf.parseWithArgs(fs, args); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if file == "" && fs.NArg() > 0 {
+		file = fs.Arg(0)
+	}
+	if file == "" {
+		fmt.Fprintln(os.Stderr, "usage: tip replay-log <tidb-slow-log-file> [-speed 2x] [-filter digest=...] [flags]")
+		return 2
+	}
+	speed, err := parseReplaySpeed(*speedFlag)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	filter, err := parseReplayFilters(filters)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		log.Println(err)
+		return 1
+	}
+	all, err := parseSlowLog(f)
+	f.Close()
+	if err != nil {
+		log.Printf("Failed to read %s: %v", file, err)
+		return 1
+	}
+	entries := filter.apply(all, *readOnly)
+	if len(entries) == 0 {
+		log.Printf("No statements to replay in %s (%d in the log)", file, len(all))
+		return 1
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].start.Before(entries[j].start) })
+	span := entries[len(entries)-1].start.Sub(entries[0].start)
+	conns := map[string]bool{}
+	for _, e := range entries {
+		conns[e.connID] = true
+	}
+	log.Printf("Replaying %d of %d statements over %d connections, %s at %gx", len(entries), len(all), len(conns),
+		time.Duration(float64(span)/speed).Round(time.Second), speed)
+	if *dryRun {
+		for _, e := range entries {
+			fmt.Printf("%s conn %s db %s: %s\n", e.start.Format(time.RFC3339Nano), e.connID, e.db, strings.Join(strings.Fields(e.sql), " "))
+		}
+		return 0
+	}
+
+	info, err := cf.connInfo()
+	if err != nil {
+		log.Println(err)
+		return 1
+	}
+	db, err := openDatabase(info)
+	if err != nil {
+		log.Println(err)
+		return 1
+	}
+	defer db.Close()
+	// One connection per original connection, whatever the pool default
+	db.SetMaxOpenConns(0)
+
+	stats := &replayStats{errors: map[string]int{}}
+	elapsed := replayLog(db, entries, speed, stats)
+	printReplayReport(os.Stdout, stats, span, elapsed)
+	return 0
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+const readOnlyReplayLog = `# Time: 2024-05-01T10:00:00.000000+08:00
+# Conn_ID: 1 Query_time: 0.1
+# DB: test
+select * from t where id = 1;
+# Time: 2024-05-01T10:00:01.000000+08:00
+# Conn_ID: 1 Query_time: 0.2
+# DB: test
+create table t2 (id int primary key);
+# Time: 2024-05-01T10:00:02.000000+08:00
+# Conn_ID: 1 Query_time: 0.3
+# DB: test
+drop index idx on t;
+# Time: 2024-05-01T10:00:03.000000+08:00
+# Conn_ID: 2 Query_time: 1.5
+# DB: test
+load data local infile '/tmp/t.csv' into table t;
+# Time: 2024-05-01T10:00:04.000000+08:00
+# Conn_ID: 2 Query_time: 0.1
+# DB: test
+create user 'u'@'%' identified by 'secret';
+# Time: 2024-05-01T10:00:05.000000+08:00
+# Conn_ID: 2 Query_time: 0.1
+# DB: test
+select * from t for update;
+# Time: 2024-05-01T10:00:06.000000+08:00
+# Conn_ID: 2 Query_time: 0.1
+# DB: test
+explain analyze delete from t;
+# Time: 2024-05-01T10:00:07.000000+08:00
+# Conn_ID: 3 Query_time: 0.1
+# DB: test
+show tables;
+`
+
+func TestReplayReadOnlySkipsWrites(t *testing.T) {
+	all, err := parseSlowLog(strings.NewReader(readOnlyReplayLog))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 8 {
+		t.Fatalf("parsed %d entries, want 8", len(all))
+	}
+
+	if got := (replayFilter{}).apply(all, false); len(got) != len(all) {
+		t.Errorf("without -read-only got %d entries, want %d", len(got), len(all))
+	}
+
+	var got []string
+	for _, e := range (replayFilter{}).apply(all, true) {
+		got = append(got, e.sql)
+	}
+	want := []string{"select * from t where id = 1;", "show tables;"}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("with -read-only got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"net"
+)
+
+// Routing modes of .route
+const (
+	routeAuto  = "auto"  // read-only statements go to the read endpoint, the rest to the write endpoint
+	routeRead  = "read"  // everything goes to the read endpoint
+	routeWrite = "write" // everything goes to the write endpoint
+)
+
+var (
+	// readDB is the connection to the read endpoint, nil when the profile defines none
+	readDB *sql.DB
+	// readAddr and writeAddr are the endpoints shown by .route
+	readAddr, writeAddr string
+	routeMode           = routeAuto
+)
+
+// connectReadEndpoint opens the read endpoint of info if it has one, replacing the previous one
+func connectReadEndpoint(info ConnInfo) error {
+	if readDB != nil {
+		readDB.Close()
+		readDB = nil
+	}
+	readAddr = ""
+	if info.ReadHost == "" {
+		return nil
+	}
+
+	readInfo := info
+	readInfo.Host = info.ReadHost
+	readInfo.Socket = ""
+	if info.ReadPort != "" {
+		readInfo.Port = info.ReadPort
+	}
+	db, err := openDatabase(readInfo)
+	if err != nil {
+		return fmt.Errorf("read endpoint: %v", err)
+	}
+	readDB = db
+	readAddr = net.JoinHostPort(readInfo.Host, readInfo.Port)
+	return nil
+}
+
+// routeStatement returns the connection query should run on. Only statements sent
+// to the global connection are routed, other connections are used as they are.
+// While a transaction is open or a snapshot is pinned everything stays on the
+// session that holds it, so that reads see the writes of the transaction. Reads of
+// the temporary tables of the session stay on it too, as no other session sees them.
+func routeStatement(db *sql.DB, query string) *sql.DB {
+	if readDB == nil || db != GetDB() || txnOpen || snapshotTSO != 0 {
+		return db
+	}
+	switch routeMode {
+	case routeRead:
+		return readDB
+	case routeWrite:
+		return db
+	}
+	if isReadOnly(query) && !usesSessionTempTable(query) {
+		return readDB
+	}
+	return db
+}
+
+// followSession repeats a USE or a SET of session variables run on the write endpoint
+// on the read endpoint, so that both keep the same current database and variables
+func followSession(db *sql.DB, query string) {
+	if readDB != nil && db == GetDB() && isSessionSetting(query) {
+		readDB.Exec(query)
+	}
+}
+
+type RouteCmd struct{}
+
+func (cmd RouteCmd) Name() string {
+	return ".route"
+}
+
+func (cmd RouteCmd) Description() string {
+	return "Show or override where statements are sent when a read endpoint is configured"
+}
+
+func (cmd RouteCmd) Usage() string {
+	return ".route [auto|read|write]"
+}
+
+func (cmd RouteCmd) Handle(args []string, resultWriter io.Writer) error {
+	if len(args) > 1 {
+		return fmt.Errorf("usage: %s", cmd.Usage())
+	}
+	if len(args) == 1 {
+		switch args[0] {
+		case routeAuto, routeRead, routeWrite:
+		default:
+			return fmt.Errorf("usage: %s", cmd.Usage())
+		}
+		if readDB == nil && args[0] != routeAuto {
+			return fmt.Errorf("no read endpoint configured, set read_host in the profile or use -read-host")
+		}
+		routeMode = args[0]
+	}
+
+	fmt.Fprintf(resultWriter, "Mode: %s\n", routeMode)
+	fmt.Fprintf(resultWriter, "Write endpoint: %s\n", writeAddr)
+	if readDB == nil {
+		fmt.Fprintf(resultWriter, "Read endpoint: (none)\n")
+	} else {
+		fmt.Fprintf(resultWriter, "Read endpoint: %s\n", readAddr)
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/pingcap/tidb/pkg/parser/ast"
+	"github.com/pingcap/tidb/pkg/parser/format"
+)
+
+// defaultSafeRowLimit is the number of rows a SELECT without LIMIT shows in the REPL
+const defaultSafeRowLimit = 1000
+
+// safeRowLimit caps the rows of SELECT statements without LIMIT run in the REPL, 0 for no cap
+var safeRowLimit = defaultSafeRowLimit
+
+// parseRowLimit parses a row limit setting, a number of rows or off
+func parseRowLimit(s string) (int, error) {
+	if strings.EqualFold(s, "off") {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid row limit: %s", s)
+	}
+	return n, nil
+}
+
+// applyRowLimit adds a LIMIT to query when it is a single SELECT without one. One row
+// more than the limit is asked for, so that a cut result can be told from a complete one.
+// It reports whether it changed the query.
+func applyRowLimit(query string) (string, bool) {
+	if safeRowLimit == 0 {
+		return query, false
+	}
+	stmtNodes, _, err := p.Parse(query, "", "")
+	if err != nil || len(stmtNodes) != 1 {
+		return query, false
+	}
+	limit := &ast.Limit{Count: ast.NewValueExpr(uint64(safeRowLimit)+1, "", "")}
+	switch stmt := stmtNodes[0].(type) {
+	case *ast.SelectStmt:
+		if stmt.Limit != nil || stmt.SelectIntoOpt != nil {
+			return query, false
+		}
+		stmt.Limit = limit
+	case *ast.SetOprStmt:
+		if stmt.Limit != nil {
+			return query, false
+		}
+		stmt.Limit = limit
+	default:
+		return query, false
+	}
+
+	var sb strings.Builder
+	if err := stmtNodes[0].Restore(format.NewRestoreCtx(format.DefaultRestoreFlags|format.RestoreStringWithoutCharset, &sb)); err != nil {
+		return query, false
+	}
+	return sb.String(), true
+}
+
+type LimitCmd struct{}
+
+func (cmd LimitCmd) Name() string {
+	return ".limit"
+}
+
+func (cmd LimitCmd) Description() string {
+	return "Set or display the number of rows shown for a SELECT without LIMIT"
+}
+
+func (cmd LimitCmd) Usage() string {
+	return ".limit [n|off]"
+}
+
+func (cmd LimitCmd) Handle(args []string, resultWriter io.Writer) error {
+	if len(args) == 0 {
+		if safeRowLimit == 0 {
+			resultWriter.Write([]byte("Row limit is off\n"))
+		} else {
+			resultWriter.Write([]byte(fmt.Sprintf("Row limit is %d\n", safeRowLimit)))
+		}
+		return nil
+	}
+	if len(args) != 1 {
+		return fmt.Errorf("usage: %s", cmd.Usage())
+	}
+	n, err := parseRowLimit(args[0])
+	if err != nil {
+		return err
+	}
+	safeRowLimit = n
+	return nil
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/pingcap/tidb/pkg/parser/ast"
+)
+
+// safeMode refuses UPDATE and DELETE statements typed in the REPL that would change
+// every row of a table, like the --safe-updates option of the mysql client
+var safeMode bool
+
+// checkSafeMode returns an error for the statements of query safe mode refuses
+func checkSafeMode(query string) error {
+	if !safeMode {
+		return nil
+	}
+	stmtNodes, _, err := p.Parse(query, "", "")
+	if err != nil {
+		// The server reports the syntax error
+		return nil
+	}
+	for _, stmt := range stmtNodes {
+		switch stmt := stmt.(type) {
+		case *ast.UpdateStmt:
+			if stmt.Where == nil && stmt.Limit == nil {
+				return fmt.Errorf("safe mode refuses an UPDATE without WHERE or LIMIT, use .safe-mode off to run it")
+			}
+		case *ast.DeleteStmt:
+			if stmt.Where == nil && stmt.Limit == nil {
+				return fmt.Errorf("safe mode refuses a DELETE without WHERE or LIMIT, use .safe-mode off to run it")
+			}
+		}
+	}
+	return nil
+}
+
+type SafeModeCmd struct{}
+
+func (cmd SafeModeCmd) Name() string {
+	return ".safe-mode"
+}
+
+func (cmd SafeModeCmd) Description() string {
+	return "Toggle refusing UPDATE and DELETE statements without WHERE or LIMIT"
+}
+
+func (cmd SafeModeCmd) Usage() string {
+	return ".safe-mode [on|off]"
+}
+
+func (cmd SafeModeCmd) Handle(args []string, resultWriter io.Writer) error {
+	if len(args) == 0 {
+		state := "off"
+		if safeMode {
+			state = "on"
+		}
+		resultWriter.Write([]byte(fmt.Sprintf("Safe mode is %s\n", state)))
+		return nil
+	}
+	switch args[0] {
+	case "on":
+		safeMode = true
+	case "off":
+		safeMode = false
+	default:
+		return fmt.Errorf("usage: %s", cmd.Usage())
+	}
+	return nil
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/pingcap/tidb/pkg/parser/ast"
+	"github.com/pingcap/tidb/pkg/parser/format"
+)
+
+var (
+	// sessionVars holds the session and user variables set in this session, as
+	// assignments restored from the SET statements, keyed by variable name
+	sessionVars     = map[string]string{}
+	sessionVarOrder []string
+	// sessionTempTables holds the local temporary tables created in this session as
+	// db.table, no metadata query lists them
+	sessionTempTables = map[string]string{}
+	sessionVarsLock   sync.Mutex
+)
+
+// rememberSessionVar records the assignment of a variable, replacing an earlier one.
+// An empty assignment forgets the variable, e.g. after it was set back to DEFAULT.
+func rememberSessionVar(name, assignment string) {
+	sessionVarsLock.Lock()
+	defer sessionVarsLock.Unlock()
+	if _, ok := sessionVars[name]; ok {
+		for i, n := range sessionVarOrder {
+			if n == name {
+				sessionVarOrder = append(sessionVarOrder[:i], sessionVarOrder[i+1:]...)
+				break
+			}
+		}
+		delete(sessionVars, name)
+	}
+	if assignment != "" {
+		sessionVars[name] = assignment
+		sessionVarOrder = append(sessionVarOrder, name)
+	}
+}
+
+// sessionVarAssignments returns the recorded assignments in the order they were made
+func sessionVarAssignments() []string {
+	sessionVarsLock.Lock()
+	defer sessionVarsLock.Unlock()
+	assignments := make([]string, len(sessionVarOrder))
+	for i, name := range sessionVarOrder {
+		assignments[i] = sessionVars[name]
+	}
+	return assignments
+}
+
+// trackSession remembers the session state a statement changes, to restore it after reconnecting
+func trackSession(query string) {
+	stmtNodes, _, err := p.Parse(query, "", "")
+	if err != nil {
+		return
+	}
+	for _, stmt := range stmtNodes {
+		switch stmt := stmt.(type) {
+		case *ast.UseStmt:
+			sessionDatabase = stmt.DBName
+		case *ast.SetStmt:
+			trackSetStmt(stmt)
+		case *ast.BeginStmt:
+			txnOpen = true
+		case *ast.CommitStmt:
+			txnOpen = false
+		case *ast.RollbackStmt:
+			// ROLLBACK TO SAVEPOINT keeps the transaction open
+			if stmt.SavepointName == "" {
+				txnOpen = false
+			}
+		case *ast.CreateTableStmt:
+			// Unlike other DDL, creating or dropping a temporary table doesn't commit the transaction
+			if stmt.TemporaryKeyword == ast.TemporaryLocal {
+				trackTempTable(stmt.Table, true)
+			} else {
+				txnOpen = false
+			}
+		case *ast.DropTableStmt:
+			// DROP TABLE drops a temporary table of the name before a regular one
+			for _, table := range stmt.Tables {
+				trackTempTable(table, false)
+			}
+			if stmt.TemporaryKeyword != ast.TemporaryLocal {
+				txnOpen = false
+			}
+		case ast.DDLNode:
+			// DDL commits the open transaction
+			txnOpen = false
+		}
+	}
+}
+
+// resetSession forgets the session state, as a new connection starts a new session
+func resetSession() {
+	sessionVarsLock.Lock()
+	defer sessionVarsLock.Unlock()
+	sessionVars = map[string]string{}
+	sessionVarOrder = nil
+	sessionTempTables = map[string]string{}
+	sessionDatabase = ""
+	txnOpen = false
+}
+
+// trackTempTable records a local temporary table being created or dropped
+func trackTempTable(table *ast.TableName, created bool) {
+	key := tempTableKey(table.Schema.O, table.Name.O)
+	sessionVarsLock.Lock()
+	defer sessionVarsLock.Unlock()
+	if created {
+		sessionTempTables[key] = table.Name.O
+	} else {
+		delete(sessionTempTables, key)
+	}
+}
+
+// tempTableKey returns the key of a temporary table in sessionTempTables, an unqualified
+// table being in the current database
+func tempTableKey(dbName, table string) string {
+	if dbName == "" {
+		dbName = sessionDatabase
+	}
+	if dbName == "" && activeConnInfo != nil {
+		dbName = activeConnInfo.Database
+	}
+	return strings.ToLower(dbName + "." + table)
+}
+
+// sessionTempTableNames returns the local temporary tables of a database created in this session
+func sessionTempTableNames(dbName string) []string {
+	sessionVarsLock.Lock()
+	defer sessionVarsLock.Unlock()
+	prefix := strings.ToLower(dbName) + "."
+	var names []string
+	for key, name := range sessionTempTables {
+		if strings.HasPrefix(key, prefix) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// isSessionTempTable reports whether table, qualified or in dbName, is a local temporary table of this session
+func isSessionTempTable(dbName, table string) bool {
+	if dot := strings.LastIndex(table, "."); dot >= 0 {
+		dbName, table = table[:dot], table[dot+1:]
+	}
+	key := strings.ToLower(strings.Trim(dbName, "`") + "." + strings.Trim(table, "`"))
+	sessionVarsLock.Lock()
+	defer sessionVarsLock.Unlock()
+	_, ok := sessionTempTables[key]
+	return ok
+}
+
+// usesSessionTempTable reports whether query reads or writes a local temporary table of
+// this session, created by the user or by .materialize. Such tables only exist on the
+// connection that created them.
+func usesSessionTempTable(query string) bool {
+	stmtNodes, _, err := p.Parse(query, "", "")
+	if err != nil {
+		return false
+	}
+	c := &tempTableCollector{}
+	for _, stmt := range stmtNodes {
+		stmt.Accept(c)
+	}
+	sessionVarsLock.Lock()
+	defer sessionVarsLock.Unlock()
+	for _, key := range c.keys {
+		if _, ok := sessionTempTables[key]; ok {
+			return true
+		}
+		if _, ok := materializedTables[key]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// tempTableCollector collects the keys, as in sessionTempTables, of the tables a statement names
+type tempTableCollector struct {
+	keys []string
+}
+
+func (c *tempTableCollector) Enter(n ast.Node) (ast.Node, bool) {
+	if tn, ok := n.(*ast.TableName); ok {
+		c.keys = append(c.keys, tempTableKey(tn.Schema.O, tn.Name.O))
+	}
+	return n, false
+}
+
+func (c *tempTableCollector) Leave(n ast.Node) (ast.Node, bool) {
+	return n, true
+}
+
+// trackSetStmt records the session and user variables a SET statement assigns.
+// Global variables survive reconnects on their own and are left out. A new time zone
+// of the session is read back for .set timezone.
+func trackSetStmt(stmt *ast.SetStmt) {
+	var timeZoneSet bool
+	defer func() {
+		if timeZoneSet {
+			refreshSessionLocation()
+		}
+	}()
+	for _, v := range stmt.Variables {
+		if v.IsGlobal || v.Name == ast.SetNames || v.Name == ast.SetCharset {
+			continue
+		}
+		name := strings.ToLower(v.Name)
+		timeZoneSet = timeZoneSet || (v.IsSystem && name == "time_zone")
+		if !v.IsSystem {
+			name = "@" + name
+		}
+		if _, ok := v.Value.(*ast.DefaultExpr); ok {
+			rememberSessionVar(name, "")
+			continue
+		}
+		var sb strings.Builder
+		if err := v.Restore(format.NewRestoreCtx(format.DefaultRestoreFlags|format.RestoreStringWithoutCharset, &sb)); err != nil {
+			continue
+		}
+		rememberSessionVar(name, sb.String())
+	}
+}
+
+// sessionConnector restores the current database and the recorded variables on
+// every new connection of the session, so that reconnects and fail overs keep the
+// behavior of the session
+type sessionConnector struct {
+	driver.Connector
+	session bool   // whether the connections carry the session, see ConnInfo.Session
+	addr    string // address connected to, for the reconnect message
+	dialed  atomic.Bool
+}
+
+func (c *sessionConnector) Connect(ctx context.Context) (driver.Conn, error) {
+	conn, err := c.Connector.Connect(ctx)
+	if err != nil || !c.session {
+		return conn, err
+	}
+	execer, ok := conn.(driver.ExecerContext)
+	if !ok {
+		return conn, nil
+	}
+	redial := c.dialed.Swap(true)
+	if db := sessionDatabase; db != "" && redial {
+		if _, err := execer.ExecContext(ctx, "USE "+quoteName(db), nil); err != nil {
+			log.Printf("Failed to restore the current database %s: %v", db, err)
+		}
+	}
+	// One at a time, so that a variable the server refuses doesn't keep the others from being set
+	assignments := sessionVarAssignments()
+	for _, assignment := range assignments {
+		if _, err := execer.ExecContext(ctx, "SET "+assignment, nil); err != nil {
+			log.Printf("Failed to restore %s: %v", assignment, err)
+		}
+	}
+	if redial {
+		sessionVarsLock.Lock()
+		sessionTempTables = map[string]string{}
+		sessionVarsLock.Unlock()
+		msg := "Reconnected to " + c.addr
+		if n := len(assignments); n > 0 {
+			msg += fmt.Sprintf(" and restored %d session variables", n)
+		}
+		log.Print(msg + ", temporary tables and locks of the lost session are gone")
+	}
+	return conn, nil
+}
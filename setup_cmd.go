@@ -0,0 +1,173 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/manifoldco/promptui"
+	"github.com/pelletier/go-toml"
+)
+
+// configFilePath returns the configuration file in use, or where it goes when there is none yet
+func configFilePath() (string, error) {
+	if globalConfigFile != "" {
+		return globalConfigFile, nil
+	}
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(homeDir, ".tip/config.toml"), nil
+}
+
+// runSetupWizard asks for the connection settings, tests them and writes them to
+// the configuration file, either as the default connection or as a named profile
+func runSetupWizard(w io.Writer) (err error) {
+	defer func() {
+		if err == promptui.ErrInterrupt || err == promptui.ErrEOF {
+			err = fmt.Errorf("setup cancelled")
+		}
+	}()
+	if !isTerminal() {
+		return fmt.Errorf("setup needs a terminal to prompt on")
+	}
+	path, err := configFilePath()
+	if err != nil {
+		return err
+	}
+
+	ask := func(label, def string, validate promptui.ValidateFunc) (string, error) {
+		prompt := promptui.Prompt{Label: label, Default: def, AllowEdit: true, Validate: validate}
+		return prompt.Run()
+	}
+	var info ConnInfo
+	if info.Host, err = ask("Host", "127.0.0.1", nil); err != nil {
+		return err
+	}
+	info.Port, err = ask("Port", "4000", func(s string) error {
+		if _, err := strconv.ParseUint(s, 10, 16); err != nil {
+			return fmt.Errorf("not a port number")
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if info.User, err = ask("User", "root", nil); err != nil {
+		return err
+	}
+	passPrompt := promptui.Prompt{Label: "Password", Mask: '*'}
+	if info.Password, err = passPrompt.Run(); err != nil {
+		return err
+	}
+	if info.Database, err = ask("Database", "test", nil); err != nil {
+		return err
+	}
+	modes := []string{sslPreferred, sslVerifyIdentity, sslVerifyCA, sslRequired, sslDisabled}
+	modeSelect := promptui.Select{Label: "TLS mode", Items: modes}
+	if _, info.SSLMode, err = modeSelect.Run(); err != nil {
+		return err
+	}
+	profile, err := ask("Profile name (empty for the default connection)", "", nil)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(w, "Testing the connection...")
+	db, err := openDatabase(info)
+	if err == nil {
+		db.Close()
+		fmt.Fprintln(w, "Connection OK.")
+	} else {
+		fmt.Fprintf(w, "Connection failed: %v\n", err)
+		confirm := promptui.Prompt{Label: "Save the settings anyway", IsConfirm: true}
+		if _, err := confirm.Run(); err != nil {
+			return fmt.Errorf("settings not saved")
+		}
+	}
+
+	if err := saveConnConfig(path, profile, info); err != nil {
+		return err
+	}
+	if profile != "" {
+		fmt.Fprintf(w, "Saved profile %q to %s, connect with: tip -profile %s\n", profile, path, profile)
+	} else {
+		fmt.Fprintf(w, "Saved to %s, connect with: tip\n", path)
+	}
+	return nil
+}
+
+// saveConnConfig writes the connection settings to the configuration file, at the top
+// or as [profiles.<profile>], keeping the rest of the file. The previous file is kept
+// as a .bak, as comments don't survive the rewrite.
+func saveConnConfig(path, profile string, info ConnInfo) error {
+	tree, err := toml.LoadFile(path)
+	if os.IsNotExist(err) {
+		tree, err = toml.TreeFromMap(map[string]interface{}{})
+	} else if err == nil {
+		var data []byte
+		if data, err = os.ReadFile(path); err == nil {
+			if err := writePrivateFile(path+".bak", data); err != nil {
+				return fmt.Errorf("failed to back up %s: %v", path, err)
+			}
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %v", path, err)
+	}
+
+	var prefix []string
+	if profile != "" {
+		prefix = []string{"profiles", profile}
+	}
+	settings := []struct{ key, value string }{
+		{"host", info.Host},
+		{"port", info.Port},
+		{"user", info.User},
+		{"password", info.Password},
+		{"database", info.Database},
+		{"ssl_mode", info.SSLMode},
+	}
+	for _, s := range settings {
+		tree.SetPath(append(prefix[:len(prefix):len(prefix)], s.key), s.value)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	// The file holds the password
+	return writePrivateFile(path, []byte(tree.String()))
+}
+
+// writePrivateFile writes a file only its owner can read. os.WriteFile only sets the
+// mode of files it creates, so an existing file is restricted before it is written.
+func writePrivateFile(path string, data []byte) error {
+	if err := os.Chmod(path, 0600); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return os.WriteFile(path, data, 0600)
+}
+
+type SetupCmd struct{}
+
+func (cmd SetupCmd) Name() string {
+	return ".setup"
+}
+
+func (cmd SetupCmd) Description() string {
+	return "Set up a connection step by step and save it to the configuration file"
+}
+
+func (cmd SetupCmd) Usage() string {
+	return ".setup"
+}
+
+func (cmd SetupCmd) Handle(args []string, resultWriter io.Writer) error {
+	if len(args) != 0 {
+		return fmt.Errorf("usage: %s", cmd.Usage())
+	}
+	return runSetupWizard(resultWriter)
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// gistAPIURL is where gists are created, see https://docs.github.com/en/rest/gists
+const gistAPIURL = "https://api.github.com/gists"
+
+type ShareCmd struct{}
+
+func (cmd ShareCmd) Name() string {
+	return ".share"
+}
+
+func (cmd ShareCmd) Description() string {
+	return "Upload the last statement, and optionally rows of its result, to a GitHub gist and print its URL"
+}
+
+func (cmd ShareCmd) Usage() string {
+	return ".share [--gist|--cloud] [--rows n] [--public]"
+}
+
+func (cmd ShareCmd) Handle(args []string, resultWriter io.Writer) error {
+	fs := flag.NewFlagSet(cmd.Name(), flag.ContinueOnError)
+	fs.SetOutput(resultWriter)
+	fs.Bool("gist", true, "Share as a GitHub gist (default)")
+	cloud := fs.Bool("cloud", false, "Share as a TiDB Cloud console link")
+	rows := fs.Int("rows", 0, "Number of rows of the last result to include")
+	public := fs.Bool("public", false, "Create a public gist instead of a secret one")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 || *rows < 0 {
+		return fmt.Errorf("usage: %s", cmd.Usage())
+	}
+	if *cloud {
+		return fmt.Errorf("the TiDB Cloud console has no API to create share links, use --gist")
+	}
+
+	stmt, err := lastStatement()
+	if err != nil {
+		return err
+	}
+	config, err := loadConfig(globalConfigFile)
+	if err != nil {
+		return fmt.Errorf("failed to read share config: %v", err)
+	}
+	token := withDefault(config.Share.GitHubToken, os.Getenv("GITHUB_TOKEN"))
+	if token == "" {
+		return fmt.Errorf("no GitHub token: set share.github_token in the config file or GITHUB_TOKEN, with the gist scope")
+	}
+
+	files := map[string]interface{}{"query.sql": map[string]string{"content": stmt + ";\n"}}
+	if *rows > 0 {
+		if len(lastResult) == 0 {
+			return fmt.Errorf("no result to include, run a query first")
+		}
+		files["result.md"] = map[string]string{"content": markdownTable(lastResult, *rows)}
+	}
+	var gist struct {
+		HTMLURL string `json:"html_url"`
+	}
+	err = postJSON(gistAPIURL, http.Header{
+		"Authorization":        {"Bearer " + token},
+		"Accept":               {"application/vnd.github+json"},
+		"X-Github-Api-Version": {"2022-11-28"},
+	}, map[string]interface{}{
+		"description": "Shared from tip",
+		"public":      *public,
+		"files":       files,
+	}, &gist)
+	if err != nil {
+		return fmt.Errorf("failed to create the gist: %v", err)
+	}
+	fmt.Fprintln(resultWriter, gist.HTMLURL)
+	return nil
+}
+
+// lastStatement returns the last SQL statement of the history, following .history run
+// entries to the statement they ran
+func lastStatement() (string, error) {
+	entries, err := historyEntries()
+	if err != nil {
+		return "", fmt.Errorf("failed to read history: %v", err)
+	}
+	for i := len(entries) - 1; i >= 0; i-- {
+		entry := entries[i]
+		if ref, ok := strings.CutPrefix(entry, ".history run "); ok {
+			n, err := strconv.Atoi(strings.TrimSpace(ref))
+			if err != nil || n < 1 || n > len(entries) {
+				continue
+			}
+			entry = entries[n-1]
+		}
+		if !strings.HasPrefix(entry, ".") && !historyRefRe.MatchString(entry) {
+			return strings.TrimSuffix(strings.TrimSpace(entry), ";"), nil
+		}
+	}
+	return "", fmt.Errorf("no statement to share, run one first")
+}
+
+// markdownTable renders up to limit rows as a Markdown table, noting the rows left out
+func markdownTable(rows []RowResult, limit int) string {
+	escape := func(s string) string {
+		return strings.ReplaceAll(strings.ReplaceAll(s, "|", `\|`), "\n", " ")
+	}
+	var sb strings.Builder
+	cols := rows[0].colNames
+	for _, col := range cols {
+		sb.WriteString("| " + escape(col) + " ")
+	}
+	sb.WriteString("|\n" + strings.Repeat("| --- ", len(cols)) + "|\n")
+	for i, row := range rows {
+		if i == limit {
+			fmt.Fprintf(&sb, "\n%d of %d rows\n", limit, len(rows))
+			break
+		}
+		for j := range row.colValues {
+			sb.WriteString("| " + escape(row.displayValue(j)) + " ")
+		}
+		sb.WriteString("|\n")
+	}
+	return sb.String()
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// shutdownTimeout bounds the time spent closing the session on a signal, a statement
+// still running holds the connection
+const shutdownTimeout = 3 * time.Second
+
+var shutdownOnce sync.Once
+
+// watchShutdownSignals shuts the REPL down cleanly when one of sigs is received, until
+// the returned function is called. The REPL watches SIGTERM and SIGHUP for the whole
+// session but SIGINT only at the prompt: there Ctrl+C is a key and SIGINT comes from
+// kill, elsewhere it interrupts .watch and the like.
+func watchShutdownSignals(sigs ...os.Signal) (stop func()) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, sigs...)
+	done := make(chan struct{})
+	go func() {
+		select {
+		case sig := <-ch:
+			shutdownOnce.Do(func() { shutdown(sig) })
+		case <-done:
+		}
+	}()
+	return func() {
+		signal.Stop(ch)
+		close(done)
+	}
+}
+
+// shutdown does what leaving the REPL does before exiting on sig: the history is saved
+// and the terminal restored, then the open transaction is rolled back, the materialized
+// tables dropped and the connection closed. Queued statements are listed as they are lost.
+func shutdown(sig os.Signal) {
+	debugLog.Info("shutting down", "signal", sig.String())
+	flushTelemetry()
+	if replLine != nil {
+		saveHistory()
+		replLine.Close()
+	}
+	fmt.Print("\033[?25h")
+	fmt.Printf("\nReceived %v, exiting\n", sig)
+
+	if len(queuedStatements) > 0 {
+		fmt.Printf("%d queued statements were not run:\n", len(queuedStatements))
+		for i, stmt := range queuedStatements {
+			fmt.Printf("%5d  %s\n", i+1, stmt)
+		}
+	}
+
+	if db := GetDB(); db != nil {
+		closed := make(chan struct{})
+		go func() {
+			defer close(closed)
+			if txnOpen {
+				if _, err := db.Exec("ROLLBACK"); err != nil {
+					fmt.Printf("Failed to roll back the open transaction: %v\n", err)
+				} else {
+					fmt.Println("Rolled back the open transaction.")
+				}
+			}
+			dropMaterializedTables()
+			db.Close()
+		}()
+		select {
+		case <-closed:
+		case <-time.After(shutdownTimeout):
+			fmt.Println("A statement is still running, the connection is dropped without cleaning up; the server rolls back an open transaction.")
+		}
+	}
+
+	code := 1
+	if s, ok := sig.(syscall.Signal); ok {
+		code = 128 + int(s)
+	}
+	os.Exit(code)
+}
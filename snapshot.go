@@ -0,0 +1,46 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// snapshotTSO is the TSO the session reads at while a consistent export runs or
+// .snapshot is on, 0 otherwise
+var snapshotTSO uint64
+
+// pinSnapshot makes the session read at the current TSO, so that every query of a
+// multi-table export sees the same point in time. The snapshot is remembered like a
+// SET statement and so survives a reconnect. It returns the TSO pinned.
+func pinSnapshot(db *sql.DB) (uint64, error) {
+	var tso uint64
+	if err := db.QueryRow("SELECT TIDB_CURRENT_TSO()").Scan(&tso); err != nil {
+		return 0, fmt.Errorf("failed to get the current TSO: %v", err)
+	}
+	return tso, pinSnapshotAt(db, tso)
+}
+
+// pinSnapshotAt makes the session read the data as it was at tso, see pinSnapshot
+func pinSnapshotAt(db *sql.DB, tso uint64) error {
+	assignment := fmt.Sprintf("@@SESSION.tidb_snapshot = '%d'", tso)
+	if _, err := db.Exec("SET " + assignment); err != nil {
+		return fmt.Errorf("failed to pin the snapshot: %v", err)
+	}
+	rememberSessionVar("tidb_snapshot", assignment)
+	snapshotTSO = tso
+	return nil
+}
+
+// tsoTime returns the wall clock time of the physical part of a TSO
+func tsoTime(tso uint64) time.Time {
+	return time.UnixMilli(int64(tso >> 18))
+}
+
+// unpinSnapshot makes the session read the latest data again
+func unpinSnapshot(db *sql.DB) error {
+	snapshotTSO = 0
+	rememberSessionVar("tidb_snapshot", "")
+	_, err := db.Exec("SET @@SESSION.tidb_snapshot = ''")
+	return err
+}
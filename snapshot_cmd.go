@@ -0,0 +1,84 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type SnapshotCmd struct{}
+
+func (cmd SnapshotCmd) Name() string {
+	return ".snapshot"
+}
+
+func (cmd SnapshotCmd) Description() string {
+	return "Read the data as it was at a point in time, until .snapshot off"
+}
+
+func (cmd SnapshotCmd) Usage() string {
+	return ".snapshot [<'yyyy-mm-dd hh:mm:ss'|-5m|tso>|off]"
+}
+
+func (cmd SnapshotCmd) Handle(args []string, resultWriter io.Writer) error {
+	if len(args) == 0 {
+		if snapshotTSO == 0 {
+			fmt.Fprintln(resultWriter, "Reading the latest data")
+		} else {
+			fmt.Fprintf(resultWriter, "Reading the data as of %s (TSO %d)\n", tsoTime(snapshotTSO).Format("2006-01-02 15:04:05"), snapshotTSO)
+		}
+		return nil
+	}
+	db, err := requireDB()
+	if err != nil {
+		return err
+	}
+	if len(args) == 1 && args[0] == "off" {
+		return unpinSnapshot(db)
+	}
+	if txnOpen {
+		return fmt.Errorf("can't read a snapshot inside a transaction, commit or roll back first")
+	}
+	tso, err := resolveSnapshotTSO(db, strings.Trim(strings.Join(args, " "), `'"`))
+	if err != nil {
+		return err
+	}
+	if err := pinSnapshotAt(db, tso); err != nil {
+		return err
+	}
+	fmt.Fprintf(resultWriter, "Reading the data as of %s (TSO %d), writes fail until .snapshot off\n",
+		tsoTime(tso).Format("2006-01-02 15:04:05"), tso)
+	return nil
+}
+
+// resolveSnapshotTSO returns the TSO of a point in time given as a TSO, a time relative
+// to now such as -5m or -1h30m, or a date and time in the session time zone. Times are
+// resolved with the clock of the server, which may not agree with the local one.
+func resolveSnapshotTSO(db *sql.DB, at string) (uint64, error) {
+	if tso, err := strconv.ParseUint(at, 10, 64); err == nil {
+		return tso, nil
+	}
+	if strings.HasPrefix(at, "-") {
+		ago, err := time.ParseDuration(at[1:])
+		if err != nil {
+			return 0, fmt.Errorf("invalid relative time %q, use e.g. -5m or -2h", at)
+		}
+		var now uint64
+		if err := db.QueryRow("SELECT TIDB_CURRENT_TSO()").Scan(&now); err != nil {
+			return 0, fmt.Errorf("failed to get the current TSO: %v", err)
+		}
+		return now - uint64(ago.Milliseconds())<<18, nil
+	}
+	var seconds sql.NullString
+	if err := db.QueryRow("SELECT UNIX_TIMESTAMP(?)", at).Scan(&seconds); err != nil {
+		return 0, err
+	}
+	secs, err := strconv.ParseFloat(seconds.String, 64)
+	if !seconds.Valid || err != nil || secs == 0 {
+		return 0, fmt.Errorf("invalid time %q, use e.g. '2024-01-02 15:04:05', -5m or a TSO", at)
+	}
+	return uint64(secs*1000) << 18, nil
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"runtime/debug"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type StatusCmd struct{}
+
+func (cmd StatusCmd) Name() string {
+	return ".status"
+}
+
+func (cmd StatusCmd) Description() string {
+	return "Show the server, connection and session settings in use"
+}
+
+func (cmd StatusCmd) Usage() string {
+	return ".status"
+}
+
+func (cmd StatusCmd) Handle(args []string, resultWriter io.Writer) error {
+	if len(args) != 0 {
+		return fmt.Errorf("usage: %s", cmd.Usage())
+	}
+	db, err := requireDB()
+	if err != nil {
+		return err
+	}
+
+	start := time.Now()
+	var connID int64
+	var user, currentUser string
+	var dbName sql.NullString
+	if err := db.QueryRow("SELECT CONNECTION_ID(), USER(), CURRENT_USER(), DATABASE()").Scan(&connID, &user, &currentUser, &dbName); err != nil {
+		return err
+	}
+	latency := time.Since(start)
+	var version, tidbVersion, charsetClient, charsetConn, collation, timeZone, systemTimeZone string
+	if err := db.QueryRow("SELECT VERSION(), tidb_version(), @@character_set_client, @@character_set_connection, "+
+		"@@collation_connection, @@time_zone, @@system_time_zone").Scan(
+		&version, &tidbVersion, &charsetClient, &charsetConn, &collation, &timeZone, &systemTimeZone); err != nil {
+		return err
+	}
+	var name, cipher, tlsVersion, uptime string
+	db.QueryRow("SHOW STATUS LIKE 'Ssl_cipher'").Scan(&name, &cipher)
+	db.QueryRow("SHOW STATUS LIKE 'Ssl_version'").Scan(&name, &tlsVersion)
+	db.QueryRow("SHOW GLOBAL STATUS LIKE 'Uptime'").Scan(&name, &uptime)
+	var serverPacket int64
+	db.QueryRow("SELECT @@max_allowed_packet").Scan(&serverPacket)
+
+	w := resultWriter
+	if info, ok := debug.ReadBuildInfo(); ok {
+		fmt.Fprintf(w, "tip version:     %s\n", info.Main.Version)
+	}
+	fmt.Fprintf(w, "Server:          %s\n", writeAddr)
+	if readAddr != "" {
+		fmt.Fprintf(w, "Read endpoint:   %s\n", readAddr)
+	}
+	fmt.Fprintf(w, "Connection id:   %d\n", connID)
+	fmt.Fprintf(w, "User:            %s", user)
+	if currentUser != user {
+		fmt.Fprintf(w, " (authenticated as %s)", currentUser)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "Database:        %s\n", withDefault(dbName.String, "(none)"))
+	if cipher != "" {
+		fmt.Fprintf(w, "TLS:             %s (%s)\n", tlsVersion, cipher)
+	} else {
+		fmt.Fprintf(w, "TLS:             disabled\n")
+	}
+	fmt.Fprintf(w, "Server version:  %s\n", version)
+	for _, line := range strings.Split(tidbVersion, "\n") {
+		if key, value, ok := strings.Cut(line, ":"); ok && (key == "Release Version" || key == "Edition") {
+			fmt.Fprintf(w, "%-17s%s\n", key+":", strings.TrimSpace(value))
+		}
+	}
+	if secs, err := strconv.ParseInt(uptime, 10, 64); err == nil {
+		fmt.Fprintf(w, "Uptime:          %s\n", time.Duration(secs)*time.Second)
+	}
+	fmt.Fprintf(w, "Character set:   client %s, connection %s (%s)\n", charsetClient, charsetConn, collation)
+	fmt.Fprintf(w, "Time zone:       %s (system %s)\n", timeZone, systemTimeZone)
+	if activeConnInfo != nil {
+		printDriverOptions(w, *activeConnInfo, serverPacket)
+	}
+	if txnOpen {
+		fmt.Fprintf(w, "Transaction:     open\n")
+	}
+	if snapshotTSO != 0 {
+		fmt.Fprintf(w, "Snapshot:        reading at TSO %d\n", snapshotTSO)
+	}
+	fmt.Fprintf(w, "Round trip:      %s\n", latency.Round(time.Microsecond))
+	return nil
+}
+
+// printDriverOptions shows the driver options of a connection and what they do: the
+// packet size bounds the statements tip sends, the timeouts those of every read and
+// write on the connection
+func printDriverOptions(w io.Writer, info ConnInfo, serverPacket int64) {
+	packet := int64(info.MaxAllowedPacket)
+	switch {
+	case packet == 0:
+		packet = driverMaxAllowedPacket
+	case packet < 0:
+		packet = serverPacket
+	}
+	fmt.Fprintf(w, "Max packet:      %s sent by tip, %s accepted by the server", formatBytes(packet), formatBytes(serverPacket))
+	if serverPacket > 0 && packet > serverPacket {
+		fmt.Fprint(w, ", larger statements fail")
+	}
+	fmt.Fprintln(w)
+	timeout := func(d time.Duration) string {
+		if d == 0 {
+			return "none"
+		}
+		return d.String()
+	}
+	fmt.Fprintf(w, "I/O timeouts:    read %s, write %s\n", timeout(info.ReadTimeout), timeout(info.WriteTimeout))
+	if info.InterpolateParams {
+		fmt.Fprintf(w, "Parameters:      interpolated by tip, one round trip per statement\n")
+	} else {
+		fmt.Fprintf(w, "Parameters:      prepared on the server\n")
+	}
+}
@@ -0,0 +1,365 @@
+package main
+
+import (
+	"bufio"
+	"database/sql"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// subsetInListSize is the number of keys per IN list when fetching related rows
+const subsetInListSize = 500
+
+type ExportSubsetCmd struct{}
+
+func (cmd ExportSubsetCmd) Name() string {
+	return ".export-subset"
+}
+
+func (cmd ExportSubsetCmd) Description() string {
+	return "Export rows of a table, and with --follow-fk the rows related to them by foreign keys, as INSERT statements"
+}
+
+func (cmd ExportSubsetCmd) Usage() string {
+	return ".export-subset <table> [file] [--follow-fk] [--consistent] [--where <condition>]"
+}
+
+func (cmd ExportSubsetCmd) Handle(args []string, resultWriter io.Writer) error {
+	if len(args) < 1 || strings.HasPrefix(args[0], "-") {
+		return fmt.Errorf("usage: %s", cmd.Usage())
+	}
+	root := args[0]
+	args = args[1:]
+	var file string
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		file = args[0]
+		args = args[1:]
+	}
+
+	// Like .dump, --where takes the rest of the line
+	where := "1"
+	for i, arg := range args {
+		if arg == "--where" || arg == "-where" {
+			where = strings.Join(args[i+1:], " ")
+			args = args[:i]
+			if where == "" {
+				return fmt.Errorf("usage: %s", cmd.Usage())
+			}
+			break
+		}
+	}
+
+	fs := flag.NewFlagSet(cmd.Name(), flag.ContinueOnError)
+	fs.SetOutput(resultWriter)
+	followFK := fs.Bool("follow-fk", false, "Also export the rows referencing the selected rows and the rows they reference")
+	consistent := fs.Bool("consistent", false, "Read all tables at a single point in time")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	db, err := requireDB()
+	if err != nil {
+		return err
+	}
+	if !strings.Contains(root, ".") {
+		var curDB sql.NullString
+		if err := db.QueryRow("SELECT DATABASE()").Scan(&curDB); err != nil {
+			return err
+		}
+		if !curDB.Valid {
+			return fmt.Errorf("no database selected, use <db>.<table>")
+		}
+		root = curDB.String + "." + root
+	}
+	root = strings.ToLower(strings.ReplaceAll(root, "`", ""))
+
+	var tso uint64
+	if *consistent {
+		if txnOpen {
+			return fmt.Errorf("--consistent can't be used inside a transaction")
+		}
+		if snapshotTSO != 0 {
+			return fmt.Errorf("--consistent can't be used while .snapshot is on, every query already reads at TSO %d", snapshotTSO)
+		}
+		if tso, err = pinSnapshot(db); err != nil {
+			return err
+		}
+		defer unpinSnapshot(db)
+	}
+
+	e := &subsetExporter{db: db, tables: map[string]*subsetTable{}}
+	if *followFK {
+		if e.edges, err = loadForeignKeys(db); err != nil {
+			return fmt.Errorf("failed to load foreign keys: %v", err)
+		}
+	}
+	if err := e.run(root, where); err != nil {
+		return err
+	}
+
+	var out io.Writer = resultWriter
+	if file != "" {
+		f, err := os.Create(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+	w := bufio.NewWriter(out)
+	fmt.Fprintf(w, "-- tip export-subset %s\n-- Exported at %s\n", Version, time.Now().Format("2006-01-02 15:04:05"))
+	fmt.Fprintf(w, "-- Rows of %s WHERE %s\n", root, where)
+	if tso != 0 {
+		fmt.Fprintf(w, "-- Consistent snapshot at TSO %d\n", tso)
+	}
+	fmt.Fprintf(w, "\n/*!40101 SET NAMES utf8mb4 */;\n/*!40014 SET FOREIGN_KEY_CHECKS=0 */;\n\n")
+	rootDB := root[:strings.Index(root, ".")]
+	var total int
+	for _, name := range e.order {
+		t := e.tables[name]
+		// Tables of the root's database are named without it, like in .dump
+		table := name
+		if strings.HasPrefix(name, rootDB+".") {
+			table = name[len(rootDB)+1:]
+		}
+		t.writeInserts(w, table)
+		total += len(t.rows)
+	}
+	fmt.Fprintf(w, "/*!40014 SET FOREIGN_KEY_CHECKS=1 */;\n")
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if file != "" {
+		resultWriter.Write([]byte(fmt.Sprintf("Exported %d rows of %d tables to %s.\n", total, len(e.order), file)))
+	}
+	return nil
+}
+
+// fkEdge is a foreign key from the child table to the parent table, named db.table in lower case
+type fkEdge struct {
+	child, parent         string
+	childCols, parentCols []string
+}
+
+// loadForeignKeys returns the foreign keys of all databases
+func loadForeignKeys(db *sql.DB) ([]fkEdge, error) {
+	rows, err := db.Query("SELECT TABLE_SCHEMA, TABLE_NAME, CONSTRAINT_NAME, COLUMN_NAME, " +
+		"REFERENCED_TABLE_SCHEMA, REFERENCED_TABLE_NAME, REFERENCED_COLUMN_NAME " +
+		"FROM INFORMATION_SCHEMA.KEY_COLUMN_USAGE WHERE REFERENCED_TABLE_NAME IS NOT NULL " +
+		"ORDER BY TABLE_SCHEMA, TABLE_NAME, CONSTRAINT_NAME, ORDINAL_POSITION")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var edges []fkEdge
+	var lastKey string
+	for rows.Next() {
+		var schema, table, constraint, col, refSchema, refTable, refCol string
+		if err := rows.Scan(&schema, &table, &constraint, &col, &refSchema, &refTable, &refCol); err != nil {
+			return nil, err
+		}
+		key := strings.ToLower(schema + "." + table + "." + constraint)
+		if key != lastKey {
+			edges = append(edges, fkEdge{
+				child:  strings.ToLower(schema + "." + table),
+				parent: strings.ToLower(refSchema + "." + refTable),
+			})
+			lastKey = key
+		}
+		edge := &edges[len(edges)-1]
+		edge.childCols = append(edge.childCols, col)
+		edge.parentCols = append(edge.parentCols, refCol)
+	}
+	return edges, rows.Err()
+}
+
+// subsetTable holds the rows of a table selected for the subset, as SQL literals
+type subsetTable struct {
+	cols    []string
+	numeric []bool
+	rows    [][]string
+	// down records for each selected row whether the rows referencing it were followed
+	down map[string]bool
+}
+
+// colIndex returns the position of a column, or -1
+func (t *subsetTable) colIndex(name string) int {
+	for i, col := range t.cols {
+		if strings.EqualFold(col, name) {
+			return i
+		}
+	}
+	return -1
+}
+
+func (t *subsetTable) writeInserts(w io.Writer, table string) {
+	if len(t.rows) == 0 {
+		return
+	}
+	cols := make([]string, len(t.cols))
+	for i, col := range t.cols {
+		cols[i] = quoteName(col)
+	}
+	prefix := fmt.Sprintf("INSERT INTO %s (%s) VALUES\n  ", quoteIdentifier(table), strings.Join(cols, ", "))
+	for i, row := range t.rows {
+		if i%dumpBatchSize == 0 {
+			if i > 0 {
+				io.WriteString(w, ";\n")
+			}
+			io.WriteString(w, prefix)
+		} else {
+			io.WriteString(w, ",\n  ")
+		}
+		io.WriteString(w, "("+strings.Join(row, ", ")+")")
+	}
+	io.WriteString(w, ";\n\n")
+}
+
+// subsetFetch is a pending query for rows of a table. Rows fetched going down, from a
+// referenced row to the rows referencing it, have their own referencing rows followed
+// too. Rows fetched going up only bring in the rows they reference, otherwise the
+// subset would grow to most of the database.
+type subsetFetch struct {
+	table string
+	where string
+	down  bool
+}
+
+// subsetExporter collects the rows of a referentially consistent subset
+type subsetExporter struct {
+	db     *sql.DB
+	edges  []fkEdge
+	tables map[string]*subsetTable
+	order  []string
+}
+
+func (e *subsetExporter) run(root, where string) error {
+	queue := []subsetFetch{{table: root, where: where, down: true}}
+	for len(queue) > 0 {
+		f := queue[0]
+		queue = queue[1:]
+		added, newlyDown, err := e.fetch(f)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %v", f.table, err)
+		}
+		t := e.tables[f.table]
+		for _, edge := range e.edges {
+			if edge.child == f.table && len(added) > 0 {
+				queue = append(queue, relatedFetches(t, added, edge.childCols, edge.parent, edge.parentCols, false)...)
+			}
+			if edge.parent == f.table && len(newlyDown) > 0 {
+				queue = append(queue, relatedFetches(t, newlyDown, edge.parentCols, edge.child, edge.childCols, true)...)
+			}
+		}
+	}
+	return nil
+}
+
+// fetch runs a pending query and returns the rows it added to the subset, and the
+// rows whose referencing rows are to be followed now
+func (e *subsetExporter) fetch(f subsetFetch) (added, newlyDown [][]string, err error) {
+	rows, err := e.db.Query("SELECT * FROM " + quoteIdentifier(f.table) + " WHERE " + f.where)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+
+	t, ok := e.tables[f.table]
+	if !ok {
+		colTypes, err := rows.ColumnTypes()
+		if err != nil {
+			return nil, nil, err
+		}
+		t = &subsetTable{down: map[string]bool{}}
+		for _, ct := range colTypes {
+			t.cols = append(t.cols, ct.Name())
+			t.numeric = append(t.numeric, isNumericType(ct.DatabaseTypeName()))
+		}
+		e.tables[f.table] = t
+		e.order = append(e.order, f.table)
+	}
+
+	values := make([]interface{}, len(t.cols))
+	valuePtrs := make([]interface{}, len(t.cols))
+	for i := range values {
+		valuePtrs[i] = &values[i]
+	}
+	for rows.Next() {
+		if err := rows.Scan(valuePtrs...); err != nil {
+			return nil, nil, err
+		}
+		row := rowLiterals(values, t.numeric)
+		key := strings.Join(row, ",")
+		down, seen := t.down[key]
+		if !seen {
+			t.rows = append(t.rows, row)
+			added = append(added, row)
+		}
+		if f.down && !down {
+			newlyDown = append(newlyDown, row)
+		}
+		if !seen || f.down {
+			t.down[key] = down || f.down
+		}
+	}
+	return added, newlyDown, rows.Err()
+}
+
+// relatedFetches returns the queries for the rows of target whose targetCols match
+// the cols of rows, in chunks of subsetInListSize keys. Keys with a NULL are skipped.
+func relatedFetches(t *subsetTable, rows [][]string, cols []string, target string, targetCols []string, down bool) []subsetFetch {
+	idx := make([]int, len(cols))
+	for i, col := range cols {
+		if idx[i] = t.colIndex(col); idx[i] < 0 {
+			return nil
+		}
+	}
+	quoted := make([]string, len(targetCols))
+	for i, col := range targetCols {
+		quoted[i] = quoteName(col)
+	}
+	lhs := strings.Join(quoted, ", ")
+	if len(quoted) > 1 {
+		lhs = "(" + lhs + ")"
+	}
+
+	var fetches []subsetFetch
+	var keys []string
+	seen := map[string]bool{}
+	flush := func() {
+		if len(keys) > 0 {
+			fetches = append(fetches, subsetFetch{table: target, where: lhs + " IN (" + strings.Join(keys, ", ") + ")", down: down})
+			keys = nil
+		}
+	}
+rowLoop:
+	for _, row := range rows {
+		parts := make([]string, len(idx))
+		for i, j := range idx {
+			if row[j] == "NULL" {
+				continue rowLoop
+			}
+			parts[i] = row[j]
+		}
+		key := strings.Join(parts, ", ")
+		if len(parts) > 1 {
+			key = "(" + key + ")"
+		}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		keys = append(keys, key)
+		if len(keys) == subsetInListSize {
+			flush()
+		}
+	}
+	flush()
+	return fetches
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// replOut and replErr are where results and messages are printed: the standard output
+// and error, copied to the tee file while there is one, see .tee
+var (
+	replOut io.Writer = os.Stdout
+	replErr io.Writer = os.Stderr
+)
+
+var (
+	teeFile      *os.File
+	teeLogOutput io.Writer // output of the log package before the tee file was opened
+)
+
+// terminalEscape matches the color and cursor sequences kept out of the tee file
+var terminalEscape = regexp.MustCompile(`\x1b\[[0-9;?]*[A-Za-z]`)
+
+// teeWriter writes to the tee file without terminal escape sequences
+type teeWriter struct {
+	f *os.File
+}
+
+func (tw teeWriter) Write(p []byte) (int, error) {
+	if _, err := tw.f.Write(terminalEscape.ReplaceAll(p, nil)); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// startTee appends the statements, results, errors and timings printed from now on to
+// the file at path, like the tee of the mysql client
+func startTee(path string) error {
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	stopTee()
+	teeFile = f
+	tw := teeWriter{f}
+	replOut = io.MultiWriter(os.Stdout, tw)
+	replErr = io.MultiWriter(os.Stderr, tw)
+	teeLogOutput = log.Writer()
+	log.SetOutput(io.MultiWriter(teeLogOutput, tw))
+	return nil
+}
+
+// stopTee closes the tee file, if there is one
+func stopTee() {
+	if teeFile == nil {
+		return
+	}
+	log.SetOutput(teeLogOutput)
+	replOut, replErr = os.Stdout, os.Stderr
+	teeFile.Close()
+	teeFile = nil
+}
+
+// teeOnly copies text shown on the terminal by other means than replOut to the tee file
+func teeOnly(text string) {
+	if teeFile != nil {
+		teeWriter{teeFile}.Write([]byte(text))
+	}
+}
+
+// teeInput records a statement or command typed after prompt, with its passwords masked
+func teeInput(prompt, input string) {
+	if teeFile == nil {
+		return
+	}
+	if !strings.HasPrefix(input, ".") {
+		input = loggableSQL(input)
+	} else if fields := strings.Fields(input); fields[0] == ".connect" {
+		// .connect <host> <port> <user> [password] [database] or .connect <url>
+		if len(fields) == 2 {
+			if u, err := url.Parse(fields[1]); err == nil {
+				fields[1] = u.Redacted()
+			}
+		}
+		if len(fields) > 4 && fields[4] != "-p" {
+			fields[4] = "********"
+		}
+		input = strings.Join(fields, " ")
+	}
+	teeOnly(prompt + input + "\n")
+}
+
+type TeeCmd struct{}
+
+func (cmd TeeCmd) Name() string {
+	return ".tee"
+}
+
+func (cmd TeeCmd) Description() string {
+	return "Copy the statements, results, errors and timings of the session to a file, until .notee"
+}
+
+func (cmd TeeCmd) Usage() string {
+	return ".tee [file]"
+}
+
+func (cmd TeeCmd) Handle(args []string, resultWriter io.Writer) error {
+	switch len(args) {
+	case 0:
+		if teeFile == nil {
+			fmt.Fprintln(resultWriter, "Not logging to a file")
+		} else {
+			fmt.Fprintf(resultWriter, "Logging to %s\n", teeFile.Name())
+		}
+		return nil
+	case 1:
+		if err := startTee(args[0]); err != nil {
+			return err
+		}
+		fmt.Fprintf(resultWriter, "Logging to %s\n", args[0])
+		return nil
+	default:
+		return fmt.Errorf("usage: %s", cmd.Usage())
+	}
+}
+
+type NoteeCmd struct{}
+
+func (cmd NoteeCmd) Name() string {
+	return ".notee"
+}
+
+func (cmd NoteeCmd) Description() string {
+	return "Stop copying the session to the file of .tee"
+}
+
+func (cmd NoteeCmd) Usage() string {
+	return ".notee"
+}
+
+func (cmd NoteeCmd) Handle(args []string, resultWriter io.Writer) error {
+	if len(args) != 0 {
+		return fmt.Errorf("usage: %s", cmd.Usage())
+	}
+	if teeFile == nil {
+		return fmt.Errorf("not logging to a file")
+	}
+	fmt.Fprintf(resultWriter, "Stopped logging to %s\n", teeFile.Name())
+	stopTee()
+	return nil
+}
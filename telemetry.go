@@ -0,0 +1,295 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// telemetryInterval is the time between two usage reports
+const telemetryInterval = 24 * time.Hour
+
+// telemetrySendTimeout is how long exiting waits for a report still being sent
+const telemetrySendTimeout = 2 * time.Second
+
+// telemetryReport is the payload sent to the telemetry endpoint, see the README. It
+// holds the names of commands and error classes with their counts, never SQL text,
+// arguments, names of databases or tables, or anything else typed in.
+type telemetryReport struct {
+	Schema    int              `json:"schema"`     // version of this payload, 1
+	InstallID string           `json:"install_id"` // random, drawn when telemetry is turned on
+	Version   string           `json:"version"`
+	OS        string           `json:"os"`
+	Arch      string           `json:"arch"`
+	Since     time.Time        `json:"since"`  // start of the period counted
+	Usage     map[string]int64 `json:"usage"`  // e.g. ".explain", "statement", "tip export"
+	Errors    map[string]int64 `json:"errors"` // e.g. "mysql-1146", "connection", "usage"
+}
+
+// telemetryState is what ~/.tip/telemetry.json keeps between runs
+type telemetryState struct {
+	Enabled   bool            `json:"enabled"`
+	InstallID string          `json:"install_id,omitempty"`
+	LastSent  time.Time       `json:"last_sent,omitempty"`
+	Pending   telemetryReport `json:"pending"`
+}
+
+// telemetry holds the counts of this run until they are added to the pending report
+var telemetry struct {
+	once    sync.Once
+	mu      sync.Mutex
+	enabled bool
+	usage   map[string]int64
+	errors  map[string]int64
+	sent    chan struct{} // closed once the report being sent is, nil if none is
+}
+
+func telemetryStatePath() string {
+	return filepath.Join(os.Getenv("HOME"), ".tip/telemetry.json")
+}
+
+func loadTelemetryState() telemetryState {
+	var state telemetryState
+	if data, err := os.ReadFile(telemetryStatePath()); err == nil {
+		json.Unmarshal(data, &state)
+	}
+	return state
+}
+
+func saveTelemetryState(state telemetryState) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	os.MkdirAll(filepath.Dir(telemetryStatePath()), 0700)
+	return os.WriteFile(telemetryStatePath(), data, 0600)
+}
+
+// telemetryEnabled reports whether the user opted in, nothing is counted otherwise
+func telemetryEnabled() bool {
+	telemetry.once.Do(func() {
+		telemetry.enabled = loadTelemetryState().Enabled
+	})
+	return telemetry.enabled
+}
+
+// countUsage counts a use of a feature, name is a fixed name such as the name of a command
+func countUsage(name string) {
+	if !telemetryEnabled() {
+		return
+	}
+	telemetry.mu.Lock()
+	defer telemetry.mu.Unlock()
+	if telemetry.usage == nil {
+		telemetry.usage = map[string]int64{}
+	}
+	telemetry.usage[name]++
+}
+
+// countError counts an error by its class, its message is not kept
+func countError(err error) {
+	if err == nil || !telemetryEnabled() {
+		return
+	}
+	telemetry.mu.Lock()
+	defer telemetry.mu.Unlock()
+	if telemetry.errors == nil {
+		telemetry.errors = map[string]int64{}
+	}
+	telemetry.errors[errorClass(err)]++
+}
+
+// errorClass names the kind of an error: the number of a server error, a lost
+// connection, a wrong command line or anything else
+func errorClass(err error) string {
+	var mysqlErr *mysql.MySQLError
+	switch {
+	case errors.As(err, &mysqlErr):
+		return fmt.Sprintf("mysql-%d", mysqlErr.Number)
+	case isConnectionLost(err):
+		return "connection"
+	case strings.HasPrefix(err.Error(), "usage:"):
+		return "usage"
+	default:
+		return "other"
+	}
+}
+
+// flushTelemetry adds the counts of this run to the pending report, and waits a little
+// for a report being sent
+func flushTelemetry() {
+	if !telemetryEnabled() {
+		return
+	}
+	if telemetry.sent != nil {
+		select {
+		case <-telemetry.sent:
+		case <-time.After(telemetrySendTimeout):
+		}
+	}
+	telemetry.mu.Lock()
+	usage, errs := telemetry.usage, telemetry.errors
+	telemetry.usage, telemetry.errors = nil, nil
+	telemetry.mu.Unlock()
+	if len(usage) == 0 && len(errs) == 0 {
+		return
+	}
+
+	state := loadTelemetryState()
+	if !state.Enabled {
+		return
+	}
+	pending := &state.Pending
+	if pending.Usage == nil {
+		pending.Usage = map[string]int64{}
+	}
+	if pending.Errors == nil {
+		pending.Errors = map[string]int64{}
+	}
+	if pending.Since.IsZero() {
+		pending.Since = time.Now().UTC().Truncate(time.Hour)
+	}
+	for name, n := range usage {
+		pending.Usage[name] += n
+	}
+	for class, n := range errs {
+		pending.Errors[class] += n
+	}
+	if err := saveTelemetryState(state); err != nil {
+		debugLog.Debug("failed to save telemetry", "error", err)
+	}
+}
+
+// telemetryEndpoint returns the URL reports are posted to, from the [telemetry] section
+// of the configuration file. Without one the counts stay in the pending report.
+func telemetryEndpoint() string {
+	config, err := loadConfig(globalConfigFile)
+	if err != nil {
+		return ""
+	}
+	return config.Telemetry.Endpoint
+}
+
+// sendTelemetryIfDue posts the pending report in the background once a day. The report
+// is cleared before it is sent, a report that fails to go out is dropped rather than
+// sent twice.
+func sendTelemetryIfDue() {
+	if !telemetryEnabled() {
+		return
+	}
+	endpoint := telemetryEndpoint()
+	state := loadTelemetryState()
+	if endpoint == "" || !state.Enabled || len(state.Pending.Usage) == 0 || time.Since(state.LastSent) < telemetryInterval {
+		return
+	}
+	report := completeReport(state)
+	state.Pending, state.LastSent = telemetryReport{}, time.Now()
+	if err := saveTelemetryState(state); err != nil {
+		return
+	}
+	telemetry.sent = make(chan struct{})
+	go func() {
+		defer close(telemetry.sent)
+		resp, err := postRequest(endpoint, nil, report)
+		if err != nil {
+			debugLog.Debug("failed to send telemetry", "error", err)
+			return
+		}
+		resp.Body.Close()
+	}()
+}
+
+// completeReport fills in the fields of the pending report that describe this installation
+func completeReport(state telemetryState) telemetryReport {
+	report := state.Pending
+	report.Schema = 1
+	report.InstallID = state.InstallID
+	report.Version = Version
+	report.OS = runtime.GOOS
+	report.Arch = runtime.GOARCH
+	return report
+}
+
+type TelemetryCmd struct{}
+
+func (cmd TelemetryCmd) Name() string {
+	return ".telemetry"
+}
+
+func (cmd TelemetryCmd) Description() string {
+	return "Show or change whether anonymous usage counts are reported, it is off unless turned on"
+}
+
+func (cmd TelemetryCmd) Usage() string {
+	return ".telemetry [status|on|off]"
+}
+
+func (cmd TelemetryCmd) Handle(args []string, resultWriter io.Writer) error {
+	if len(args) > 1 {
+		return fmt.Errorf("usage: %s", cmd.Usage())
+	}
+	action := "status"
+	if len(args) == 1 {
+		action = args[0]
+	}
+	state := loadTelemetryState()
+	switch action {
+	case "status":
+		if !state.Enabled {
+			fmt.Fprintln(resultWriter, "Telemetry is off, nothing is counted or sent. Use .telemetry on to help prioritize the development of tip.")
+			return nil
+		}
+		// Counts of this session not flushed yet are shown too
+		flushTelemetry()
+		state = loadTelemetryState()
+		if endpoint := telemetryEndpoint(); endpoint != "" {
+			fmt.Fprintf(resultWriter, "Telemetry is on, reports are sent to %s once a day.\n", endpoint)
+		} else {
+			fmt.Fprintln(resultWriter, "Telemetry is on, reports are kept until an endpoint is set in the [telemetry] section of the configuration file.")
+		}
+		data, err := json.MarshalIndent(completeReport(state), "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(resultWriter, "Next report:\n%s\n", data)
+	case "on":
+		if !state.Enabled {
+			id := make([]byte, 16)
+			if _, err := rand.Read(id); err != nil {
+				return err
+			}
+			state = telemetryState{Enabled: true, InstallID: hex.EncodeToString(id)}
+			if err := saveTelemetryState(state); err != nil {
+				return err
+			}
+		}
+		telemetry.once.Do(func() {})
+		telemetry.enabled = true
+		fmt.Fprintln(resultWriter, "Telemetry is on: the names of the commands used and the classes of errors met are counted, never SQL text or arguments. .telemetry status shows the next report.")
+	case "off":
+		// The install id goes too, turning telemetry on again starts afresh
+		if err := saveTelemetryState(telemetryState{}); err != nil {
+			return err
+		}
+		telemetry.once.Do(func() {})
+		telemetry.mu.Lock()
+		telemetry.enabled = false
+		telemetry.usage, telemetry.errors = nil, nil
+		telemetry.mu.Unlock()
+		fmt.Fprintln(resultWriter, "Telemetry is off, the counts not sent yet were deleted.")
+	default:
+		return fmt.Errorf("usage: %s", cmd.Usage())
+	}
+	return nil
+}
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"strings"
+
 	"github.com/pingcap/tidb/pkg/parser"
 	"github.com/pingcap/tidb/pkg/parser/ast"
 	_ "github.com/pingcap/tidb/pkg/parser/test_driver"
@@ -44,3 +46,94 @@ func isQuery(stmt string) (bool, error) {
 	}
 	return true, nil
 }
+
+// isDDL reports whether any of the statements changes the schema
+func isDDL(stmt string) bool {
+	stmtNodes, _, err := p.Parse(stmt, "", "")
+	if err != nil {
+		return false
+	}
+	for _, stmt := range stmtNodes {
+		if _, ok := stmt.(ast.DDLNode); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// isReadOnly reports whether the statements only read data, so that they can be
+// sent to a read endpoint or safely run again. Unlike isQuery, which takes unknown
+// statements for queries, it only accepts the statements isReadOnlyStmt knows of.
+func isReadOnly(stmt string) bool {
+	stmtNodes, _, err := p.Parse(stmt, "", "")
+	if err != nil || len(stmtNodes) == 0 {
+		return false
+	}
+	for _, stmt := range stmtNodes {
+		if !isReadOnlyStmt(stmt) {
+			return false
+		}
+	}
+	return true
+}
+
+// isReadOnlyStmt reports whether a statement is one of those known to only read:
+// SELECT without a locking clause or INTO, UNION and the other set operations of
+// such SELECTs, SHOW, and EXPLAIN without ANALYZE, which doesn't run the statement.
+// Everything else counts as a write.
+func isReadOnlyStmt(stmt ast.Node) bool {
+	switch stmt := stmt.(type) {
+	case *ast.SelectStmt:
+		return (stmt.LockInfo == nil || stmt.LockInfo.LockType == ast.SelectLockNone) && stmt.SelectIntoOpt == nil
+	case *ast.SetOprStmt:
+		return stmt.SelectList != nil && isReadOnlyStmt(stmt.SelectList)
+	case *ast.SetOprSelectList:
+		for _, sel := range stmt.Selects {
+			if !isReadOnlyStmt(sel) {
+				return false
+			}
+		}
+		return true
+	case *ast.ShowStmt:
+		return true
+	case *ast.ExplainStmt:
+		return !stmt.Analyze
+	default:
+		return false
+	}
+}
+
+// isSessionSetting reports whether stmt is a USE or a SET of session or user variables,
+// which only change the state of the session it runs in
+func isSessionSetting(stmt string) bool {
+	stmtNodes, _, err := p.Parse(stmt, "", "")
+	if err != nil || len(stmtNodes) != 1 {
+		return false
+	}
+	switch stmt := stmtNodes[0].(type) {
+	case *ast.UseStmt:
+		return true
+	case *ast.SetStmt:
+		for _, v := range stmt.Variables {
+			if v.IsGlobal {
+				return false
+			}
+		}
+		return true
+	default:
+		return false
+	}
+}
+
+// splitStatements splits sql into its statements
+func splitStatements(sql string) ([]string, error) {
+	stmtNodes, _, err := p.Parse(sql, "", "")
+	if err != nil {
+		return nil, err
+	}
+	stmts := make([]string, len(stmtNodes))
+	for i, stmt := range stmtNodes {
+		stmts[i] = strings.TrimSpace(stmt.Text())
+	}
+	return stmts, nil
+}
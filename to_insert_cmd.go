@@ -0,0 +1,105 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+)
+
+type ToInsertCmd struct{}
+
+func (cmd ToInsertCmd) Name() string {
+	return ".to-insert"
+}
+
+func (cmd ToInsertCmd) Description() string {
+	return "Convert the last result set into multi-row INSERT statements, optionally executing them against a profile"
+}
+
+func (cmd ToInsertCmd) Usage() string {
+	return ".to-insert <target_table> [--batch 500] [--profile name]"
+}
+
+func (cmd ToInsertCmd) Handle(args []string, resultWriter io.Writer) error {
+	if len(args) < 1 || strings.HasPrefix(args[0], "-") {
+		return fmt.Errorf("usage: %s", cmd.Usage())
+	}
+	target := args[0]
+
+	fs := flag.NewFlagSet(cmd.Name(), flag.ContinueOnError)
+	fs.SetOutput(resultWriter)
+	batch := fs.Int("batch", 500, "Number of rows per INSERT statement")
+	profile := fs.String("profile", "", "Execute the statements against this profile instead of printing them")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	if *batch <= 0 {
+		return fmt.Errorf("batch size must be positive")
+	}
+
+	if len(lastResult) == 0 {
+		return fmt.Errorf("no result set to convert, run a query first")
+	}
+	stmts := buildInsertStatements(target, lastResult, *batch)
+
+	if *profile == "" {
+		for _, stmt := range stmts {
+			resultWriter.Write([]byte(stmt + ";\n"))
+		}
+		return nil
+	}
+
+	config, err := loadProfile(globalConfigFile, *profile)
+	if err != nil {
+		return err
+	}
+	db, err := openDatabase(connInfoFromConfig(config))
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var total int64
+	for i, stmt := range stmts {
+		result, err := db.Exec(stmt)
+		if err != nil {
+			return fmt.Errorf("failed to execute batch %d/%d: %v", i+1, len(stmts), err)
+		}
+		affected, _ := result.RowsAffected()
+		total += affected
+	}
+	resultWriter.Write([]byte(fmt.Sprintf("Inserted %d rows into %s on profile %s in %d statements.\n", total, target, *profile, len(stmts))))
+	return nil
+}
+
+// buildInsertStatements turns rows into INSERT statements of at most batchSize rows each
+func buildInsertStatements(table string, rows []RowResult, batchSize int) []string {
+	cols := make([]string, len(rows[0].colNames))
+	for i, col := range rows[0].colNames {
+		cols[i] = quoteName(col)
+	}
+	prefix := fmt.Sprintf("INSERT INTO %s (%s) VALUES ", quoteIdentifier(table), strings.Join(cols, ", "))
+
+	var stmts []string
+	for start := 0; start < len(rows); start += batchSize {
+		end := start + batchSize
+		if end > len(rows) {
+			end = len(rows)
+		}
+		var sb strings.Builder
+		sb.WriteString(prefix)
+		for i, row := range rows[start:end] {
+			if i > 0 {
+				sb.WriteString(",\n  ")
+			}
+			values := make([]string, len(row.colValues))
+			for j, val := range row.colValues {
+				values[j] = formatSQLValue(val)
+			}
+			sb.WriteString("(" + strings.Join(values, ", ") + ")")
+		}
+		stmts = append(stmts, sb.String())
+	}
+	return stmts
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"database/sql"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// sparkBars draw the latency trend of a digest, from the fastest window to the slowest
+var sparkBars = []rune("▁▂▃▄▅▆▇█")
+
+// topTrendWindows is the number of summary windows the trend of .top covers
+const topTrendWindows = 12
+
+// topQueryWidth is the length the statements listed by .top are cut to
+const topQueryWidth = 60
+
+// topOrders are the orders .top ranks digests in, by the SQL expression of each
+var topOrders = map[string]string{
+	"latency": "SUM(SUM_LATENCY)",
+	"calls":   "SUM(EXEC_COUNT)",
+	"mem":     "MAX(MAX_MEM)",
+}
+
+type TopCmd struct{}
+
+func (cmd TopCmd) Name() string {
+	return ".top"
+}
+
+func (cmd TopCmd) Description() string {
+	return "Show the heaviest statement digests of the cluster with the trend of their latency"
+}
+
+func (cmd TopCmd) Usage() string {
+	return ".top [by latency|calls|mem] [--limit n]"
+}
+
+func (cmd TopCmd) Handle(args []string, resultWriter io.Writer) error {
+	by := "latency"
+	if len(args) >= 2 && args[0] == "by" {
+		by, args = args[1], args[2:]
+	}
+	order, ok := topOrders[by]
+	if !ok {
+		return fmt.Errorf("usage: %s", cmd.Usage())
+	}
+	fs := flag.NewFlagSet(cmd.Name(), flag.ContinueOnError)
+	fs.SetOutput(resultWriter)
+	limit := fs.Int("limit", 10, "Number of digests to show")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 || *limit < 1 {
+		return fmt.Errorf("usage: %s", cmd.Usage())
+	}
+	db, err := requireDB()
+	if err != nil {
+		return err
+	}
+	startTime := time.Now()
+
+	rows, err := db.Query("SELECT DIGEST, IFNULL(MAX(SCHEMA_NAME), ''), MAX(DIGEST_TEXT), SUM(EXEC_COUNT), SUM(SUM_LATENCY), "+
+		"MAX(MAX_LATENCY), MAX(MAX_MEM) FROM INFORMATION_SCHEMA.CLUSTER_STATEMENTS_SUMMARY "+
+		"WHERE DIGEST IS NOT NULL AND DIGEST != '' GROUP BY DIGEST ORDER BY "+order+" DESC LIMIT ?", *limit)
+	if err != nil {
+		return fmt.Errorf("failed to read the statements summary: %v", err)
+	}
+	defer rows.Close()
+
+	cols := []string{"Digest", "Schema", "Calls", "Total", "Avg", "Max", "Max mem", "Trend", "Statement"}
+	var output []RowResult
+	var digests []string
+	for rows.Next() {
+		var digest, schema, text string
+		var calls, total, maxLatency, maxMem int64
+		if err := rows.Scan(&digest, &schema, &text, &calls, &total, &maxLatency, &maxMem); err != nil {
+			return fmt.Errorf("failed to read the statements summary: %v", err)
+		}
+		text = strings.Join(strings.Fields(text), " ")
+		if len(text) > topQueryWidth {
+			text = text[:topQueryWidth-3] + "..."
+		}
+		var avg time.Duration
+		if calls > 0 {
+			avg = time.Duration(total / calls)
+		}
+		digests = append(digests, digest)
+		output = append(output, RowResult{colNames: cols, colValues: []interface{}{
+			digest[:min(len(digest), 12)], schema, calls,
+			time.Duration(total).Round(time.Millisecond).String(), avg.Round(time.Microsecond).String(),
+			time.Duration(maxLatency).Round(time.Microsecond).String(), formatBytes(maxMem), "", text,
+		}})
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read the statements summary: %v", err)
+	}
+	if len(output) == 0 {
+		fmt.Fprintln(resultWriter, "No statements in the statements summary")
+		return nil
+	}
+
+	for i, digest := range digests {
+		trend, err := latencyTrend(db, digest)
+		if err != nil {
+			return err
+		}
+		output[i].colValues[7] = sparkline(trend)
+	}
+	printResults(true, output, *globalOutputFormat, true, time.Since(startTime), 0)
+	fmt.Fprintf(resultWriter, "Trend: average latency of the last %d summary windows, oldest first; .latency <digest> shows it by hour\n", topTrendWindows)
+	return nil
+}
+
+// latencyTrend returns the average latency of a digest in the last summary windows, oldest first
+func latencyTrend(db *sql.DB, digest string) ([]float64, error) {
+	rows, err := db.Query("SELECT SUM(SUM_LATENCY) / SUM(EXEC_COUNT) FROM ("+
+		"SELECT SUMMARY_BEGIN_TIME, SUM_LATENCY, EXEC_COUNT FROM INFORMATION_SCHEMA.CLUSTER_STATEMENTS_SUMMARY_HISTORY WHERE DIGEST = ? UNION ALL "+
+		"SELECT SUMMARY_BEGIN_TIME, SUM_LATENCY, EXEC_COUNT FROM INFORMATION_SCHEMA.CLUSTER_STATEMENTS_SUMMARY WHERE DIGEST = ?"+
+		") s GROUP BY SUMMARY_BEGIN_TIME ORDER BY SUMMARY_BEGIN_TIME DESC LIMIT ?", digest, digest, topTrendWindows)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the statements summary history: %v", err)
+	}
+	defer rows.Close()
+	var trend []float64
+	for rows.Next() {
+		var ns sql.NullFloat64
+		if err := rows.Scan(&ns); err != nil {
+			return nil, fmt.Errorf("failed to read the statements summary history: %v", err)
+		}
+		trend = append([]float64{ns.Float64}, trend...)
+	}
+	return trend, rows.Err()
+}
+
+// sparkline draws values as bars scaled between the smallest and the largest
+func sparkline(values []float64) string {
+	if len(values) == 0 {
+		return ""
+	}
+	lo, hi := values[0], values[0]
+	for _, v := range values {
+		lo, hi = min(lo, v), max(hi, v)
+	}
+	var sb strings.Builder
+	for _, v := range values {
+		i := 0
+		if hi > lo {
+			i = min(int((v-lo)/(hi-lo)*float64(len(sparkBars))), len(sparkBars)-1)
+		}
+		sb.WriteRune(sparkBars[i])
+	}
+	return sb.String()
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// txnOpen is set while the session is inside a transaction started with BEGIN or
+// START TRANSACTION, as seen in the statements run through the REPL
+var txnOpen bool
+
+// inTransaction reports whether the session behind db has an open transaction.
+// TiDB exposes the start ts of the current transaction, which is 0 outside of one.
+func inTransaction(db *sql.DB) bool {
+	var ts uint64
+	if err := db.QueryRow("SELECT @@tidb_current_ts").Scan(&ts); err != nil {
+		return false
+	}
+	return ts != 0
+}
+
+func warnIfInTransaction(db *sql.DB, resultWriter io.Writer) {
+	if inTransaction(db) {
+		resultWriter.Write([]byte("Warning: a transaction is in progress, the change takes effect from the next transaction\n"))
+	}
+}
+
+// runTxnStatement runs BEGIN, COMMIT or ROLLBACK on the current connection, tracking the transaction state
+func runTxnStatement(stmt string, done string, resultWriter io.Writer) error {
+	db, err := requireDB()
+	if err != nil {
+		return err
+	}
+	if _, _, _, _, err := executeSQL(db, stmt, nil); err != nil {
+		return err
+	}
+	resultWriter.Write([]byte(done + "\n"))
+	return nil
+}
+
+type BeginCmd struct{}
+
+func (cmd BeginCmd) Name() string {
+	return ".begin"
+}
+
+func (cmd BeginCmd) Description() string {
+	return "Start a transaction, the prompt shows a * until it ends"
+}
+
+func (cmd BeginCmd) Usage() string {
+	return ".begin"
+}
+
+func (cmd BeginCmd) Handle(args []string, resultWriter io.Writer) error {
+	if len(args) != 0 {
+		return fmt.Errorf("usage: %s", cmd.Usage())
+	}
+	if txnOpen {
+		resultWriter.Write([]byte("Warning: BEGIN commits the transaction in progress\n"))
+	}
+	return runTxnStatement("BEGIN", "Transaction started.", resultWriter)
+}
+
+type CommitCmd struct{}
+
+func (cmd CommitCmd) Name() string {
+	return ".commit"
+}
+
+func (cmd CommitCmd) Description() string {
+	return "Commit the current transaction"
+}
+
+func (cmd CommitCmd) Usage() string {
+	return ".commit"
+}
+
+func (cmd CommitCmd) Handle(args []string, resultWriter io.Writer) error {
+	if len(args) != 0 {
+		return fmt.Errorf("usage: %s", cmd.Usage())
+	}
+	return runTxnStatement("COMMIT", "Committed.", resultWriter)
+}
+
+type RollbackCmd struct{}
+
+func (cmd RollbackCmd) Name() string {
+	return ".rollback"
+}
+
+func (cmd RollbackCmd) Description() string {
+	return "Roll back the current transaction"
+}
+
+func (cmd RollbackCmd) Usage() string {
+	return ".rollback"
+}
+
+func (cmd RollbackCmd) Handle(args []string, resultWriter io.Writer) error {
+	if len(args) != 0 {
+		return fmt.Errorf("usage: %s", cmd.Usage())
+	}
+	return runTxnStatement("ROLLBACK", "Rolled back.", resultWriter)
+}
+
+type TxnModeCmd struct{}
+
+func (cmd TxnModeCmd) Name() string {
+	return ".txn-mode"
+}
+
+func (cmd TxnModeCmd) Description() string {
+	return "Set or display the transaction mode (optimistic or pessimistic)"
+}
+
+func (cmd TxnModeCmd) Usage() string {
+	return ".txn-mode [optimistic|pessimistic]"
+}
+
+func (cmd TxnModeCmd) Handle(args []string, resultWriter io.Writer) error {
+	db, err := requireDB()
+	if err != nil {
+		return err
+	}
+
+	if len(args) == 0 {
+		mode, err := getTxnMode(db)
+		if err != nil {
+			return err
+		}
+		resultWriter.Write([]byte(fmt.Sprintf("Transaction mode: %s\n", mode)))
+		return nil
+	}
+
+	if len(args) != 1 {
+		return fmt.Errorf("usage: %s", cmd.Usage())
+	}
+	mode := strings.ToLower(args[0])
+	if mode != "optimistic" && mode != "pessimistic" {
+		return fmt.Errorf("invalid transaction mode: %s", args[0])
+	}
+
+	warnIfInTransaction(db, resultWriter)
+	if _, err := db.Exec("SET SESSION tidb_txn_mode = ?", mode); err != nil {
+		return fmt.Errorf("failed to set transaction mode: %v", err)
+	}
+	rememberSessionVar("tidb_txn_mode", "@@SESSION.tidb_txn_mode="+quoteSQLString(mode))
+	resultWriter.Write([]byte(fmt.Sprintf("Transaction mode set to: %s\n", mode)))
+	return nil
+}
+
+// getTxnMode returns the session transaction mode, an empty tidb_txn_mode means optimistic
+func getTxnMode(db *sql.DB) (string, error) {
+	var mode string
+	if err := db.QueryRow("SELECT @@tidb_txn_mode").Scan(&mode); err != nil {
+		return "", fmt.Errorf("failed to get transaction mode: %v", err)
+	}
+	if mode == "" {
+		mode = "optimistic"
+	}
+	return mode, nil
+}
+
+type IsolationCmd struct{}
+
+func (cmd IsolationCmd) Name() string {
+	return ".isolation"
+}
+
+func (cmd IsolationCmd) Description() string {
+	return "Set or display the transaction isolation level"
+}
+
+func (cmd IsolationCmd) Usage() string {
+	return ".isolation [read-committed|repeatable-read|read-uncommitted|serializable] (read-uncommitted and serializable need tidb_skip_isolation_level_check=1)"
+}
+
+func (cmd IsolationCmd) Handle(args []string, resultWriter io.Writer) error {
+	db, err := requireDB()
+	if err != nil {
+		return err
+	}
+
+	if len(args) == 0 {
+		level, err := getIsolationLevel(db)
+		if err != nil {
+			return err
+		}
+		resultWriter.Write([]byte(fmt.Sprintf("Isolation level: %s\n", level)))
+		return nil
+	}
+
+	level, err := parseIsolationLevel(strings.Join(args, " "))
+	if err != nil {
+		return err
+	}
+
+	warnIfInTransaction(db, resultWriter)
+	if _, err := db.Exec("SET SESSION transaction_isolation = ?", level); err != nil {
+		if level == "READ-UNCOMMITTED" || level == "SERIALIZABLE" {
+			return fmt.Errorf("failed to set isolation level: %v (TiDB accepts %s only after SET tidb_skip_isolation_level_check = 1, without implementing it)", err, level)
+		}
+		return fmt.Errorf("failed to set isolation level: %v", err)
+	}
+	rememberSessionVar("transaction_isolation", "@@SESSION.transaction_isolation="+quoteSQLString(level))
+	resultWriter.Write([]byte(fmt.Sprintf("Isolation level set to: %s\n", level)))
+	return nil
+}
+
+func getIsolationLevel(db *sql.DB) (string, error) {
+	var level string
+	if err := db.QueryRow("SELECT @@transaction_isolation").Scan(&level); err != nil {
+		return "", fmt.Errorf("failed to get isolation level: %v", err)
+	}
+	return level, nil
+}
+
+// parseIsolationLevel accepts the common spellings of an isolation level
+// ("read committed", "READ_COMMITTED", "rc", ...) and returns the canonical one
+func parseIsolationLevel(s string) (string, error) {
+	normalized := strings.ToUpper(strings.TrimSpace(s))
+	normalized = strings.NewReplacer(" ", "-", "_", "-").Replace(normalized)
+	switch normalized {
+	case "RC", "READ-COMMITTED":
+		return "READ-COMMITTED", nil
+	case "RR", "REPEATABLE-READ":
+		return "REPEATABLE-READ", nil
+	case "RU", "READ-UNCOMMITTED":
+		return "READ-UNCOMMITTED", nil
+	case "SERIALIZABLE":
+		return "SERIALIZABLE", nil
+	default:
+		return "", fmt.Errorf("invalid isolation level: %s", s)
+	}
+}
+
+// confirmExitInTransaction warns that leaving the REPL rolls back the open
+// transaction and, on a terminal, asks whether to exit anyway
+func confirmExitInTransaction(line *lineEditor) bool {
+	fmt.Println("Warning: a transaction is open, its changes are rolled back on exit. Use .commit to keep them.")
+	if !isTerminal() {
+		return true
+	}
+	answer, err := line.Prompt("Exit anyway? [y/N] ")
+	return err != nil || strings.EqualFold(strings.TrimSpace(answer), "y")
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// tidbVersionRe finds the TiDB release in VERSION(), e.g. 8.0.11-TiDB-v7.5.1
+var tidbVersionRe = regexp.MustCompile(`v?(\d+)\.(\d+)\.(\d+)`)
+
+// releaseVersion is a TiDB release as major, minor and patch numbers
+type releaseVersion [3]int
+
+func parseReleaseVersion(s string) (releaseVersion, error) {
+	m := tidbVersionRe.FindStringSubmatch(s)
+	if m == nil {
+		return releaseVersion{}, fmt.Errorf("invalid version: %s", s)
+	}
+	var v releaseVersion
+	for i := range v {
+		v[i], _ = strconv.Atoi(m[i+1])
+	}
+	return v, nil
+}
+
+func (v releaseVersion) less(o releaseVersion) bool {
+	for i := range v {
+		if v[i] != o[i] {
+			return v[i] < o[i]
+		}
+	}
+	return false
+}
+
+func (v releaseVersion) String() string {
+	return fmt.Sprintf("v%d.%d.%d", v[0], v[1], v[2])
+}
+
+// upgradeRule is a change of a TiDB release that can break a cluster upgraded past it.
+// check returns what it finds on the cluster, nothing when the change doesn't affect it.
+type upgradeRule struct {
+	since    string
+	severity string
+	check    func(db *sql.DB) ([]string, error)
+}
+
+// upgradeRules are checked when the upgrade crosses their release, the ones without a
+// release on every upgrade. New releases are added here.
+var upgradeRules = []upgradeRule{
+	{since: "", severity: "blocker", check: checkRunningDDL},
+	{since: "", severity: "warning", check: checkStatsVersion1},
+	{since: "v6.2.0", severity: "info", check: checkGlobalVar("tidb_enable_change_multi_schema", func(string) bool { return true },
+		"tidb_enable_change_multi_schema is deprecated: multi-schema changes are always allowed, remove it from scripts and configuration")},
+	{since: "v6.3.0", severity: "warning", check: checkGlobalVar("tidb_partition_prune_mode", func(v string) bool { return strings.EqualFold(v, "static") },
+		"tidb_partition_prune_mode is static: dynamic pruning is the default of new clusters from v6.3.0, plan to switch and re-analyze partitioned tables")},
+	{since: "v7.4.0", severity: "info", check: func(*sql.DB) ([]string, error) {
+		return []string{"TiDB reports itself as MySQL 8.0.11 instead of 5.7.25: check clients and tools that look at the server version"}, nil
+	}},
+	{since: "v7.4.0", severity: "warning", check: checkRemovedSQLModes},
+	{since: "v7.5.0", severity: "warning", check: checkGlobalVar("tidb_enable_fast_analyze", isOn,
+		"tidb_enable_fast_analyze is ON: Fast Analyze is deprecated, turn it off and use regular ANALYZE")},
+	{since: "v7.5.0", severity: "warning", check: checkGlobalVar("log_bin", isOn,
+		"TiDB Binlog is enabled: it is deprecated, plan the move to TiCDC")},
+	{since: "v8.4.0", severity: "blocker", check: checkGlobalVar("log_bin", isOn,
+		"TiDB Binlog is enabled: it is removed, replicate with TiCDC before upgrading")},
+}
+
+type UpgradeCheckCmd struct{}
+
+func (cmd UpgradeCheckCmd) Name() string {
+	return ".upgrade-check"
+}
+
+func (cmd UpgradeCheckCmd) Description() string {
+	return "Check the cluster for deprecated settings, removed features and pending work before upgrading to a TiDB release"
+}
+
+func (cmd UpgradeCheckCmd) Usage() string {
+	return ".upgrade-check <target-version>"
+}
+
+func (cmd UpgradeCheckCmd) Handle(args []string, resultWriter io.Writer) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: %s", cmd.Usage())
+	}
+	target, err := parseReleaseVersion(args[0])
+	if err != nil {
+		return err
+	}
+	db, err := requireDB()
+	if err != nil {
+		return err
+	}
+	var version string
+	if err := db.QueryRow("SELECT VERSION()").Scan(&version); err != nil {
+		return err
+	}
+	if !strings.Contains(version, "TiDB") {
+		return fmt.Errorf("%s is not a TiDB server", version)
+	}
+	current, err := parseReleaseVersion(version[strings.Index(version, "TiDB"):])
+	if err != nil {
+		return err
+	}
+	if !current.less(target) {
+		return fmt.Errorf("the cluster already runs %s", current)
+	}
+	startTime := time.Now()
+
+	cols := []string{"Severity", "Since", "Finding"}
+	var output []RowResult
+	for _, rule := range upgradeRules {
+		if rule.since != "" {
+			since, _ := parseReleaseVersion(rule.since)
+			// Only changes of the releases the upgrade goes through matter
+			if !current.less(since) || target.less(since) {
+				continue
+			}
+		}
+		findings, err := rule.check(db)
+		if err != nil {
+			findings = []string{fmt.Sprintf("could not be checked: %v", err)}
+		}
+		for _, finding := range findings {
+			output = append(output, RowResult{colNames: cols, colValues: []interface{}{rule.severity, rule.since, finding}})
+		}
+	}
+
+	fmt.Fprintf(resultWriter, "Upgrade from %s to %s\n", current, target)
+	if len(output) == 0 {
+		fmt.Fprintln(resultWriter, "Nothing found.")
+		return nil
+	}
+	printResults(true, output, *globalOutputFormat, true, time.Since(startTime), 0)
+	return nil
+}
+
+func isOn(v string) bool {
+	return strings.EqualFold(v, "ON") || v == "1"
+}
+
+// checkGlobalVar reports finding when the global variable exists and bad holds for its value
+func checkGlobalVar(name string, bad func(string) bool, finding string) func(*sql.DB) ([]string, error) {
+	return func(db *sql.DB) ([]string, error) {
+		var varName, value string
+		err := db.QueryRow("SHOW GLOBAL VARIABLES LIKE ?", name).Scan(&varName, &value)
+		if err == sql.ErrNoRows || (err == nil && !bad(value)) {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		return []string{finding}, nil
+	}
+}
+
+// checkRunningDDL reports DDL jobs that haven't finished, which an upgrade has to wait for
+func checkRunningDDL(db *sql.DB) ([]string, error) {
+	var n int
+	if err := db.QueryRow("SELECT COUNT(*) FROM INFORMATION_SCHEMA.DDL_JOBS " +
+		"WHERE STATE NOT IN ('done', 'synced', 'cancelled', 'rollback done')").Scan(&n); err != nil {
+		return nil, err
+	}
+	if n == 0 {
+		return nil, nil
+	}
+	return []string{fmt.Sprintf("%d DDL jobs are still running or queued: wait for them or cancel them before upgrading (ADMIN SHOW DDL JOBS)", n)}, nil
+}
+
+// checkStatsVersion1 reports tables whose statistics were collected with version 1
+func checkStatsVersion1(db *sql.DB) ([]string, error) {
+	var n int
+	if err := db.QueryRow("SELECT COUNT(DISTINCT table_id) FROM mysql.stats_histograms WHERE stats_ver = 1").Scan(&n); err != nil {
+		return nil, err
+	}
+	if n == 0 {
+		return nil, nil
+	}
+	return []string{fmt.Sprintf("%d tables have version 1 statistics: re-analyze them with tidb_analyze_version = 2, which newer releases are tuned for", n)}, nil
+}
+
+// checkRemovedSQLModes reports modes of the global sql_mode that MySQL 8.0 removed
+func checkRemovedSQLModes(db *sql.DB) ([]string, error) {
+	var mode string
+	if err := db.QueryRow("SELECT @@GLOBAL.sql_mode").Scan(&mode); err != nil {
+		return nil, err
+	}
+	removed := map[string]bool{"NO_AUTO_CREATE_USER": true, "NO_FIELD_OPTIONS": true, "NO_KEY_OPTIONS": true,
+		"NO_TABLE_OPTIONS": true, "DB2": true, "MAXDB": true, "MSSQL": true, "MYSQL323": true, "MYSQL40": true,
+		"ORACLE": true, "POSTGRESQL": true}
+	var found []string
+	for _, m := range strings.Split(mode, ",") {
+		if removed[strings.ToUpper(strings.TrimSpace(m))] {
+			found = append(found, m)
+		}
+	}
+	if len(found) == 0 {
+		return nil, nil
+	}
+	return []string{fmt.Sprintf("sql_mode has %s, removed in MySQL 8.0: clients that copy the mode to MySQL 8.0 compatible servers fail", strings.Join(found, ", "))}, nil
+}
@@ -2,14 +2,17 @@ package main
 
 import (
 	"database/sql"
+	"strings"
 
 	_ "github.com/go-sql-driver/mysql"
 )
 
 var (
-	cachedDBNames     []string
-	cachedTableNames  = make(map[string][]string)
-	cachedColumnNames = make(map[string][]string)
+	cachedDBNames          []string
+	cachedTableNames       = make(map[string][]string)
+	cachedColumnNames      = make(map[string][]string)
+	cachedTableColumnNames = make(map[string][]string)
+	cachedSessionVarNames  []string
 )
 
 var KEYWORDS = []string{
@@ -20,6 +23,15 @@ var KEYWORDS = []string{
 	"UPDATE", "SET", "WHERE", "ON", "AND", "OR", "XOR", "NOT", "EXISTS",
 }
 
+// invalidateCompletionCache drops all cached names, they are reloaded on next use
+func invalidateCompletionCache() {
+	cachedDBNames = nil
+	cachedTableNames = make(map[string][]string)
+	cachedColumnNames = make(map[string][]string)
+	cachedTableColumnNames = make(map[string][]string)
+	cachedSessionVarNames = nil
+}
+
 // Get databases and tables
 func getDatabases(db *sql.DB) ([]string, error) {
 	if len(cachedDBNames) > 0 {
@@ -42,11 +54,28 @@ func getDatabases(db *sql.DB) ([]string, error) {
 	return databases, nil
 }
 
+// getTableNames returns the tables, views and sequences of a database, with the
+// temporary tables of the session, which come and go and so are not cached
 func getTableNames(db *sql.DB, dbName string) ([]string, error) {
+	tables, err := getCachedTableNames(db, dbName)
+	if err != nil {
+		return nil, err
+	}
+	if temp := sessionTempTableNames(dbName); len(temp) > 0 {
+		tables = append(append([]string{}, tables...), temp...)
+	}
+	return tables, nil
+}
+
+func getCachedTableNames(db *sql.DB, dbName string) ([]string, error) {
 	if cachedTableNames[dbName] != nil {
 		return cachedTableNames[dbName], nil
 	}
-	rows, err := db.Query("SHOW TABLES")
+	query := "SHOW TABLES"
+	if dbName != "" && dbName != "(none)" {
+		query += " FROM " + quoteName(dbName)
+	}
+	rows, err := db.Query(query)
 	if err != nil {
 		return nil, err
 	}
@@ -83,3 +112,50 @@ func getAllColumnNames(db *sql.DB, dbName string) ([]string, error) {
 	cachedColumnNames[dbName] = columnNames
 	return columnNames, nil
 }
+
+// getTableColumnNames returns the columns of a single table, table may be qualified with a database
+func getTableColumnNames(db *sql.DB, dbName string, table string) ([]string, error) {
+	if dot := strings.LastIndex(table, "."); dot >= 0 {
+		dbName, table = table[:dot], table[dot+1:]
+	}
+	key := dbName + "." + table
+	if cachedTableColumnNames[key] != nil {
+		return cachedTableColumnNames[key], nil
+	}
+	rows, err := db.Query("SELECT COLUMN_NAME FROM INFORMATION_SCHEMA.COLUMNS WHERE TABLE_SCHEMA = ? AND TABLE_NAME = ? ORDER BY ORDINAL_POSITION", dbName, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var columnNames []string
+	for rows.Next() {
+		var columnName string
+		if err := rows.Scan(&columnName); err == nil {
+			columnNames = append(columnNames, columnName)
+		}
+	}
+	cachedTableColumnNames[key] = columnNames
+	return columnNames, nil
+}
+
+func getSessionVariableNames(db *sql.DB) ([]string, error) {
+	if len(cachedSessionVarNames) > 0 {
+		return cachedSessionVarNames, nil
+	}
+	rows, err := db.Query("SHOW SESSION VARIABLES")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var name, value string
+		if err := rows.Scan(&name, &value); err == nil {
+			names = append(names, name)
+		}
+	}
+	cachedSessionVarNames = names
+	return names, nil
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type WatchCmd struct{}
+
+func (cmd WatchCmd) Name() string {
+	return ".watch"
+}
+
+func (cmd WatchCmd) Description() string {
+	return "Re-run a query at an interval, showing the change of numeric columns (Ctrl+C to stop)"
+}
+
+func (cmd WatchCmd) Usage() string {
+	return ".watch <seconds> <sql>"
+}
+
+func (cmd WatchCmd) Handle(args []string, resultWriter io.Writer) error {
+	if len(args) < 2 {
+		return fmt.Errorf("usage: %s", cmd.Usage())
+	}
+	interval, err := parseInterval(args[0])
+	if err != nil {
+		return err
+	}
+	db, err := requireDB()
+	if err != nil {
+		return err
+	}
+	return watchQuery(db, strings.Join(args[1:], " "), interval, *globalOutputFormat)
+}
+
+// parseInterval accepts a number of seconds ("5", "0.5") or a duration ("1m")
+func parseInterval(s string) (time.Duration, error) {
+	var interval time.Duration
+	if secs, err := strconv.ParseFloat(s, 64); err == nil {
+		interval = time.Duration(secs * float64(time.Second))
+	} else if d, err := time.ParseDuration(s); err == nil {
+		interval = d
+	}
+	if interval <= 0 {
+		return 0, fmt.Errorf("invalid interval: %s", s)
+	}
+	return interval, nil
+}
+
+// watchQuery runs query every interval until interrupted, clearing the screen
+// before each run and adding a delta column after each numeric column
+func watchQuery(db *sql.DB, query string, interval time.Duration, format OutputFormat) error {
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	// Every run replaces the screen, waiting for a key to page would stop the refresh
+	defer func(enabled bool) { pagerEnabled = enabled }(pagerEnabled)
+	pagerEnabled = false
+
+	var prev []RowResult
+	for {
+		startTime := time.Now()
+		isQ, output, hasRows, affectedRows, err := executeSQL(db, query, nil)
+
+		fmt.Print("\033[H\033[2J")
+		fmt.Printf("Every %s: %s    %s\n\n", interval, query, startTime.Format("2006-01-02 15:04:05"))
+		if err != nil {
+			fmt.Println(err)
+		} else {
+			rows := output
+			if isQ && prev != nil {
+				rows = addDeltaColumns(output, prev)
+			}
+			printResults(isQ, rows, format, hasRows, time.Since(startTime), affectedRows)
+			prev = output
+		}
+
+		select {
+		case <-interrupt:
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// addDeltaColumns returns rows with a Δ column after each numeric column
+// holding the change since prev. Rows are matched on their non-numeric
+// columns, or on their position when those don't identify a row.
+func addDeltaColumns(cur, prev []RowResult) []RowResult {
+	if len(cur) == 0 {
+		return cur
+	}
+	cols := cur[0].colNames
+	numeric := make([]bool, len(cols))
+	for i := range cols {
+		numeric[i] = true
+		for _, row := range cur {
+			if _, ok := numericValue(row.colValues[i]); !ok && row.colValues[i] != nil {
+				numeric[i] = false
+				break
+			}
+		}
+	}
+
+	rowKey := func(row RowResult) string {
+		var parts []string
+		for i, val := range row.colValues {
+			if !numeric[i] {
+				parts = append(parts, formatValue(val))
+			}
+		}
+		return strings.Join(parts, "\x00")
+	}
+	prevByKey := make(map[string]RowResult)
+	for _, row := range prev {
+		prevByKey[rowKey(row)] = row
+	}
+	byPosition := len(prevByKey) != len(prev) || len(prevByKey) == 1
+
+	var newCols []string
+	for i, col := range cols {
+		newCols = append(newCols, col)
+		if numeric[i] {
+			newCols = append(newCols, "Δ"+col)
+		}
+	}
+
+	result := make([]RowResult, len(cur))
+	for r, row := range cur {
+		var before *RowResult
+		if byPosition {
+			if r < len(prev) {
+				before = &prev[r]
+			}
+		} else if p, ok := prevByKey[rowKey(row)]; ok {
+			before = &p
+		}
+
+		values := make([]interface{}, 0, len(newCols))
+		for i, val := range row.colValues {
+			values = append(values, val)
+			if !numeric[i] {
+				continue
+			}
+			delta := ""
+			if before != nil && i < len(before.colValues) {
+				now, ok1 := numericValue(val)
+				then, ok2 := numericValue(before.colValues[i])
+				if ok1 && ok2 {
+					delta = strconv.FormatFloat(now-then, 'f', -1, 64)
+					if now-then > 0 {
+						delta = "+" + delta
+					}
+				}
+			}
+			values = append(values, delta)
+		}
+		result[r] = RowResult{colNames: newCols, colValues: values}
+	}
+	return result
+}
+
+func numericValue(val interface{}) (float64, bool) {
+	if val == nil {
+		return 0, false
+	}
+	f, err := strconv.ParseFloat(formatValue(val), 64)
+	return f, err == nil
+}
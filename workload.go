@@ -0,0 +1,526 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// workloadPreset is a transaction mix of sysbench's OLTP tests, run against tables
+// sbtest1..N laid out as sysbench lays them out
+type workloadPreset struct {
+	name        string
+	description string
+	transaction bool // the statements run within BEGIN and COMMIT
+
+	pointSelects    int
+	simpleRanges    int
+	sumRanges       int
+	orderRanges     int
+	distinctRanges  int
+	indexUpdates    int
+	nonIndexUpdates int
+	deleteInserts   int
+	inserts         int
+}
+
+var workloadPresets = []workloadPreset{
+	{name: "oltp_read_write", description: "10 point selects, 4 range queries, 2 updates, a delete and an insert in a transaction",
+		transaction: true, pointSelects: 10, simpleRanges: 1, sumRanges: 1, orderRanges: 1, distinctRanges: 1,
+		indexUpdates: 1, nonIndexUpdates: 1, deleteInserts: 1},
+	{name: "oltp_read_only", description: "10 point selects and 4 range queries in a transaction",
+		transaction: true, pointSelects: 10, simpleRanges: 1, sumRanges: 1, orderRanges: 1, distinctRanges: 1},
+	{name: "oltp_write_only", description: "2 updates, a delete and an insert in a transaction",
+		transaction: true, indexUpdates: 1, nonIndexUpdates: 1, deleteInserts: 1},
+	{name: "oltp_point_select", description: "a select by primary key", pointSelects: 1},
+	{name: "oltp_update_index", description: "an update of an indexed column by primary key", indexUpdates: 1},
+	{name: "oltp_update_non_index", description: "an update of a column without index by primary key", nonIndexUpdates: 1},
+	{name: "oltp_insert", description: "an insert with an auto-increment id", inserts: 1},
+}
+
+func findWorkloadPreset(name string) *workloadPreset {
+	for i := range workloadPresets {
+		if workloadPresets[i].name == name {
+			return &workloadPresets[i]
+		}
+	}
+	return nil
+}
+
+// workloadStatements are the statements of the presets, %d is the number of the table
+var workloadStatements = map[string]string{
+	"point_select":     "SELECT c FROM sbtest%d WHERE id = ?",
+	"simple_range":     "SELECT c FROM sbtest%d WHERE id BETWEEN ? AND ?",
+	"sum_range":        "SELECT SUM(k) FROM sbtest%d WHERE id BETWEEN ? AND ?",
+	"order_range":      "SELECT c FROM sbtest%d WHERE id BETWEEN ? AND ? ORDER BY c",
+	"distinct_range":   "SELECT DISTINCT c FROM sbtest%d WHERE id BETWEEN ? AND ? ORDER BY c",
+	"index_update":     "UPDATE sbtest%d SET k = k + 1 WHERE id = ?",
+	"non_index_update": "UPDATE sbtest%d SET c = ? WHERE id = ?",
+	"delete":           "DELETE FROM sbtest%d WHERE id = ?",
+	"insert":           "INSERT INTO sbtest%d (id, k, c, pad) VALUES (?, ?, ?, ?)",
+	"insert_auto":      "INSERT INTO sbtest%d (k, c, pad) VALUES (?, ?, ?)",
+}
+
+// workloadPrepareBatch is the number of rows of an INSERT loading a table
+const workloadPrepareBatch = 1000
+
+// workloadConfig holds the flags of tip workload
+type workloadConfig struct {
+	tables    int
+	rows      int
+	threads   int
+	rangeSize int
+}
+
+func workloadUsage() {
+	fmt.Fprintln(os.Stderr, "usage: tip workload prepare|run|cleanup <preset> [-tables 10] [-rows 10000] [-threads 8] [-duration 1m]\n\nPresets:")
+	for _, preset := range workloadPresets {
+		fmt.Fprintf(os.Stderr, "  %-22s %s\n", preset.name, preset.description)
+	}
+}
+
+func runWorkload(args []string) int {
+	if len(args) < 2 || strings.HasPrefix(args[1], "-") {
+		workloadUsage()
+		return 2
+	}
+	action := args[0]
+	preset := findWorkloadPreset(args[1])
+	if preset == nil || (action != "prepare" && action != "run" && action != "cleanup") {
+		workloadUsage()
+		return 2
+	}
+	fs := flag.NewFlagSet("tip workload", flag.ExitOnError)
+	cf := registerConnFlags(fs)
+	var cfg workloadConfig
+	fs.IntVar(&cfg.tables, "tables", 10, "Number of tables, sbtest1 to sbtestN")
+	fs.IntVar(&cfg.rows, "rows", 10000, "Number of rows of each table")
+	fs.IntVar(&cfg.threads, "threads", 8, "Number of connections running transactions, or loading tables with prepare")
+	fs.IntVar(&cfg.rangeSize, "range-size", 100, "Number of rows read by the range queries")
+	duration := fs.Duration("duration", time.Minute, "How long to run the workload")
+	reportInterval := fs.Duration("report-interval", 10*time.Second, "Print the throughput and latency every interval while running, 0 to not")
+	if err := cf.parse(fs, args[2:]); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	if cfg.tables < 1 || cfg.rows < 1 || cfg.threads < 1 || cfg.rangeSize < 1 || *duration <= 0 {
+		workloadUsage()
+		return 2
+	}
+	info, err := cf.connInfo()
+	if err != nil {
+		log.Println(err)
+		return 1
+	}
+	if info.Database == "" {
+		log.Println("The workload tables need a database, choose one with -d or in the connection string")
+		return 2
+	}
+	db, err := openDatabase(info)
+	if err != nil {
+		log.Println(err)
+		return 1
+	}
+	defer db.Close()
+	db.SetMaxOpenConns(cfg.threads)
+	db.SetMaxIdleConns(cfg.threads)
+
+	switch action {
+	case "prepare":
+		err = prepareWorkload(db, cfg)
+	case "cleanup":
+		err = cleanupWorkload(db, cfg)
+	case "run":
+		var existing int
+		existing, err = countWorkloadTables(db, cfg.tables)
+		if err == nil && existing < cfg.tables {
+			log.Printf("Found %d of the %d tables, preparing them first", existing, cfg.tables)
+			err = prepareWorkload(db, cfg)
+		}
+		if err == nil {
+			return runWorkloadPreset(db, *preset, cfg, *duration, *reportInterval)
+		}
+	}
+	if err != nil {
+		log.Println(err)
+		return 1
+	}
+	return 0
+}
+
+// countWorkloadTables returns how many of the tables sbtest1..n exist in the current database
+func countWorkloadTables(db *sql.DB, n int) (int, error) {
+	rows, err := db.Query("SELECT TABLE_NAME FROM information_schema.TABLES WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME LIKE 'sbtest%'")
+	if err != nil {
+		return 0, fmt.Errorf("failed to list tables: %w", err)
+	}
+	defer rows.Close()
+	existing := map[string]bool{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return 0, err
+		}
+		existing[name] = true
+	}
+	count := 0
+	for i := 1; i <= n; i++ {
+		if existing[fmt.Sprintf("sbtest%d", i)] {
+			count++
+		}
+	}
+	return count, rows.Err()
+}
+
+// prepareWorkload creates and loads the tables that don't exist yet, on up to threads
+// connections. The index on k is created after the rows are loaded, as sysbench does.
+func prepareWorkload(db *sql.DB, cfg workloadConfig) error {
+	start := time.Now()
+	tables := make(chan int, cfg.tables)
+	for i := 1; i <= cfg.tables; i++ {
+		tables <- i
+	}
+	close(tables)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	var firstErr error
+	for t := 0; t < min(cfg.threads, cfg.tables); t++ {
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+			rng := rand.New(rand.NewSource(seed))
+			for table := range tables {
+				if err := prepareWorkloadTable(db, table, cfg.rows, rng); err != nil {
+					mu.Lock()
+					if firstErr == nil {
+						firstErr = err
+					}
+					mu.Unlock()
+					return
+				}
+			}
+		}(time.Now().UnixNano() + int64(t))
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return firstErr
+	}
+	log.Printf("Prepared %d tables of %d rows in %s", cfg.tables, cfg.rows, time.Since(start).Round(time.Millisecond))
+	return nil
+}
+
+func prepareWorkloadTable(db *sql.DB, table, rows int, rng *rand.Rand) error {
+	var exists int
+	err := db.QueryRow("SELECT COUNT(*) FROM information_schema.TABLES WHERE TABLE_SCHEMA = DATABASE() AND TABLE_NAME = ?",
+		fmt.Sprintf("sbtest%d", table)).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("failed to look for sbtest%d: %w", table, err)
+	}
+	if exists > 0 {
+		log.Printf("sbtest%d exists, skipped", table)
+		return nil
+	}
+	create := fmt.Sprintf(`CREATE TABLE sbtest%d (
+  id INT NOT NULL AUTO_INCREMENT,
+  k INT NOT NULL DEFAULT 0,
+  c CHAR(120) NOT NULL DEFAULT '',
+  pad CHAR(60) NOT NULL DEFAULT '',
+  PRIMARY KEY (id)
+)`, table)
+	if _, err := db.Exec(create); err != nil {
+		return fmt.Errorf("failed to create sbtest%d: %w", table, err)
+	}
+	var sb strings.Builder
+	for first := 1; first <= rows; first += workloadPrepareBatch {
+		sb.Reset()
+		fmt.Fprintf(&sb, "INSERT INTO sbtest%d (id, k, c, pad) VALUES ", table)
+		for id := first; id < first+workloadPrepareBatch && id <= rows; id++ {
+			if id > first {
+				sb.WriteByte(',')
+			}
+			fmt.Fprintf(&sb, "(%d,%d,'%s','%s')", id, rng.Intn(rows)+1, workloadString(rng, 10), workloadString(rng, 5))
+		}
+		if _, err := db.Exec(sb.String()); err != nil {
+			return fmt.Errorf("failed to load sbtest%d: %w", table, err)
+		}
+	}
+	if _, err := db.Exec(fmt.Sprintf("CREATE INDEX k_%d ON sbtest%d (k)", table, table)); err != nil {
+		return fmt.Errorf("failed to index sbtest%d: %w", table, err)
+	}
+	log.Printf("Loaded %d rows into sbtest%d", rows, table)
+	return nil
+}
+
+// workloadString returns groups of 11 random digits separated by dashes, the values of
+// the c and pad columns
+func workloadString(rng *rand.Rand, groups int) string {
+	b := make([]byte, 0, groups*12)
+	for g := 0; g < groups; g++ {
+		if g > 0 {
+			b = append(b, '-')
+		}
+		for i := 0; i < 11; i++ {
+			b = append(b, byte('0'+rng.Intn(10)))
+		}
+	}
+	return string(b)
+}
+
+func cleanupWorkload(db *sql.DB, cfg workloadConfig) error {
+	for i := 1; i <= cfg.tables; i++ {
+		if _, err := db.Exec(fmt.Sprintf("DROP TABLE IF EXISTS sbtest%d", i)); err != nil {
+			return fmt.Errorf("failed to drop sbtest%d: %w", i, err)
+		}
+	}
+	log.Printf("Dropped %d tables", cfg.tables)
+	return nil
+}
+
+// workloadClient runs the transactions of a preset on one connection, with the
+// statements prepared on it as they are first needed
+type workloadClient struct {
+	conn    *sql.Conn
+	preset  workloadPreset
+	cfg     workloadConfig
+	rng     *rand.Rand
+	stmts   map[string]*sql.Stmt
+	queries *atomic.Int64
+}
+
+func (c *workloadClient) stmt(ctx context.Context, kind string, table int) (*sql.Stmt, error) {
+	key := fmt.Sprintf("%s/%d", kind, table)
+	if stmt, ok := c.stmts[key]; ok {
+		return stmt, nil
+	}
+	stmt, err := c.conn.PrepareContext(ctx, fmt.Sprintf(workloadStatements[kind], table))
+	if err != nil {
+		return nil, err
+	}
+	c.stmts[key] = stmt
+	return stmt, nil
+}
+
+// exec runs a prepared statement, reading the rows of a query
+func (c *workloadClient) exec(ctx context.Context, kind string, table int, args ...interface{}) error {
+	stmt, err := c.stmt(ctx, kind, table)
+	if err != nil {
+		return err
+	}
+	rows, err := stmt.QueryContext(ctx, args...)
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	c.queries.Add(1)
+	return nil
+}
+
+// transaction runs one transaction of the preset on a random table, rolled back if a
+// statement fails
+func (c *workloadClient) transaction(ctx context.Context) error {
+	table := c.rng.Intn(c.cfg.tables) + 1
+	if c.preset.transaction {
+		if _, err := c.conn.ExecContext(ctx, "BEGIN"); err != nil {
+			return err
+		}
+		c.queries.Add(1)
+	}
+	if err := c.statements(ctx, table); err != nil {
+		if c.preset.transaction {
+			c.conn.ExecContext(context.Background(), "ROLLBACK")
+		}
+		return err
+	}
+	if c.preset.transaction {
+		if _, err := c.conn.ExecContext(ctx, "COMMIT"); err != nil {
+			return err
+		}
+		c.queries.Add(1)
+	}
+	return nil
+}
+
+func (c *workloadClient) statements(ctx context.Context, table int) error {
+	p, rng, rows := c.preset, c.rng, c.cfg.rows
+	id := func() int { return rng.Intn(rows) + 1 }
+	ranges := []struct {
+		kind  string
+		count int
+	}{
+		{"simple_range", p.simpleRanges}, {"sum_range", p.sumRanges},
+		{"order_range", p.orderRanges}, {"distinct_range", p.distinctRanges},
+	}
+	for i := 0; i < p.pointSelects; i++ {
+		if err := c.exec(ctx, "point_select", table, id()); err != nil {
+			return err
+		}
+	}
+	for _, r := range ranges {
+		for i := 0; i < r.count; i++ {
+			first := rng.Intn(max(rows-c.cfg.rangeSize, 0)+1) + 1
+			if err := c.exec(ctx, r.kind, table, first, first+c.cfg.rangeSize-1); err != nil {
+				return err
+			}
+		}
+	}
+	for i := 0; i < p.indexUpdates; i++ {
+		if err := c.exec(ctx, "index_update", table, id()); err != nil {
+			return err
+		}
+	}
+	for i := 0; i < p.nonIndexUpdates; i++ {
+		if err := c.exec(ctx, "non_index_update", table, workloadString(rng, 10), id()); err != nil {
+			return err
+		}
+	}
+	for i := 0; i < p.deleteInserts; i++ {
+		deleted := id()
+		if err := c.exec(ctx, "delete", table, deleted); err != nil {
+			return err
+		}
+		if err := c.exec(ctx, "insert", table, deleted, id(), workloadString(rng, 10), workloadString(rng, 5)); err != nil {
+			return err
+		}
+	}
+	for i := 0; i < p.inserts; i++ {
+		if err := c.exec(ctx, "insert_auto", table, id(), workloadString(rng, 10), workloadString(rng, 5)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runWorkloadPreset runs the transactions of preset on cfg.threads connections for
+// duration, then prints the TPS, QPS and the latency percentiles of the transactions
+func runWorkloadPreset(db *sql.DB, preset workloadPreset, cfg workloadConfig, duration, reportInterval time.Duration) int {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	conns := make([]*sql.Conn, cfg.threads)
+	for i := range conns {
+		var err error
+		if conns[i], err = db.Conn(ctx); err != nil {
+			log.Println("Failed to open connections:", err)
+			return 1
+		}
+		defer conns[i].Close()
+	}
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	defer signal.Stop(interrupt)
+
+	log.Printf("Running %s for %s on %d threads", preset.name, duration, cfg.threads)
+	var done, failed, queries atomic.Int64
+	workers := make([]*benchWorker, cfg.threads)
+	var wg sync.WaitGroup
+	for i, conn := range conns {
+		w := &benchWorker{errors: map[string]int{}}
+		workers[i] = w
+		client := &workloadClient{conn: conn, preset: preset, cfg: cfg, stmts: map[string]*sql.Stmt{}, queries: &queries,
+			rng: rand.New(rand.NewSource(time.Now().UnixNano() + int64(i)))}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ctx.Err() == nil {
+				start := time.Now()
+				err := client.transaction(ctx)
+				if errors.Is(err, context.Canceled) || ctx.Err() != nil {
+					continue
+				}
+				if err != nil {
+					w.errors[workloadErrorKey(err)]++
+					failed.Add(1)
+					continue
+				}
+				w.latencies = append(w.latencies, time.Since(start))
+				done.Add(1)
+			}
+		}()
+	}
+
+	startTime := time.Now()
+	var ticks <-chan time.Time
+	if reportInterval > 0 {
+		ticker := time.NewTicker(reportInterval)
+		defer ticker.Stop()
+		ticks = ticker.C
+	}
+	timer := time.NewTimer(duration)
+	var lastDone, lastFailed, lastQueries int64
+	lastTick := startTime
+wait:
+	for {
+		select {
+		case <-timer.C:
+			break wait
+		case <-interrupt:
+			log.Println("Interrupted")
+			break wait
+		case now := <-ticks:
+			d, f, q := done.Load(), failed.Load(), queries.Load()
+			secs := now.Sub(lastTick).Seconds()
+			fmt.Fprintf(os.Stderr, "[%4.0fs] tps %.1f, qps %.1f, errors %d\n", now.Sub(startTime).Seconds(),
+				float64(d-lastDone)/secs, float64(q-lastQueries)/secs, f-lastFailed)
+			lastDone, lastFailed, lastQueries, lastTick = d, f, q, now
+		}
+	}
+	elapsed := time.Since(startTime)
+	cancel()
+	wg.Wait()
+
+	run := summarizeBench(workers, elapsed, cfg.threads)
+	printWorkloadRun(os.Stdout, preset, cfg, run, queries.Load())
+	if run.Failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// workloadErrorKey groups errors that differ only by the keys, ids or timestamps in their
+// message, such as write conflicts
+func workloadErrorKey(err error) string {
+	var mysqlErr *mysql.MySQLError
+	if !errors.As(err, &mysqlErr) {
+		return err.Error()
+	}
+	msg := mysqlErr.Message
+	if i := strings.IndexAny(msg, "',["); i > 0 {
+		msg = msg[:i]
+	}
+	return fmt.Sprintf("Error %d: %s", mysqlErr.Number, strings.TrimSpace(msg))
+}
+
+// printWorkloadRun prints the throughput in transactions and statements, and the latency
+// percentiles and errors of the transactions
+func printWorkloadRun(w io.Writer, preset workloadPreset, cfg workloadConfig, run benchRun, queries int64) {
+	fmt.Fprintf(w, "Workload:     %s on %d tables of %d rows\n", preset.name, cfg.tables, cfg.rows)
+	fmt.Fprintf(w, "Duration:     %s on %d threads\n", time.Duration(run.Duration*float64(time.Second)).Round(time.Millisecond), run.Concurrency)
+	fmt.Fprintf(w, "Transactions: %d succeeded, %d failed\n", run.Succeeded, run.Failed)
+	fmt.Fprintf(w, "TPS:          %.1f\n", run.QPS)
+	fmt.Fprintf(w, "QPS:          %.1f\n", float64(queries)/run.Duration)
+	if run.Succeeded > 0 {
+		l := run.Latency
+		fmt.Fprintf(w, "Latency:      avg %s, p50 %s, p95 %s, p99 %s, max %s\n",
+			microseconds(l.Avg), microseconds(l.P50), microseconds(l.P95), microseconds(l.P99), microseconds(l.Max))
+	}
+	printBenchErrors(w, run.Errors)
+}
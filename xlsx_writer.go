@@ -0,0 +1,278 @@
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"database/sql"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// excelEpoch is day zero of the serial dates used by spreadsheets
+var excelEpoch = time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+
+// xlsxNumber is a number written into a cell as the database sent it, so that
+// DECIMAL values keep all their digits instead of going through a float64
+type xlsxNumber string
+
+// sheetWriter is implemented by result writers that keep the results of each statement apart
+type sheetWriter interface {
+	NextSheet() error
+}
+
+// XLSXResultIOWriter writes results to an .xlsx workbook, one sheet per statement.
+// Rows are streamed into the sheet being written, so large results don't need to fit in memory.
+type XLSXResultIOWriter struct {
+	zip    *zip.Writer
+	sheet  *bufio.Writer // data of the sheet being written, nil before the first one
+	sheets []string
+	row    int // number of rows written to the current sheet, including the header
+}
+
+func NewXLSXResultIOWriter(writer io.Writer) *XLSXResultIOWriter {
+	return &XLSXResultIOWriter{
+		zip: zip.NewWriter(writer),
+	}
+}
+
+// NextSheet ends the current sheet, the rows written next go to a new one
+func (w *XLSXResultIOWriter) NextSheet() error {
+	if w.sheet == nil {
+		return nil
+	}
+	if err := w.endSheet(); err != nil {
+		return err
+	}
+	w.sheet = nil
+	return nil
+}
+
+// SetColumnTypes starts the sheet of a result with its header row, so that a
+// statement returning no rows still gets a sheet
+func (w *XLSXResultIOWriter) SetColumnTypes(colTypes []*sql.ColumnType) error {
+	if w.sheet != nil {
+		return nil
+	}
+	cols := make([]string, len(colTypes))
+	for i, ct := range colTypes {
+		cols[i] = ct.Name()
+	}
+	return w.startSheet(cols)
+}
+
+func (w *XLSXResultIOWriter) startSheet(colNames []string) error {
+	w.sheets = append(w.sheets, fmt.Sprintf("Sheet%d", len(w.sheets)+1))
+	f, err := w.zip.Create(fmt.Sprintf("xl/worksheets/sheet%d.xml", len(w.sheets)))
+	if err != nil {
+		return err
+	}
+	w.sheet = bufio.NewWriter(f)
+	w.row = 0
+	w.sheet.WriteString(xml.Header)
+	w.sheet.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+
+	header := make([]interface{}, len(colNames))
+	for i, col := range colNames {
+		header[i] = col
+	}
+	return w.writeRow(header)
+}
+
+func (w *XLSXResultIOWriter) endSheet() error {
+	w.sheet.WriteString(`</sheetData></worksheet>`)
+	return w.sheet.Flush()
+}
+
+func (w *XLSXResultIOWriter) Write(rows []RowResult) error {
+	for _, row := range rows {
+		if w.sheet == nil {
+			if err := w.startSheet(row.colNames); err != nil {
+				return err
+			}
+		}
+		if err := w.writeRow(row.colValues); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *XLSXResultIOWriter) writeRow(values []interface{}) error {
+	w.row++
+	fmt.Fprintf(w.sheet, `<row r="%d">`, w.row)
+	for i, val := range values {
+		ref := xlsxColumnName(i) + strconv.Itoa(w.row)
+		switch v := xlsxCellValue(val).(type) {
+		case nil:
+		case float64:
+			fmt.Fprintf(w.sheet, `<c r="%s"><v>%s</v></c>`, ref, strconv.FormatFloat(v, 'g', -1, 64))
+		case xlsxNumber:
+			fmt.Fprintf(w.sheet, `<c r="%s"><v>%s</v></c>`, ref, v)
+		case int64:
+			fmt.Fprintf(w.sheet, `<c r="%s"><v>%d</v></c>`, ref, v)
+		case time.Time:
+			days := v.Sub(excelEpoch).Hours() / 24
+			fmt.Fprintf(w.sheet, `<c r="%s" s="1"><v>%s</v></c>`, ref, strconv.FormatFloat(days, 'f', -1, 64))
+		case string:
+			fmt.Fprintf(w.sheet, `<c r="%s" t="inlineStr"><is><t xml:space="preserve">`, ref)
+			if err := xml.EscapeText(w.sheet, []byte(v)); err != nil {
+				return err
+			}
+			w.sheet.WriteString(`</t></is></c>`)
+		}
+	}
+	_, err := w.sheet.WriteString(`</row>`)
+	return err
+}
+
+// xlsxCellValue converts a value read from the database to the type of cell it is
+// written as: numbers and dates become typed cells, everything else text
+func xlsxCellValue(val interface{}) interface{} {
+	switch v := val.(type) {
+	case nil:
+		return nil
+	case int64:
+		return v
+	case uint64:
+		if v <= math.MaxInt64 {
+			return int64(v)
+		}
+		return strconv.FormatUint(v, 10)
+	case float64:
+		return v
+	case time.Time:
+		return v.UTC()
+	case []byte:
+		if !utf8.Valid(v) {
+			return displayBinary(v)
+		}
+		s := string(v)
+		// Only convert numbers that read back the same, so that e.g. "007" stays text
+		if n, err := strconv.ParseInt(s, 10, 64); err == nil && strconv.FormatInt(n, 10) == s {
+			return n
+		}
+		// An UNSIGNED BIGINT past the range of int64 would lose digits as a double
+		if _, err := strconv.ParseUint(s, 10, 64); err == nil {
+			return s
+		}
+		// Spreadsheets keep 15 significant digits, longer DECIMAL values are kept as text
+		if _, err := strconv.ParseFloat(s, 64); err == nil && isPlainDecimal(s) {
+			if significantDigits(s) > 15 {
+				return s
+			}
+			return xlsxNumber(s)
+		}
+		for _, layout := range []string{"2006-01-02 15:04:05.999999", "2006-01-02"} {
+			if t, err := time.Parse(layout, s); err == nil {
+				return t
+			}
+		}
+		return s
+	default:
+		return formatValue(v)
+	}
+}
+
+// isPlainDecimal reports whether s is written like a DECIMAL or DOUBLE value,
+// without leading zeros, hex digits or words like "Inf"
+func isPlainDecimal(s string) bool {
+	digits := strings.TrimPrefix(s, "-")
+	if len(digits) > 1 && digits[0] == '0' && digits[1] != '.' {
+		return false
+	}
+	return strings.Trim(s, "0123456789.-+eE") == ""
+}
+
+// significantDigits counts the digits of a number written in decimal notation, from
+// the first one that isn't zero
+func significantDigits(s string) int {
+	if i := strings.IndexAny(s, "eE"); i >= 0 {
+		s = s[:i]
+	}
+	s = strings.TrimLeft(s, "-+0.")
+	return len(strings.ReplaceAll(s, ".", ""))
+}
+
+// xlsxColumnName returns the letters of the i-th column, counting from 0
+func xlsxColumnName(i int) string {
+	name := ""
+	for i++; i > 0; i = (i - 1) / 26 {
+		name = string(rune('A'+(i-1)%26)) + name
+	}
+	return name
+}
+
+// Flush ends the last sheet and writes the parts of the workbook that refer to the sheets
+func (w *XLSXResultIOWriter) Flush() error {
+	if w.sheet != nil {
+		if err := w.endSheet(); err != nil {
+			return err
+		}
+		w.sheet = nil
+	}
+	if len(w.sheets) == 0 {
+		// A workbook needs at least one sheet
+		if err := w.startSheet(nil); err != nil {
+			return err
+		}
+		if err := w.endSheet(); err != nil {
+			return err
+		}
+		w.sheet = nil
+	}
+
+	var contentTypes, workbook, workbookRels strings.Builder
+	contentTypes.WriteString(xml.Header + `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+		`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+		`<Default Extension="xml" ContentType="application/xml"/>` +
+		`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+		`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>`)
+	workbook.WriteString(xml.Header + `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" ` +
+		`xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets>`)
+	workbookRels.WriteString(xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rIdStyles" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>`)
+	for i, name := range w.sheets {
+		n := i + 1
+		fmt.Fprintf(&contentTypes, `<Override PartName="/xl/worksheets/sheet%d.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`, n)
+		fmt.Fprintf(&workbook, `<sheet name="%s" sheetId="%d" r:id="rId%d"/>`, name, n, n)
+		fmt.Fprintf(&workbookRels, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet%d.xml"/>`, n, n)
+	}
+	contentTypes.WriteString(`</Types>`)
+	workbook.WriteString(`</sheets></workbook>`)
+	workbookRels.WriteString(`</Relationships>`)
+
+	parts := []struct{ name, content string }{
+		{"[Content_Types].xml", contentTypes.String()},
+		{"_rels/.rels", xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+			`</Relationships>`},
+		{"xl/workbook.xml", workbook.String()},
+		{"xl/_rels/workbook.xml.rels", workbookRels.String()},
+		// Style 1 shows the serial dates of date cells as dates
+		{"xl/styles.xml", xml.Header + `<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+			`<numFmts count="1"><numFmt numFmtId="164" formatCode="yyyy-mm-dd hh:mm:ss"/></numFmts>` +
+			`<fonts count="1"><font><sz val="11"/><name val="Calibri"/></font></fonts>` +
+			`<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>` +
+			`<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>` +
+			`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>` +
+			`<cellXfs count="2"><xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>` +
+			`<xf numFmtId="164" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/></cellXfs>` +
+			`</styleSheet>`},
+	}
+	for _, part := range parts {
+		f, err := w.zip.Create(part.name)
+		if err != nil {
+			return err
+		}
+		if _, err := io.WriteString(f, part.content); err != nil {
+			return err
+		}
+	}
+	return w.zip.Close()
+}